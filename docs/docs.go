@@ -16,51 +16,378 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/bookings": {
+        "/admin/analytics/heatmap": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the occupancy of the occurrences between the dates, both inclusive, by the day of the week and the hour in UTC they start at, ordered by day from Sunday and then by hour. Hours without occurrences are left out.\nThe range defaults to the last 30 days and covers at most 366 days.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the occupancy heatmap",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First date in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only the occurrences of the class",
+                        "name": "classId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.OccupancyHeatmapResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/analytics/occupancy": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns how many spots of the occurrences between the dates, both inclusive, were booked, in total and by class, ordered by fill rate from highest to lowest.\nThe range defaults to the last 30 days and covers at most 366 days. Results are cached for a short while, so recent bookings can take a moment to show.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the occupancy of classes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First date in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only the occurrences of the class",
+                        "name": "classId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.OccupancyResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/analytics/trend": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the occupancy of the occurrences between the dates, both inclusive, by day or by week, ordered by date. Weeks begin on Monday. Periods without occurrences are left out.\nThe range defaults to the last 30 days and covers at most 366 days.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the occupancy trend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First date in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only the occurrences of the class",
+                        "name": "classId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "day (default) or week",
+                        "name": "period",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.OccupancyTrendResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/audit": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the recorded changes matching the filters, newest first. Every create, update and delete of classes, bookings, holds, memberships, members and other records is recorded along with who made it and in which request. Secrets are redacted.\nPass the ID of the last entry as beforeId to get the next page. Entries are deleted once they are older than AUDIT_RETENTION.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Type of the changed record, e.g. booking",
+                        "name": "entity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the changed record",
+                        "name": "entityId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Who made the change, e.g. admin",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "create, update or delete",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "X-Request-Id of the request that made the change",
+                        "name": "requestId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "First date, in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date, in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only entries older than this one",
+                        "name": "beforeId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries, 100 by default and at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.AuditEntryResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/classes/import": {
             "post": {
-                "description": "Creates a new booking for the given class and member name.",
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Creates the classes of a CSV file or an iCalendar file in one transaction. Every row is checked by the same rules as POST /classes, and nothing is created if any row is invalid or on a dry run. The errors of all invalid rows are returned.\nCSV files start with a header row naming their columns: name, startDate, endDate and capacity, and optionally startTime, durationMinutes, freeCancelHoursBefore, instructorId, roomId, price and recurrence. Classes are held on every day from their start until their end date unless a recurrence rule such as 'FREQ=WEEKLY;BYDAY=MO,WE' limits the dates.\niCalendar events become classes by their SUMMARY, DTSTART, DTEND or DURATION, RRULE and X-CAPACITY. Only daily and weekly recurrence rules are supported, and a class is created for every occurrence of a rule that doesn't repeat every day.",
                 "consumes": [
-                    "application/json"
+                    "text/csv",
+                    "text/calendar"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Bookings"
+                    "Admin"
                 ],
-                "summary": "Create a new booking",
+                "summary": "Import a timetable",
                 "parameters": [
                     {
-                        "description": "Request body",
+                        "type": "string",
+                        "description": "Format of the timetable, 'csv' or 'ics'. Taken from the Content-Type header when omitted.",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only report the errors",
+                        "name": "dryRun",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Capacity of the classes of iCalendar events without an X-CAPACITY property",
+                        "name": "capacity",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Timetable",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.CreateBookingRequest"
+                            "type": "string"
                         }
                     }
                 ],
                 "responses": {
+                    "200": {
+                        "description": "Dry run of a valid timetable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ImportClassesResponse"
+                        }
+                    },
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/handler.response"
+                            "$ref": "#/definitions/handler.ImportClassesResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/handler.response"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "$ref": "#/definitions/handler.response"
                         }
                     },
-                    "409": {
-                        "description": "Conflict",
+                    "415": {
+                        "description": "Unsupported Media Type",
                         "schema": {
                             "$ref": "#/definitions/handler.response"
                         }
@@ -68,7 +395,7 @@ const docTemplate = `{
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
-                            "$ref": "#/definitions/handler.response"
+                            "$ref": "#/definitions/handler.ImportClassesResponse"
                         }
                     },
                     "500": {
@@ -80,9 +407,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/classes": {
-            "post": {
-                "description": "Creates a new class with the given name, description, start date, end date, and capacity.",
+        "/admin/classes/{id}/instructor": {
+            "put": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Makes the instructor teach the class, replacing the previous one. Rejected if any occurrence of the class overlaps another class of the instructor.",
                 "consumes": [
                     "application/json"
                 ],
@@ -90,23 +422,30 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Classes"
+                    "Instructors"
                 ],
-                "summary": "Create a new class",
+                "summary": "Assign an instructor to a class",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Class ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "description": "Request body",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.CreateClassRequest"
+                            "$ref": "#/definitions/handler.AssignInstructorRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/handler.response"
                         }
@@ -117,6 +456,24 @@ const docTemplate = `{
                             "$ref": "#/definitions/handler.response"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ScheduleConflictResponse"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
@@ -131,51 +488,3934 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "handler.CreateBookingRequest": {
-            "type": "object",
-            "required": [
-                "classId",
-                "date",
-                "memberName"
-            ],
-            "properties": {
-                "classId": {
-                    "type": "integer"
-                },
-                "date": {
-                    "type": "string"
-                },
-                "memberName": {
-                    "type": "string"
-                }
-            }
         },
-        "handler.CreateClassRequest": {
-            "type": "object",
-            "required": [
-                "capacity",
-                "endDate",
-                "name",
-                "startDate"
-            ],
-            "properties": {
-                "capacity": {
-                    "type": "integer"
-                },
+        "/admin/exports/bookings": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Streams the bookings for the dates in the range, along with their class, ordered by date. The format is chosen by the Accept header: CSV with a header row (text/csv, the default) or newline-delimited JSON (application/x-ndjson). Cancelled bookings are included.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Export bookings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First date, in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date, in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only the bookings of the class",
+                        "name": "classId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.BookingExportRow"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/exports/classes": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Streams the classes held on any date in the range, ordered by start date. The format is chosen by the Accept header like for bookings.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Export classes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First date, in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date, in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only the class",
+                        "name": "classId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.ClassExportRow"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/instructors": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Creates a new instructor with the given name.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Instructors"
+                ],
+                "summary": "Create a new instructor",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateInstructorRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/locations": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Creates a new location with the given name, time zone and address.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Locations"
+                ],
+                "summary": "Create a new location",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateLocationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/locations/{id}/rooms": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Creates a new room at the location with the given name and physical capacity.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Locations"
+                ],
+                "summary": "Create a new room",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Location ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateRoomRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/members/{name}/access-token": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Issues a new secret token to hand to the member, who sends it as 'Authorization: Bearer \u003ctoken\u003e' to manage their own bookings. The token issued before stops working.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Issue an access token for a member",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.AccessTokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/members/{name}/calendar-token": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Issues a new secret token for the member's bookings calendar and returns it along with the subscription URL to hand to the member. The token issued before stops working.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Issue a calendar token for a member",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.CalendarTokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/members/{name}/penalties/waive": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Lifts a booking block by discarding all late cancellations and no-shows of the member recorded so far.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Waive the penalties of a member",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/members/{name}/subscriptions": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Entitles the member to book classes from the start date to the end date, both inclusive, according to the plan.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Subscribe a member to a plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateSubscriptionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox/dead": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the events that could not be published after all retries, newest first. Later events of the same class are published regardless.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get dead-lettered events",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.OutboxMessageResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox/{id}/retry": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Publishes the dead-lettered event again as soon as possible, with retries starting over.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Retry a dead-lettered event",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Outbox message ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/plans": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Creates a new plan that entitles members to unlimited classes, a number of classes per week or a pack of class credits.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Create a new membership plan",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreatePlanRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhook-deliveries/{id}/replay": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Sends the delivery again as soon as possible, with retries starting over, e.g. after a receiver outage.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Replay a webhook delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns all webhooks without their secrets.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get all webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.WebhookResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Subscribes the URL to events. Deliveries are POST requests with the event as JSON body, signed with HMAC-SHA256 in the X-Webhook-Signature header as 't=\u003ctimestamp\u003e,v1=\u003chex signature of \"\u003ctimestamp\u003e.\u003cbody\u003e\"\u003e'. Failed deliveries are retried with exponential backoff.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Create a webhook",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateWebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Deletes the webhook together with its delivery log. Pending deliveries are dropped.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns the deliveries of the webhook, newest first, with a log of every attempt to send them.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the deliveries of a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.WebhookDeliveryResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings": {
+            "post": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Creates a new booking for the given class and member name. The member needs an active membership that entitles them to another class, which is used up by the booking.\nOnly the member, with their access token, and staff may book for them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Create a new booking",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateBookingRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings/drop-in": {
+            "post": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Books the class for a member paying its drop-in price instead of using a membership. The spot is held while the payment is pending and released if it is not completed in time.\nOnly the member, with their access token, and staff may book for them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Create a drop-in booking",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateBookingRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.DropInBookingResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Cancels the booking with the given ID and gives the class back to the membership that paid for it. Cancellations after the free cancellation period of the class are flagged as late and count as a penalty. Drop-in payments are refunded in full in the background unless the cancellation is late.\nOnly the member of the booking, with their access token, and staff may cancel it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Cancel a booking",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.CancelBookingResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings/{id}/check-in": {
+            "post": {
+                "security": [
+                    {
+                        "FrontDeskToken": []
+                    }
+                ],
+                "description": "Records that the member of the booking attended. Check-in opens an hour before the class starts and closes when it ends.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Attendance"
+                ],
+                "summary": "Check in a booking",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings/{id}/check-in-token": {
+            "get": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Returns a new signed check-in token for the booking. It expires when the booked class ends and can be used only once. Only the member of the booking and staff may get it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Attendance"
+                ],
+                "summary": "Get a check-in token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.CheckInTokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings/{id}/no-show": {
+            "post": {
+                "security": [
+                    {
+                        "FrontDeskToken": []
+                    }
+                ],
+                "description": "Records that the member did not attend the booked occurrence. No-shows count as a penalty.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Mark a booking as no-show",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/bookings/{id}/qr.png": {
+            "get": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Returns a new signed check-in token for the booking encoded as a QR code, for scanning at the front desk. Only the member of the booking and staff may get it.",
+                "produces": [
+                    "image/png"
+                ],
+                "tags": [
+                    "Attendance"
+                ],
+                "summary": "Get a check-in QR code",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Booking ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/checkin": {
+            "post": {
+                "security": [
+                    {
+                        "FrontDeskToken": []
+                    }
+                ],
+                "description": "Checks in the booking of a scanned check-in token. The token must be for today's occurrence of the class, and can be used only once.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Attendance"
+                ],
+                "summary": "Check in with a token",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CheckInWithTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/classes": {
+            "get": {
+                "description": "Returns all classes ordered by start date, optionally only those held at the given location.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Classes"
+                ],
+                "summary": "Get all classes",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Location ID",
+                        "name": "locationId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.ClassResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new class with the given name, start date, end date, start time, duration, capacity, booking window, cancellation policy, instructor and room.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Classes"
+                ],
+                "summary": "Create a new class",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateClassRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ScheduleConflictResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/classes/{id}": {
+            "get": {
+                "description": "Returns the class with the given ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Classes"
+                ],
+                "summary": "Get a class",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Class ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ClassResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/classes/{id}/availability/stream": {
+            "get": {
+                "description": "Streams the spots of the occurrences of the class between the dates as Server-Sent Events. Each 'availability' event holds an array of occurrences: all of them in the first event, and the ones whose spots changed in later events, which are sent as bookings, seat holds and drop-ins of the class are made, cancelled or released.\nComments are sent every STREAM_HEARTBEAT to keep the connection open. Clients that reconnect with the Last-Event-ID header are sent the occurrences that changed since that event, or all of them again if it is too old. A client may have at most MAX_STREAMS_PER_CLIENT streams open.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Classes"
+                ],
+                "summary": "Stream the availability of a class",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Class ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "First date in YYYY-MM-DD format, today by default",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date in YYYY-MM-DD format, at most 365 days after 'from', which is the default",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.OccurrenceAvailabilityResponse"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/classes/{id}/calendar.ics": {
+            "get": {
+                "description": "Returns an iCalendar feed with an event for the class that repeats on every date of the class. Calendar apps can subscribe to it to keep up with changes.",
+                "produces": [
+                    "text/calendar"
+                ],
+                "tags": [
+                    "Classes"
+                ],
+                "summary": "Get the calendar of a class",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Class ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/classes/{id}/check-in": {
+            "post": {
+                "security": [
+                    {
+                        "FrontDeskToken": []
+                    }
+                ],
+                "description": "Checks in the booking of the member for the occurrence of the class on the given date. Check-in opens an hour before the class starts and closes when it ends.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Attendance"
+                ],
+                "summary": "Check in a member",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Class ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CheckInMemberRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/classes/{id}/roster": {
+            "get": {
+                "security": [
+                    {
+                        "FrontDeskToken": []
+                    }
+                ],
+                "description": "Returns all bookings for the occurrence of the class on the given date with their attendance state, including cancelled bookings.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Attendance"
+                ],
+                "summary": "Get the roster of a class",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Class ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Date of the occurrence in YYYY-MM-DD format",
+                        "name": "date",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.BookingResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/front-desk/ws": {
+            "get": {
+                "security": [
+                    {
+                        "FrontDeskToken": []
+                    }
+                ],
+                "description": "Upgrades the connection to a WebSocket over which front desks receive bookings, cancellations, seat holds, check-ins and no-shows as they happen, and check members in. Messages are JSON objects with a 'type' field. Front desks send handler.FrontDeskCommand messages and are sent handler.FrontDeskMessage messages.\nSend 'subscribe' and 'unsubscribe' commands with topics such as class:1 or location:2 to choose which events to receive, and 'check_in' commands with a booking ID, or a class ID, member name and date, to check members in. Every command is replied to with a 'result' or 'error' message whose replyTo is the ID of the command.\nEvents of a class are sent for the class topic and for the location of its room. Connections whose client doesn't keep up with the messages are closed, after which clients reconnect and reload what they show. The token can be passed in the query parameter 'token' instead of the Authorization header, for browsers.",
+                "tags": [
+                    "Front desk"
+                ],
+                "summary": "Connect a front desk",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Front desk or admin token, instead of the Authorization header",
+                        "name": "token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/handler.FrontDeskMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/graphql": {
+            "post": {
+                "description": "Runs a GraphQL query or mutation over classes, their occurrences and remaining spots, bookings and members, e.g. '{ member(name: \"John\") { bookings { date occurrence { remaining } } } }'. The schema can be introspected.\nQueries nested more than 10 levels deep or estimated to cost more than GRAPHQL_MAX_COMPLEXITY are rejected. Every field costs 1, and the fields below a list cost as much again for each item it is expected to hold: 20 for classes and bookings, and the days in the range for occurrences.\nQueries can also be sent with GET, passing the fields of the body as query parameters, but mutations can only be sent with POST. Errors of fields have the HTTP status the REST API responds with in their extensions.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "GraphQL"
+                ],
+                "summary": "Query classes and bookings with GraphQL",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.GraphQLRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.GraphQLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.GraphQLResponse"
+                        }
+                    },
+                    "405": {
+                        "description": "Method Not Allowed",
+                        "schema": {
+                            "$ref": "#/definitions/handler.GraphQLResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/holds": {
+            "post": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Reserves a spot in the occurrence of the class on the given date while the member checks out. The hold counts towards the capacity of the class until it is confirmed or expires.\nOnly the member, with their access token, and staff may hold a spot for them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Hold a spot in a class",
+                "parameters": [
+                    {
+                        "description": "Request body",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateBookingRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.HoldResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/holds/{id}/confirm": {
+            "post": {
+                "security": [
+                    {
+                        "MemberToken": []
+                    }
+                ],
+                "description": "Turns the hold into a booking, which uses up a class of the member's membership like any other booking.\nOnly the member of the hold, with their access token, and staff may confirm it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Confirm a hold",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Hold ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handler.createdResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/instructors": {
+            "get": {
+                "description": "Returns all instructors.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Instructors"
+                ],
+                "summary": "Get all instructors",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.InstructorResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/instructors/{id}": {
+            "get": {
+                "description": "Returns the instructor with the given ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Instructors"
+                ],
+                "summary": "Get an instructor",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Instructor ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.InstructorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/instructors/{id}/schedule": {
+            "get": {
+                "description": "Returns the occurrences of all classes taught by the instructor between the given dates, both inclusive, ordered by start.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Instructors"
+                ],
+                "summary": "Get the schedule of an instructor",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Instructor ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "First date in YYYY-MM-DD format",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last date in YYYY-MM-DD format",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.OccurrenceResponse"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/locations": {
+            "get": {
+                "description": "Returns all locations.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Locations"
+                ],
+                "summary": "Get all locations",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.LocationResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/locations/{id}": {
+            "get": {
+                "description": "Returns the location with the given ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Locations"
+                ],
+                "summary": "Get a location",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Location ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.LocationResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/locations/{id}/rooms": {
+            "get": {
+                "description": "Returns all rooms at the location.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Locations"
+                ],
+                "summary": "Get the rooms of a location",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Location ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.RoomResponse"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/members/{name}/bookings.ics": {
+            "get": {
+                "description": "Returns an iCalendar feed with an event for every booking of the member from the last 90 days on. Cancelled bookings are kept as cancelled events so that subscribed calendars remove them. The token is issued by an admin and is the only thing protecting the feed, so its URL must be kept secret.",
+                "produces": [
+                    "text/calendar"
+                ],
+                "tags": [
+                    "Bookings"
+                ],
+                "summary": "Get the calendar of a member's bookings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Calendar token of the member",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/members/{name}/subscriptions": {
+            "get": {
+                "description": "Returns all subscriptions of the member, including expired ones.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Memberships"
+                ],
+                "summary": "Get the subscriptions of a member",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.SubscriptionResponse"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/payments/webhook": {
+            "post": {
+                "description": "Confirms or releases drop-in bookings as their payments succeed or fail. Events must be signed with the Stripe-Signature header. Payments that arrive after the hold was released are refunded.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payments"
+                ],
+                "summary": "Receive payment events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event signature",
+                        "name": "Stripe-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        },
+        "/plans": {
+            "get": {
+                "description": "Returns all membership plans.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Memberships"
+                ],
+                "summary": "Get all membership plans",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handler.PlanResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.response"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handler.AccessTokenResponse": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.AssignInstructorRequest": {
+            "type": "object",
+            "properties": {
+                "instructorId": {
+                    "description": "Pass 0 to unassign the current instructor",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.AuditEntryResponse": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/repo.AuditAction"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "description": "Fields that changed, with the values they had before and after the change. Before is null for creates and after for deletes, which hold every field instead.",
+                    "type": "object"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "entity": {
+                    "type": "string"
+                },
+                "entityId": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "requestId": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.BookingExportRow": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "cancelledAt": {
+                    "type": "string"
+                },
+                "checkedInAt": {
+                    "type": "string"
+                },
+                "classId": {
+                    "type": "integer"
+                },
+                "className": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "description": "Timestamps of the status transitions in RFC 3339 format. Empty if the transition didn't happen.",
+                    "type": "string"
+                },
+                "date": {
+                    "type": "string"
+                },
+                "durationMinutes": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "instructorId": {
+                    "type": "integer"
+                },
+                "memberName": {
+                    "type": "string"
+                },
+                "noShowAt": {
+                    "type": "string"
+                },
+                "paymentId": {
+                    "description": "Set for drop-ins only. Amounts are in the smallest unit of the currency.",
+                    "type": "string"
+                },
+                "refundedAmount": {
+                    "type": "integer"
+                },
+                "roomId": {
+                    "type": "integer"
+                },
+                "startTime": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/repo.BookingStatus"
+                },
+                "subscriptionId": {
+                    "description": "Zero for drop-ins",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.BookingResponse": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Only set for drop-in bookings",
+                    "type": "integer"
+                },
+                "cancelledAt": {
+                    "type": "string"
+                },
+                "checkedInAt": {
+                    "type": "string"
+                },
+                "classId": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "description": "Omitted if the booking predates them being recorded",
+                    "type": "string"
+                },
+                "date": {
+                    "type": "string"
+                },
+                "holdExpiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "memberName": {
+                    "type": "string"
+                },
+                "noShowAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/service.BookingStatus"
+                }
+            }
+        },
+        "handler.BookingWindowRequest": {
+            "type": "object",
+            "required": [
+                "opensAt"
+            ],
+            "properties": {
+                "closesMinutesBefore": {
+                    "type": "integer"
+                },
+                "opensAt": {
+                    "description": "Time of day in 24-hour HH:MM format, in the time zone of the class",
+                    "type": "string"
+                },
+                "opensDaysBefore": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.BookingWindowResponse": {
+            "type": "object",
+            "properties": {
+                "closesMinutesBefore": {
+                    "type": "integer"
+                },
+                "opensAt": {
+                    "type": "string"
+                },
+                "opensDaysBefore": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.CalendarTokenResponse": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string"
+                },
+                "url": {
+                    "description": "Subscription URL of the member's bookings calendar",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CancelBookingResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Either cancelled or late_cancelled",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/service.BookingStatus"
+                        }
+                    ]
+                }
+            }
+        },
+        "handler.CheckInMemberRequest": {
+            "type": "object",
+            "required": [
+                "date",
+                "memberName"
+            ],
+            "properties": {
+                "date": {
+                    "type": "string"
+                },
+                "memberName": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CheckInTokenResponse": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CheckInWithTokenRequest": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ClassExportRow": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer"
+                },
+                "durationMinutes": {
+                    "type": "integer"
+                },
+                "endDate": {
+                    "type": "string"
+                },
+                "freeCancelHoursBefore": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "instructorId": {
+                    "description": "Zero if no instructor is assigned",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "integer"
+                },
+                "roomId": {
+                    "description": "Zero if the class is not held in a room",
+                    "type": "integer"
+                },
+                "startDate": {
+                    "type": "string"
+                },
+                "startTime": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ClassOccupancyResponse": {
+            "type": "object",
+            "properties": {
+                "booked": {
+                    "description": "Spots taken by bookings, including attended ones and no-shows",
+                    "type": "integer"
+                },
+                "capacity": {
+                    "description": "Spots of all occurrences together",
+                    "type": "integer"
+                },
+                "checkedIn": {
+                    "type": "integer"
+                },
+                "classCapacity": {
+                    "description": "Capacity of a single occurrence",
+                    "type": "integer"
+                },
+                "classId": {
+                    "type": "integer"
+                },
+                "className": {
+                    "type": "string"
+                },
+                "fillRate": {
+                    "description": "Share of spots taken, between 0 and 1",
+                    "type": "number"
+                },
+                "fullOccurrences": {
+                    "description": "Occurrences all spots of which were taken",
+                    "type": "integer"
+                },
+                "fullRejections": {
+                    "description": "Bookings, holds and drop-ins rejected because the class was full",
+                    "type": "integer"
+                },
+                "noShowRate": {
+                    "description": "Share of attended or missed bookings that were missed, between 0 and 1",
+                    "type": "number"
+                },
+                "noShows": {
+                    "type": "integer"
+                },
+                "occurrences": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.ClassResponse": {
+            "type": "object",
+            "properties": {
+                "bookingOpensAt": {
+                    "description": "When booking opens for the next occurrence that has not started yet. Omitted if booking is always open or the class is over.",
+                    "type": "string"
+                },
+                "bookingWindow": {
+                    "$ref": "#/definitions/handler.BookingWindowResponse"
+                },
+                "capacity": {
+                    "type": "integer"
+                },
+                "durationMinutes": {
+                    "type": "integer"
+                },
+                "endDate": {
+                    "type": "string"
+                },
+                "freeCancelHoursBefore": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "instructorId": {
+                    "description": "Omitted if no instructor is assigned",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "price": {
+                    "description": "Drop-in price, 0 if drop-ins are not available",
+                    "type": "integer"
+                },
+                "roomId": {
+                    "description": "Omitted if the class is not held in a room",
+                    "type": "integer"
+                },
+                "startDate": {
+                    "type": "string"
+                },
+                "startTime": {
+                    "type": "string"
+                },
+                "timezone": {
+                    "description": "IANA time zone name the dates and times of the class are in, that of the location of its room or UTC",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateBookingRequest": {
+            "type": "object",
+            "required": [
+                "classId",
+                "date",
+                "memberName"
+            ],
+            "properties": {
+                "classId": {
+                    "type": "integer"
+                },
+                "date": {
+                    "type": "string"
+                },
+                "memberEmail": {
+                    "description": "Booking notifications are emailed to it. It is remembered for later bookings of the member if the booking succeeds, replacing the address remembered before.",
+                    "type": "string"
+                },
+                "memberName": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateClassRequest": {
+            "type": "object",
+            "required": [
+                "capacity",
+                "endDate",
+                "name",
+                "startDate"
+            ],
+            "properties": {
+                "bookingWindow": {
+                    "description": "Booking is open right away when omitted",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/handler.BookingWindowRequest"
+                        }
+                    ]
+                },
+                "capacity": {
+                    "type": "integer"
+                },
+                "durationMinutes": {
+                    "description": "Defaults to 60 minutes",
+                    "type": "integer"
+                },
+                "endDate": {
+                    "type": "string"
+                },
+                "freeCancelHoursBefore": {
+                    "description": "Cancellations later than this are flagged as late. Defaults to cancelling free of charge until the class starts.",
+                    "type": "integer"
+                },
+                "instructorId": {
+                    "description": "Optional. The instructor must not be teaching another class at the same time.",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "price": {
+                    "description": "Drop-in price in the smallest unit of the currency, e.g. cents. Drop-ins are not available when omitted.",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "roomId": {
+                    "description": "Optional. The room must not be in use by another class at the same time, and capacity must not exceed the capacity of the room. Dates and times are in the time zone of the location of the room, or UTC if omitted.",
+                    "type": "integer"
+                },
+                "startDate": {
+                    "type": "string"
+                },
+                "startTime": {
+                    "description": "Time of day in 24-hour HH:MM format, in the time zone of the class. Defaults to midnight.",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateInstructorRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateLocationRequest": {
+            "type": "object",
+            "required": [
+                "address",
+                "name",
+                "timezone"
+            ],
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "timezone": {
+                    "description": "IANA time zone name, e.g. Europe/London",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreatePlanRequest": {
+            "type": "object",
+            "required": [
+                "kind",
+                "name"
+            ],
+            "properties": {
+                "classesPerWeek": {
+                    "description": "Required for weekly plans",
+                    "type": "integer"
+                },
+                "credits": {
+                    "description": "Required for class packs",
+                    "type": "integer"
+                },
+                "kind": {
+                    "enum": [
+                        "unlimited",
+                        "weekly",
+                        "pack"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/repo.PlanKind"
+                        }
+                    ]
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateRoomRequest": {
+            "type": "object",
+            "required": [
+                "capacity",
+                "name"
+            ],
+            "properties": {
+                "capacity": {
+                    "description": "Maximum number of people the room physically fits",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateSubscriptionRequest": {
+            "type": "object",
+            "required": [
+                "endDate",
+                "planId",
+                "startDate"
+            ],
+            "properties": {
                 "endDate": {
+                    "description": "Last day of the subscription",
+                    "type": "string"
+                },
+                "planId": {
+                    "type": "integer"
+                },
+                "startDate": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateWebhookRequest": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "events": {
+                    "description": "Event types to deliver. All events are delivered when empty.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhook.EventType"
+                    }
+                },
+                "secret": {
+                    "description": "Key deliveries are signed with. A random secret is generated when empty.",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateWebhookResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Verify the X-Webhook-Signature header of deliveries with it",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.DropInBookingResponse": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "In the smallest unit of the currency, e.g. cents",
+                    "type": "integer"
+                },
+                "clientSecret": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "holdExpiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "paymentId": {
+                    "description": "Payment to be completed by the client before the hold expires",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.FrontDeskEventBody": {
+            "type": "object",
+            "properties": {
+                "bookingId": {
+                    "description": "Zero for seat holds",
+                    "type": "integer"
+                },
+                "classId": {
+                    "type": "integer"
+                },
+                "date": {
+                    "description": "In YYYY-MM-DD format",
+                    "type": "string"
+                },
+                "memberName": {
+                    "type": "string"
+                },
+                "type": {
+                    "enum": [
+                        "booked",
+                        "cancelled",
+                        "held",
+                        "released",
+                        "checked_in",
+                        "no_show"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/repo.ChangeType"
+                        }
+                    ]
+                }
+            }
+        },
+        "handler.FrontDeskMessage": {
+            "type": "object",
+            "properties": {
+                "bookingId": {
+                    "description": "Booking checked in by a check_in command",
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "$ref": "#/definitions/handler.FrontDeskEventBody"
+                },
+                "replyTo": {
+                    "description": "ID of the command replied to",
+                    "type": "string"
+                },
+                "topic": {
+                    "description": "Topic an event was sent for",
+                    "type": "string"
+                },
+                "topics": {
+                    "description": "Topics subscribed to after a subscribe or unsubscribe command",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "result",
+                        "error",
+                        "event",
+                        "ping"
+                    ]
+                }
+            }
+        },
+        "handler.GraphQLRequest": {
+            "type": "object",
+            "properties": {
+                "operationName": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "variables": {
+                    "description": "Values of the variables of the operation. In GET requests they are JSON encoded.",
+                    "type": "object",
+                    "additionalProperties": {}
+                }
+            }
+        },
+        "handler.GraphQLResponse": {
+            "type": "object",
+            "properties": {
+                "data": {},
+                "errors": {
+                    "description": "Each has a message, and the HTTP status the REST API responds with in its extensions if a field could not be resolved",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                }
+            }
+        },
+        "handler.HoldResponse": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "description": "The spot is released if the hold is not confirmed by then",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.HourOccupancyResponse": {
+            "type": "object",
+            "properties": {
+                "booked": {
+                    "description": "Spots taken by bookings, including attended ones and no-shows",
+                    "type": "integer"
+                },
+                "capacity": {
+                    "description": "Spots of all occurrences together",
+                    "type": "integer"
+                },
+                "checkedIn": {
+                    "type": "integer"
+                },
+                "fillRate": {
+                    "description": "Share of spots taken, between 0 and 1",
+                    "type": "number"
+                },
+                "fullOccurrences": {
+                    "description": "Occurrences all spots of which were taken",
+                    "type": "integer"
+                },
+                "fullRejections": {
+                    "description": "Bookings, holds and drop-ins rejected because the class was full",
+                    "type": "integer"
+                },
+                "hour": {
+                    "description": "0-23, in UTC",
+                    "type": "integer"
+                },
+                "noShowRate": {
+                    "description": "Share of attended or missed bookings that were missed, between 0 and 1",
+                    "type": "number"
+                },
+                "noShows": {
+                    "type": "integer"
+                },
+                "occurrences": {
+                    "type": "integer"
+                },
+                "weekday": {
+                    "description": "e.g. Monday",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ImportClassesResponse": {
+            "type": "object",
+            "properties": {
+                "classes": {
+                    "description": "Number of classes created, or that would be created. A row whose recurrence is not every day creates a class per occurrence.",
+                    "type": "integer"
+                },
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "errors": {
+                    "description": "Ordered by line",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.ImportRowError"
+                    }
+                },
+                "ids": {
+                    "description": "IDs of the created classes. Empty on dry runs and when nothing was created.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ImportRowError": {
+            "type": "object",
+            "properties": {
+                "line": {
+                    "description": "Line of the CSV row or of the BEGIN:VEVENT of the event",
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.InstructorResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.LocationResponse": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "timezone": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.OccupancyHeatmapResponse": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "hours": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.HourOccupancyResponse"
+                    }
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.OccupancyResponse": {
+            "type": "object",
+            "properties": {
+                "classes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.ClassOccupancyResponse"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "totals": {
+                    "$ref": "#/definitions/handler.OccupancyStatsResponse"
+                }
+            }
+        },
+        "handler.OccupancyStatsResponse": {
+            "type": "object",
+            "properties": {
+                "booked": {
+                    "description": "Spots taken by bookings, including attended ones and no-shows",
+                    "type": "integer"
+                },
+                "capacity": {
+                    "description": "Spots of all occurrences together",
+                    "type": "integer"
+                },
+                "checkedIn": {
+                    "type": "integer"
+                },
+                "fillRate": {
+                    "description": "Share of spots taken, between 0 and 1",
+                    "type": "number"
+                },
+                "fullOccurrences": {
+                    "description": "Occurrences all spots of which were taken",
+                    "type": "integer"
+                },
+                "fullRejections": {
+                    "description": "Bookings, holds and drop-ins rejected because the class was full",
+                    "type": "integer"
+                },
+                "noShowRate": {
+                    "description": "Share of attended or missed bookings that were missed, between 0 and 1",
+                    "type": "number"
+                },
+                "noShows": {
+                    "type": "integer"
+                },
+                "occurrences": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.OccupancyTrendResponse": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "period": {
+                    "$ref": "#/definitions/repo.Period"
+                },
+                "periods": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.PeriodOccupancyResponse"
+                    }
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.OccurrenceAvailabilityResponse": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer"
+                },
+                "date": {
+                    "description": "In YYYY-MM-DD format",
+                    "type": "string"
+                },
+                "remaining": {
+                    "type": "integer"
+                },
+                "taken": {
+                    "description": "Spots taken by bookings and seat holds",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.OccurrenceResponse": {
+            "type": "object",
+            "properties": {
+                "classId": {
+                    "type": "integer"
+                },
+                "className": {
+                    "type": "string"
+                },
+                "end": {
+                    "type": "string"
+                },
+                "start": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.OutboxMessageResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "classId": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "data": {
+                    "type": "object"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastError": {
+                    "type": "string"
+                },
+                "type": {
+                    "$ref": "#/definitions/repo.EventType"
+                }
+            }
+        },
+        "handler.PeriodOccupancyResponse": {
+            "type": "object",
+            "properties": {
+                "booked": {
+                    "description": "Spots taken by bookings, including attended ones and no-shows",
+                    "type": "integer"
+                },
+                "capacity": {
+                    "description": "Spots of all occurrences together",
+                    "type": "integer"
+                },
+                "checkedIn": {
+                    "type": "integer"
+                },
+                "fillRate": {
+                    "description": "Share of spots taken, between 0 and 1",
+                    "type": "number"
+                },
+                "fullOccurrences": {
+                    "description": "Occurrences all spots of which were taken",
+                    "type": "integer"
+                },
+                "fullRejections": {
+                    "description": "Bookings, holds and drop-ins rejected because the class was full",
+                    "type": "integer"
+                },
+                "noShowRate": {
+                    "description": "Share of attended or missed bookings that were missed, between 0 and 1",
+                    "type": "number"
+                },
+                "noShows": {
+                    "type": "integer"
+                },
+                "occurrences": {
+                    "type": "integer"
+                },
+                "start": {
+                    "description": "First date of the period, in YYYY-MM-DD format",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.PlanResponse": {
+            "type": "object",
+            "properties": {
+                "classesPerWeek": {
+                    "type": "integer"
+                },
+                "credits": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "$ref": "#/definitions/repo.PlanKind"
+                },
+                "name": {
                     "type": "string"
+                }
+            }
+        },
+        "handler.RoomResponse": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "locationId": {
+                    "type": "integer"
                 },
                 "name": {
                     "type": "string"
+                }
+            }
+        },
+        "handler.ScheduleConflictResponse": {
+            "type": "object",
+            "properties": {
+                "conflicts": {
+                    "description": "Occurrences of other classes with the same instructor or room that overlap the class",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.OccurrenceResponse"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.SubscriptionResponse": {
+            "type": "object",
+            "properties": {
+                "creditsRemaining": {
+                    "description": "Only set for class packs",
+                    "type": "integer"
+                },
+                "endDate": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "memberName": {
+                    "type": "string"
+                },
+                "planId": {
+                    "type": "integer"
                 },
                 "startDate": {
                     "type": "string"
                 }
             }
         },
+        "handler.WebhookAttemptResponse": {
+            "type": "object",
+            "properties": {
+                "attemptedAt": {
+                    "type": "string"
+                },
+                "durationMs": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "statusCode": {
+                    "description": "Omitted if no response was received",
+                    "type": "integer"
+                }
+            }
+        },
+        "handler.WebhookDeliveryResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.WebhookAttemptResponse"
+                    }
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "nextAttemptAt": {
+                    "description": "Omitted once the delivery is no longer pending",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "One of pending, delivered or failed",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/repo.WebhookDeliveryStatus"
+                        }
+                    ]
+                }
+            }
+        },
+        "handler.WebhookResponse": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhook.EventType"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.createdResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
         "handler.response": {
             "type": "object",
             "properties": {
@@ -183,6 +4423,181 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "repo.AuditAction": {
+            "type": "string",
+            "enum": [
+                "create",
+                "update",
+                "delete"
+            ],
+            "x-enum-varnames": [
+                "AuditActionCreate",
+                "AuditActionUpdate",
+                "AuditActionDelete"
+            ]
+        },
+        "repo.BookingStatus": {
+            "type": "string",
+            "enum": [
+                "booked",
+                "cancelled",
+                "late_cancelled",
+                "no_show",
+                "checked_in",
+                "pending_payment",
+                "payment_failed"
+            ],
+            "x-enum-varnames": [
+                "BookingStatusBooked",
+                "BookingStatusCancelled",
+                "BookingStatusLateCancelled",
+                "BookingStatusNoShow",
+                "BookingStatusCheckedIn",
+                "BookingStatusPendingPayment",
+                "BookingStatusPaymentFailed"
+            ]
+        },
+        "repo.ChangeType": {
+            "type": "string",
+            "enum": [
+                "booked",
+                "cancelled",
+                "held",
+                "released",
+                "checked_in",
+                "no_show"
+            ],
+            "x-enum-varnames": [
+                "ChangeBooked",
+                "ChangeCancelled",
+                "ChangeHeld",
+                "ChangeReleased",
+                "ChangeCheckedIn",
+                "ChangeNoShow"
+            ]
+        },
+        "repo.EventType": {
+            "type": "string",
+            "enum": [
+                "booking.created",
+                "booking.cancelled",
+                "class.created",
+                "class.full",
+                "waitlist.promoted",
+                "class.cancelled"
+            ],
+            "x-enum-varnames": [
+                "EventBookingCreated",
+                "EventBookingCancelled",
+                "EventClassCreated",
+                "EventClassFull",
+                "EventWaitlistPromoted",
+                "EventClassCancelled"
+            ]
+        },
+        "repo.Period": {
+            "type": "string",
+            "enum": [
+                "day",
+                "week"
+            ],
+            "x-enum-varnames": [
+                "PeriodDay",
+                "PeriodWeek"
+            ]
+        },
+        "repo.PlanKind": {
+            "type": "string",
+            "enum": [
+                "unlimited",
+                "weekly",
+                "pack"
+            ],
+            "x-enum-varnames": [
+                "PlanKindUnlimited",
+                "PlanKindWeekly",
+                "PlanKindPack"
+            ]
+        },
+        "repo.WebhookDeliveryStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "delivered",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "WebhookDeliveryStatusPending",
+                "WebhookDeliveryStatusDelivered",
+                "WebhookDeliveryStatusFailed"
+            ]
+        },
+        "service.BookingStatus": {
+            "type": "string",
+            "enum": [
+                "booked",
+                "cancelled",
+                "late_cancelled",
+                "no_show",
+                "checked_in",
+                "pending_payment",
+                "payment_failed"
+            ],
+            "x-enum-varnames": [
+                "BookingStatusBooked",
+                "BookingStatusCancelled",
+                "BookingStatusLateCancelled",
+                "BookingStatusNoShow",
+                "BookingStatusCheckedIn",
+                "BookingStatusPendingPayment",
+                "BookingStatusPaymentFailed"
+            ]
+        },
+        "webhook.EventType": {
+            "type": "string",
+            "enum": [
+                "booking.created",
+                "booking.cancelled",
+                "class.created",
+                "class.full",
+                "waitlist.promoted",
+                "class.cancelled",
+                "booking.created",
+                "booking.cancelled",
+                "class.created",
+                "class.full",
+                "waitlist.promoted",
+                "class.cancelled"
+            ],
+            "x-enum-varnames": [
+                "EventBookingCreated",
+                "EventBookingCancelled",
+                "EventClassCreated",
+                "EventClassFull",
+                "EventWaitlistPromoted",
+                "EventClassCancelled"
+            ]
+        }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "description": "Bearer token configured through ADMIN_TOKEN, e.g. 'Bearer \u003ctoken\u003e'",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
+        "FrontDeskToken": {
+            "description": "Bearer token configured through FRONT_DESK_TOKEN or ADMIN_TOKEN, e.g. 'Bearer \u003ctoken\u003e'",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
+        "MemberToken": {
+            "description": "Bearer token issued to a member by an admin, e.g. 'Bearer \u003ctoken\u003e'. The admin and front desk tokens are accepted as well.",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -0,0 +1,19 @@
+// Package backoff computes how long to wait before retrying work that failed, like jobs, webhook deliveries, outbox messages and emails.
+package backoff
+
+import "time"
+
+// Exponential delays the first retry by Base, doubling the delay after every further failed attempt up to Max.
+type Exponential struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay returns how long to wait before retrying work that has failed 'attempts' times.
+func (e Exponential) Delay(attempts uint) time.Duration {
+	delay := e.Base
+	for i := uint(1); i < attempts && delay < e.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, e.Max)
+}
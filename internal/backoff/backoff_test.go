@@ -0,0 +1,30 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/backoff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponential(t *testing.T) {
+	tests := []struct {
+		backoff  backoff.Exponential
+		attempts uint
+		want     time.Duration
+	}{
+		{backoff: backoff.Exponential{Base: time.Second, Max: time.Minute}, attempts: 1, want: time.Second},
+		{backoff: backoff.Exponential{Base: time.Second, Max: time.Minute}, attempts: 2, want: 2 * time.Second},
+		{backoff: backoff.Exponential{Base: time.Second, Max: time.Minute}, attempts: 3, want: 4 * time.Second},
+		{backoff: backoff.Exponential{Base: time.Second, Max: time.Minute}, attempts: 6, want: 32 * time.Second},
+		{backoff: backoff.Exponential{Base: time.Second, Max: time.Minute}, attempts: 7, want: time.Minute},
+		{backoff: backoff.Exponential{Base: time.Second, Max: time.Minute}, attempts: 100, want: time.Minute},
+		{backoff: backoff.Exponential{Base: time.Second, Max: 10 * time.Second}, attempts: 4, want: 8 * time.Second},
+		{backoff: backoff.Exponential{Base: time.Second, Max: 10 * time.Second}, attempts: 5, want: 10 * time.Second},
+		{backoff: backoff.Exponential{Base: 0, Max: time.Hour}, attempts: 3, want: 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.backoff.Delay(tt.attempts), "After %d attempts with %+v", tt.attempts, tt.backoff)
+	}
+}
@@ -0,0 +1,105 @@
+// Package checkin issues and verifies the signed tokens that members show at the front desk to check in, usually as a QR code.
+package checkin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var (
+	InvalidTokenError = errors.New("Check-in token is invalid")
+	TokenExpiredError = errors.New("Check-in token has expired")
+)
+
+// Claims identify the occurrence a token checks in to. Nonce is unique per token so that every token can be redeemed only once.
+type Claims struct {
+	BookingID uint64
+	ClassID   uint64
+	// UNIX timestamp of the date of the occurrence
+	Date int64
+	// UNIX timestamp after which the token is rejected
+	ExpiresAt int64
+	Nonce     string
+}
+
+// Signer signs tokens with HMAC-SHA256. A token is the base64url encoded claims and signature separated by a dot.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) == 0 {
+		return nil, errors.New("Signing key must not be empty")
+	}
+	return &Signer{key: key}, nil
+}
+
+// RandomKey returns a key for when none is configured. Tokens signed with it become invalid when the process restarts.
+func RandomKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("Failed to generate signing key: %w", err)
+	}
+	return key, nil
+}
+
+func (s *Signer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Issue returns a signed token for 'claims'. A random nonce is generated if claims.Nonce is empty.
+func (s *Signer) Issue(claims Claims) (string, error) {
+	if claims.Nonce == "" {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return "", fmt.Errorf("Failed to generate nonce: %w", err)
+		}
+		claims.Nonce = hex.EncodeToString(nonce)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d.%d.%d.%s", claims.BookingID, claims.ClassID, claims.Date, claims.ExpiresAt, claims.Nonce))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload)), nil
+}
+
+// Verify checks the signature and expiry of 'token' and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, InvalidTokenError
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.sign(payload)) {
+		return nil, InvalidTokenError
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, InvalidTokenError
+	}
+	var claims Claims
+	if _, err = fmt.Sscanf(string(raw), "%d.%d.%d.%d.%s", &claims.BookingID, &claims.ClassID, &claims.Date, &claims.ExpiresAt, &claims.Nonce); err != nil {
+		return nil, InvalidTokenError
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, TokenExpiredError
+	}
+	return &claims, nil
+}
+
+// QRCode renders 'token' as a square PNG image 'size' pixels wide.
+func QRCode(token string, size int) ([]byte, error) {
+	png, err := qrcode.Encode(token, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode QR code: %w", err)
+	}
+	return png, nil
+}
@@ -0,0 +1,69 @@
+package checkin_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/checkin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	s, err := checkin.NewSigner([]byte("secret"))
+	assert.Nil(t, err)
+	other, err := checkin.NewSigner([]byte("other-secret"))
+	assert.Nil(t, err)
+
+	now := time.Now()
+	claims := checkin.Claims{BookingID: 1, ClassID: 2, Date: 1700000000, ExpiresAt: now.Add(time.Hour).Unix()}
+	token, err := s.Issue(claims)
+	assert.Nil(t, err)
+	otherToken, err := other.Issue(claims)
+	assert.Nil(t, err)
+
+	t.Run("Nonce", func(t *testing.T) {
+		again, err := s.Issue(claims)
+		assert.Nil(t, err)
+		assert.NotEqual(t, token, again)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			token string
+			now   time.Time
+			err   error
+		}{
+			{name: "Valid token", token: token, now: now},
+			{name: "Expired", token: token, now: now.Add(time.Hour), err: checkin.TokenExpiredError},
+			{name: "Signed with another key", token: otherToken, now: now, err: checkin.InvalidTokenError},
+			{name: "Tampered", token: "x" + token, now: now, err: checkin.InvalidTokenError},
+			{name: "Malformed", token: "token", now: now, err: checkin.InvalidTokenError},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := s.Verify(tt.token, tt.now)
+				assert.Equal(t, tt.err, err)
+				if tt.err == nil {
+					assert.Equal(t, claims.BookingID, got.BookingID)
+					assert.Equal(t, claims.ClassID, got.ClassID)
+					assert.Equal(t, claims.Date, got.Date)
+					assert.Equal(t, claims.ExpiresAt, got.ExpiresAt)
+					assert.NotEmpty(t, got.Nonce)
+				}
+			})
+		}
+	})
+
+	t.Run("QRCode", func(t *testing.T) {
+		png, err := checkin.QRCode(token, 256)
+		assert.Nil(t, err)
+		assert.True(t, bytes.HasPrefix(png, []byte("\x89PNG")))
+	})
+
+	t.Run("Empty key", func(t *testing.T) {
+		_, err := checkin.NewSigner(nil)
+		assert.NotNil(t, err)
+	})
+}
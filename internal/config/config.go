@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -14,6 +16,55 @@ type Config struct {
 	Port            string        `validate:"required,number"`
 	DatabaseURL     string        `validate:"required,filepath"`
 	ShutdownTimeout time.Duration `validate:"required"`
+	// Directory the database is continuously replicated to. Replication is disabled when empty.
+	ReplicaDir string
+	// Bearer token for the /admin endpoints. They reject every request when empty.
+	AdminToken string
+	// Bearer token for the front desk WebSocket, which also accepts AdminToken. Only admins can connect when empty.
+	FrontDeskToken string
+	// Members are blocked from booking once they have PenaltyLimit late cancellations and no-shows within PenaltyWindow. A limit of 0 disables blocking.
+	PenaltyLimit  uint
+	PenaltyWindow time.Duration
+	// Key for signing check-in tokens. A random key is used when empty, which invalidates issued tokens on restart.
+	CheckInSecret string
+	// How long a seat hold reserves its spot
+	HoldTTL time.Duration
+	// Members are reminded of their bookings this long before the class starts. Reminders are disabled when zero.
+	ReminderLead time.Duration
+	// How long a drop-in booking holds its spot while the payment is pending
+	PaymentHold time.Duration
+	// How long analytics are cached. They are computed on every request when zero.
+	AnalyticsCacheTTL time.Duration
+	// How long audit log entries are kept. They are kept forever when zero.
+	AuditRetention time.Duration
+	// Comments are sent on event streams this often to keep them open
+	StreamHeartbeat time.Duration `validate:"gt=0"`
+	// Event streams a client may have open at once. There is no limit when zero.
+	MaxStreamsPerClient uint
+	// CIDRs of the reverse proxies whose X-Forwarded-For header tells the address of the client. The address of the connection is used when empty.
+	TrustedProxies []string `validate:"dive,cidr"`
+	// GraphQL queries estimated to cost more than this are rejected. Every field costs 1, and the fields below a list cost as much again for each item it is expected to hold.
+	GraphQLMaxComplexity uint `validate:"gt=0"`
+	// ISO currency code class prices are in
+	Currency string
+	// Stripe is used for payments when set, otherwise payments are faked in-process
+	StripeAPIKey string
+	StripeURL    string
+	// Secret payment webhook events are signed with. Webhooks are rejected when empty.
+	PaymentWebhookSecret string
+	// Where booking and class events are published: any of webhook, email, stdout and nats
+	OutboxSinks []string `validate:"dive,oneof=webhook email stdout nats"`
+	// NATS server events are published to. An embedded server is started when empty.
+	NatsURL string
+	// Events are published on the subject '<NatsSubjectPrefix>.<event type>'
+	NatsSubjectPrefix string
+	// How emails are sent: through the SMTP server at SMTPAddr, written to files in EmailDir, or logged
+	EmailSender  string `validate:"oneof=smtp file log"`
+	EmailFrom    string `validate:"required"`
+	EmailDir     string `validate:"required_if=EmailSender file"`
+	SMTPAddr     string `validate:"required_if=EmailSender smtp,omitempty,hostname_port"`
+	SMTPUsername string
+	SMTPPassword string
 }
 
 func Load() (*Config, error) {
@@ -22,12 +73,145 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("Failed to parse SHUTDOWN_TIMEOUT: %w", err)
 	}
 
+	penaltyLimit := uint64(3)
+	if v := os.Getenv("PENALTY_LIMIT"); v != "" {
+		if penaltyLimit, err = strconv.ParseUint(v, 10, 0); err != nil {
+			return nil, fmt.Errorf("Failed to parse PENALTY_LIMIT: %w", err)
+		}
+	}
+
+	penaltyWindow := time.Hour * 24 * 30
+	if v := os.Getenv("PENALTY_WINDOW"); v != "" {
+		if penaltyWindow, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse PENALTY_WINDOW: %w", err)
+		}
+	}
+
+	holdTTL := 10 * time.Minute
+	if v := os.Getenv("HOLD_TTL"); v != "" {
+		if holdTTL, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse HOLD_TTL: %w", err)
+		}
+	}
+
+	reminderLead := 2 * time.Hour
+	if v := os.Getenv("REMINDER_LEAD"); v != "" {
+		if reminderLead, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse REMINDER_LEAD: %w", err)
+		}
+	}
+
+	paymentHold := 15 * time.Minute
+	if v := os.Getenv("PAYMENT_HOLD"); v != "" {
+		if paymentHold, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse PAYMENT_HOLD: %w", err)
+		}
+	}
+
+	analyticsCacheTTL := time.Minute
+	if v := os.Getenv("ANALYTICS_CACHE_TTL"); v != "" {
+		if analyticsCacheTTL, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse ANALYTICS_CACHE_TTL: %w", err)
+		}
+	}
+
+	auditRetention := 365 * 24 * time.Hour
+	if v := os.Getenv("AUDIT_RETENTION"); v != "" {
+		if auditRetention, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse AUDIT_RETENTION: %w", err)
+		}
+	}
+
+	streamHeartbeat := 15 * time.Second
+	if v := os.Getenv("STREAM_HEARTBEAT"); v != "" {
+		if streamHeartbeat, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse STREAM_HEARTBEAT: %w", err)
+		}
+	}
+
+	maxStreamsPerClient := uint64(5)
+	if v := os.Getenv("MAX_STREAMS_PER_CLIENT"); v != "" {
+		if maxStreamsPerClient, err = strconv.ParseUint(v, 10, 0); err != nil {
+			return nil, fmt.Errorf("Failed to parse MAX_STREAMS_PER_CLIENT: %w", err)
+		}
+	}
+
+	graphQLMaxComplexity := uint64(5000)
+	if v := os.Getenv("GRAPHQL_MAX_COMPLEXITY"); v != "" {
+		if graphQLMaxComplexity, err = strconv.ParseUint(v, 10, 0); err != nil {
+			return nil, fmt.Errorf("Failed to parse GRAPHQL_MAX_COMPLEXITY: %w", err)
+		}
+	}
+
+	var trustedProxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies = strings.Split(v, ",")
+	}
+
+	currency := "usd"
+	if v := os.Getenv("CURRENCY"); v != "" {
+		currency = v
+	}
+
+	outboxSinks := []string{"webhook", "email"}
+	if v := os.Getenv("OUTBOX_SINKS"); v != "" {
+		outboxSinks = strings.Split(v, ",")
+	}
+
+	natsSubjectPrefix := "abc"
+	if v := os.Getenv("NATS_SUBJECT_PREFIX"); v != "" {
+		natsSubjectPrefix = v
+	}
+
+	emailSender := "log"
+	if v := os.Getenv("EMAIL_SENDER"); v != "" {
+		emailSender = v
+	}
+
+	emailFrom := "no-reply@localhost"
+	if v := os.Getenv("EMAIL_FROM"); v != "" {
+		emailFrom = v
+	}
+
+	emailDir := ".local/mail"
+	if v := os.Getenv("EMAIL_DIR"); v != "" {
+		emailDir = v
+	}
+
 	cfg := Config{
-		Env:             os.Getenv("ENV"),
-		Host:            os.Getenv("HOST"),
-		Port:            os.Getenv("PORT"),
-		DatabaseURL:     os.Getenv("DATABASE_URL"),
-		ShutdownTimeout: shutdownTimeout,
+		Env:                  os.Getenv("ENV"),
+		Host:                 os.Getenv("HOST"),
+		Port:                 os.Getenv("PORT"),
+		DatabaseURL:          os.Getenv("DATABASE_URL"),
+		ShutdownTimeout:      shutdownTimeout,
+		ReplicaDir:           os.Getenv("REPLICA_DIR"),
+		AdminToken:           os.Getenv("ADMIN_TOKEN"),
+		FrontDeskToken:       os.Getenv("FRONT_DESK_TOKEN"),
+		PenaltyLimit:         uint(penaltyLimit),
+		PenaltyWindow:        penaltyWindow,
+		CheckInSecret:        os.Getenv("CHECKIN_SECRET"),
+		HoldTTL:              holdTTL,
+		ReminderLead:         reminderLead,
+		PaymentHold:          paymentHold,
+		AnalyticsCacheTTL:    analyticsCacheTTL,
+		AuditRetention:       auditRetention,
+		StreamHeartbeat:      streamHeartbeat,
+		MaxStreamsPerClient:  uint(maxStreamsPerClient),
+		TrustedProxies:       trustedProxies,
+		GraphQLMaxComplexity: uint(graphQLMaxComplexity),
+		Currency:             currency,
+		StripeAPIKey:         os.Getenv("STRIPE_API_KEY"),
+		StripeURL:            os.Getenv("STRIPE_URL"),
+		PaymentWebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		OutboxSinks:          outboxSinks,
+		NatsURL:              os.Getenv("NATS_URL"),
+		NatsSubjectPrefix:    natsSubjectPrefix,
+		EmailSender:          emailSender,
+		EmailFrom:            emailFrom,
+		EmailDir:             emailDir,
+		SMTPAddr:             os.Getenv("SMTP_ADDR"),
+		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
 	}
 
 	if err = validator.New().Struct(cfg); err != nil {
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"runtime"
 	"strings"
 
 	_ "modernc.org/sqlite"
@@ -14,6 +16,16 @@ const (
 	DirName = ".local"
 )
 
+// SQLite optimizations. These are passed through the DSN so that every connection in the pool gets them, not just the first one.
+var pragmas = [...]string{
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+	"locking_mode(NORMAL)",
+	"busy_timeout(10000)",
+	"cache_size(10000)",
+	"foreign_keys(ON)",
+}
+
 func createDirIfNotExists(path string) error {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -30,46 +42,78 @@ func createDirIfNotExists(path string) error {
 	return nil
 }
 
-// 'dbName' is the name of the database file. Pass :memory: for in-memory database.
-func NewSQLite(dbName string) (*sql.DB, error) {
-	if dbName != ":memory:" {
-		if err := createDirIfNotExists(DirName); err != nil {
-			return nil, err
-		}
-		dbName = strings.Replace(dbName, ".db", "", 1)
-		dbName = fmt.Sprintf("%s/%s.db", DirName, dbName)
+// Path returns the location of the database file for 'dbName'. :memory: is returned as is.
+func Path(dbName string) string {
+	if dbName == ":memory:" {
+		return dbName
+	}
+	dbName = strings.Replace(dbName, ".db", "", 1)
+	return fmt.Sprintf("%s/%s.db", DirName, dbName)
+}
+
+// DB separates reads from writes. SQLite allows only one writer at a time, so writes go through a single connection that takes the write lock as soon as a transaction begins, instead of failing with SQLITE_BUSY when a deferred transaction is upgraded. Reads go through a pool of read-only connections and never wait on writers.
+type DB struct {
+	Writer *sql.DB
+	Reader *sql.DB
+}
+
+func (db *DB) Close() error {
+	if db.Reader == db.Writer {
+		return db.Writer.Close()
+	}
+	return errors.Join(db.Reader.Close(), db.Writer.Close())
+}
+
+func open(dsn string, pragmas []string, params url.Values) (*sql.DB, error) {
+	q := url.Values{}
+	for _, pragma := range pragmas {
+		q.Add("_pragma", pragma)
+	}
+	for key, values := range params {
+		q[key] = values
 	}
 
-	db, err := sql.Open("sqlite", dbName)
+	db, err := sql.Open("sqlite", dsn+"?"+q.Encode())
 	if err != nil {
 		return nil, fmt.Errorf("Failed to open sqlite database: %w", err)
 	}
 
-	// SQLite optimizations
-	stmts := [...]string{
-		"PRAGMA journal_mode = WAL;",
-		"PRAGMA synchronous = NORMAL;",
-		"PRAGMA locking_mode = NORMAL;",
-		"PRAGMA busy_timeout = 10000;",
-		"PRAGMA cache_size = 10000;",
-		"PRAGMA foreign_keys = ON;",
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to ping SQLite database: %w", err)
 	}
 
-	var errList []error
+	return db, nil
+}
 
-	for _, stmt := range stmts {
-		if _, err := db.Exec(stmt); err != nil {
-			errList = append(errList, err)
+// 'dbName' is the name of the database file. Pass :memory: for in-memory database, in which case reads and writes share a single connection. 'extraPragmas' are applied to every connection after the default ones, in the form "name(value)".
+func NewSQLite(dbName string, extraPragmas ...string) (*DB, error) {
+	if dbName != ":memory:" {
+		if err := createDirIfNotExists(DirName); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(errList) > 0 {
-		return nil, errors.Join(errList...)
+	writerPragmas := append(pragmas[:], extraPragmas...)
+	writer, err := open(Path(dbName), writerPragmas, url.Values{"_txlock": {"immediate"}})
+	if err != nil {
+		return nil, err
 	}
+	writer.SetMaxOpenConns(1)
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("Failed to ping SQLite database: %w", err)
+	// Every in-memory connection is a database of its own.
+	if dbName == ":memory:" {
+		return &DB{Writer: writer, Reader: writer}, nil
 	}
 
-	return db, nil
+	// The writer has already switched the database to WAL, which is persistent.
+	readerPragmas := append(writerPragmas, "query_only(1)")
+	reader, err := open(Path(dbName), readerPragmas, nil)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader.SetMaxOpenConns(max(4, runtime.NumCPU()))
+
+	return &DB{Writer: writer, Reader: reader}, nil
 }
@@ -0,0 +1,73 @@
+// Package dataloader batches the lookups made while resolving a GraphQL query, so that a list of N items costs one query instead of N. Lookups are queued until the first of them is needed, which the executor only asks for once it has resolved every field at the same depth.
+package dataloader
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchFunc looks up all the keys at once. Keys missing from the returned map resolve to the zero value.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader caches what it has loaded, so it is meant to live for a single request. The zero value is not usable, loaders are created with New.
+type Loader[K comparable, V any] struct {
+	batch BatchFunc[K, V]
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]*result[V]
+}
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// New returns a loader that looks up keys with 'batch'.
+func New[K comparable, V any](batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{batch: batch, results: map[K]*result[V]{}}
+}
+
+// Load queues 'key' and returns a function that waits for its value. The first call to any such function looks up every key queued so far in one batch.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	res, ok := l.results[key]
+	if !ok {
+		res = &result[V]{done: make(chan struct{})}
+		l.results[key] = res
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		select {
+		case <-res.done:
+		default:
+			l.dispatch(ctx)
+			<-res.done
+		}
+		return res.value, res.err
+	}
+}
+
+// dispatch looks up the pending keys, unless another caller already took them.
+func (l *Loader[K, V]) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	batch := make([]*result[V], 0, len(keys))
+	for _, key := range keys {
+		batch = append(batch, l.results[key])
+	}
+	l.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	values, err := l.batch(ctx, keys)
+	for i, key := range keys {
+		batch[i].value, batch[i].err = values[key], err
+		close(batch[i].done)
+	}
+}
@@ -0,0 +1,88 @@
+package dataloader_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rohitxdev/abc-task/internal/dataloader"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+
+	// squares records the batches it is called with
+	squares := func(batches *[][]int) dataloader.BatchFunc[int, int] {
+		return func(_ context.Context, keys []int) (map[int]int, error) {
+			*batches = append(*batches, keys)
+			values := map[int]int{}
+			for _, key := range keys {
+				if key >= 0 {
+					values[key] = key * key
+				}
+			}
+			return values, nil
+		}
+	}
+
+	t.Run("Batch", func(t *testing.T) {
+		var batches [][]int
+		l := dataloader.New(squares(&batches))
+		thunks := []func() (int, error){l.Load(ctx, 1), l.Load(ctx, 2), l.Load(ctx, 2), l.Load(ctx, -3)}
+		assert.Empty(t, batches)
+		for i, want := range []int{1, 4, 4, 0} {
+			got, err := thunks[i]()
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+		assert.Equal(t, [][]int{{1, 2, -3}}, batches)
+
+		// Loaded keys are cached and new ones make a new batch
+		thunks = []func() (int, error){l.Load(ctx, 2), l.Load(ctx, 4)}
+		for i, want := range []int{4, 16} {
+			got, err := thunks[i]()
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+		assert.Equal(t, [][]int{{1, 2, -3}, {4}}, batches)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		l := dataloader.New(func(context.Context, []int) (map[int]int, error) {
+			return nil, errors.New("Lookup failed")
+		})
+		thunks := []func() (int, error){l.Load(ctx, 1), l.Load(ctx, 2)}
+		for _, thunk := range thunks {
+			_, err := thunk()
+			assert.EqualError(t, err, "Lookup failed")
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := 0
+		l := dataloader.New(func(_ context.Context, keys []int) (map[int]int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls += len(keys)
+			return map[int]int{1: 1, 2: 2}, nil
+		})
+		thunks := []func() (int, error){l.Load(ctx, 1), l.Load(ctx, 2)}
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j, thunk := range thunks {
+					got, err := thunk()
+					assert.NoError(t, err)
+					assert.Equal(t, j+1, got)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 2, calls)
+	})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// adminAuth only lets through requests with the header 'Authorization: Bearer <token>'. Every request is rejected if 'token' is empty.
+func adminAuth(token string) echo.MiddlewareFunc {
+	return middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		return matchesToken(key, token), nil
+	})
+}
+
+type MemberRequest struct {
+	Name string `param:"name" validate:"required"`
+}
+
+// @Summary Waive the penalties of a member
+// @Description Lifts a booking block by discarding all late cancellations and no-shows of the member recorded so far.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Member name"
+// @Success 200 {object} response
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/members/{name}/penalties/waive [post]
+func WaivePenalties(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(MemberRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if err := svc.Repo.WaivePenalties(c.Request().Context(), req.Name); err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		return c.JSON(http.StatusOK, response{Message: "Penalties waived successfully"})
+	}
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Analytics cover at most this many days, as every occurrence in the range is computed
+const maxAnalyticsDays = 366
+
+type AnalyticsRequest struct {
+	// First date, in YYYY-MM-DD format. 29 days before 'to' when empty.
+	From string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	// Last date, in YYYY-MM-DD format. Today when empty.
+	To      string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+	ClassID uint64 `query:"classId"`
+}
+
+// filter returns the range of the request, defaulting to the last 30 days, or a message for the client if the range is invalid.
+func (req *AnalyticsRequest) filter() (repo.AnalyticsFilter, string) {
+	// The dates have been validated
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if req.To != "" {
+		to, _ = time.Parse("2006-01-02", req.To)
+	}
+	from := to.AddDate(0, 0, -29)
+	if req.From != "" {
+		from, _ = time.Parse("2006-01-02", req.From)
+	}
+	if from.After(to) {
+		return repo.AnalyticsFilter{}, "To cannot be before from"
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return repo.AnalyticsFilter{}, "Analytics cover at most 366 days"
+	}
+	return repo.AnalyticsFilter{From: from.Unix(), To: to.Unix(), ClassID: req.ClassID}, ""
+}
+
+type OccupancyStatsResponse struct {
+	Occurrences uint `json:"occurrences"`
+	// Spots of all occurrences together
+	Capacity uint `json:"capacity"`
+	// Spots taken by bookings, including attended ones and no-shows
+	Booked    uint `json:"booked"`
+	CheckedIn uint `json:"checkedIn"`
+	NoShows   uint `json:"noShows"`
+	// Occurrences all spots of which were taken
+	FullOccurrences uint `json:"fullOccurrences"`
+	// Bookings, holds and drop-ins rejected because the class was full
+	FullRejections uint `json:"fullRejections"`
+	// Share of spots taken, between 0 and 1
+	FillRate float64 `json:"fillRate"`
+	// Share of attended or missed bookings that were missed, between 0 and 1
+	NoShowRate float64 `json:"noShowRate"`
+}
+
+func newOccupancyStatsResponse(stats *repo.OccupancyStats) OccupancyStatsResponse {
+	// Rounded to a tenth of a percent
+	round := func(rate float64) float64 {
+		return math.Round(rate*1000) / 1000
+	}
+	return OccupancyStatsResponse{
+		Occurrences:     stats.Occurrences,
+		Capacity:        stats.Capacity,
+		Booked:          stats.Booked,
+		CheckedIn:       stats.CheckedIn,
+		NoShows:         stats.NoShows,
+		FullOccurrences: stats.FullOccurrences,
+		FullRejections:  stats.FullRejections,
+		FillRate:        round(stats.FillRate()),
+		NoShowRate:      round(stats.NoShowRate()),
+	}
+}
+
+type ClassOccupancyResponse struct {
+	ClassID   uint64 `json:"classId"`
+	ClassName string `json:"className"`
+	// Capacity of a single occurrence
+	ClassCapacity uint `json:"classCapacity"`
+	OccupancyStatsResponse
+}
+
+type OccupancyResponse struct {
+	From    string                   `json:"from"`
+	To      string                   `json:"to"`
+	Totals  OccupancyStatsResponse   `json:"totals"`
+	Classes []ClassOccupancyResponse `json:"classes"`
+}
+
+type PeriodOccupancyResponse struct {
+	// First date of the period, in YYYY-MM-DD format
+	Start string `json:"start"`
+	OccupancyStatsResponse
+}
+
+type OccupancyTrendResponse struct {
+	From    string                    `json:"from"`
+	To      string                    `json:"to"`
+	Period  repo.Period               `json:"period"`
+	Periods []PeriodOccupancyResponse `json:"periods"`
+}
+
+type HourOccupancyResponse struct {
+	// e.g. Monday
+	Weekday string `json:"weekday"`
+	// 0-23, in UTC
+	Hour uint `json:"hour"`
+	OccupancyStatsResponse
+}
+
+type OccupancyHeatmapResponse struct {
+	From  string                  `json:"from"`
+	To    string                  `json:"to"`
+	Hours []HourOccupancyResponse `json:"hours"`
+}
+
+func formatDate(date int64) string {
+	return time.Unix(date, 0).UTC().Format("2006-01-02")
+}
+
+// @Summary Get the occupancy of classes
+// @Description Returns how many spots of the occurrences between the dates, both inclusive, were booked, in total and by class, ordered by fill rate from highest to lowest.
+// @Description The range defaults to the last 30 days and covers at most 366 days. Results are cached for a short while, so recent bookings can take a moment to show.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param from query string false "First date in YYYY-MM-DD format"
+// @Param to query string false "Last date in YYYY-MM-DD format"
+// @Param classId query int false "Only the occurrences of the class"
+// @Success 200 {object} handler.OccupancyResponse
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/analytics/occupancy [get]
+func GetOccupancy(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(AnalyticsRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		filter, msg := req.filter()
+		if msg != "" {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: msg})
+		}
+		totals, err := svc.Repo.GetOccupancyTotals(c.Request().Context(), filter)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		classes, err := svc.Repo.GetClassOccupancy(c.Request().Context(), filter)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := OccupancyResponse{From: formatDate(filter.From), To: formatDate(filter.To), Totals: newOccupancyStatsResponse(totals), Classes: make([]ClassOccupancyResponse, 0, len(classes))}
+		for _, class := range classes {
+			res.Classes = append(res.Classes, ClassOccupancyResponse{ClassID: class.ClassID, ClassName: class.ClassName, ClassCapacity: class.Capacity, OccupancyStatsResponse: newOccupancyStatsResponse(&class.OccupancyStats)})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type GetOccupancyTrendRequest struct {
+	AnalyticsRequest
+	Period repo.Period `query:"period" validate:"omitempty,oneof=day week"`
+}
+
+// @Summary Get the occupancy trend
+// @Description Returns the occupancy of the occurrences between the dates, both inclusive, by day or by week, ordered by date. Weeks begin on Monday. Periods without occurrences are left out.
+// @Description The range defaults to the last 30 days and covers at most 366 days.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param from query string false "First date in YYYY-MM-DD format"
+// @Param to query string false "Last date in YYYY-MM-DD format"
+// @Param classId query int false "Only the occurrences of the class"
+// @Param period query string false "day (default) or week"
+// @Success 200 {object} handler.OccupancyTrendResponse
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/analytics/trend [get]
+func GetOccupancyTrend(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetOccupancyTrendRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		filter, msg := req.filter()
+		if msg != "" {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: msg})
+		}
+		if req.Period == "" {
+			req.Period = repo.PeriodDay
+		}
+		periods, err := svc.Repo.GetOccupancyTrend(c.Request().Context(), filter, req.Period)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := OccupancyTrendResponse{From: formatDate(filter.From), To: formatDate(filter.To), Period: req.Period, Periods: make([]PeriodOccupancyResponse, 0, len(periods))}
+		for _, p := range periods {
+			res.Periods = append(res.Periods, PeriodOccupancyResponse{Start: formatDate(p.Start), OccupancyStatsResponse: newOccupancyStatsResponse(&p.OccupancyStats)})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// @Summary Get the occupancy heatmap
+// @Description Returns the occupancy of the occurrences between the dates, both inclusive, by the day of the week and the hour in UTC they start at, ordered by day from Sunday and then by hour. Hours without occurrences are left out.
+// @Description The range defaults to the last 30 days and covers at most 366 days.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param from query string false "First date in YYYY-MM-DD format"
+// @Param to query string false "Last date in YYYY-MM-DD format"
+// @Param classId query int false "Only the occurrences of the class"
+// @Success 200 {object} handler.OccupancyHeatmapResponse
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/analytics/heatmap [get]
+func GetOccupancyHeatmap(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(AnalyticsRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		filter, msg := req.filter()
+		if msg != "" {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: msg})
+		}
+		hours, err := svc.Repo.GetOccupancyHeatmap(c.Request().Context(), filter)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := OccupancyHeatmapResponse{From: formatDate(filter.From), To: formatDate(filter.To), Hours: make([]HourOccupancyResponse, 0, len(hours))}
+		for _, h := range hours {
+			res.Hours = append(res.Hours, HourOccupancyResponse{Weekday: h.Weekday.String(), Hour: h.Hour, OccupancyStatsResponse: newOccupancyStatsResponse(&h.OccupancyStats)})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Actors changes are recorded as made by in the audit log. Holders of the admin and front desk tokens are recorded by their role.
+const (
+	// Callers of the public API who aren't authenticated, followed by what tells them apart
+	actorAnonymous = "anonymous"
+	// Followed by the name of the member holding the access token
+	actorMember = "member:"
+	// The front desk socket, which takes the token as a query parameter rather than the Authorization header
+	actorFrontDesk = roleFrontDesk
+	// Notifications of the payment provider
+	actorPaymentProvider = "payment-provider"
+)
+
+// Entries returned by GetAuditLog when no limit is given
+const defaultAuditLimit = 100
+
+// withActor records the changes made while handling requests as made by 'name' in the audit log, along with the ID of the request. It must run after the request ID middleware.
+func withActor(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+			c.SetRequest(req.WithContext(repo.WithActor(req.Context(), name, requestID)))
+			return next(c)
+		}
+	}
+}
+
+type GetAuditLogRequest struct {
+	// e.g. booking
+	Entity   string           `query:"entity"`
+	EntityID string           `query:"entityId"`
+	Actor    string           `query:"actor"`
+	Action   repo.AuditAction `query:"action" validate:"omitempty,oneof=create update delete"`
+	// Value of the X-Request-Id header of the request that made the changes
+	RequestID string `query:"requestId"`
+	// First date, in YYYY-MM-DD format
+	From string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	// Last date, in YYYY-MM-DD format
+	To string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+	// Only entries older than this one, to page through the log
+	BeforeID uint64 `query:"beforeId"`
+	Limit    int    `query:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+func (req *GetAuditLogRequest) filter() repo.AuditFilter {
+	filter := repo.AuditFilter{
+		Entity:    req.Entity,
+		EntityID:  req.EntityID,
+		Actor:     req.Actor,
+		RequestID: req.RequestID,
+		Action:    req.Action,
+		BeforeID:  req.BeforeID,
+		Limit:     req.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	// The dates have been validated
+	if from, err := time.Parse("2006-01-02", req.From); err == nil {
+		filter.From = from.Unix()
+	}
+	if to, err := time.Parse("2006-01-02", req.To); err == nil {
+		// Up to the end of the day
+		filter.To = to.Add(24*time.Hour).Unix() - 1
+	}
+	return filter
+}
+
+type AuditEntryResponse struct {
+	ID        uint64           `json:"id"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Actor     string           `json:"actor"`
+	RequestID string           `json:"requestId"`
+	Action    repo.AuditAction `json:"action"`
+	Entity    string           `json:"entity"`
+	EntityID  string           `json:"entityId"`
+	// Fields that changed, with the values they had before and after the change. Before is null for creates and after for deletes, which hold every field instead.
+	Before json.RawMessage `json:"before" swaggertype:"object"`
+	After  json.RawMessage `json:"after" swaggertype:"object"`
+}
+
+// rawJSON returns the JSON document 's', or null if it is empty.
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+// @Summary Get the audit log
+// @Description Returns the recorded changes matching the filters, newest first. Every create, update and delete of classes, bookings, holds, memberships, members and other records is recorded along with who made it and in which request. Secrets are redacted.
+// @Description Pass the ID of the last entry as beforeId to get the next page. Entries are deleted once they are older than AUDIT_RETENTION.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param entity query string false "Type of the changed record, e.g. booking"
+// @Param entityId query string false "ID of the changed record"
+// @Param actor query string false "Who made the change, e.g. admin"
+// @Param action query string false "create, update or delete"
+// @Param requestId query string false "X-Request-Id of the request that made the change"
+// @Param from query string false "First date, in YYYY-MM-DD format"
+// @Param to query string false "Last date, in YYYY-MM-DD format"
+// @Param beforeId query int false "Only entries older than this one"
+// @Param limit query int false "Maximum number of entries, 100 by default and at most 1000"
+// @Success 200 {array} handler.AuditEntryResponse
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/audit [get]
+func GetAuditLog(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetAuditLogRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		entries, err := svc.Repo.GetAuditLog(c.Request().Context(), req.filter())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]AuditEntryResponse, 0, len(entries))
+		for _, e := range entries {
+			res = append(res, AuditEntryResponse{
+				ID:        e.ID,
+				CreatedAt: time.Unix(e.CreatedAt, 0).UTC(),
+				Actor:     e.Actor,
+				RequestID: e.RequestID,
+				Action:    e.Action,
+				Entity:    e.Entity,
+				EntityID:  e.EntityID,
+				Before:    rawJSON(e.Before),
+				After:     rawJSON(e.After),
+			})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+const (
+	MIMETextEventStream = "text/event-stream"
+	// Header EventSource clients send when they reconnect, holding the ID of the last event they received
+	HeaderLastEventID = "Last-Event-ID"
+)
+
+// Streams cover at most this many days from their first date
+const maxStreamDays = 366
+
+// Clients are told to wait this long before reconnecting to a stream that ended
+const streamRetry = 3 * time.Second
+
+type AvailabilityStreamRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+	// First date, in YYYY-MM-DD format. Today when empty.
+	From string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	// Last date, in YYYY-MM-DD format. At most 365 days after 'from', which is the default when empty.
+	To string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// dates returns the range of the stream in UNIX timestamp format, or a message for the client if it is invalid.
+func (req *AvailabilityStreamRequest) dates(now time.Time) (int64, int64, string) {
+	// The dates have been validated
+	from := now.UTC().Truncate(24 * time.Hour)
+	if req.From != "" {
+		from, _ = time.Parse("2006-01-02", req.From)
+	}
+	last := from.AddDate(0, 0, maxStreamDays-1)
+	to := last
+	if req.To != "" {
+		to, _ = time.Parse("2006-01-02", req.To)
+	}
+	if to.Before(from) {
+		return 0, 0, "To cannot be before from"
+	}
+	if to.After(last) {
+		return 0, 0, "Streams cover at most 366 days"
+	}
+	return from.Unix(), to.Unix(), ""
+}
+
+type OccurrenceAvailabilityResponse struct {
+	// In YYYY-MM-DD format
+	Date     string `json:"date"`
+	Capacity uint   `json:"capacity"`
+	// Spots taken by bookings and seat holds
+	Taken     uint `json:"taken"`
+	Remaining uint `json:"remaining"`
+}
+
+func newAvailabilityResponse(availability []repo.OccurrenceAvailability) []OccurrenceAvailabilityResponse {
+	res := make([]OccurrenceAvailabilityResponse, 0, len(availability))
+	for _, a := range availability {
+		res = append(res, OccurrenceAvailabilityResponse{Date: formatDate(a.Date), Capacity: a.Capacity, Taken: a.Taken, Remaining: a.Remaining()})
+	}
+	return res
+}
+
+// streamLimiter caps the streams a client may have open at once.
+type streamLimiter struct {
+	// No limit when zero
+	max  uint
+	mu   sync.Mutex
+	open map[string]uint
+}
+
+func newStreamLimiter(max uint) *streamLimiter {
+	return &streamLimiter{max: max, open: map[string]uint{}}
+}
+
+// acquire reports whether the client may open another stream, counting it if so. Every successful call must be followed by release.
+func (l *streamLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.open[client] >= l.max {
+		return false
+	}
+	l.open[client]++
+	return true
+}
+
+func (l *streamLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[client]--; l.open[client] == 0 {
+		delete(l.open, client)
+	}
+}
+
+// formatEventID returns the ID of the event sent for message 'seq' of the broker of 'epoch'.
+func formatEventID(epoch int64, seq uint64) string {
+	return fmt.Sprintf("%d-%d", epoch, seq)
+}
+
+// parseEventID returns the message number of an event ID, if it was sent by the broker of 'epoch'.
+func parseEventID(id string, epoch int64) (uint64, bool) {
+	e, s, ok := strings.Cut(id, "-")
+	if !ok || e != strconv.FormatInt(epoch, 10) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(s, 10, 64)
+	return seq, err == nil
+}
+
+// sseWriter writes Server-Sent Events to the response and flushes them right away.
+type sseWriter struct {
+	res *echo.Response
+}
+
+func (w sseWriter) event(id string, name string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w.res, "id: %s\nevent: %s\ndata: %s\n\n", id, name, b); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+// comment sends a line clients ignore, which keeps proxies from closing an idle connection.
+func (w sseWriter) comment(text string) error {
+	if _, err := fmt.Fprintf(w.res, ": %s\n\n", text); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+// @Summary Stream the availability of a class
+// @Description Streams the spots of the occurrences of the class between the dates as Server-Sent Events. Each 'availability' event holds an array of occurrences: all of them in the first event, and the ones whose spots changed in later events, which are sent as bookings, seat holds and drop-ins of the class are made, cancelled or released.
+// @Description Comments are sent every STREAM_HEARTBEAT to keep the connection open. Clients that reconnect with the Last-Event-ID header are sent the occurrences that changed since that event, or all of them again if it is too old. A client may have at most MAX_STREAMS_PER_CLIENT streams open.
+// @Tags Classes
+// @Produce text/event-stream
+// @Param id path int true "Class ID"
+// @Param from query string false "First date in YYYY-MM-DD format, today by default"
+// @Param to query string false "Last date in YYYY-MM-DD format, at most 365 days after 'from', which is the default"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {array} handler.OccurrenceAvailabilityResponse
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 429 {object} response
+// @Failure 500 {object} response
+// @Router /classes/{id}/availability/stream [get]
+func StreamAvailability(svc *Services) echo.HandlerFunc {
+	limiter := newStreamLimiter(svc.Config.MaxStreamsPerClient)
+	return func(c echo.Context) error {
+		req := new(AvailabilityStreamRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		from, to, msg := req.dates(time.Now())
+		if msg != "" {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: msg})
+		}
+		ctx := c.Request().Context()
+		if _, err := svc.Repo.GetClass(ctx, req.ID); err != nil {
+			switch err {
+			case repo.ClassNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Class not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		client := c.RealIP()
+		if !limiter.acquire(client) {
+			return c.JSON(http.StatusTooManyRequests, response{Message: "Too many open streams"})
+		}
+		defer limiter.release(client)
+
+		// Subscribing before reading the spots makes sure no change in between is missed
+		broker := svc.Repo.Availability
+		after, resumed := parseEventID(c.Request().Header.Get(HeaderLastEventID), broker.Epoch)
+		sub, missed, caughtUp := broker.Subscribe(after, func(change repo.OccurrenceChange) bool {
+			return change.Type.TakesSpots() && change.ClassID == req.ID && change.Date >= from && change.Date <= to
+		})
+		defer sub.Close()
+
+		var first []repo.OccurrenceAvailability
+		firstID := sub.Start
+		switch {
+		case resumed && caughtUp:
+			// Only the occurrences that changed since the last event, each once
+			seen := map[int64]bool{}
+			for _, m := range missed {
+				firstID = m.Seq
+				if seen[m.Value.Date] {
+					continue
+				}
+				seen[m.Value.Date] = true
+				availability, err := svc.Repo.GetAvailability(ctx, req.ID, m.Value.Date, m.Value.Date)
+				if err != nil {
+					slog.Error(err.Error())
+					return echo.ErrInternalServerError
+				}
+				first = append(first, availability...)
+			}
+		default:
+			availability, err := svc.Repo.GetAvailability(ctx, req.ID, from, to)
+			if err != nil {
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+			first = availability
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, MIMETextEventStream)
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		// Keeps reverse proxies such as nginx from buffering the stream
+		res.Header().Set("X-Accel-Buffering", "no")
+		// Streams outlive any write timeout of the server. Not every writer supports deadlines, which is fine as they have none then.
+		http.NewResponseController(res).SetWriteDeadline(time.Time{})
+		res.WriteHeader(http.StatusOK)
+
+		w := sseWriter{res: res}
+		if _, err := fmt.Fprintf(res, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+			return nil
+		}
+		if len(first) > 0 || !resumed || !caughtUp {
+			if err := w.event(formatEventID(broker.Epoch, firstID), "availability", newAvailabilityResponse(first)); err != nil {
+				return nil
+			}
+		} else {
+			res.Flush()
+		}
+
+		heartbeat := time.NewTicker(svc.Config.StreamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-heartbeat.C:
+				if err := w.comment("heartbeat"); err != nil {
+					return nil
+				}
+			case m, ok := <-sub.C:
+				if !ok {
+					// The server is shutting down or the client fell behind. Either way it reconnects and catches up.
+					return nil
+				}
+				availability, err := svc.Repo.GetAvailability(ctx, req.ID, m.Value.Date, m.Value.Date)
+				if err != nil {
+					slog.Error(fmt.Sprintf("Failed to stream availability of class %d: %s", req.ID, err.Error()))
+					return nil
+				}
+				if err = w.event(formatEventID(broker.Epoch, m.Seq), "availability", newAvailabilityResponse(availability)); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
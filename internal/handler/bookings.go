@@ -7,22 +7,29 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
 )
 
 type CreateBookingRequest struct {
 	MemberName string `json:"memberName" validate:"required"`
 	Date       string `json:"date" validate:"required"`
 	ClassID    uint64 `json:"classId" validate:"required,number"`
+	// Booking notifications are emailed to it. It is remembered for later bookings of the member if the booking succeeds, replacing the address remembered before.
+	MemberEmail string `json:"memberEmail" validate:"omitempty,email"`
 }
 
 // @Summary Create a new booking
-// @Description Creates a new booking for the given class and member name.
+// @Description Creates a new booking for the given class and member name. The member needs an active membership that entitles them to another class, which is used up by the booking.
+// @Description Only the member, with their access token, and staff may book for them.
 // @Tags Bookings
 // @Accept json
 // @Produce json
+// @Security MemberToken
 // @Param body body handler.CreateBookingRequest true "Request body"
-// @Success 201 {object} response
+// @Success 201 {object} createdResponse
 // @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 403 {object} response
 // @Failure 404 {object} response
 // @Failure 409 {object} response
 // @Failure 422 {object} response
@@ -34,26 +41,192 @@ func CreateBooking(svc *Services) echo.HandlerFunc {
 		if err := bindAndValidate(c, req); err != nil {
 			return err
 		}
-		date, err := time.Parse("2006-01-02", req.Date)
+		ctx := c.Request().Context()
+		if err := principalFrom(ctx).authorize(req.MemberName); err != nil {
+			return err
+		}
+		id, err := svc.Service.CreateBooking(ctx, req.newBooking())
+		if err != nil {
+			return serviceError(c, err)
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Booking created successfully", ID: id})
+	}
+}
+
+// newBooking returns the booking the request asks the service for. Seat holds and drop-ins are asked for the same way. Only the member and staff may ask for them, so the email address they give replaces the one remembered for the member.
+func (req *CreateBookingRequest) newBooking() *service.NewBooking {
+	return &service.NewBooking{
+		ClassID:      req.ClassID,
+		MemberName:   req.MemberName,
+		Date:         req.Date,
+		MemberEmail:  req.MemberEmail,
+		ReplaceEmail: true,
+	}
+}
+
+type BookingResponse struct {
+	ID         uint64                `json:"id"`
+	ClassID    uint64                `json:"classId"`
+	MemberName string                `json:"memberName"`
+	Date       string                `json:"date"`
+	Status     service.BookingStatus `json:"status"`
+	// Omitted if the booking predates them being recorded
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	CheckedInAt *time.Time `json:"checkedInAt,omitempty"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+	NoShowAt    *time.Time `json:"noShowAt,omitempty"`
+	// Only set for drop-in bookings
+	Amount        int64      `json:"amount,omitempty"`
+	HoldExpiresAt *time.Time `json:"holdExpiresAt,omitempty"`
+}
+
+// optionalTime converts a UNIX timestamp that is zero when unset.
+func optionalTime(t int64) *time.Time {
+	if t == 0 {
+		return nil
+	}
+	tt := time.Unix(t, 0).UTC()
+	return &tt
+}
+
+// timeOrNil omits times that are zero when unset.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func newBookingResponse(booking *service.Booking) BookingResponse {
+	return BookingResponse{
+		ID:            booking.ID,
+		ClassID:       booking.ClassID,
+		MemberName:    booking.MemberName,
+		Date:          booking.Date.Format("2006-01-02"),
+		Status:        booking.Status,
+		CreatedAt:     timeOrNil(booking.CreatedAt),
+		CheckedInAt:   timeOrNil(booking.CheckedInAt),
+		CancelledAt:   timeOrNil(booking.CancelledAt),
+		NoShowAt:      timeOrNil(booking.NoShowAt),
+		Amount:        booking.Amount,
+		HoldExpiresAt: timeOrNil(booking.HoldExpiresAt),
+	}
+}
+
+type BookingIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+type CancelBookingResponse struct {
+	Message string `json:"message"`
+	// Either cancelled or late_cancelled
+	Status service.BookingStatus `json:"status"`
+}
+
+// @Summary Cancel a booking
+// @Description Cancels the booking with the given ID and gives the class back to the membership that paid for it. Cancellations after the free cancellation period of the class are flagged as late and count as a penalty. Drop-in payments are refunded in full in the background unless the cancellation is late.
+// @Description Only the member of the booking, with their access token, and staff may cancel it.
+// @Tags Bookings
+// @Produce json
+// @Security MemberToken
+// @Param id path int true "Booking ID"
+// @Success 200 {object} handler.CancelBookingResponse
+// @Failure 401 {object} response
+// @Failure 403 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /bookings/{id} [delete]
+func CancelBooking(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(BookingIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		booking, err := svc.Service.GetBooking(ctx, req.ID)
 		if err != nil {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format"})
+			return serviceError(c, err)
 		}
-		if time.Now().After(date) {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Date cannot be in the past"})
+		if err := principalFrom(ctx).authorize(booking.MemberName); err != nil {
+			return err
+		}
+		status, err := svc.Service.CancelBooking(ctx, req.ID)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		if status == service.BookingStatusLateCancelled {
+			return c.JSON(http.StatusOK, CancelBookingResponse{Message: "Booking cancelled after the free cancellation period, a penalty has been recorded", Status: status})
+		}
+		return c.JSON(http.StatusOK, CancelBookingResponse{Message: "Booking cancelled successfully", Status: status})
+	}
+}
+
+// @Summary Mark a booking as no-show
+// @Description Records that the member did not attend the booked occurrence. No-shows count as a penalty.
+// @Tags Bookings
+// @Produce json
+// @Security FrontDeskToken
+// @Param id path int true "Booking ID"
+// @Success 200 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /bookings/{id}/no-show [post]
+func MarkNoShow(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(BookingIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if err := svc.Repo.MarkNoShow(c.Request().Context(), req.ID); err != nil {
+			switch err {
+			case repo.BookingNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Booking not found"})
+			case repo.BookingNotMarkableError:
+				return c.JSON(http.StatusConflict, response{Message: "Only active bookings whose class has started can be marked as no-show"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, response{Message: "Booking marked as no-show"})
+	}
+}
+
+// @Summary Check in a booking
+// @Description Records that the member of the booking attended. Check-in opens an hour before the class starts and closes when it ends.
+// @Tags Attendance
+// @Produce json
+// @Security FrontDeskToken
+// @Param id path int true "Booking ID"
+// @Success 200 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /bookings/{id}/check-in [post]
+func CheckInBooking(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(BookingIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
 		}
-		if err := svc.Repo.CreateBooking(c.Request().Context(), req.ClassID, req.MemberName, date.Unix()); err != nil {
+		if err := svc.Repo.CheckIn(c.Request().Context(), req.ID); err != nil {
 			switch err {
-			case repo.ClassNotFoundError:
-				return c.JSON(http.StatusNotFound, response{Message: "Class not found"})
-			case repo.ClassFullError:
-				return c.JSON(http.StatusConflict, response{Message: "Class is full"})
-			case repo.InvalidDateRangeError:
-				return c.JSON(http.StatusUnprocessableEntity, response{Message: "No class is available on the given date"})
+			case repo.BookingNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Booking not found"})
+			case repo.CheckInNotAllowedError:
+				return c.JSON(http.StatusConflict, response{Message: "Check-in is not open for the booking"})
 			default:
 				slog.Error(err.Error())
 				return echo.ErrInternalServerError
 			}
 		}
-		return c.JSON(http.StatusCreated, response{Message: "Booking created successfully"})
+		return c.JSON(http.StatusOK, response{Message: "Booking checked in successfully"})
 	}
 }
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/ical"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Calendar apps identify events by UIDs that are unique across domains
+const uidDomain = "abc-task"
+
+// Bookings feeds cover the occurrences from this long ago on
+const bookingsFeedHistory = 90 * 24 * time.Hour
+
+// @Summary Get the calendar of a class
+// @Description Returns an iCalendar feed with an event for the class that repeats on every date of the class. Calendar apps can subscribe to it to keep up with changes.
+// @Tags Classes
+// @Produce text/calendar
+// @Param id path int true "Class ID"
+// @Success 200 {file} binary
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /classes/{id}/calendar.ics [get]
+func GetClassCalendar(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetClassRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		class, err := svc.Repo.GetClass(ctx, req.ID)
+		if err != nil {
+			switch err {
+			case repo.ClassNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Class not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		description, err := classDescription(ctx, svc, class)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		event := ical.Event{
+			UID:         fmt.Sprintf("class-%d@%s", class.ID, uidDomain),
+			Sequence:    class.Sequence,
+			Stamp:       time.Now(),
+			Start:       class.Occurrence(class.StartDate),
+			End:         class.OccurrenceEnd(class.StartDate),
+			Summary:     class.Name,
+			Description: description,
+		}
+		if class.EndDate > class.StartDate {
+			if class.Location() == time.UTC {
+				event.RepeatDailyUntil = class.Occurrence(class.EndDate)
+			} else {
+				// Occurrences start at the same time of day in the time zone of the class, which isn't the same in UTC across daylight saving time changes
+				for _, o := range class.Occurrences(event.End, class.OccurrenceEnd(class.EndDate)) {
+					event.RepeatOn = append(event.RepeatOn, o.Start)
+				}
+			}
+		}
+		return writeCalendar(c, &ical.Calendar{Name: class.Name, Events: []ical.Event{event}})
+	}
+}
+
+type GetMemberCalendarRequest struct {
+	Name  string `param:"name" validate:"required"`
+	Token string `query:"token" validate:"required"`
+}
+
+// @Summary Get the calendar of a member's bookings
+// @Description Returns an iCalendar feed with an event for every booking of the member from the last 90 days on. Cancelled bookings are kept as cancelled events so that subscribed calendars remove them. The token is issued by an admin and is the only thing protecting the feed, so its URL must be kept secret.
+// @Tags Bookings
+// @Produce text/calendar
+// @Param name path string true "Member name"
+// @Param token query string true "Calendar token of the member"
+// @Success 200 {file} binary
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /members/{name}/bookings.ics [get]
+func GetMemberCalendar(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetMemberCalendarRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		ok, err := svc.Repo.CheckCalendarToken(ctx, req.Name, req.Token)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, response{Message: "Invalid calendar token"})
+		}
+		now := time.Now()
+		since := now.Add(-bookingsFeedHistory).UTC().Truncate(24 * time.Hour)
+		bookings, err := svc.Repo.GetMemberBookings(ctx, req.Name, since.Unix())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		classes := map[uint64]*repo.Class{}
+		events := make([]ical.Event, 0, len(bookings))
+		for i := range bookings {
+			booking := &bookings[i]
+			class, ok := classes[booking.ClassID]
+			if !ok {
+				if class, err = svc.Repo.GetClass(ctx, booking.ClassID); err != nil {
+					slog.Error(err.Error())
+					return echo.ErrInternalServerError
+				}
+				classes[booking.ClassID] = class
+			}
+			events = append(events, ical.Event{
+				UID:      fmt.Sprintf("booking-%d@%s", booking.ID, uidDomain),
+				Sequence: booking.Sequence,
+				Stamp:    bookingStamp(booking, now),
+				Start:    class.Occurrence(booking.Date),
+				End:      class.OccurrenceEnd(booking.Date),
+				Summary:  class.Name,
+				Status:   bookingEventStatus(booking.Status),
+			})
+		}
+		return writeCalendar(c, &ical.Calendar{Name: "Bookings of " + req.Name, Events: events})
+	}
+}
+
+type CalendarTokenResponse struct {
+	Token string `json:"token"`
+	// Subscription URL of the member's bookings calendar
+	URL string `json:"url"`
+}
+
+// @Summary Issue a calendar token for a member
+// @Description Issues a new secret token for the member's bookings calendar and returns it along with the subscription URL to hand to the member. The token issued before stops working.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Member name"
+// @Success 200 {object} handler.CalendarTokenResponse
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/members/{name}/calendar-token [post]
+func ResetCalendarToken(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(MemberRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		token, err := svc.Repo.ResetCalendarToken(c.Request().Context(), req.Name)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		feedURL := fmt.Sprintf("%s://%s/members/%s/bookings.ics?token=%s", c.Scheme(), c.Request().Host, url.PathEscape(req.Name), token)
+		return c.JSON(http.StatusOK, CalendarTokenResponse{Token: token, URL: feedURL})
+	}
+}
+
+// classDescription names the instructor of the class, if one is assigned.
+func classDescription(ctx context.Context, svc *Services, class *repo.Class) (string, error) {
+	if class.InstructorID == 0 {
+		return "", nil
+	}
+	instructor, err := svc.Repo.GetInstructor(ctx, class.InstructorID)
+	if err != nil {
+		return "", err
+	}
+	return "Instructor: " + instructor.Name, nil
+}
+
+// bookingStamp returns when the booking last changed, or 'now' if that wasn't recorded.
+func bookingStamp(booking *repo.Booking, now time.Time) time.Time {
+	stamp := max(booking.CreatedAt, booking.CheckedInAt, booking.CancelledAt, booking.NoShowAt)
+	if stamp == 0 {
+		return now
+	}
+	return time.Unix(stamp, 0)
+}
+
+func bookingEventStatus(status repo.BookingStatus) string {
+	switch status {
+	case repo.BookingStatusPendingPayment:
+		return ical.StatusTentative
+	case repo.BookingStatusCancelled, repo.BookingStatusLateCancelled, repo.BookingStatusPaymentFailed:
+		return ical.StatusCancelled
+	default:
+		return ical.StatusConfirmed
+	}
+}
+
+func writeCalendar(c echo.Context, cal *ical.Calendar) error {
+	var b bytes.Buffer
+	if err := cal.Write(&b); err != nil {
+		slog.Error(err.Error())
+		return echo.ErrInternalServerError
+	}
+	return c.Blob(http.StatusOK, ical.ContentType, b.Bytes())
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/checkin"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Width of the QR code images in pixels
+const qrCodeSize = 256
+
+var errNoCheckInToken = errors.New("Booking has no check-in token")
+
+// issueCheckInToken returns a new token for the booking that is valid until its occurrence ends. Only active bookings whose occurrence hasn't ended have one, and only the member of the booking and staff may get it.
+func issueCheckInToken(ctx context.Context, svc *Services, id uint64) (string, time.Time, error) {
+	booking, err := svc.Repo.GetBooking(ctx, id)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := principalFrom(ctx).authorize(booking.MemberName); err != nil {
+		return "", time.Time{}, err
+	}
+	class, err := svc.Repo.GetClass(ctx, booking.ClassID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := class.OccurrenceEnd(booking.Date)
+	if booking.Status != repo.BookingStatusBooked || !time.Now().Before(expiresAt) {
+		return "", time.Time{}, errNoCheckInToken
+	}
+	token, err := svc.Tokens.Issue(checkin.Claims{
+		BookingID: booking.ID,
+		ClassID:   booking.ClassID,
+		Date:      booking.Date,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	return token, expiresAt, err
+}
+
+func checkInTokenError(c echo.Context, err error) error {
+	if _, ok := err.(*echo.HTTPError); ok {
+		return err
+	}
+	switch err {
+	case repo.BookingNotFoundError:
+		return c.JSON(http.StatusNotFound, response{Message: "Booking not found"})
+	case errNoCheckInToken:
+		return c.JSON(http.StatusConflict, response{Message: "Only active bookings whose class has not ended have a check-in token"})
+	default:
+		slog.Error(err.Error())
+		return echo.ErrInternalServerError
+	}
+}
+
+type CheckInTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// @Summary Get a check-in token
+// @Description Returns a new signed check-in token for the booking. It expires when the booked class ends and can be used only once. Only the member of the booking and staff may get it.
+// @Tags Attendance
+// @Produce json
+// @Security MemberToken
+// @Param id path int true "Booking ID"
+// @Success 200 {object} handler.CheckInTokenResponse
+// @Failure 401 {object} response
+// @Failure 403 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /bookings/{id}/check-in-token [get]
+func GetCheckInToken(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(BookingIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		token, expiresAt, err := issueCheckInToken(c.Request().Context(), svc, req.ID)
+		if err != nil {
+			return checkInTokenError(c, err)
+		}
+		return c.JSON(http.StatusOK, CheckInTokenResponse{Token: token, ExpiresAt: expiresAt.UTC()})
+	}
+}
+
+// @Summary Get a check-in QR code
+// @Description Returns a new signed check-in token for the booking encoded as a QR code, for scanning at the front desk. Only the member of the booking and staff may get it.
+// @Tags Attendance
+// @Produce png
+// @Security MemberToken
+// @Param id path int true "Booking ID"
+// @Success 200 {file} binary
+// @Failure 401 {object} response
+// @Failure 403 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /bookings/{id}/qr.png [get]
+func GetCheckInQRCode(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(BookingIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		token, _, err := issueCheckInToken(c.Request().Context(), svc, req.ID)
+		if err != nil {
+			return checkInTokenError(c, err)
+		}
+		png, err := checkin.QRCode(token, qrCodeSize)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		// Every request issues a new token
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return c.Blob(http.StatusOK, "image/png", png)
+	}
+}
+
+type CheckInWithTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// @Summary Check in with a token
+// @Description Checks in the booking of a scanned check-in token. The token must be for today's occurrence of the class, and can be used only once.
+// @Tags Attendance
+// @Accept json
+// @Produce json
+// @Security FrontDeskToken
+// @Param body body handler.CheckInWithTokenRequest true "Request body"
+// @Success 200 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /checkin [post]
+func CheckInWithToken(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CheckInWithTokenRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		claims, err := svc.Tokens.Verify(req.Token, time.Now())
+		if err != nil {
+			switch err {
+			case checkin.TokenExpiredError:
+				return c.JSON(http.StatusUnauthorized, response{Message: "Check-in token has expired"})
+			default:
+				return c.JSON(http.StatusUnauthorized, response{Message: "Check-in token is invalid"})
+			}
+		}
+		if err = svc.Repo.CheckInWithToken(c.Request().Context(), claims.BookingID, claims.ClassID, claims.Date, claims.Nonce); err != nil {
+			switch err {
+			case repo.BookingNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Booking not found"})
+			case repo.TokenOccurrenceMismatchError:
+				return c.JSON(http.StatusConflict, response{Message: "Check-in token is not for today's class"})
+			case repo.TokenAlreadyUsedError:
+				return c.JSON(http.StatusConflict, response{Message: "Check-in token has already been used"})
+			case repo.CheckInNotAllowedError:
+				return c.JSON(http.StatusConflict, response{Message: "Check-in is not open for the booking"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, createdResponse{Message: "Member checked in successfully", ID: claims.BookingID})
+	}
+}
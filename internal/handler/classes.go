@@ -6,23 +6,135 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
 )
 
+type BookingWindowRequest struct {
+	OpensDaysBefore uint `json:"opensDaysBefore"`
+	// Time of day in 24-hour HH:MM format, in the time zone of the class
+	OpensAt             string `json:"opensAt" validate:"required"`
+	ClosesMinutesBefore uint   `json:"closesMinutesBefore"`
+}
+
 type CreateClassRequest struct {
 	Name      string `json:"name" validate:"required"`
 	StartDate string `json:"startDate" validate:"required"`
 	EndDate   string `json:"endDate" validate:"required"`
-	Capacity  uint   `json:"capacity" validate:"required"`
+	// Time of day in 24-hour HH:MM format, in the time zone of the class. Defaults to midnight.
+	StartTime string `json:"startTime"`
+	// Defaults to 60 minutes
+	DurationMinutes uint `json:"durationMinutes"`
+	Capacity        uint `json:"capacity" validate:"required"`
+	// Booking is open right away when omitted
+	BookingWindow *BookingWindowRequest `json:"bookingWindow"`
+	// Cancellations later than this are flagged as late. Defaults to cancelling free of charge until the class starts.
+	FreeCancelHoursBefore uint `json:"freeCancelHoursBefore"`
+	// Optional. The instructor must not be teaching another class at the same time.
+	InstructorID uint64 `json:"instructorId"`
+	// Optional. The room must not be in use by another class at the same time, and capacity must not exceed the capacity of the room. Dates and times are in the time zone of the location of the room, or UTC if omitted.
+	RoomID uint64 `json:"roomId"`
+	// Drop-in price in the smallest unit of the currency, e.g. cents. Drop-ins are not available when omitted.
+	Price int64 `json:"price" validate:"min=0"`
+}
+
+type BookingWindowResponse struct {
+	OpensDaysBefore     uint   `json:"opensDaysBefore"`
+	OpensAt             string `json:"opensAt"`
+	ClosesMinutesBefore uint   `json:"closesMinutesBefore"`
+}
+
+type ClassResponse struct {
+	ID                    uint64                 `json:"id"`
+	Name                  string                 `json:"name"`
+	StartDate             string                 `json:"startDate"`
+	EndDate               string                 `json:"endDate"`
+	StartTime             string                 `json:"startTime"`
+	DurationMinutes       uint                   `json:"durationMinutes"`
+	Capacity              uint                   `json:"capacity"`
+	BookingWindow         *BookingWindowResponse `json:"bookingWindow,omitempty"`
+	FreeCancelHoursBefore uint                   `json:"freeCancelHoursBefore"`
+	// When booking opens for the next occurrence that has not started yet. Omitted if booking is always open or the class is over.
+	BookingOpensAt *time.Time `json:"bookingOpensAt,omitempty"`
+	// Omitted if no instructor is assigned
+	InstructorID *uint64 `json:"instructorId,omitempty"`
+	// Omitted if the class is not held in a room
+	RoomID *uint64 `json:"roomId,omitempty"`
+	// Drop-in price, 0 if drop-ins are not available
+	Price int64 `json:"price"`
+	// IANA time zone name the dates and times of the class are in, that of the location of its room or UTC
+	Timezone string `json:"timezone"`
+}
+
+func formatTimeOfDay(seconds uint) string {
+	return time.Unix(int64(seconds), 0).UTC().Format("15:04")
+}
+
+func newClassResponse(class *service.Class, now time.Time) ClassResponse {
+	res := ClassResponse{
+		ID:                    class.ID,
+		Name:                  class.Name,
+		StartDate:             class.StartDate.Format("2006-01-02"),
+		EndDate:               class.EndDate.Format("2006-01-02"),
+		StartTime:             formatTimeOfDay(uint(class.StartTime / time.Second)),
+		DurationMinutes:       uint(class.Duration / time.Minute),
+		Capacity:              class.Capacity,
+		FreeCancelHoursBefore: uint(class.FreeCancelBefore / time.Hour),
+		Price:                 class.Price,
+		Timezone:              class.Timezone,
+	}
+	if res.Timezone == "" {
+		res.Timezone = "UTC"
+	}
+	if class.InstructorID != 0 {
+		res.InstructorID = &class.InstructorID
+	}
+	if class.RoomID != 0 {
+		res.RoomID = &class.RoomID
+	}
+	if w := class.BookingWindow; w != nil {
+		res.BookingWindow = &BookingWindowResponse{
+			OpensDaysBefore:     w.OpensDaysBefore,
+			OpensAt:             formatTimeOfDay(uint(w.OpensAt / time.Second)),
+			ClosesMinutesBefore: uint(w.ClosesBefore / time.Minute),
+		}
+		if opensAt, ok := class.NextBookingOpensAt(now); ok {
+			res.BookingOpensAt = &opensAt
+		}
+	}
+	return res
+}
+
+// newClass returns the class the request asks the service for.
+func (req *CreateClassRequest) newClass() *service.NewClass {
+	class := &service.NewClass{
+		Name:                  req.Name,
+		StartDate:             req.StartDate,
+		EndDate:               req.EndDate,
+		StartTime:             req.StartTime,
+		DurationMinutes:       req.DurationMinutes,
+		Capacity:              req.Capacity,
+		FreeCancelHoursBefore: req.FreeCancelHoursBefore,
+		InstructorID:          req.InstructorID,
+		RoomID:                req.RoomID,
+		Price:                 req.Price,
+	}
+	if w := req.BookingWindow; w != nil {
+		class.BookingWindow = &service.NewBookingWindow{OpensDaysBefore: w.OpensDaysBefore, OpensAt: w.OpensAt, ClosesMinutesBefore: w.ClosesMinutesBefore}
+	}
+	return class
 }
 
 // @Summary Create a new class
-// @Description Creates a new class with the given name, description, start date, end date, and capacity.
+// @Description Creates a new class with the given name, start date, end date, start time, duration, capacity, booking window, cancellation policy, instructor and room.
 // @Tags Classes
 // @Accept json
 // @Produce json
 // @Param body body handler.CreateClassRequest true "Request body"
-// @Success 201 {object} response
+// @Success 201 {object} createdResponse
 // @Failure 400 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} handler.ScheduleConflictResponse
 // @Failure 422 {object} response
 // @Failure 500 {object} response
 // @Router /classes [post]
@@ -33,34 +145,155 @@ func CreateClass(svc *Services) echo.HandlerFunc {
 			return err
 		}
 
-		startDate, err := time.Parse("2006-01-02", req.StartDate)
+		class, err := svc.Service.CreateClass(c.Request().Context(), req.newClass())
 		if err != nil {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format for start date"})
+			return serviceError(c, err)
 		}
-		endDate, err := time.Parse("2006-01-02", req.EndDate)
+
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Class created successfully", ID: class.ID})
+	}
+}
+
+type GetClassesRequest struct {
+	LocationID uint64 `query:"locationId"`
+}
+
+// @Summary Get all classes
+// @Description Returns all classes ordered by start date, optionally only those held at the given location.
+// @Tags Classes
+// @Produce json
+// @Param locationId query int false "Location ID"
+// @Success 200 {array} handler.ClassResponse
+// @Failure 400 {object} response
+// @Failure 500 {object} response
+// @Router /classes [get]
+func GetClasses(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetClassesRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		classes, err := svc.Service.GetClasses(c.Request().Context(), req.LocationID)
 		if err != nil {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format for end date"})
+			return serviceError(c, err)
 		}
+		now := svc.Service.Now()
+		res := make([]ClassResponse, 0, len(classes))
+		for i := range classes {
+			res = append(res, newClassResponse(&classes[i], now))
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type GetClassRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
 
-		t := time.Now()
-		if t.After(startDate) {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Start date cannot be in the past"})
+// @Summary Get a class
+// @Description Returns the class with the given ID.
+// @Tags Classes
+// @Produce json
+// @Param id path int true "Class ID"
+// @Success 200 {object} handler.ClassResponse
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /classes/{id} [get]
+func GetClass(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetClassRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
 		}
-		if t.After(endDate) {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "End date cannot be in the past"})
+		class, err := svc.Service.GetClass(c.Request().Context(), req.ID)
+		if err != nil {
+			return serviceError(c, err)
 		}
-		if startDate.After(endDate) {
-			return c.JSON(http.StatusUnprocessableEntity, response{Message: "End date cannot be before start date"})
+		return c.JSON(http.StatusOK, newClassResponse(class, svc.Service.Now()))
+	}
+}
+
+type CheckInMemberRequest struct {
+	ClassID    uint64 `param:"id" json:"-" validate:"required"`
+	MemberName string `json:"memberName" validate:"required"`
+	Date       string `json:"date" validate:"required"`
+}
+
+// @Summary Check in a member
+// @Description Checks in the booking of the member for the occurrence of the class on the given date. Check-in opens an hour before the class starts and closes when it ends.
+// @Tags Attendance
+// @Accept json
+// @Produce json
+// @Security FrontDeskToken
+// @Param id path int true "Class ID"
+// @Param body body handler.CheckInMemberRequest true "Request body"
+// @Success 200 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /classes/{id}/check-in [post]
+func CheckInMember(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CheckInMemberRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
 		}
-		if err := svc.Repo.CreateClass(c.Request().Context(), req.Name, startDate.Unix(), endDate.Unix(), req.Capacity); err != nil {
+		date, err := time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format"})
+		}
+		id, err := svc.Repo.CheckInMember(c.Request().Context(), req.ClassID, req.MemberName, date.Unix())
+		if err != nil {
 			switch err {
+			case repo.BookingNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "No active booking found for the member on the given date"})
+			case repo.CheckInNotAllowedError:
+				return c.JSON(http.StatusConflict, response{Message: "Check-in is not open for the class"})
 			default:
-				// Usually I add a lot more details to the log for internal server errors, but for this task, I'm just logging the error and returning a generic error message
 				slog.Error(err.Error())
 				return echo.ErrInternalServerError
 			}
 		}
+		return c.JSON(http.StatusOK, createdResponse{Message: "Member checked in successfully", ID: id})
+	}
+}
 
-		return c.JSON(http.StatusCreated, response{Message: "Class created successfully"})
+type GetRosterRequest struct {
+	ClassID uint64 `param:"id" validate:"required"`
+	Date    string `query:"date" validate:"required"`
+}
+
+// @Summary Get the roster of a class
+// @Description Returns all bookings for the occurrence of the class on the given date with their attendance state, including cancelled bookings.
+// @Tags Attendance
+// @Produce json
+// @Security FrontDeskToken
+// @Param id path int true "Class ID"
+// @Param date query string true "Date of the occurrence in YYYY-MM-DD format"
+// @Success 200 {array} handler.BookingResponse
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /classes/{id}/roster [get]
+func GetRoster(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetRosterRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		bookings, err := svc.Service.GetRoster(c.Request().Context(), req.ClassID, req.Date)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		res := make([]BookingResponse, 0, len(bookings))
+		for i := range bookings {
+			res = append(res, newBookingResponse(&bookings[i]))
+		}
+		return c.JSON(http.StatusOK, res)
 	}
 }
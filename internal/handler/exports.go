@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Media types of exports
+const (
+	MIMETextCSV = "text/csv"
+	// Newline-delimited JSON, one object per line
+	MIMEApplicationNDJSON = "application/x-ndjson"
+)
+
+// Exports are flushed to the client every this many rows
+const exportFlushEvery = 100
+
+type ExportRequest struct {
+	// First date, in YYYY-MM-DD format
+	From string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	// Last date, in YYYY-MM-DD format
+	To      string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+	ClassID uint64 `query:"classId"`
+}
+
+func (req *ExportRequest) filter() repo.ExportFilter {
+	filter := repo.ExportFilter{ClassID: req.ClassID}
+	// The dates have been validated
+	if from, err := time.Parse("2006-01-02", req.From); err == nil {
+		filter.From = from.Unix()
+	}
+	if to, err := time.Parse("2006-01-02", req.To); err == nil {
+		filter.To = to.Unix()
+	}
+	return filter
+}
+
+// exportRow is a row of an export, which is encoded as a JSON object in NDJSON and as record() in CSV.
+type exportRow interface {
+	record() []string
+}
+
+type BookingExportRow struct {
+	ID              uint64             `json:"id"`
+	ClassID         uint64             `json:"classId"`
+	ClassName       string             `json:"className"`
+	Date            string             `json:"date"`
+	StartTime       string             `json:"startTime"`
+	DurationMinutes uint               `json:"durationMinutes"`
+	InstructorID    uint64             `json:"instructorId"`
+	RoomID          uint64             `json:"roomId"`
+	MemberName      string             `json:"memberName"`
+	Status          repo.BookingStatus `json:"status"`
+	// Timestamps of the status transitions in RFC 3339 format. Empty if the transition didn't happen.
+	CreatedAt   string `json:"createdAt"`
+	CheckedInAt string `json:"checkedInAt"`
+	CancelledAt string `json:"cancelledAt"`
+	NoShowAt    string `json:"noShowAt"`
+	// Zero for drop-ins
+	SubscriptionID uint64 `json:"subscriptionId"`
+	// Set for drop-ins only. Amounts are in the smallest unit of the currency.
+	PaymentID      string `json:"paymentId"`
+	Amount         int64  `json:"amount"`
+	RefundedAmount int64  `json:"refundedAmount"`
+}
+
+var bookingExportHeader = []string{"id", "classId", "className", "date", "startTime", "durationMinutes", "instructorId", "roomId", "memberName", "status", "createdAt", "checkedInAt", "cancelledAt", "noShowAt", "subscriptionId", "paymentId", "amount", "refundedAmount"}
+
+func newBookingExportRow(export *repo.BookingExport) *BookingExportRow {
+	return &BookingExportRow{
+		ID:              export.ID,
+		ClassID:         export.ClassID,
+		ClassName:       export.ClassName,
+		Date:            time.Unix(export.Date, 0).UTC().Format("2006-01-02"),
+		StartTime:       formatTimeOfDay(export.ClassStartTime),
+		DurationMinutes: export.ClassDuration / 60,
+		InstructorID:    export.InstructorID,
+		RoomID:          export.RoomID,
+		MemberName:      export.MemberName,
+		Status:          export.Status,
+		CreatedAt:       formatExportTime(export.CreatedAt),
+		CheckedInAt:     formatExportTime(export.CheckedInAt),
+		CancelledAt:     formatExportTime(export.CancelledAt),
+		NoShowAt:        formatExportTime(export.NoShowAt),
+		SubscriptionID:  export.SubscriptionID,
+		PaymentID:       export.PaymentID,
+		Amount:          export.Amount,
+		RefundedAmount:  export.RefundedAmount,
+	}
+}
+
+func (row *BookingExportRow) record() []string {
+	return []string{
+		formatUint(row.ID), formatUint(row.ClassID), row.ClassName, row.Date, row.StartTime, formatUint(uint64(row.DurationMinutes)), formatUint(row.InstructorID), formatUint(row.RoomID), row.MemberName, string(row.Status),
+		row.CreatedAt, row.CheckedInAt, row.CancelledAt, row.NoShowAt, formatUint(row.SubscriptionID), row.PaymentID, strconv.FormatInt(row.Amount, 10), strconv.FormatInt(row.RefundedAmount, 10),
+	}
+}
+
+type ClassExportRow struct {
+	ID                    uint64 `json:"id"`
+	Name                  string `json:"name"`
+	StartDate             string `json:"startDate"`
+	EndDate               string `json:"endDate"`
+	StartTime             string `json:"startTime"`
+	DurationMinutes       uint   `json:"durationMinutes"`
+	Capacity              uint   `json:"capacity"`
+	FreeCancelHoursBefore uint   `json:"freeCancelHoursBefore"`
+	// Zero if no instructor is assigned
+	InstructorID uint64 `json:"instructorId"`
+	// Zero if the class is not held in a room
+	RoomID uint64 `json:"roomId"`
+	Price  int64  `json:"price"`
+}
+
+var classExportHeader = []string{"id", "name", "startDate", "endDate", "startTime", "durationMinutes", "capacity", "freeCancelHoursBefore", "instructorId", "roomId", "price"}
+
+func newClassExportRow(class *repo.Class) *ClassExportRow {
+	return &ClassExportRow{
+		ID:                    class.ID,
+		Name:                  class.Name,
+		StartDate:             time.Unix(class.StartDate, 0).UTC().Format("2006-01-02"),
+		EndDate:               time.Unix(class.EndDate, 0).UTC().Format("2006-01-02"),
+		StartTime:             formatTimeOfDay(class.StartTime),
+		DurationMinutes:       class.Duration / 60,
+		Capacity:              class.Capacity,
+		FreeCancelHoursBefore: class.FreeCancelBefore / 3600,
+		InstructorID:          class.InstructorID,
+		RoomID:                class.RoomID,
+		Price:                 class.Price,
+	}
+}
+
+func (row *ClassExportRow) record() []string {
+	return []string{
+		formatUint(row.ID), row.Name, row.StartDate, row.EndDate, row.StartTime, formatUint(uint64(row.DurationMinutes)), formatUint(uint64(row.Capacity)),
+		formatUint(uint64(row.FreeCancelHoursBefore)), formatUint(row.InstructorID), formatUint(row.RoomID), strconv.FormatInt(row.Price, 10),
+	}
+}
+
+func formatUint(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+// formatExportTime formats a UNIX timestamp that is zero when unset.
+func formatExportTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+// negotiateExportType returns the media type of the export the Accept header asks for, or an empty string if it asks for none that is supported. CSV is the default.
+func negotiateExportType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return MIMETextCSV
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case MIMETextCSV, "text/*", "*/*":
+			return MIMETextCSV
+		case MIMEApplicationNDJSON, "application/ndjson", "application/jsonl":
+			return MIMEApplicationNDJSON
+		}
+	}
+	return ""
+}
+
+// exportWriter encodes the rows of an export.
+type exportWriter interface {
+	write(row exportRow) error
+	// flush writes out the buffered rows
+	flush() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvExportWriter) write(row exportRow) error {
+	return w.w.Write(row.record())
+}
+
+func (w *csvExportWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonExportWriter) write(row exportRow) error {
+	// Encode ends every object with a newline
+	return w.enc.Encode(row)
+}
+
+func (w *ndjsonExportWriter) flush() error {
+	return nil
+}
+
+// streamExport responds with the rows 'export' passes to its 'emit' function as they come, flushing them to the client in batches. The status and headers are sent before the first row, so an export that fails halfway aborts the response to let the client know it is incomplete.
+func streamExport(c echo.Context, name string, header []string, export func(emit func(row exportRow) error) error) error {
+	mediaType := negotiateExportType(c.Request().Header.Get(echo.HeaderAccept))
+	if mediaType == "" {
+		return c.JSON(http.StatusNotAcceptable, response{Message: fmt.Sprintf("Exports are available as %s and %s", MIMETextCSV, MIMEApplicationNDJSON)})
+	}
+	filename := name + ".csv"
+	if mediaType == MIMEApplicationNDJSON {
+		filename = name + ".ndjson"
+	}
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mediaType+"; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	res.WriteHeader(http.StatusOK)
+
+	var w exportWriter = &ndjsonExportWriter{enc: json.NewEncoder(res)}
+	if mediaType == MIMETextCSV {
+		cw := csv.NewWriter(res)
+		// Buffered along with the first rows
+		cw.Write(header)
+		w = &csvExportWriter{w: cw}
+	}
+
+	rows := 0
+	err := export(func(row exportRow) error {
+		if err := w.write(row); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushEvery == 0 {
+			if err := w.flush(); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.flush()
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("Export of %s failed after %d rows: %s", name, rows, err.Error()))
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+// @Summary Export bookings
+// @Description Streams the bookings for the dates in the range, along with their class, ordered by date. The format is chosen by the Accept header: CSV with a header row (text/csv, the default) or newline-delimited JSON (application/x-ndjson). Cancelled bookings are included.
+// @Tags Admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security AdminToken
+// @Param from query string false "First date, in YYYY-MM-DD format"
+// @Param to query string false "Last date, in YYYY-MM-DD format"
+// @Param classId query int false "Only the bookings of the class"
+// @Success 200 {array} handler.BookingExportRow
+// @Failure 401 {object} response
+// @Failure 406 {object} response
+// @Failure 422 {object} response
+// @Router /admin/exports/bookings [get]
+func ExportBookings(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(ExportRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		return streamExport(c, "bookings", bookingExportHeader, func(emit func(row exportRow) error) error {
+			return svc.Repo.ExportBookings(c.Request().Context(), req.filter(), func(export *repo.BookingExport) error {
+				return emit(newBookingExportRow(export))
+			})
+		})
+	}
+}
+
+// @Summary Export classes
+// @Description Streams the classes held on any date in the range, ordered by start date. The format is chosen by the Accept header like for bookings.
+// @Tags Admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security AdminToken
+// @Param from query string false "First date, in YYYY-MM-DD format"
+// @Param to query string false "Last date, in YYYY-MM-DD format"
+// @Param classId query int false "Only the class"
+// @Success 200 {array} handler.ClassExportRow
+// @Failure 401 {object} response
+// @Failure 406 {object} response
+// @Failure 422 {object} response
+// @Router /admin/exports/classes [get]
+func ExportClasses(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(ExportRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		return streamExport(c, "classes", classExportHeader, func(emit func(row exportRow) error) error {
+			return svc.Repo.ExportClasses(c.Request().Context(), req.filter(), func(class *repo.Class) error {
+				return emit(newClassExportRow(class))
+			})
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rohitxdev/abc-task/internal/pubsub"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"golang.org/x/net/websocket"
+)
+
+// Types of the messages front desks send
+const (
+	FrontDeskSubscribe   = "subscribe"
+	FrontDeskUnsubscribe = "unsubscribe"
+	FrontDeskCheckIn     = "check_in"
+)
+
+// Types of the messages sent to front desks
+const (
+	// A command succeeded
+	FrontDeskResult = "result"
+	// A command failed, or the connection is about to be closed when ReplyTo is empty
+	FrontDeskError = "error"
+	// A booking or seat hold of a subscribed class or location changed
+	FrontDeskEvent = "event"
+	// Sent every STREAM_HEARTBEAT to keep idle connections open
+	FrontDeskPing = "ping"
+)
+
+// Topics front desks subscribe to, followed by ':' and the ID of the class or location
+const (
+	topicClass    = "class"
+	topicLocation = "location"
+)
+
+// Front desks may be subscribed to at most this many topics at once
+const maxFrontDeskTopics = 100
+
+// Commands larger than this close the connection
+const maxFrontDeskMessage = 64 << 10
+
+// Replies waiting to be sent. The connection stops reading commands while the queue is full.
+const frontDeskQueue = 16
+
+// frontDeskAuth only lets through requests with the header 'Authorization: Bearer <token>', where the token is any of 'tokens'. Empty tokens match no request.
+func frontDeskAuth(tokens ...string) echo.MiddlewareFunc {
+	return staffKeyAuth("header:"+echo.HeaderAuthorization, tokens)
+}
+
+// frontDeskSocketAuth is frontDeskAuth for the WebSocket of front desks, which also takes the token from the query parameter 'token' as browsers can't set headers on WebSockets. Query strings end up in access logs, so no other route accepts it.
+func frontDeskSocketAuth(tokens ...string) echo.MiddlewareFunc {
+	return staffKeyAuth("header:"+echo.HeaderAuthorization+",query:token", tokens)
+}
+
+// staffKeyAuth only lets through requests with any of 'tokens' where 'lookup' finds it.
+func staffKeyAuth(lookup string, tokens []string) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: lookup,
+		Validator: func(key string, c echo.Context) (bool, error) {
+			for _, token := range tokens {
+				if matchesToken(key, token) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	})
+}
+
+// FrontDeskCommand is a message sent by a front desk. Which fields are used depends on Type.
+type FrontDeskCommand struct {
+	// Echoed as ReplyTo in the reply
+	ID   string `json:"id"`
+	Type string `json:"type" enums:"subscribe,unsubscribe,check_in"`
+	// For subscribe and unsubscribe, e.g. class:1 or location:2
+	Topics []string `json:"topics,omitempty"`
+	// For check_in: either BookingID, or ClassID, MemberName and Date in YYYY-MM-DD format
+	BookingID  uint64 `json:"bookingId,omitempty"`
+	ClassID    uint64 `json:"classId,omitempty"`
+	MemberName string `json:"memberName,omitempty"`
+	Date       string `json:"date,omitempty"`
+}
+
+// FrontDeskMessage is a message sent to a front desk. Which fields are set depends on Type.
+type FrontDeskMessage struct {
+	Type string `json:"type" enums:"result,error,event,ping"`
+	// ID of the command replied to
+	ReplyTo string `json:"replyTo,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Topics subscribed to after a subscribe or unsubscribe command
+	Topics []string `json:"topics,omitempty"`
+	// Booking checked in by a check_in command
+	BookingID uint64 `json:"bookingId,omitempty"`
+	// Topic an event was sent for
+	Topic string              `json:"topic,omitempty"`
+	Event *FrontDeskEventBody `json:"event,omitempty"`
+}
+
+type FrontDeskEventBody struct {
+	Type    repo.ChangeType `json:"type" enums:"booked,cancelled,held,released,checked_in,no_show"`
+	ClassID uint64          `json:"classId"`
+	// In YYYY-MM-DD format
+	Date string `json:"date"`
+	// Zero for seat holds
+	BookingID  uint64 `json:"bookingId"`
+	MemberName string `json:"memberName"`
+}
+
+// parseTopic returns the kind and ID of the topic, or a message for the client if it is invalid.
+func parseTopic(topic string) (kind string, id uint64, msg string) {
+	kind, s, _ := strings.Cut(topic, ":")
+	id, err := strconv.ParseUint(s, 10, 64)
+	if (kind != topicClass && kind != topicLocation) || err != nil || id == 0 {
+		return "", 0, fmt.Sprintf("Invalid topic '%s', expected class:<id> or location:<id>", topic)
+	}
+	return kind, id, ""
+}
+
+func formatTopic(kind string, id uint64) string {
+	return kind + ":" + strconv.FormatUint(id, 10)
+}
+
+// classLocations caches the locations of classes, which don't move once created.
+type classLocations struct {
+	repo *repo.Repo
+	mu   sync.Mutex
+	ids  map[uint64]uint64
+}
+
+func (l *classLocations) get(ctx context.Context, classID uint64) (uint64, error) {
+	l.mu.Lock()
+	id, ok := l.ids[classID]
+	l.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	id, err := l.repo.GetClassLocation(ctx, classID)
+	if err != nil {
+		return 0, err
+	}
+	l.mu.Lock()
+	l.ids[classID] = id
+	l.mu.Unlock()
+	return id, nil
+}
+
+// frontDeskConn serves a front desk connected over a WebSocket. Commands are read and handled one at a time, while replies and events are written by a single writer so that messages never interleave.
+type frontDeskConn struct {
+	svc       *Services
+	ws        *websocket.Conn
+	locations *classLocations
+	replies   chan FrontDeskMessage
+	// Closed when the connection stops reading commands
+	done chan struct{}
+	// Closed when the connection stops writing
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+func (c *frontDeskConn) send(msg FrontDeskMessage) error {
+	// A client that doesn't take a message within a heartbeat is too slow to keep up
+	if err := c.ws.SetWriteDeadline(time.Now().Add(c.svc.Config.StreamHeartbeat)); err != nil {
+		return err
+	}
+	return websocket.JSON.Send(c.ws, msg)
+}
+
+// topic returns the subscribed topic the change is sent for, or an empty string if the front desk isn't subscribed to the class or its location.
+func (c *frontDeskConn) topic(ctx context.Context, change repo.OccurrenceChange) string {
+	c.mu.Lock()
+	class := formatTopic(topicClass, change.ClassID)
+	subscribed, anyLocation := c.topics[class], false
+	for topic := range c.topics {
+		anyLocation = anyLocation || strings.HasPrefix(topic, topicLocation+":")
+	}
+	c.mu.Unlock()
+	if subscribed {
+		return class
+	}
+	if !anyLocation {
+		return ""
+	}
+	locationID, err := c.locations.get(ctx, change.ClassID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to get the location of class %d: %s", change.ClassID, err.Error()))
+		return ""
+	}
+	location := formatTopic(topicLocation, locationID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if locationID == 0 || !c.topics[location] {
+		return ""
+	}
+	return location
+}
+
+// write sends replies, pings and the events of the subscribed topics until the connection stops reading or a write fails. Events are dropped by the broker once the client falls too far behind, which closes the connection.
+func (c *frontDeskConn) write(ctx context.Context, changes <-chan pubsub.Message[repo.OccurrenceChange]) {
+	defer close(c.stopped)
+	// Makes the reader stop as well
+	defer c.ws.Close()
+
+	heartbeat := time.NewTicker(c.svc.Config.StreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var msg FrontDeskMessage
+		select {
+		case <-c.done:
+			return
+		case msg = <-c.replies:
+		case <-heartbeat.C:
+			msg = FrontDeskMessage{Type: FrontDeskPing}
+		case m, ok := <-changes:
+			if !ok {
+				// The server is shutting down or the client fell behind. Either way it reconnects and reloads what it shows.
+				c.send(FrontDeskMessage{Type: FrontDeskError, Error: "Updates stopped, reconnect to resume"})
+				return
+			}
+			topic := c.topic(ctx, m.Value)
+			if topic == "" {
+				continue
+			}
+			change := m.Value
+			msg = FrontDeskMessage{Type: FrontDeskEvent, Topic: topic, Event: &FrontDeskEventBody{
+				Type:       change.Type,
+				ClassID:    change.ClassID,
+				Date:       formatDate(change.Date),
+				BookingID:  change.BookingID,
+				MemberName: change.MemberName,
+			}}
+		}
+		if err := c.send(msg); err != nil {
+			return
+		}
+	}
+}
+
+// read handles commands until the connection is closed.
+func (c *frontDeskConn) read(ctx context.Context) {
+	c.ws.MaxPayloadBytes = maxFrontDeskMessage
+	for {
+		var cmd FrontDeskCommand
+		var reply FrontDeskMessage
+		err := websocket.JSON.Receive(c.ws, &cmd)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case err == nil:
+			reply = c.handle(ctx, &cmd)
+		case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+			reply = FrontDeskMessage{Type: FrontDeskError, Error: "Invalid message"}
+		default:
+			return
+		}
+		select {
+		case c.replies <- reply:
+		case <-c.stopped:
+			return
+		}
+	}
+}
+
+func (c *frontDeskConn) handle(ctx context.Context, cmd *FrontDeskCommand) FrontDeskMessage {
+	var res FrontDeskMessage
+	var msg string
+	switch cmd.Type {
+	case FrontDeskSubscribe:
+		res, msg = c.subscribe(ctx, cmd.Topics)
+	case FrontDeskUnsubscribe:
+		res, msg = c.unsubscribe(cmd.Topics)
+	case FrontDeskCheckIn:
+		res, msg = c.checkIn(ctx, cmd)
+	default:
+		msg = fmt.Sprintf("Unknown message type '%s'", cmd.Type)
+	}
+	if msg != "" {
+		res = FrontDeskMessage{Type: FrontDeskError, Error: msg}
+	}
+	res.ReplyTo = cmd.ID
+	return res
+}
+
+func (c *frontDeskConn) subscribe(ctx context.Context, topics []string) (FrontDeskMessage, string) {
+	if len(topics) == 0 {
+		return FrontDeskMessage{}, "Topics are required"
+	}
+	add := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		kind, id, msg := parseTopic(topic)
+		if msg != "" {
+			return FrontDeskMessage{}, msg
+		}
+		var err error
+		switch kind {
+		case topicClass:
+			_, err = c.svc.Repo.GetClass(ctx, id)
+		case topicLocation:
+			_, err = c.svc.Repo.GetLocation(ctx, id)
+		}
+		switch err {
+		case nil:
+		case repo.ClassNotFoundError:
+			return FrontDeskMessage{}, "Class not found"
+		case repo.LocationNotFoundError:
+			return FrontDeskMessage{}, "Location not found"
+		default:
+			slog.Error(err.Error())
+			return FrontDeskMessage{}, "Internal Server Error"
+		}
+		add = append(add, formatTopic(kind, id))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.topics)
+	for _, topic := range add {
+		if !c.topics[topic] {
+			n++
+		}
+	}
+	if n > maxFrontDeskTopics {
+		return FrontDeskMessage{}, fmt.Sprintf("At most %d topics can be subscribed to", maxFrontDeskTopics)
+	}
+	for _, topic := range add {
+		c.topics[topic] = true
+	}
+	return FrontDeskMessage{Type: FrontDeskResult, Topics: c.subscribed()}, ""
+}
+
+func (c *frontDeskConn) unsubscribe(topics []string) (FrontDeskMessage, string) {
+	if len(topics) == 0 {
+		return FrontDeskMessage{}, "Topics are required"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		kind, id, msg := parseTopic(topic)
+		if msg != "" {
+			return FrontDeskMessage{}, msg
+		}
+		delete(c.topics, formatTopic(kind, id))
+	}
+	return FrontDeskMessage{Type: FrontDeskResult, Topics: c.subscribed()}, ""
+}
+
+// subscribed returns the topics in a stable order. It must be called with c.mu held.
+func (c *frontDeskConn) subscribed() []string {
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+func (c *frontDeskConn) checkIn(ctx context.Context, cmd *FrontDeskCommand) (FrontDeskMessage, string) {
+	id := cmd.BookingID
+	var err error
+	if id != 0 {
+		err = c.svc.Repo.CheckIn(ctx, id)
+	} else {
+		if cmd.ClassID == 0 || cmd.MemberName == "" {
+			return FrontDeskMessage{}, "Either bookingId, or classId, memberName and date are required"
+		}
+		date, parseErr := time.Parse("2006-01-02", cmd.Date)
+		if parseErr != nil {
+			return FrontDeskMessage{}, "Invalid date format"
+		}
+		id, err = c.svc.Repo.CheckInMember(ctx, cmd.ClassID, cmd.MemberName, date.Unix())
+	}
+	switch err {
+	case nil:
+		return FrontDeskMessage{Type: FrontDeskResult, BookingID: id}, ""
+	case repo.BookingNotFoundError:
+		return FrontDeskMessage{}, "No active booking found"
+	case repo.CheckInNotAllowedError:
+		return FrontDeskMessage{}, "Check-in is not open for the class"
+	default:
+		slog.Error(err.Error())
+		return FrontDeskMessage{}, "Internal Server Error"
+	}
+}
+
+// @Summary Connect a front desk
+// @Description Upgrades the connection to a WebSocket over which front desks receive bookings, cancellations, seat holds, check-ins and no-shows as they happen, and check members in. Messages are JSON objects with a 'type' field. Front desks send handler.FrontDeskCommand messages and are sent handler.FrontDeskMessage messages.
+// @Description Send 'subscribe' and 'unsubscribe' commands with topics such as class:1 or location:2 to choose which events to receive, and 'check_in' commands with a booking ID, or a class ID, member name and date, to check members in. Every command is replied to with a 'result' or 'error' message whose replyTo is the ID of the command.
+// @Description Events of a class are sent for the class topic and for the location of its room. Connections whose client doesn't keep up with the messages are closed, after which clients reconnect and reload what they show. The token can be passed in the query parameter 'token' instead of the Authorization header, for browsers.
+// @Tags Front desk
+// @Security FrontDeskToken
+// @Param token query string false "Front desk or admin token, instead of the Authorization header"
+// @Success 101 {object} handler.FrontDeskMessage
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Router /front-desk/ws [get]
+func FrontDeskSocket(svc *Services) echo.HandlerFunc {
+	locations := &classLocations{repo: svc.Repo, ids: map[uint64]uint64{}}
+	return func(c echo.Context) error {
+		// WebSockets can only be upgraded from HTTP/1.1 connections
+		if !c.IsWebSocket() || c.Request().ProtoMajor != 1 {
+			return c.JSON(http.StatusBadRequest, response{Message: "Expected a WebSocket upgrade"})
+		}
+		ctx := c.Request().Context()
+		server := websocket.Server{
+			// Clients are authenticated by token, so any origin is accepted
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(ws *websocket.Conn) {
+				conn := &frontDeskConn{
+					svc:       svc,
+					ws:        ws,
+					locations: locations,
+					replies:   make(chan FrontDeskMessage, frontDeskQueue),
+					done:      make(chan struct{}),
+					stopped:   make(chan struct{}),
+					topics:    map[string]bool{},
+				}
+				sub, _, _ := svc.Repo.Availability.Subscribe(svc.Repo.Availability.Seq(), nil)
+				defer sub.Close()
+				go conn.write(ctx, sub.C)
+				conn.read(ctx)
+				close(conn.done)
+				<-conn.stopped
+			},
+		}
+		server.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
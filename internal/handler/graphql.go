@@ -0,0 +1,729 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/dataloader"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
+)
+
+const (
+	// Queries nesting fields deeper than this are rejected
+	maxGraphQLDepth = 10
+	// Lists other than occurrences are expected to hold this many items when estimating the cost of a query
+	graphQLListSize = 20
+	// Occurrences of a class are listed for at most this many days at once
+	maxOccurrenceDays = 366
+)
+
+type GraphQLRequest struct {
+	Query         string `json:"query" query:"query"`
+	OperationName string `json:"operationName" query:"operationName"`
+	// Values of the variables of the operation. In GET requests they are JSON encoded.
+	Variables map[string]any `json:"variables"`
+}
+
+type GraphQLResponse struct {
+	Data any `json:"data,omitempty"`
+	// Each has a message, and the HTTP status the REST API responds with in its extensions if a field could not be resolved
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty" swaggertype:"array,object"`
+}
+
+// graphQLError reports the reason a field could not be resolved, with the HTTP status the REST API responds with in its extensions.
+type graphQLError struct {
+	status  int
+	message string
+}
+
+func (e graphQLError) Error() string {
+	return e.message
+}
+
+func (e graphQLError) Extensions() map[string]any {
+	return map[string]any{"status": e.status}
+}
+
+// resolveError returns the error 'err' is reported with, with the status the REST API reports errors of the service with. Unknown errors are logged and reported as internal.
+func resolveError(err error) error {
+	var e *service.Error
+	if errors.As(err, &e) {
+		return graphQLError{serviceStatus[e.Kind], e.Message}
+	}
+	slog.Error(err.Error())
+	return graphQLError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)}
+}
+
+func invalidInput(msg string) error {
+	return graphQLError{http.StatusUnprocessableEntity, msg}
+}
+
+// graphQLLoaders batch the lookups of a single request.
+type graphQLLoaders struct {
+	classes *dataloader.Loader[uint64, *repo.Class]
+	taken   *dataloader.Loader[repo.OccurrenceKey, uint]
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, svc *Services) context.Context {
+	loaders := &graphQLLoaders{
+		classes: dataloader.New(func(ctx context.Context, ids []uint64) (map[uint64]*repo.Class, error) {
+			classes, err := svc.Repo.GetClassesByID(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[uint64]*repo.Class, len(classes))
+			for i := range classes {
+				byID[classes[i].ID] = &classes[i]
+			}
+			return byID, nil
+		}),
+		taken: dataloader.New(svc.Repo.GetTaken),
+	}
+	return context.WithValue(ctx, loadersKey{}, loaders)
+}
+
+func loaders(ctx context.Context) *graphQLLoaders {
+	return ctx.Value(loadersKey{}).(*graphQLLoaders)
+}
+
+// occurrence is the occurrence of a class on a date, which is in UNIX timestamp format.
+type occurrence struct {
+	class *repo.Class
+	date  int64
+}
+
+func (o occurrence) key() repo.OccurrenceKey {
+	return repo.OccurrenceKey{ClassID: o.class.ID, Date: o.date}
+}
+
+// resolve returns a resolver of a field of 'T' that can't fail.
+func resolve[T any](fn func(source T) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return fn(p.Source.(T)), nil
+	}
+}
+
+// optionalID resolves IDs that are zero when unset to null.
+func optionalID(id uint64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// optionalTimestamp resolves UNIX timestamps that are zero when unset to null, and others to RFC 3339.
+func optionalTimestamp(t int64) any {
+	if t == 0 {
+		return nil
+	}
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+func parseID(v any) (uint64, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		return 0, invalidInput("Invalid ID")
+	}
+	return id, nil
+}
+
+// parseDateArg parses the argument 'name' of a field in YYYY-MM-DD format into a UNIX timestamp.
+func parseDateArg(args map[string]any, name string) (int64, error) {
+	s, _ := args[name].(string)
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, invalidInput(fmt.Sprintf("Invalid date format for %s", name))
+	}
+	return date.Unix(), nil
+}
+
+// occurrenceDays returns how many days the range from 'from' to 'to' covers, or an error if it is invalid.
+func occurrenceDays(from, to int64) (int, error) {
+	if to < from {
+		return 0, invalidInput("To cannot be before from")
+	}
+	days := int((to-from)/(24*60*60)) + 1
+	if days > maxOccurrenceDays {
+		return 0, invalidInput(fmt.Sprintf("Occurrences cover at most %d days", maxOccurrenceDays))
+	}
+	return days, nil
+}
+
+// newGraphQLSchema returns the schema of the GraphQL API over classes, their occurrences, bookings and members.
+func newGraphQLSchema(svc *Services) (graphql.Schema, error) {
+	occurrenceType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Occurrence",
+		Description: "A single session of a class",
+		Fields: graphql.Fields{
+			"date": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "In YYYY-MM-DD format",
+				Resolve:     resolve(func(o occurrence) any { return formatDate(o.date) }),
+			},
+			"startsAt": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.DateTime),
+				Description: "In UTC",
+				Resolve:     resolve(func(o occurrence) any { return o.class.Occurrence(o.date) }),
+			},
+			"endsAt": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.DateTime),
+				Resolve: resolve(func(o occurrence) any { return o.class.OccurrenceEnd(o.date) }),
+			},
+			"capacity": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: resolve(func(o occurrence) any { return o.class.Capacity }),
+			},
+			"taken": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Spots taken by bookings and seat holds",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					load := loaders(p.Context).taken.Load(p.Context, p.Source.(occurrence).key())
+					return func() (any, error) {
+						return load()
+					}, nil
+				},
+			},
+			"remaining": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					o := p.Source.(occurrence)
+					load := loaders(p.Context).taken.Load(p.Context, o.key())
+					return func() (any, error) {
+						taken, err := load()
+						if err != nil {
+							return nil, err
+						}
+						a := repo.OccurrenceAvailability{Capacity: o.class.Capacity, Taken: taken}
+						return a.Remaining(), nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	classType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Class",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolve(func(c *repo.Class) any { return c.ID })},
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolve(func(c *repo.Class) any { return c.Name })},
+			"startDate": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "In YYYY-MM-DD format",
+				Resolve:     resolve(func(c *repo.Class) any { return formatDate(c.StartDate) }),
+			},
+			"endDate": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "In YYYY-MM-DD format",
+				Resolve:     resolve(func(c *repo.Class) any { return formatDate(c.EndDate) }),
+			},
+			"startTime": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "Time of day in 24-hour HH:MM format, in the time zone of the class",
+				Resolve:     resolve(func(c *repo.Class) any { return formatTimeOfDay(c.StartTime) }),
+			},
+			"timezone": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "IANA time zone name the dates and times of the class are in, that of the location of its room or UTC",
+				Resolve: resolve(func(c *repo.Class) any {
+					if c.Timezone == "" {
+						return "UTC"
+					}
+					return c.Timezone
+				}),
+			},
+			"durationMinutes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: resolve(func(c *repo.Class) any { return c.Duration / 60 })},
+			"capacity":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: resolve(func(c *repo.Class) any { return c.Capacity })},
+			"instructorId": &graphql.Field{
+				Type:        graphql.ID,
+				Description: "Null if no instructor is assigned",
+				Resolve:     resolve(func(c *repo.Class) any { return optionalID(c.InstructorID) }),
+			},
+			"roomId": &graphql.Field{
+				Type:        graphql.ID,
+				Description: "Null if the class is not held in a room",
+				Resolve:     resolve(func(c *repo.Class) any { return optionalID(c.RoomID) }),
+			},
+			"price": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Drop-in price in the smallest unit of the currency, 0 if drop-ins are not available",
+				Resolve:     resolve(func(c *repo.Class) any { return c.Price }),
+			},
+			"occurrences": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(occurrenceType))),
+				Description: fmt.Sprintf("Occurrences from 'from' to 'to', both inclusive and in YYYY-MM-DD format, ordered by date. The range covers at most %d days.", maxOccurrenceDays),
+				Args: graphql.FieldConfigArgument{
+					"from": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"to":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					class := p.Source.(*repo.Class)
+					from, err := parseDateArg(p.Args, "from")
+					if err != nil {
+						return nil, err
+					}
+					to, err := parseDateArg(p.Args, "to")
+					if err != nil {
+						return nil, err
+					}
+					if _, err = occurrenceDays(from, to); err != nil {
+						return nil, err
+					}
+					occurrences := []occurrence{}
+					for date := max(from, class.StartDate); date <= min(to, class.EndDate); date += 24 * 60 * 60 {
+						occurrences = append(occurrences, occurrence{class: class, date: date})
+					}
+					return occurrences, nil
+				},
+			},
+		},
+	})
+	occurrenceType.AddFieldConfig("class", &graphql.Field{
+		Type:    graphql.NewNonNull(classType),
+		Resolve: resolve(func(o occurrence) any { return o.class }),
+	})
+
+	// loadClass resolves a field of the class of a booking, batching the lookups of all bookings in the result.
+	loadClass := func(p graphql.ResolveParams, then func(b *repo.Booking, class *repo.Class) any) (any, error) {
+		b := p.Source.(*repo.Booking)
+		load := loaders(p.Context).classes.Load(p.Context, b.ClassID)
+		return func() (any, error) {
+			class, err := load()
+			if err != nil || class == nil {
+				return nil, err
+			}
+			return then(b, class), nil
+		}, nil
+	}
+	bookingType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Booking",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolve(func(b *repo.Booking) any { return b.ID })},
+			"classId":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolve(func(b *repo.Booking) any { return b.ClassID })},
+			"memberName": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolve(func(b *repo.Booking) any { return b.MemberName })},
+			"date": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "In YYYY-MM-DD format",
+				Resolve:     resolve(func(b *repo.Booking) any { return formatDate(b.Date) }),
+			},
+			"status": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "e.g. booked, checked_in or cancelled",
+				Resolve:     resolve(func(b *repo.Booking) any { return string(b.Status) }),
+			},
+			"createdAt":   &graphql.Field{Type: graphql.String, Resolve: resolve(func(b *repo.Booking) any { return optionalTimestamp(b.CreatedAt) })},
+			"checkedInAt": &graphql.Field{Type: graphql.String, Resolve: resolve(func(b *repo.Booking) any { return optionalTimestamp(b.CheckedInAt) })},
+			"cancelledAt": &graphql.Field{Type: graphql.String, Resolve: resolve(func(b *repo.Booking) any { return optionalTimestamp(b.CancelledAt) })},
+			"class": &graphql.Field{
+				Type: classType,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return loadClass(p, func(_ *repo.Booking, class *repo.Class) any { return class })
+				},
+			},
+			"occurrence": &graphql.Field{
+				Type:        occurrenceType,
+				Description: "The booked occurrence of the class",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return loadClass(p, func(b *repo.Booking, class *repo.Class) any { return occurrence{class: class, date: b.Date} })
+				},
+			},
+		},
+	})
+
+	memberType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Member",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolve(func(name string) any { return name })},
+			"bookings": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookingType))),
+				Description: "Bookings for the dates since 'from', in YYYY-MM-DD format and today by default, ordered by date. Cancelled bookings are included.",
+				Args: graphql.FieldConfigArgument{
+					"from": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					since := svc.Service.Now().UTC().Truncate(24 * time.Hour).Unix()
+					if _, ok := p.Args["from"]; ok {
+						var err error
+						if since, err = parseDateArg(p.Args, "from"); err != nil {
+							return nil, err
+						}
+					}
+					bookings, err := svc.Repo.GetMemberBookings(p.Context, p.Source.(string), since)
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					res := make([]*repo.Booking, 0, len(bookings))
+					for i := range bookings {
+						res = append(res, &bookings[i])
+					}
+					return res, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"classes": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(classType))),
+				Description: "All classes ordered by start date, optionally only those held at a location",
+				Args: graphql.FieldConfigArgument{
+					"locationId": &graphql.ArgumentConfig{Type: graphql.ID},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var filter repo.ClassFilter
+					if v, ok := p.Args["locationId"]; ok {
+						var err error
+						if filter.LocationID, err = parseID(v); err != nil {
+							return nil, err
+						}
+					}
+					classes, err := svc.Repo.GetClasses(p.Context, filter)
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					res := make([]*repo.Class, 0, len(classes))
+					for i := range classes {
+						res = append(res, &classes[i])
+					}
+					return res, nil
+				},
+			},
+			"class": &graphql.Field{
+				Type:        classType,
+				Description: "Null if there is no class with the ID",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					load := loaders(p.Context).classes.Load(p.Context, id)
+					return func() (any, error) {
+						class, err := load()
+						if err != nil || class == nil {
+							return nil, err
+						}
+						return class, nil
+					}, nil
+				},
+			},
+			"booking": &graphql.Field{
+				Type:        bookingType,
+				Description: "Null if there is no booking with the ID. Only the member, with their access token, and staff may query it.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					booking, err := svc.Repo.GetBooking(p.Context, id)
+					if err == repo.BookingNotFoundError {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					if err := principalFrom(p.Context).authorize(booking.MemberName); err != nil {
+						return nil, graphQLError{err.Code, err.Message.(string)}
+					}
+					return booking, nil
+				},
+			},
+			"member": &graphql.Field{
+				Type:        graphql.NewNonNull(memberType),
+				Description: "Only the member, with their access token, and staff may query it",
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					name, _ := p.Args["name"].(string)
+					if err := principalFrom(p.Context).authorize(name); err != nil {
+						return nil, graphQLError{err.Code, err.Message.(string)}
+					}
+					return name, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createBooking": &graphql.Field{
+				Type:        graphql.NewNonNull(bookingType),
+				Description: "Books the occurrence of a class for a member, using up an entitlement of their active membership. Only the member, with their access token, and staff may book for them.",
+				Args: graphql.FieldConfigArgument{
+					"classId":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"memberName": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"date":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "In YYYY-MM-DD format"},
+					"memberEmail": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "Booking notifications are emailed to it. It is remembered for later bookings of the member if the booking succeeds, replacing the address remembered before.",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					classID, err := parseID(p.Args["classId"])
+					if err != nil {
+						return nil, err
+					}
+					req := &CreateBookingRequest{ClassID: classID}
+					req.MemberName, _ = p.Args["memberName"].(string)
+					req.Date, _ = p.Args["date"].(string)
+					req.MemberEmail, _ = p.Args["memberEmail"].(string)
+					if err = validate.Struct(req); err != nil {
+						return nil, invalidInput(err.Error())
+					}
+					if err := principalFrom(p.Context).authorize(req.MemberName); err != nil {
+						return nil, graphQLError{err.Code, err.Message.(string)}
+					}
+					id, err := svc.Service.CreateBooking(p.Context, req.newBooking())
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					booking, err := svc.Repo.GetBooking(p.Context, id)
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					return booking, nil
+				},
+			},
+			"cancelBooking": &graphql.Field{
+				Type:        graphql.NewNonNull(bookingType),
+				Description: "Cancels a booking and gives the class back to the membership that paid for it. Cancellations after the free cancellation period of the class have the status late_cancelled and count as a penalty.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					target, err := svc.Service.GetBooking(p.Context, id)
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					if err := principalFrom(p.Context).authorize(target.MemberName); err != nil {
+						return nil, graphQLError{err.Code, err.Message.(string)}
+					}
+					if _, err = svc.Service.CancelBooking(p.Context, id); err != nil {
+						return nil, resolveError(err)
+					}
+					booking, err := svc.Repo.GetBooking(p.Context, id)
+					if err != nil {
+						return nil, resolveError(err)
+					}
+					return booking, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// graphQLCost estimates what resolving an operation costs, so that expensive queries can be rejected before they run.
+type graphQLCost struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// selectionSet returns the cost of the selections of an object of type 'parent', and how deep they nest below it. Fields cost 1 plus the cost of their own selections, times the number of items a list is expected to hold.
+func (q *graphQLCost) selectionSet(parent *graphql.Object, set *ast.SelectionSet) (cost int, depth int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var c, d int
+		switch s := selection.(type) {
+		case *ast.Field:
+			c, d = q.field(parent, s)
+		case *ast.InlineFragment:
+			c, d = q.selectionSet(q.typeCondition(parent, s.TypeCondition), s.SelectionSet)
+		case *ast.FragmentSpread:
+			if f, ok := q.fragments[s.Name.Value]; ok {
+				c, d = q.selectionSet(q.typeCondition(parent, f.TypeCondition), f.SelectionSet)
+			}
+		}
+		cost += c
+		depth = max(depth, d)
+	}
+	return cost, depth
+}
+
+func (q *graphQLCost) field(parent *graphql.Object, f *ast.Field) (int, int) {
+	def, ok := parent.Fields()[f.Name.Value]
+	if !ok {
+		// Meta fields like __typename and introspection
+		return 1, 1
+	}
+	t, isList := def.Type, false
+	for {
+		if nonNull, ok := t.(*graphql.NonNull); ok {
+			t = nonNull.OfType
+		} else if list, ok := t.(*graphql.List); ok {
+			t, isList = list.OfType, true
+		} else {
+			break
+		}
+	}
+	obj, ok := t.(*graphql.Object)
+	if !ok {
+		return 1, 1
+	}
+	cost, depth := q.selectionSet(obj, f.SelectionSet)
+	if isList {
+		cost *= q.listSize(parent, f)
+	}
+	return 1 + cost, 1 + depth
+}
+
+// listSize returns how many items the list field 'f' is expected to hold. Occurrences are counted from the range asked for.
+func (q *graphQLCost) listSize(parent *graphql.Object, f *ast.Field) int {
+	if parent.Name() != "Class" || f.Name.Value != "occurrences" {
+		return graphQLListSize
+	}
+	args := map[string]any{}
+	for _, arg := range f.Arguments {
+		switch v := arg.Value.(type) {
+		case *ast.StringValue:
+			args[arg.Name.Value] = v.Value
+		case *ast.Variable:
+			args[arg.Name.Value] = q.variables[v.Name.Value]
+		}
+	}
+	from, err := parseDateArg(args, "from")
+	if err != nil {
+		return 1
+	}
+	to, err := parseDateArg(args, "to")
+	if err != nil {
+		return 1
+	}
+	// Invalid ranges fail to resolve
+	days, err := occurrenceDays(from, to)
+	if err != nil {
+		return 1
+	}
+	return days
+}
+
+func (q *graphQLCost) typeCondition(parent *graphql.Object, cond *ast.Named) *graphql.Object {
+	if cond != nil {
+		if obj, ok := q.schema.Type(cond.Name.Value).(*graphql.Object); ok {
+			return obj
+		}
+	}
+	return parent
+}
+
+// prepareGraphQL parses and validates the request and checks that it is within the limits, returning the document to execute and its operation.
+func prepareGraphQL(schema *graphql.Schema, req *GraphQLRequest, maxComplexity uint) (*ast.Document, *ast.OperationDefinition, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		return nil, nil, gqlerrors.FormatErrors(err)
+	}
+	if res := graphql.ValidateDocument(schema, doc, nil); !res.IsValid {
+		return nil, nil, res.Errors
+	}
+
+	q := &graphQLCost{schema: schema, fragments: map[string]*ast.FragmentDefinition{}, variables: req.Variables}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			q.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if req.OperationName == "" || (def.Name != nil && def.Name.Value == req.OperationName) {
+				op = def
+			}
+		}
+	}
+	if op == nil {
+		// Reported by the executor
+		return doc, nil, nil
+	}
+	root := schema.QueryType()
+	if op.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+	cost, depth := q.selectionSet(root, op.SelectionSet)
+	if depth > maxGraphQLDepth {
+		return nil, nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError(fmt.Sprintf("Query is nested %d levels deep, which exceeds the limit of %d", depth, maxGraphQLDepth))}
+	}
+	if cost > int(maxComplexity) {
+		return nil, nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError(fmt.Sprintf("Query has a complexity of %d, which exceeds the limit of %d", cost, maxComplexity))}
+	}
+	return doc, op, nil
+}
+
+// @Summary Query classes and bookings with GraphQL
+// @Description Runs a GraphQL query or mutation over classes, their occurrences and remaining spots, bookings and members, e.g. '{ member(name: "John") { bookings { date occurrence { remaining } } } }'. The schema can be introspected.
+// @Description Queries nested more than 10 levels deep or estimated to cost more than GRAPHQL_MAX_COMPLEXITY are rejected. Every field costs 1, and the fields below a list cost as much again for each item it is expected to hold: 20 for classes and bookings, and the days in the range for occurrences.
+// @Description Queries can also be sent with GET, passing the fields of the body as query parameters, but mutations can only be sent with POST. Errors of fields have the HTTP status the REST API responds with in their extensions.
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param body body handler.GraphQLRequest true "Request body"
+// @Success 200 {object} handler.GraphQLResponse
+// @Failure 400 {object} handler.GraphQLResponse
+// @Failure 405 {object} handler.GraphQLResponse
+// @Failure 422 {object} response
+// @Router /graphql [post]
+func GraphQL(svc *Services, schema *graphql.Schema) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GraphQLRequest)
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+		if c.Request().Method == http.MethodGet {
+			if v := c.QueryParam("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid variables"})
+				}
+			}
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Query is required"})
+		}
+
+		doc, op, errs := prepareGraphQL(schema, req, svc.Config.GraphQLMaxComplexity)
+		if len(errs) > 0 {
+			return c.JSON(http.StatusBadRequest, GraphQLResponse{Errors: errs})
+		}
+		if op != nil && op.Operation != ast.OperationTypeQuery && c.Request().Method == http.MethodGet {
+			return c.JSON(http.StatusMethodNotAllowed, GraphQLResponse{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError("Mutations must be sent with POST")}})
+		}
+
+		res := graphql.Execute(graphql.ExecuteParams{
+			Schema:        *schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       withLoaders(c.Request().Context(), svc),
+		})
+		return c.JSON(http.StatusOK, GraphQLResponse{Data: res.Data, Errors: res.Errors})
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rohitxdev/abc-task/internal/pb"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys of the request ID and the bearer token, like the X-Request-Id and Authorization headers of the REST API
+const (
+	metadataRequestID     = "x-request-id"
+	metadataAuthorization = "authorization"
+)
+
+// NewGRPC returns the gRPC server of the class and booking services, with the health and reflection services registered, and the health server so that it can be told about shutdowns. Serve it alongside the REST API with Multiplex.
+func NewGRPC(svc *Services) (*grpc.Server, *health.Server) {
+	s := grpc.NewServer(grpc.UnaryInterceptor(withRPCActor(svc)))
+	pb.RegisterClassServiceServer(s, &classServer{svc: svc})
+	pb.RegisterBookingServiceServer(s, &bookingServer{svc: svc})
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+	return s, healthServer
+}
+
+// Multiplex serves gRPC requests with 'rpc' and all others with 'rest', so that both APIs share a port. gRPC needs HTTP/2, so without TLS the handler has to be wrapped with h2c.
+func Multiplex(rest http.Handler, rpc http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			rpc.ServeHTTP(w, r)
+			return
+		}
+		rest.ServeHTTP(w, r)
+	})
+}
+
+// withRPCActor finds out who made the call from the 'authorization' metadata and records the changes made by it as made by them in the audit log, like identify does for REST requests. The request ID is taken from the metadata of the call, or generated and sent back in the header.
+func withRPCActor(svc *Services) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var requestID, authorization string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(metadataRequestID); len(ids) > 0 {
+				requestID = ids[0]
+			}
+			if values := md.Get(metadataAuthorization); len(values) > 0 {
+				authorization = values[0]
+			}
+		}
+		if requestID == "" {
+			requestID = middleware.DefaultRequestIDConfig.Generator()
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, requestID)); err != nil {
+			return nil, err
+		}
+		p, err := identifyBearer(ctx, svc, authorization)
+		if err != nil {
+			return nil, rpcError(err)
+		}
+		if client, ok := peer.FromContext(ctx); ok {
+			p.ip = client.Addr.String()
+			if host, _, err := net.SplitHostPort(p.ip); err == nil {
+				p.ip = host
+			}
+		}
+		ctx = context.WithValue(ctx, principalKey{}, p)
+		return handler(repo.WithActor(ctx, p.actor(), requestID), req)
+	}
+}
+
+// requireStaff returns the status to report unless the call was made with the admin or front desk token.
+func requireStaff(ctx context.Context) error {
+	p := principalFrom(ctx)
+	switch {
+	case p.staff():
+		return nil
+	case p.role == "":
+		return status.Error(codes.Unauthenticated, "Missing or invalid token")
+	default:
+		return status.Error(codes.PermissionDenied, "Only staff may do this")
+	}
+}
+
+// requireMember returns the status to report unless the call was made with the access token of the member or a staff token.
+func requireMember(ctx context.Context, memberName string) error {
+	if err := principalFrom(ctx).authorize(memberName); err != nil {
+		code := codes.PermissionDenied
+		if err.Code == http.StatusUnauthorized {
+			code = codes.Unauthenticated
+		}
+		return status.Error(code, err.Message.(string))
+	}
+	return nil
+}
+
+// rpcCodes are the codes every kind of error of the service is reported with, matching the HTTP status of the REST API
+var rpcCodes = map[service.Kind]codes.Code{
+	service.KindInvalid:   codes.InvalidArgument,
+	service.KindNotFound:  codes.NotFound,
+	service.KindConflict:  codes.FailedPrecondition,
+	service.KindForbidden: codes.PermissionDenied,
+	service.KindGone:      codes.FailedPrecondition,
+	service.KindUpstream:  codes.Unavailable,
+}
+
+// rpcError returns the status an error of the service is reported with. Unknown errors are logged and reported as internal.
+func rpcError(err error) error {
+	var conflict *service.ScheduleConflictError
+	if errors.As(err, &conflict) {
+		return status.Error(codes.FailedPrecondition, conflict.Error())
+	}
+	var e *service.Error
+	if errors.As(err, &e) {
+		return status.Error(rpcCodes[e.Kind], e.Message)
+	}
+	slog.Error(err.Error())
+	return status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+}
+
+// invalidArgument returns the status of a request that fails validation.
+func invalidArgument(msg string) error {
+	return status.Error(codes.InvalidArgument, msg)
+}
+
+type classServer struct {
+	pb.UnimplementedClassServiceServer
+	svc *Services
+}
+
+func (s *classServer) CreateClass(ctx context.Context, in *pb.CreateClassRequest) (*pb.CreateClassResponse, error) {
+	req := &CreateClassRequest{
+		Name:                  in.Name,
+		StartDate:             in.StartDate,
+		EndDate:               in.EndDate,
+		StartTime:             in.StartTime,
+		DurationMinutes:       uint(in.DurationMinutes),
+		Capacity:              uint(in.Capacity),
+		FreeCancelHoursBefore: uint(in.FreeCancelHoursBefore),
+		InstructorID:          in.InstructorId,
+		RoomID:                in.RoomId,
+		Price:                 in.Price,
+	}
+	if w := in.BookingWindow; w != nil {
+		req.BookingWindow = &BookingWindowRequest{OpensDaysBefore: uint(w.OpensDaysBefore), OpensAt: w.OpensAt, ClosesMinutesBefore: uint(w.ClosesMinutesBefore)}
+	}
+	if err := validate.Struct(req); err != nil {
+		return nil, invalidArgument(err.Error())
+	}
+	class, err := s.svc.Service.CreateClass(ctx, req.newClass())
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pb.CreateClassResponse{Id: class.ID}, nil
+}
+
+func (s *classServer) GetClass(ctx context.Context, in *pb.GetClassRequest) (*pb.Class, error) {
+	class, err := s.svc.Service.GetClass(ctx, in.Id)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return newPBClass(class), nil
+}
+
+func (s *classServer) ListClasses(ctx context.Context, in *pb.ListClassesRequest) (*pb.ListClassesResponse, error) {
+	classes, err := s.svc.Service.GetClasses(ctx, in.LocationId)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	res := &pb.ListClassesResponse{Classes: make([]*pb.Class, 0, len(classes))}
+	for i := range classes {
+		res.Classes = append(res.Classes, newPBClass(&classes[i]))
+	}
+	return res, nil
+}
+
+func newPBClass(class *service.Class) *pb.Class {
+	res := &pb.Class{
+		Id:                    class.ID,
+		Name:                  class.Name,
+		StartDate:             class.StartDate.Format("2006-01-02"),
+		EndDate:               class.EndDate.Format("2006-01-02"),
+		StartTime:             formatTimeOfDay(uint(class.StartTime / time.Second)),
+		DurationMinutes:       uint32(class.Duration / time.Minute),
+		Capacity:              uint32(class.Capacity),
+		FreeCancelHoursBefore: uint32(class.FreeCancelBefore / time.Hour),
+		InstructorId:          class.InstructorID,
+		RoomId:                class.RoomID,
+		Price:                 class.Price,
+	}
+	if w := class.BookingWindow; w != nil {
+		res.BookingWindow = &pb.BookingWindow{
+			OpensDaysBefore:     uint32(w.OpensDaysBefore),
+			OpensAt:             formatTimeOfDay(uint(w.OpensAt / time.Second)),
+			ClosesMinutesBefore: uint32(w.ClosesBefore / time.Minute),
+		}
+	}
+	return res
+}
+
+type bookingServer struct {
+	pb.UnimplementedBookingServiceServer
+	svc *Services
+}
+
+func (s *bookingServer) CreateBooking(ctx context.Context, in *pb.CreateBookingRequest) (*pb.CreateBookingResponse, error) {
+	req := &CreateBookingRequest{MemberName: in.MemberName, Date: in.Date, ClassID: in.ClassId, MemberEmail: in.MemberEmail}
+	if err := validate.Struct(req); err != nil {
+		return nil, invalidArgument(err.Error())
+	}
+	if err := requireMember(ctx, req.MemberName); err != nil {
+		return nil, err
+	}
+	id, err := s.svc.Service.CreateBooking(ctx, req.newBooking())
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pb.CreateBookingResponse{Id: id}, nil
+}
+
+func (s *bookingServer) GetBooking(ctx context.Context, in *pb.GetBookingRequest) (*pb.Booking, error) {
+	booking, err := s.svc.Service.GetBooking(ctx, in.Id)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	if err = requireMember(ctx, booking.MemberName); err != nil {
+		return nil, err
+	}
+	return newPBBooking(booking), nil
+}
+
+func (s *bookingServer) GetRoster(ctx context.Context, in *pb.GetRosterRequest) (*pb.GetRosterResponse, error) {
+	if err := requireStaff(ctx); err != nil {
+		return nil, err
+	}
+	bookings, err := s.svc.Service.GetRoster(ctx, in.ClassId, in.Date)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	res := &pb.GetRosterResponse{Bookings: make([]*pb.Booking, 0, len(bookings))}
+	for i := range bookings {
+		res.Bookings = append(res.Bookings, newPBBooking(&bookings[i]))
+	}
+	return res, nil
+}
+
+// unixOrZero converts times that are zero when unset to UNIX timestamps that are zero when unset.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func newPBBooking(booking *service.Booking) *pb.Booking {
+	return &pb.Booking{
+		Id:            booking.ID,
+		ClassId:       booking.ClassID,
+		MemberName:    booking.MemberName,
+		Date:          booking.Date.Format("2006-01-02"),
+		Status:        string(booking.Status),
+		CreatedAt:     unixOrZero(booking.CreatedAt),
+		CheckedInAt:   unixOrZero(booking.CheckedInAt),
+		CancelledAt:   unixOrZero(booking.CancelledAt),
+		NoShowAt:      unixOrZero(booking.NoShowAt),
+		Amount:        booking.Amount,
+		HoldExpiresAt: unixOrZero(booking.HoldExpiresAt),
+	}
+}
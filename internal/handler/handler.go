@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 
@@ -8,8 +11,11 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/rohitxdev/abc-task/docs"
+	"github.com/rohitxdev/abc-task/internal/checkin"
 	"github.com/rohitxdev/abc-task/internal/config"
+	"github.com/rohitxdev/abc-task/internal/payment"
 	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
@@ -18,6 +24,12 @@ type response struct {
 	Message string `json:"message"`
 }
 
+// Response for requests that create a resource
+type createdResponse struct {
+	Message string `json:"message"`
+	ID      uint64 `json:"id"`
+}
+
 // bindAndValidate binds path params, query params and the request body into provided type `i` and validates provided `i`. `i` must be a pointer. The default binder binds body based on Content-Type header. Validator must be registered using `Echo#Validator`.
 func bindAndValidate(c echo.Context, i any) error {
 	var err error
@@ -34,6 +46,9 @@ func bindAndValidate(c echo.Context, i any) error {
 	return err
 }
 
+// Validates requests against the 'validate' tags of their fields
+var validate = validator.New()
+
 // Custom HTTP request validator
 type customValidator struct {
 	validator *validator.Validate
@@ -46,11 +61,75 @@ func (v customValidator) Validate(i any) error {
 	return nil
 }
 
+// serviceStatus is the HTTP status every kind of error of the service is reported with
+var serviceStatus = map[service.Kind]int{
+	service.KindInvalid:   http.StatusUnprocessableEntity,
+	service.KindNotFound:  http.StatusNotFound,
+	service.KindConflict:  http.StatusConflict,
+	service.KindForbidden: http.StatusForbidden,
+	service.KindGone:      http.StatusGone,
+	service.KindUpstream:  http.StatusBadGateway,
+}
+
+// serviceError responds with an error of the service. Schedule conflicts come with the clashing occurrences. Unknown errors are logged and reported as internal.
+func serviceError(c echo.Context, err error) error {
+	var conflict *service.ScheduleConflictError
+	if errors.As(err, &conflict) {
+		res := ScheduleConflictResponse{Message: conflict.Error(), Conflicts: make([]OccurrenceResponse, 0, len(conflict.Conflicts))}
+		for _, o := range conflict.Conflicts {
+			res.Conflicts = append(res.Conflicts, OccurrenceResponse{ClassID: o.ClassID, ClassName: o.ClassName, Start: o.Start, End: o.End})
+		}
+		return c.JSON(http.StatusConflict, res)
+	}
+	var e *service.Error
+	if errors.As(err, &e) {
+		return c.JSON(serviceStatus[e.Kind], response{Message: e.Message})
+	}
+	slog.Error(err.Error())
+	return echo.ErrInternalServerError
+}
+
 type Services struct {
 	Config *config.Config
 	Repo   *repo.Repo
+	// Signs and verifies check-in tokens
+	Tokens *checkin.Signer
+	// Collects drop-in payments
+	Payments payment.Provider
+	// Rules of classes and bookings, shared by all transports
+	Service *service.Service
 }
 
+// ipExtractor returns how the address of the client is found, which limits like MAX_STREAMS_PER_CLIENT rely on. X-Forwarded-For is only trusted from the proxies in 'trustedProxies', which are CIDRs, as clients could send any address in it otherwise.
+func ipExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description Bearer token configured through ADMIN_TOKEN, e.g. 'Bearer <token>'
+
+// @securityDefinitions.apikey FrontDeskToken
+// @in header
+// @name Authorization
+// @description Bearer token configured through FRONT_DESK_TOKEN or ADMIN_TOKEN, e.g. 'Bearer <token>'
+
+// @securityDefinitions.apikey MemberToken
+// @in header
+// @name Authorization
+// @description Bearer token issued to a member by an admin, e.g. 'Bearer <token>'. The admin and front desk tokens are accepted as well.
 func New(svc *Services) (*echo.Echo, error) {
 	docs.SwaggerInfo.Host = net.JoinHostPort(svc.Config.Host, svc.Config.Port)
 
@@ -58,19 +137,84 @@ func New(svc *Services) (*echo.Echo, error) {
 
 	e.HideBanner = true
 	e.HidePort = true
+	extractIP, err := ipExtractor(svc.Config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	e.IPExtractor = extractIP
 
 	e.Validator = customValidator{
-		validator: validator.New(),
+		validator: validate,
 	}
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		UnsafeWildcardOriginWithAllowCredentials: svc.Config.Env == "development",
 	}))
+	e.Use(middleware.RequestID(), identify(svc))
 
 	e.GET("/swagger/*", echoSwagger.EchoWrapHandler())
 
+	e.GET("/classes", GetClasses(svc))
+	e.GET("/classes/:id", GetClass(svc))
 	e.POST("/classes", CreateClass(svc))
+	e.POST("/classes/:id/check-in", CheckInMember(svc), frontDeskAuth(svc.Config.FrontDeskToken, svc.Config.AdminToken))
+	e.GET("/classes/:id/roster", GetRoster(svc), frontDeskAuth(svc.Config.FrontDeskToken, svc.Config.AdminToken))
+	e.GET("/classes/:id/calendar.ics", GetClassCalendar(svc))
+	e.GET("/classes/:id/availability/stream", StreamAvailability(svc))
+	e.GET("/instructors", GetInstructors(svc))
+	e.GET("/instructors/:id", GetInstructor(svc))
+	e.GET("/instructors/:id/schedule", GetInstructorSchedule(svc))
+	e.GET("/locations", GetLocations(svc))
+	e.GET("/locations/:id", GetLocation(svc))
+	e.GET("/locations/:id/rooms", GetRooms(svc))
+	e.GET("/plans", GetPlans(svc))
+	e.GET("/members/:name/subscriptions", GetSubscriptions(svc))
+	e.GET("/members/:name/bookings.ics", GetMemberCalendar(svc))
+	e.POST("/holds", CreateHold(svc))
+	e.POST("/holds/:id/confirm", ConfirmHold(svc))
 	e.POST("/bookings", CreateBooking(svc))
+	e.POST("/bookings/drop-in", CreateDropInBooking(svc))
+	e.DELETE("/bookings/:id", CancelBooking(svc))
+	e.POST("/bookings/:id/no-show", MarkNoShow(svc), frontDeskAuth(svc.Config.FrontDeskToken, svc.Config.AdminToken))
+	e.POST("/bookings/:id/check-in", CheckInBooking(svc), frontDeskAuth(svc.Config.FrontDeskToken, svc.Config.AdminToken))
+	e.GET("/bookings/:id/check-in-token", GetCheckInToken(svc))
+	e.GET("/bookings/:id/qr.png", GetCheckInQRCode(svc))
+	e.POST("/checkin", CheckInWithToken(svc), frontDeskAuth(svc.Config.FrontDeskToken, svc.Config.AdminToken))
+	e.POST("/payments/webhook", PaymentWebhook(svc), withActor(actorPaymentProvider))
+
+	schema, err := newGraphQLSchema(svc)
+	if err != nil {
+		return nil, err
+	}
+	e.GET("/graphql", GraphQL(svc, &schema))
+	e.POST("/graphql", GraphQL(svc, &schema))
+
+	e.GET("/front-desk/ws", FrontDeskSocket(svc), frontDeskSocketAuth(svc.Config.FrontDeskToken, svc.Config.AdminToken), withActor(actorFrontDesk))
+
+	admin := e.Group("/admin", adminAuth(svc.Config.AdminToken))
+	admin.POST("/plans", CreatePlan(svc))
+	admin.POST("/members/:name/subscriptions", CreateSubscription(svc))
+	admin.POST("/members/:name/penalties/waive", WaivePenalties(svc))
+	admin.POST("/members/:name/calendar-token", ResetCalendarToken(svc))
+	admin.POST("/members/:name/access-token", ResetAccessToken(svc))
+	admin.POST("/classes/import", ImportClasses(svc))
+	admin.PUT("/classes/:id/instructor", AssignInstructor(svc))
+	admin.POST("/instructors", CreateInstructor(svc))
+	admin.POST("/locations", CreateLocation(svc))
+	admin.POST("/locations/:id/rooms", CreateRoom(svc))
+	admin.GET("/exports/bookings", ExportBookings(svc))
+	admin.GET("/exports/classes", ExportClasses(svc))
+	admin.GET("/analytics/occupancy", GetOccupancy(svc))
+	admin.GET("/analytics/trend", GetOccupancyTrend(svc))
+	admin.GET("/analytics/heatmap", GetOccupancyHeatmap(svc))
+	admin.GET("/webhooks", GetWebhooks(svc))
+	admin.POST("/webhooks", CreateWebhook(svc))
+	admin.DELETE("/webhooks/:id", DeleteWebhook(svc))
+	admin.GET("/webhooks/:id/deliveries", GetWebhookDeliveries(svc))
+	admin.POST("/webhook-deliveries/:id/replay", ReplayWebhookDelivery(svc))
+	admin.GET("/outbox/dead", GetDeadOutboxMessages(svc))
+	admin.POST("/outbox/:id/retry", RetryOutboxMessage(svc))
+	admin.GET("/audit", GetAuditLog(svc))
 
 	return e, nil
 }
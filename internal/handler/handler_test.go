@@ -1,20 +1,45 @@
 package handler_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/rohitxdev/abc-task/internal/checkin"
 	"github.com/rohitxdev/abc-task/internal/config"
 	"github.com/rohitxdev/abc-task/internal/database"
 	"github.com/rohitxdev/abc-task/internal/handler"
+	"github.com/rohitxdev/abc-task/internal/outbox"
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/pb"
 	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
+	"github.com/rohitxdev/abc-task/internal/webhook"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type httpRequestOpts struct {
@@ -35,11 +60,15 @@ func createHttpRequest(opts *httpRequestOpts) (*http.Request, error) {
 		q.Set(key, value)
 	}
 	url.RawQuery = q.Encode()
-	j, err := json.Marshal(opts.body)
-	if err != nil {
-		return nil, err
+	var body io.Reader
+	if opts.body != nil {
+		j, err := json.Marshal(opts.body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(j)
 	}
-	req := httptest.NewRequest(opts.method, url.String(), bytes.NewReader(j))
+	req := httptest.NewRequest(opts.method, url.String(), body)
 	for key, value := range opts.headers {
 		req.Header.Set(key, value)
 	}
@@ -49,6 +78,11 @@ func createHttpRequest(opts *httpRequestOpts) (*http.Request, error) {
 func TestAPI(t *testing.T) {
 	cfg, err := config.Load()
 	assert.Nil(t, err)
+	cfg.AdminToken = "admin-token"
+	cfg.FrontDeskToken = "front-desk-token"
+	// Streams are kept open with heartbeats, which the tests wait for
+	cfg.StreamHeartbeat = 50 * time.Millisecond
+	cfg.PaymentWebhookSecret = "webhook-secret"
 
 	db, err := database.NewSQLite("test.db")
 	assert.Nil(t, err)
@@ -60,9 +94,26 @@ func TestAPI(t *testing.T) {
 	r, err := repo.New(db)
 	assert.Nil(t, err)
 
+	// Members need an active membership to book
+	plan := repo.Plan{Name: "Unlimited", Kind: repo.PlanKindUnlimited}
+	assert.Nil(t, r.CreatePlan(context.TODO(), &plan))
+	assert.Nil(t, r.CreateSubscription(context.TODO(), &repo.Subscription{MemberName: "Rohit", PlanID: plan.ID, StartDate: time.Now().Unix() - 24*60*60, EndDate: time.Now().Unix() + 365*24*60*60}))
+
+	tokens, err := checkin.NewSigner([]byte("checkin-secret"))
+	assert.Nil(t, err)
+
+	payments := payment.NewFake(cfg.PaymentWebhookSecret)
+	rules := service.New(r)
+	rules.Payments = payments
+	rules.HoldTTL = cfg.HoldTTL
+	rules.PaymentHold = cfg.PaymentHold
+	rules.Currency = cfg.Currency
 	svc := &handler.Services{
-		Config: cfg,
-		Repo:   r,
+		Config:   cfg,
+		Repo:     r,
+		Tokens:   tokens,
+		Payments: payments,
+		Service:  rules,
 	}
 
 	h, err := handler.New(svc)
@@ -113,6 +164,31 @@ func TestAPI(t *testing.T) {
 				}},
 				want: http.StatusUnprocessableEntity,
 			},
+			{name: "Invalid start time", args: args{
+				body: handler.CreateClassRequest{
+					Name:      "Yoga-5",
+					StartDate: time.Now().Add(time.Hour * 24).Format("2006-01-02"),
+					EndDate:   time.Now().Add(time.Hour * 24 * 2).Format("2006-01-02"),
+					StartTime: "25:00",
+					Capacity:  3,
+				}},
+				want: http.StatusUnprocessableEntity,
+			},
+			{name: "Valid request with booking window", args: args{
+				body: handler.CreateClassRequest{
+					Name:      "Yoga-6",
+					StartDate: time.Now().Add(time.Hour * 24 * 30).Format("2006-01-02"),
+					EndDate:   time.Now().Add(time.Hour * 24 * 40).Format("2006-01-02"),
+					StartTime: "18:30",
+					Capacity:  3,
+					BookingWindow: &handler.BookingWindowRequest{
+						OpensDaysBefore:     7,
+						OpensAt:             "08:00",
+						ClosesMinutesBefore: 60,
+					},
+				}},
+				want: http.StatusCreated,
+			},
 		}
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
@@ -134,17 +210,57 @@ func TestAPI(t *testing.T) {
 		}
 	})
 
+	t.Run("GET /classes/:id", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			id             string
+			want           int
+			bookingOpensAt bool
+		}{
+			{name: "Class without booking window", id: "1", want: http.StatusOK},
+			{name: "Class with booking window", id: "2", want: http.StatusOK, bookingOpensAt: true},
+			{name: "Class not found", id: "99", want: http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := createHttpRequest(&httpRequestOpts{
+					method: http.MethodGet,
+					path:   "/classes/" + tt.id,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				c := h.NewContext(req, res)
+				c.SetParamNames("id")
+				c.SetParamValues(tt.id)
+				err = handler.GetClass(svc)(c)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, res.Code)
+				if tt.want == http.StatusOK {
+					var class handler.ClassResponse
+					assert.Nil(t, json.NewDecoder(res.Body).Decode(&class))
+					assert.Equal(t, tt.bookingOpensAt, class.BookingOpensAt != nil)
+				}
+			})
+		}
+	})
+
 	t.Run("POST /bookings", func(t *testing.T) {
+		member, err := r.ResetAccessToken(context.TODO(), "Rohit")
+		assert.Nil(t, err)
+		other, err := r.ResetAccessToken(context.TODO(), "Someone")
+		assert.Nil(t, err)
 		type args struct {
 			body handler.CreateBookingRequest
 		}
 		tests := []struct {
-			name string
-			args args
-			want int
+			name  string
+			token string
+			args  args
+			want  int
 		}{
 			{
-				name: "Class not available on the given date",
+				name:  "Class not available on the given date",
+				token: member,
 				args: args{
 					body: handler.CreateBookingRequest{
 						ClassID:    1,
@@ -154,7 +270,7 @@ func TestAPI(t *testing.T) {
 				},
 				want: http.StatusUnprocessableEntity,
 			},
-			{name: "Date is in the past", args: args{
+			{name: "Date is in the past", token: member, args: args{
 				body: handler.CreateBookingRequest{
 					ClassID:    1,
 					MemberName: "Rohit",
@@ -162,23 +278,49 @@ func TestAPI(t *testing.T) {
 				}},
 				want: http.StatusUnprocessableEntity,
 			},
-			{name: "Class not found", args: args{
+			{name: "Booking not open yet", token: member, args: args{
 				body: handler.CreateBookingRequest{
 					ClassID:    2,
 					MemberName: "Rohit",
+					Date:       time.Now().Add(time.Hour * 24 * 30).Format("2006-01-02"),
+				}},
+				want: http.StatusUnprocessableEntity,
+			},
+			{name: "Class not found", token: member, args: args{
+				body: handler.CreateBookingRequest{
+					ClassID:    99,
+					MemberName: "Rohit",
 					Date:       time.Now().Add(time.Hour * 24).Format("2006-01-02"),
 				}},
 				want: http.StatusNotFound,
 			},
-			{name: "Valid request", args: args{
+			{name: "Valid request with email", token: member, args: args{
+				body: handler.CreateBookingRequest{
+					ClassID:     1,
+					MemberName:  "Rohit",
+					Date:        time.Now().Add(time.Hour * 24).Format("2006-01-02"),
+					MemberEmail: "rohit@example.com",
+				}},
+				want: http.StatusCreated,
+			},
+			{name: "Email of someone else without a token", args: args{
+				body: handler.CreateBookingRequest{
+					ClassID:     1,
+					MemberName:  "Rohit",
+					Date:        time.Now().Add(time.Hour * 24).Format("2006-01-02"),
+					MemberEmail: "someone@example.com",
+				}},
+				want: http.StatusUnauthorized,
+			},
+			{name: "Another member", token: other, args: args{
 				body: handler.CreateBookingRequest{
 					ClassID:    1,
 					MemberName: "Rohit",
 					Date:       time.Now().Add(time.Hour * 24).Format("2006-01-02"),
 				}},
-				want: http.StatusCreated,
+				want: http.StatusForbidden,
 			},
-			{name: "Valid request", args: args{
+			{name: "Valid request", token: member, args: args{
 				body: handler.CreateBookingRequest{
 					ClassID:    1,
 					MemberName: "Rohit",
@@ -186,7 +328,7 @@ func TestAPI(t *testing.T) {
 				}},
 				want: http.StatusCreated,
 			},
-			{name: "Valid request", args: args{
+			{name: "Valid request from staff", token: "front-desk-token", args: args{
 				body: handler.CreateBookingRequest{
 					ClassID:    1,
 					MemberName: "Rohit",
@@ -194,7 +336,7 @@ func TestAPI(t *testing.T) {
 				}},
 				want: http.StatusCreated,
 			},
-			{name: "Class is full", args: args{
+			{name: "Class is full", token: member, args: args{
 				body: handler.CreateBookingRequest{
 					ClassID:    1,
 					MemberName: "Rohit",
@@ -203,21 +345,1752 @@ func TestAPI(t *testing.T) {
 				want: http.StatusConflict,
 			},
 		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				headers := map[string]string{"Content-Type": "application/json"}
+				if tt.token != "" {
+					headers["Authorization"] = "Bearer " + tt.token
+				}
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  http.MethodPost,
+					path:    "/bookings",
+					body:    tt.args.body,
+					headers: headers,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				// Served through the router so that the caller is identified
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+		// Only the member or staff may book, and so replace the address once it is remembered
+		email, err := svc.Repo.GetMemberEmail(context.TODO(), "Rohit")
+		assert.Nil(t, err)
+		assert.Equal(t, "rohit@example.com", email)
+	})
+
+	t.Run("DELETE /bookings/:id", func(t *testing.T) {
+		// Booking 1 is Rohit's
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/admin/members/Rohit/access-token", nil))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		req := httptest.NewRequest(http.MethodPost, "/admin/members/Rohit/access-token", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		var member handler.AccessTokenResponse
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &member))
+		other, err := r.ResetAccessToken(context.TODO(), "Someone")
+		assert.Nil(t, err)
+
+		tests := []struct {
+			name  string
+			id    string
+			token string
+			want  int
+		}{
+			{name: "Missing token", id: "1", want: http.StatusUnauthorized},
+			{name: "Unknown token", id: "1", token: "guess", want: http.StatusUnauthorized},
+			{name: "Another member", id: "1", token: other, want: http.StatusForbidden},
+			{name: "Valid request", id: "1", token: member.Token, want: http.StatusOK},
+			{name: "Already cancelled", id: "1", token: "admin-token", want: http.StatusConflict},
+			{name: "Booking not found", id: "999", token: "front-desk-token", want: http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodDelete, "/bookings/"+tt.id, nil)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+	})
+
+	t.Run("POST /bookings/:id/no-show", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			headers map[string]string
+			want    int
+		}{
+			{name: "Missing token", want: http.StatusBadRequest},
+			{name: "Invalid token", headers: map[string]string{"Authorization": "Bearer guess"}, want: http.StatusUnauthorized},
+			{name: "Booking not found", headers: map[string]string{"Authorization": "Bearer front-desk-token"}, want: http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := createHttpRequest(&httpRequestOpts{method: http.MethodPost, path: "/bookings/999/no-show", headers: tt.headers})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+	})
+
+	t.Run("POST /bookings/:id/check-in", func(t *testing.T) {
+		tests := []struct {
+			name string
+			id   string
+			want int
+		}{
+			{name: "Cancelled booking", id: "1", want: http.StatusConflict},
+			{name: "Booking not found", id: "999", want: http.StatusNotFound},
+		}
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				req, err := createHttpRequest(&httpRequestOpts{
 					method: http.MethodPost,
-					path:   "/bookings",
-					body:   tt.args.body,
-					headers: map[string]string{
-						"Content-Type": "application/json",
-					},
+					path:   "/bookings/" + tt.id + "/check-in",
 				})
 				assert.Nil(t, err)
 				res := httptest.NewRecorder()
 				c := h.NewContext(req, res)
-				err = handler.CreateBooking(svc)(c)
+				c.SetParamNames("id")
+				c.SetParamValues(tt.id)
+				err = handler.CheckInBooking(svc)(c)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+	})
+
+	t.Run("POST /classes/:id/check-in", func(t *testing.T) {
+		req, err := createHttpRequest(&httpRequestOpts{
+			method: http.MethodPost,
+			path:   "/classes/1/check-in",
+			body: handler.CheckInMemberRequest{
+				MemberName: "Nobody",
+				Date:       time.Now().Add(time.Hour * 24).Format("2006-01-02"),
+			},
+			headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+		})
+		assert.Nil(t, err)
+		res := httptest.NewRecorder()
+		c := h.NewContext(req, res)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		err = handler.CheckInMember(svc)(c)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+
+	t.Run("GET /classes/:id/roster", func(t *testing.T) {
+		tomorrow := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+		tests := []struct {
+			name  string
+			id    string
+			date  string
+			token string
+			// Sent as the query parameter 'token', which only the front desk WebSocket accepts
+			query string
+			want  int
+			count int
+		}{
+			{name: "Valid request", id: "1", date: tomorrow, token: "front-desk-token", want: http.StatusOK, count: 3},
+			{name: "Admin token", id: "1", date: tomorrow, token: "admin-token", want: http.StatusOK, count: 3},
+			{name: "Missing token", id: "1", date: tomorrow, want: http.StatusBadRequest},
+			{name: "Invalid token", id: "1", date: tomorrow, token: "guess", want: http.StatusUnauthorized},
+			{name: "Token in the query", id: "1", date: tomorrow, query: "front-desk-token", want: http.StatusBadRequest},
+			{name: "Invalid date", id: "1", date: "tomorrow", token: "front-desk-token", want: http.StatusUnprocessableEntity},
+			{name: "Class not found", id: "99", date: time.Now().Format("2006-01-02"), token: "front-desk-token", want: http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				opts := &httpRequestOpts{
+					method: http.MethodGet,
+					path:   "/classes/" + tt.id + "/roster",
+					query:  map[string]string{"date": tt.date},
+				}
+				if tt.token != "" {
+					opts.headers = map[string]string{"Authorization": "Bearer " + tt.token}
+				}
+				if tt.query != "" {
+					opts.query["token"] = tt.query
+				}
+				req, err := createHttpRequest(opts)
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				// Served through the router so that the front desk middleware runs
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+				if tt.want == http.StatusOK {
+					var roster []handler.BookingResponse
+					assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &roster))
+					assert.Len(t, roster, tt.count)
+				}
+			})
+		}
+	})
+
+	var token string
+	// Bookings 1 and 2 are Rohit's
+	rohit, err := r.ResetAccessToken(context.TODO(), "Rohit")
+	assert.Nil(t, err)
+	someone, err := r.ResetAccessToken(context.TODO(), "Someone")
+	assert.Nil(t, err)
+	t.Run("GET /bookings/:id/check-in-token", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			id    string
+			token string
+			want  int
+		}{
+			{name: "Missing token", id: "2", want: http.StatusUnauthorized},
+			{name: "Another member", id: "2", token: someone, want: http.StatusForbidden},
+			{name: "Cancelled booking", id: "1", token: rohit, want: http.StatusConflict},
+			{name: "Booking not found", id: "999", token: rohit, want: http.StatusNotFound},
+			{name: "Admin token", id: "2", token: "admin-token", want: http.StatusOK},
+			{name: "Valid request", id: "2", token: rohit, want: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/bookings/"+tt.id+"/check-in-token", nil)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+				if tt.want == http.StatusOK {
+					var body handler.CheckInTokenResponse
+					assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &body))
+					token = body.Token
+				}
+			})
+		}
+	})
+
+	t.Run("GET /bookings/:id/qr.png", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/bookings/2/qr.png", nil))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/bookings/2/qr.png", nil)
+		req.Header.Set("Authorization", "Bearer "+rohit)
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "image/png", res.Header().Get("Content-Type"))
+	})
+
+	t.Run("POST /checkin", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			token     string
+			deskToken string
+			want      int
+		}{
+			{name: "Missing front desk token", token: token, want: http.StatusBadRequest},
+			{name: "Member token", token: token, deskToken: rohit, want: http.StatusUnauthorized},
+			{name: "Invalid token", token: "invalid", deskToken: "front-desk-token", want: http.StatusUnauthorized},
+			// The booking is for tomorrow
+			{name: "Not for today", token: token, deskToken: "front-desk-token", want: http.StatusConflict},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				headers := map[string]string{"Content-Type": "application/json"}
+				if tt.deskToken != "" {
+					headers["Authorization"] = "Bearer " + tt.deskToken
+				}
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  http.MethodPost,
+					path:    "/checkin",
+					body:    handler.CheckInWithTokenRequest{Token: tt.token},
+					headers: headers,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+	})
+
+	t.Run("Instructors", func(t *testing.T) {
+		start := time.Now().Add(time.Hour * 24 * 50).Format("2006-01-02")
+		end := time.Now().Add(time.Hour * 24 * 52).Format("2006-01-02")
+		class := func(name string, startTime string, instructorID uint64) handler.CreateClassRequest {
+			return handler.CreateClassRequest{Name: name, StartDate: start, EndDate: end, StartTime: startTime, Capacity: 3, InstructorID: instructorID}
+		}
+		tests := []struct {
+			name      string
+			method    string
+			path      string
+			query     map[string]string
+			body      any
+			token     string
+			want      int
+			conflicts int
+		}{
+			{name: "Create instructor without admin token", method: http.MethodPost, path: "/admin/instructors", body: handler.CreateInstructorRequest{Name: "Mallory"}, want: http.StatusBadRequest},
+			{name: "Create instructor", method: http.MethodPost, path: "/admin/instructors", body: handler.CreateInstructorRequest{Name: "Asha"}, token: "admin-token", want: http.StatusCreated},
+			{name: "Get instructor", method: http.MethodGet, path: "/instructors/1", want: http.StatusOK},
+			{name: "Instructor not found", method: http.MethodGet, path: "/instructors/99", want: http.StatusNotFound},
+			{name: "Create class with instructor", method: http.MethodPost, path: "/classes", body: class("Pilates-1", "09:00", 1), want: http.StatusCreated},
+			{name: "Create overlapping class", method: http.MethodPost, path: "/classes", body: class("Pilates-2", "09:30", 1), want: http.StatusConflict, conflicts: 3},
+			{name: "Create class with unknown instructor", method: http.MethodPost, path: "/classes", body: class("Pilates-3", "09:30", 99), want: http.StatusNotFound},
+			{name: "Create class without instructor", method: http.MethodPost, path: "/classes", body: class("Pilates-4", "09:30", 0), want: http.StatusCreated},
+			{name: "Assign instructor with the front desk token", method: http.MethodPut, path: "/admin/classes/4/instructor", body: handler.AssignInstructorRequest{InstructorID: 1}, token: "front-desk-token", want: http.StatusUnauthorized},
+			{name: "Assign overlapping class", method: http.MethodPut, path: "/admin/classes/4/instructor", body: handler.AssignInstructorRequest{InstructorID: 1}, token: "admin-token", want: http.StatusConflict, conflicts: 3},
+			{name: "Get schedule", method: http.MethodGet, path: "/instructors/1/schedule", query: map[string]string{"from": start, "to": start}, want: http.StatusOK},
+			{name: "Get schedule with invalid range", method: http.MethodGet, path: "/instructors/1/schedule", query: map[string]string{"from": end, "to": start}, want: http.StatusUnprocessableEntity},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				headers := map[string]string{"Content-Type": "application/json"}
+				if tt.token != "" {
+					headers["Authorization"] = "Bearer " + tt.token
+				}
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  tt.method,
+					path:    tt.path,
+					query:   tt.query,
+					body:    tt.body,
+					headers: headers,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+				if tt.conflicts > 0 {
+					var body handler.ScheduleConflictResponse
+					assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &body))
+					assert.Len(t, body.Conflicts, tt.conflicts)
+				}
+			})
+		}
+	})
+
+	t.Run("Locations", func(t *testing.T) {
+		start := time.Now().Add(time.Hour * 24 * 60).Format("2006-01-02")
+		class := func(name string, capacity uint, roomID uint64) handler.CreateClassRequest {
+			return handler.CreateClassRequest{Name: name, StartDate: start, EndDate: start, StartTime: "07:00", Capacity: capacity, RoomID: roomID}
+		}
+		tests := []struct {
+			name    string
+			method  string
+			path    string
+			query   map[string]string
+			body    any
+			token   string
+			want    int
+			classes int
+		}{
+			{name: "Create location without admin token", method: http.MethodPost, path: "/admin/locations", body: handler.CreateLocationRequest{Name: "Rogue", Timezone: "UTC", Address: "Nowhere"}, want: http.StatusBadRequest},
+			{name: "Create location", method: http.MethodPost, path: "/admin/locations", body: handler.CreateLocationRequest{Name: "Central", Timezone: "Europe/London", Address: "1 High Street"}, token: "admin-token", want: http.StatusCreated},
+			{name: "Create location with invalid time zone", method: http.MethodPost, path: "/admin/locations", body: handler.CreateLocationRequest{Name: "Nowhere", Timezone: "Mars/Olympus", Address: "Olympus Mons"}, token: "admin-token", want: http.StatusUnprocessableEntity},
+			{name: "Get location", method: http.MethodGet, path: "/locations/1", want: http.StatusOK},
+			{name: "Location not found", method: http.MethodGet, path: "/locations/99", want: http.StatusNotFound},
+			{name: "Create room with the front desk token", method: http.MethodPost, path: "/admin/locations/1/rooms", body: handler.CreateRoomRequest{Name: "Studio X", Capacity: 5}, token: "front-desk-token", want: http.StatusUnauthorized},
+			{name: "Create room", method: http.MethodPost, path: "/admin/locations/1/rooms", body: handler.CreateRoomRequest{Name: "Studio A", Capacity: 5}, token: "admin-token", want: http.StatusCreated},
+			{name: "Create room at unknown location", method: http.MethodPost, path: "/admin/locations/99/rooms", body: handler.CreateRoomRequest{Name: "Studio B", Capacity: 5}, token: "admin-token", want: http.StatusNotFound},
+			{name: "Get rooms", method: http.MethodGet, path: "/locations/1/rooms", want: http.StatusOK},
+			{name: "Create class over room capacity", method: http.MethodPost, path: "/classes", body: class("Spin-1", 6, 1), want: http.StatusUnprocessableEntity},
+			{name: "Create class in room", method: http.MethodPost, path: "/classes", body: class("Spin-1", 5, 1), want: http.StatusCreated},
+			{name: "Create overlapping class in room", method: http.MethodPost, path: "/classes", body: class("Spin-2", 5, 1), want: http.StatusConflict},
+			{name: "Create class in unknown room", method: http.MethodPost, path: "/classes", body: class("Spin-3", 5, 99), want: http.StatusNotFound},
+			{name: "Get classes at location", method: http.MethodGet, path: "/classes", query: map[string]string{"locationId": "1"}, want: http.StatusOK, classes: 1},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				headers := map[string]string{"Content-Type": "application/json"}
+				if tt.token != "" {
+					headers["Authorization"] = "Bearer " + tt.token
+				}
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  tt.method,
+					path:    tt.path,
+					query:   tt.query,
+					body:    tt.body,
+					headers: headers,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+				if tt.classes > 0 {
+					var classes []handler.ClassResponse
+					assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &classes))
+					assert.Len(t, classes, tt.classes)
+				}
+			})
+		}
+	})
+
+	t.Run("Memberships", func(t *testing.T) {
+		start := time.Now().Format("2006-01-02")
+		end := time.Now().Add(time.Hour * 24 * 30).Format("2006-01-02")
+		tomorrow := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+		member, err := r.ResetAccessToken(context.TODO(), "Pat")
+		assert.Nil(t, err)
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			body   any
+			token  string
+			want   int
+		}{
+			{name: "Create plan without admin token", method: http.MethodPost, path: "/admin/plans", body: handler.CreatePlanRequest{Name: "Free", Kind: repo.PlanKindUnlimited}, token: member, want: http.StatusUnauthorized},
+			{name: "Create weekly plan without limit", method: http.MethodPost, path: "/admin/plans", body: handler.CreatePlanRequest{Name: "Weekly", Kind: repo.PlanKindWeekly}, token: "admin-token", want: http.StatusUnprocessableEntity},
+			{name: "Create class pack", method: http.MethodPost, path: "/admin/plans", body: handler.CreatePlanRequest{Name: "1-class pack", Kind: repo.PlanKindPack, Credits: 1}, token: "admin-token", want: http.StatusCreated},
+			{name: "Get plans", method: http.MethodGet, path: "/plans", want: http.StatusOK},
+			{name: "Book without membership", method: http.MethodPost, path: "/bookings", body: handler.CreateBookingRequest{ClassID: 1, MemberName: "Pat", Date: tomorrow}, token: member, want: http.StatusForbidden},
+			{name: "Subscribe without admin token", method: http.MethodPost, path: "/admin/members/Pat/subscriptions", body: handler.CreateSubscriptionRequest{PlanID: 1, StartDate: start, EndDate: end}, token: member, want: http.StatusUnauthorized},
+			{name: "Subscribe to unknown plan", method: http.MethodPost, path: "/admin/members/Pat/subscriptions", body: handler.CreateSubscriptionRequest{PlanID: 99, StartDate: start, EndDate: end}, token: "admin-token", want: http.StatusNotFound},
+			{name: "Subscribe to class pack", method: http.MethodPost, path: "/admin/members/Pat/subscriptions", body: handler.CreateSubscriptionRequest{PlanID: 2, StartDate: start, EndDate: end}, token: "admin-token", want: http.StatusCreated},
+			{name: "Get subscriptions", method: http.MethodGet, path: "/members/Pat/subscriptions", want: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				headers := map[string]string{"Content-Type": "application/json"}
+				if tt.token != "" {
+					headers["Authorization"] = "Bearer " + tt.token
+				}
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  tt.method,
+					path:    tt.path,
+					body:    tt.body,
+					headers: headers,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+		plans, err := r.GetPlans(context.TODO())
+		assert.Nil(t, err)
+		for _, plan := range plans {
+			assert.NotEqual(t, "Free", plan.Name, "Plans are only created with the admin token")
+		}
+	})
+
+	t.Run("Drop-in payments", func(t *testing.T) {
+		tomorrow := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+		serve := func(method string, path string, body any, headers map[string]string) *httptest.ResponseRecorder {
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			headers["Content-Type"] = "application/json"
+			req, err := createHttpRequest(&httpRequestOpts{method: method, path: path, body: body, headers: headers})
+			assert.Nil(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res
+		}
+		// Guests have no access tokens, so the front desk books drop-ins for them
+		staff := func() map[string]string {
+			return map[string]string{"Authorization": "Bearer front-desk-token"}
+		}
+		webhook := func(eventType payment.EventType, paymentID string) int {
+			payload, signature := payments.Event(eventType, paymentID, time.Now())
+			req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewReader(payload))
+			req.Header.Set("Stripe-Signature", signature)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res.Code
+		}
+
+		res := serve(http.MethodPost, "/classes", handler.CreateClassRequest{Name: "Drop-in", StartDate: tomorrow, EndDate: tomorrow, StartTime: "23:00", Capacity: 1, Price: 1500}, nil)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var class struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &class))
+
+		res = serve(http.MethodPost, "/bookings/drop-in", handler.CreateBookingRequest{ClassID: 1, MemberName: "Guest", Date: tomorrow}, staff())
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code, "Class without a price")
+
+		res = serve(http.MethodPost, "/bookings/drop-in", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Guest", Date: tomorrow}, staff())
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var held handler.DropInBookingResponse
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &held))
+		assert.Equal(t, int64(1500), held.Amount)
+		assert.Equal(t, "usd", held.Currency)
+
+		res = serve(http.MethodPost, "/bookings/drop-in", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Guest-2", Date: tomorrow}, staff())
+		assert.Equal(t, http.StatusConflict, res.Code, "Spot is held")
+
+		res = serve(http.MethodPost, "/payments/webhook", map[string]string{"type": "payment_intent.succeeded"}, map[string]string{"Stripe-Signature": "t=1,v1=forged"})
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Equal(t, http.StatusOK, webhook("charge.refunded", held.PaymentID), "Unknown events are ignored")
+		assert.Equal(t, http.StatusOK, webhook(payment.EventPaymentSucceeded, held.PaymentID))
+		assert.Equal(t, http.StatusOK, webhook(payment.EventPaymentSucceeded, held.PaymentID), "Redelivered event")
+		booking, err := r.GetBooking(context.TODO(), held.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusBooked, booking.Status)
+
+		res = serve(http.MethodDelete, fmt.Sprintf("/bookings/%d", held.ID), nil, map[string]string{"Authorization": "Bearer admin-token"})
+		assert.Equal(t, http.StatusOK, res.Code)
+		// Refunded by the job only
+		assert.Equal(t, int64(0), payments.Refunded(held.PaymentID))
+		job, err := r.GetJob(context.TODO(), fmt.Sprintf("%s/%d", repo.JobKindRefund, held.ID))
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusPending, job.Status)
+
+		// A failed payment frees the spot, and a late success is refunded
+		res = serve(http.MethodPost, "/bookings/drop-in", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Guest-2", Date: tomorrow}, staff())
+		assert.Equal(t, http.StatusCreated, res.Code)
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &held))
+		assert.Equal(t, http.StatusOK, webhook(payment.EventPaymentFailed, held.PaymentID))
+		assert.Equal(t, http.StatusOK, webhook(payment.EventPaymentSucceeded, held.PaymentID))
+		assert.Equal(t, int64(1500), payments.Refunded(held.PaymentID))
+		res = serve(http.MethodPost, "/bookings/drop-in", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Guest-3", Date: tomorrow}, staff())
+		assert.Equal(t, http.StatusCreated, res.Code)
+	})
+
+	t.Run("Seat holds", func(t *testing.T) {
+		tomorrow := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			body   any
+			token  string
+			want   int
+		}{
+			{name: "Create class", method: http.MethodPost, path: "/classes", body: handler.CreateClassRequest{Name: "Held", StartDate: tomorrow, EndDate: tomorrow, StartTime: "22:00", Capacity: 1}, want: http.StatusCreated},
+			{name: "Hold without a token", method: http.MethodPost, path: "/holds", body: handler.CreateBookingRequest{ClassID: 0, MemberName: "Rohit", Date: tomorrow}, want: http.StatusUnauthorized},
+			{name: "Hold unknown class", method: http.MethodPost, path: "/holds", body: handler.CreateBookingRequest{ClassID: 999, MemberName: "Rohit", Date: tomorrow}, token: rohit, want: http.StatusNotFound},
+			{name: "Hold spot", method: http.MethodPost, path: "/holds", body: handler.CreateBookingRequest{ClassID: 0, MemberName: "Rohit", Date: tomorrow}, token: rohit, want: http.StatusCreated},
+			{name: "Book held spot", method: http.MethodPost, path: "/bookings", body: handler.CreateBookingRequest{ClassID: 0, MemberName: "Rohit", Date: tomorrow}, token: rohit, want: http.StatusConflict},
+			{name: "Confirm hold without a token", method: http.MethodPost, path: "/holds/%d/confirm", want: http.StatusUnauthorized},
+			{name: "Confirm hold of someone else", method: http.MethodPost, path: "/holds/%d/confirm", token: someone, want: http.StatusForbidden},
+			{name: "Confirm hold", method: http.MethodPost, path: "/holds/%d/confirm", token: rohit, want: http.StatusCreated},
+			{name: "Confirm hold again", method: http.MethodPost, path: "/holds/%d/confirm", token: rohit, want: http.StatusNotFound},
+		}
+		var classID, holdID uint64
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if body, ok := tt.body.(handler.CreateBookingRequest); ok && body.ClassID == 0 {
+					body.ClassID = classID
+					tt.body = body
+				}
+				if strings.Contains(tt.path, "%d") {
+					tt.path = fmt.Sprintf(tt.path, holdID)
+				}
+				headers := map[string]string{"Content-Type": "application/json"}
+				if tt.token != "" {
+					headers["Authorization"] = "Bearer " + tt.token
+				}
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  tt.method,
+					path:    tt.path,
+					body:    tt.body,
+					headers: headers,
+				})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+				if res.Code == http.StatusCreated {
+					var created struct{ ID uint64 }
+					assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &created))
+					switch tt.path {
+					case "/classes":
+						classID = created.ID
+					case "/holds":
+						holdID = created.ID
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		dispatcher := webhook.NewDispatcher(r)
+		relay := outbox.NewRelay(r, &outbox.WebhookSink{Dispatcher: dispatcher})
+		// Events of earlier tests are published before there is a webhook to deliver them to
+		_, err := relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		var received []webhook.Event
+		var secret string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Nil(t, webhook.Verify(secret, body, r.Header.Get(webhook.HeaderSignature), time.Now(), time.Minute))
+			var event webhook.Event
+			assert.Nil(t, json.Unmarshal(body, &event))
+			received = append(received, event)
+		}))
+		defer srv.Close()
+		admin := map[string]string{"Authorization": "Bearer admin-token", "Content-Type": "application/json"}
+		serve := func(method string, path string, body any) *httptest.ResponseRecorder {
+			req, err := createHttpRequest(&httpRequestOpts{method: method, path: path, body: body, headers: admin})
+			assert.Nil(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res
+		}
+
+		res := serve(http.MethodPost, "/admin/webhooks", handler.CreateWebhookRequest{URL: srv.URL, Events: []webhook.EventType{"booking.exploded"}})
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+		res = serve(http.MethodPost, "/admin/webhooks", handler.CreateWebhookRequest{URL: srv.URL, Events: []webhook.EventType{webhook.EventBookingCreated, webhook.EventClassFull}})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var created handler.CreateWebhookResponse
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &created))
+		assert.NotEmpty(t, created.Secret)
+		secret = created.Secret
+		res = serve(http.MethodGet, "/admin/webhooks", nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.NotContains(t, res.Body.String(), secret)
+
+		// Booking the only spot announces both the booking and the class being full
+		tomorrow := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+		res = serve(http.MethodPost, "/classes", handler.CreateClassRequest{Name: "Announced", StartDate: tomorrow, EndDate: tomorrow, StartTime: "21:00", Capacity: 1})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var class struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &class))
+		res = serve(http.MethodPost, "/bookings", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Rohit", Date: tomorrow})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		n, err := relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 3, n, "class.created, booking.created and class.full")
+		n, err = dispatcher.Deliver(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+		assert.Len(t, received, 2)
+		assert.Equal(t, webhook.EventBookingCreated, received[0].Type)
+		assert.Equal(t, webhook.EventClassFull, received[1].Type)
+
+		res = serve(http.MethodGet, fmt.Sprintf("/admin/webhooks/%d/deliveries", created.ID), nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		var deliveries []handler.WebhookDeliveryResponse
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &deliveries))
+		assert.Len(t, deliveries, 2)
+		assert.Equal(t, repo.WebhookDeliveryStatusDelivered, deliveries[0].Status)
+		assert.Len(t, deliveries[0].Attempts, 1)
+
+		res = serve(http.MethodPost, fmt.Sprintf("/admin/webhook-deliveries/%d/replay", deliveries[1].ID), nil)
+		assert.Equal(t, http.StatusAccepted, res.Code)
+		_, err = dispatcher.Deliver(context.TODO())
+		assert.Nil(t, err)
+		assert.Len(t, received, 3)
+		assert.Equal(t, received[0].ID, received[2].ID, "Replays resend the same event")
+		res = serve(http.MethodPost, "/admin/webhook-deliveries/999/replay", nil)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+
+		res = serve(http.MethodDelete, fmt.Sprintf("/admin/webhooks/%d", created.ID), nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		res = serve(http.MethodGet, fmt.Sprintf("/admin/webhooks/%d/deliveries", created.ID), nil)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+
+	t.Run("Calendars", func(t *testing.T) {
+		serve := func(method string, path string, body any, headers map[string]string) *httptest.ResponseRecorder {
+			req, err := createHttpRequest(&httpRequestOpts{method: method, path: path, body: body, headers: headers})
+			assert.Nil(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res
+		}
+		headers := map[string]string{"Content-Type": "application/json"}
+		admin := map[string]string{"Authorization": "Bearer admin-token"}
+		// event returns the VEVENT with the UID in the feed
+		event := func(feed string, uid string) string {
+			for _, e := range strings.Split(feed, "BEGIN:VEVENT\r\n")[1:] {
+				if strings.Contains(e, "UID:"+uid+"\r\n") {
+					return e
+				}
+			}
+			return ""
+		}
+
+		tomorrow := time.Now().Add(time.Hour * 24).Format("2006-01-02")
+		dayAfter := time.Now().Add(time.Hour * 24 * 2).Format("2006-01-02")
+		res := serve(http.MethodPost, "/classes", handler.CreateClassRequest{Name: "Calendar, Yoga", StartDate: tomorrow, EndDate: dayAfter, StartTime: "20:30", DurationMinutes: 60, Capacity: 2}, headers)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var class struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &class))
+
+		res = serve(http.MethodGet, fmt.Sprintf("/classes/%d/calendar.ics", class.ID), nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "text/calendar; charset=utf-8", res.Header().Get("Content-Type"))
+		e := event(res.Body.String(), fmt.Sprintf("class-%d@abc-task", class.ID))
+		assert.Contains(t, e, "SUMMARY:Calendar\\, Yoga\r\n")
+		assert.Contains(t, e, "DTSTART:"+strings.ReplaceAll(tomorrow, "-", "")+"T203000Z\r\n")
+		assert.Contains(t, e, "DTEND:"+strings.ReplaceAll(tomorrow, "-", "")+"T213000Z\r\n")
+		assert.Contains(t, e, "RRULE:FREQ=DAILY;UNTIL="+strings.ReplaceAll(dayAfter, "-", "")+"T203000Z\r\n")
+		assert.Contains(t, e, "SEQUENCE:0\r\n")
+		res = serve(http.MethodGet, "/classes/999/calendar.ics", nil, nil)
+		assert.Equal(t, http.StatusNotFound, res.Code)
+
+		res = serve(http.MethodPost, "/bookings", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Rohit", Date: tomorrow}, map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + rohit})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var booking struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &booking))
+		uid := fmt.Sprintf("booking-%d@abc-task", booking.ID)
+
+		res = serve(http.MethodGet, "/members/Rohit/bookings.ics", nil, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+		res = serve(http.MethodGet, "/members/Rohit/bookings.ics?token=guess", nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		res = serve(http.MethodPost, "/admin/members/Rohit/calendar-token", nil, nil)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		res = serve(http.MethodPost, "/admin/members/Rohit/calendar-token", nil, admin)
+		assert.Equal(t, http.StatusOK, res.Code)
+		var token handler.CalendarTokenResponse
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &token))
+		feedURL, err := url.Parse(token.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, "/members/Rohit/bookings.ics", feedURL.Path)
+		assert.Equal(t, token.Token, feedURL.Query().Get("token"))
+
+		res = serve(http.MethodGet, feedURL.RequestURI(), nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		e = event(res.Body.String(), uid)
+		assert.Contains(t, e, "SEQUENCE:0\r\n")
+		assert.Contains(t, e, "STATUS:CONFIRMED\r\n")
+		res = serve(http.MethodGet, fmt.Sprintf("/members/Someone/bookings.ics?token=%s", token.Token), nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code, "Tokens only open the feed of their member")
+
+		// Cancelled bookings stay in the feed so that subscribed calendars drop them
+		res = serve(http.MethodDelete, fmt.Sprintf("/bookings/%d", booking.ID), nil, admin)
+		assert.Equal(t, http.StatusOK, res.Code)
+		res = serve(http.MethodGet, feedURL.RequestURI(), nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		e = event(res.Body.String(), uid)
+		assert.Contains(t, e, "SEQUENCE:1\r\n")
+		assert.Contains(t, e, "STATUS:CANCELLED\r\n")
+
+		res = serve(http.MethodPost, "/admin/members/Rohit/calendar-token", nil, admin)
+		assert.Equal(t, http.StatusOK, res.Code)
+		res = serve(http.MethodGet, feedURL.RequestURI(), nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code, "Issuing a new token revokes the old one")
+	})
+
+	t.Run("POST /admin/classes/import", func(t *testing.T) {
+		// Monday at least a week from now
+		monday := time.Now().UTC().AddDate(0, 0, 7)
+		monday = monday.AddDate(0, 0, (8-int(monday.Weekday()))%7)
+		day := func(offset int) string {
+			return monday.AddDate(0, 0, offset).Format("2006-01-02")
+		}
+		compact := func(offset int) string {
+			return monday.AddDate(0, 0, offset).Format("20060102")
+		}
+		valid := "name,startDate,endDate,capacity,startTime,recurrence\n" +
+			"Imported Pilates," + day(0) + "," + day(13) + ",5,07:00,\"FREQ=WEEKLY;BYDAY=MO,WE\"\n" +
+			"\"Imported Yoga, daily\"," + day(0) + "," + day(2) + ",10,,\n"
+		tests := []struct {
+			name        string
+			query       string
+			contentType string
+			body        string
+			want        int
+			wantClasses int
+			wantErrors  []handler.ImportRowError
+		}{
+			{name: "Unknown format", contentType: "application/json", body: "{}", want: http.StatusUnsupportedMediaType},
+			{name: "Dry run", query: "dryRun=true", contentType: "text/csv", body: valid, want: http.StatusOK, wantClasses: 5},
+			{name: "Unknown column", contentType: "text/csv", body: "name,startDate,endDate,capacity,colour\n", want: http.StatusUnprocessableEntity, wantErrors: []handler.ImportRowError{
+				{Line: 1, Message: `Unknown column "colour", columns must be one of name, startDate, endDate, startTime, durationMinutes, capacity, freeCancelHoursBefore, instructorId, roomId, price, recurrence`},
+			}},
+			{name: "Invalid rows", query: "format=csv", body: "name,startDate,endDate,capacity,instructorId,recurrence\n" +
+				"Valid," + day(0) + "," + day(0) + ",5,,\n" +
+				"Past,2020-01-01,2020-01-02,5,,\n" +
+				"Backwards," + day(2) + "," + day(0) + ",5,,\n" +
+				"No teacher," + day(0) + "," + day(0) + ",5,999,\n" +
+				"Monthly," + day(0) + "," + day(0) + ",5,,FREQ=MONTHLY\n" +
+				"Crowded," + day(0) + "," + day(0) + ",lots,,\n",
+				want: http.StatusUnprocessableEntity, wantClasses: 3, wantErrors: []handler.ImportRowError{
+					{Line: 3, Message: "Start date cannot be in the past"},
+					{Line: 4, Message: "End date cannot be before start date"},
+					{Line: 5, Message: "Instructor not found"},
+					{Line: 6, Message: `Unsupported recurrence frequency "MONTHLY", only DAILY and WEEKLY are supported`},
+					{Line: 7, Message: `Invalid value "lots" for capacity`},
+				}},
+			{name: "Import", contentType: "text/csv", body: valid, want: http.StatusCreated, wantClasses: 5},
+			{name: "iCalendar", query: "capacity=8", contentType: "text/calendar; charset=utf-8", body: "BEGIN:VCALENDAR\r\n" +
+				"BEGIN:VEVENT\r\nSUMMARY:Imported Spin\r\nDTSTART:" + compact(1) + "T180000Z\r\nDURATION:PT45M\r\nRRULE:FREQ=WEEKLY;COUNT=2\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nSUMMARY:Imported Boxing\r\nDTSTART:" + compact(1) + "T190000Z\r\nDTEND:" + compact(1) + "T200000Z\r\nX-CAPACITY:12\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nSUMMARY:Cancelled\r\nDTSTART:" + compact(1) + "T200000Z\r\nSTATUS:CANCELLED\r\nEND:VEVENT\r\n" +
+				"END:VCALENDAR\r\n", want: http.StatusCreated, wantClasses: 3},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				before, err := r.GetClasses(context.TODO(), repo.ClassFilter{})
+				assert.Nil(t, err)
+				req := httptest.NewRequest(http.MethodPost, "/admin/classes/import?"+tt.query, strings.NewReader(tt.body))
+				req.Header.Set("Authorization", "Bearer admin-token")
+				if tt.contentType != "" {
+					req.Header.Set("Content-Type", tt.contentType)
+				}
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code, res.Body.String())
+				after, err := r.GetClasses(context.TODO(), repo.ClassFilter{})
+				assert.Nil(t, err)
+				if tt.want != http.StatusCreated {
+					assert.Len(t, after, len(before), "Nothing is created")
+				}
+				if res.Code == http.StatusUnsupportedMediaType {
+					return
+				}
+				var body handler.ImportClassesResponse
+				assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &body))
+				assert.Equal(t, tt.wantClasses, body.Classes)
+				if tt.wantErrors == nil {
+					tt.wantErrors = []handler.ImportRowError{}
+				}
+				assert.Equal(t, tt.wantErrors, body.Errors)
+				if tt.want == http.StatusCreated {
+					assert.Len(t, body.IDs, tt.wantClasses)
+					assert.Len(t, after, len(before)+tt.wantClasses)
+				} else {
+					assert.Empty(t, body.IDs)
+				}
+			})
+		}
+
+		// The weekly class is created for every occurrence, and the daily one as a single class
+		classes, err := r.GetClasses(context.TODO(), repo.ClassFilter{})
+		assert.Nil(t, err)
+		var pilates, yoga []repo.Class
+		for _, class := range classes {
+			switch class.Name {
+			case "Imported Pilates":
+				pilates = append(pilates, class)
+			case "Imported Yoga, daily":
+				yoga = append(yoga, class)
+			}
+		}
+		if assert.Len(t, pilates, 4) {
+			for i, offset := range []int{0, 2, 7, 9} {
+				assert.Equal(t, day(offset), time.Unix(pilates[i].StartDate, 0).UTC().Format("2006-01-02"))
+				assert.Equal(t, pilates[i].StartDate, pilates[i].EndDate)
+				assert.Equal(t, uint(7*60*60), pilates[i].StartTime)
+			}
+		}
+		if assert.Len(t, yoga, 1) {
+			assert.Equal(t, day(2), time.Unix(yoga[0].EndDate, 0).UTC().Format("2006-01-02"))
+		}
+	})
+
+	t.Run("Exports", func(t *testing.T) {
+		date := time.Now().UTC().AddDate(0, 0, 60).Format("2006-01-02")
+		class := handler.CreateClassRequest{Name: "Exported, Yoga", StartDate: date, EndDate: date, StartTime: "06:15", DurationMinutes: 45, Capacity: 3}
+		req, err := createHttpRequest(&httpRequestOpts{method: http.MethodPost, path: "/classes", body: class, headers: map[string]string{"Content-Type": "application/json"}})
+		assert.Nil(t, err)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var created struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &created))
+		bookingID, err := r.CreateBooking(context.TODO(), created.ID, "Rohit", time.Now().UTC().AddDate(0, 0, 60).Truncate(24*time.Hour).Unix(), nil)
+		assert.Nil(t, err)
+		classID := fmt.Sprint(created.ID)
+
+		tests := []struct {
+			name     string
+			path     string
+			query    map[string]string
+			headers  map[string]string
+			want     int
+			wantType string
+			wantBody string
+		}{
+			{name: "Missing token", path: "/admin/exports/bookings", want: http.StatusBadRequest},
+			{name: "Bookings as CSV by default", path: "/admin/exports/bookings", query: map[string]string{"classId": classID}, want: http.StatusOK, wantType: "text/csv; charset=utf-8",
+				wantBody: "id,classId,className,date,startTime,durationMinutes,instructorId,roomId,memberName,status,createdAt,checkedInAt,cancelledAt,noShowAt,subscriptionId,paymentId,amount,refundedAmount\n" +
+					fmt.Sprintf("%d,%s,\"Exported, Yoga\",%s,06:15,45,0,0,Rohit,booked,", bookingID, classID, date)},
+			{name: "Bookings as NDJSON", path: "/admin/exports/bookings", query: map[string]string{"classId": classID}, headers: map[string]string{"Accept": "application/x-ndjson"}, want: http.StatusOK, wantType: "application/x-ndjson; charset=utf-8",
+				wantBody: fmt.Sprintf(`{"id":%d,"classId":%s,"className":"Exported, Yoga","date":"%s","startTime":"06:15","durationMinutes":45,`, bookingID, classID, date)},
+			{name: "No bookings in range", path: "/admin/exports/bookings", query: map[string]string{"classId": classID, "to": "2020-01-01"}, headers: map[string]string{"Accept": "application/x-ndjson"}, want: http.StatusOK, wantType: "application/x-ndjson; charset=utf-8"},
+			{name: "Classes", path: "/admin/exports/classes", query: map[string]string{"from": date, "to": date, "classId": classID}, headers: map[string]string{"Accept": "text/csv, */*;q=0.1"}, want: http.StatusOK, wantType: "text/csv; charset=utf-8",
+				wantBody: "id,name,startDate,endDate,startTime,durationMinutes,capacity,freeCancelHoursBefore,instructorId,roomId,price\n" +
+					fmt.Sprintf("%s,\"Exported, Yoga\",%s,%s,06:15,45,3,", classID, date, date)},
+			{name: "Unsupported format", path: "/admin/exports/classes", headers: map[string]string{"Accept": "application/xml"}, want: http.StatusNotAcceptable},
+			{name: "Invalid date", path: "/admin/exports/classes", query: map[string]string{"from": "01/01/2026"}, want: http.StatusUnprocessableEntity},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				headers := map[string]string{"Authorization": "Bearer admin-token"}
+				if tt.want == http.StatusBadRequest {
+					headers = map[string]string{}
+				}
+				for key, value := range tt.headers {
+					headers[key] = value
+				}
+				req, err := createHttpRequest(&httpRequestOpts{method: http.MethodGet, path: tt.path, query: tt.query, headers: headers})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code, res.Body.String())
+				if tt.want != http.StatusOK {
+					return
+				}
+				assert.Equal(t, tt.wantType, res.Header().Get("Content-Type"))
+				assert.Contains(t, res.Header().Get("Content-Disposition"), "attachment")
+				if tt.wantBody == "" {
+					assert.Empty(t, res.Body.String())
+					return
+				}
+				assert.True(t, strings.HasPrefix(res.Body.String(), tt.wantBody), res.Body.String())
+				assert.Equal(t, 1, strings.Count(res.Body.String(), "Exported, Yoga"), "Only the filtered rows are exported")
+			})
+		}
+	})
+
+	t.Run("Analytics", func(t *testing.T) {
+		date := time.Now().UTC().AddDate(0, 0, 3).Format("2006-01-02")
+		serve := func(method string, path string, body any, headers map[string]string) *httptest.ResponseRecorder {
+			req, err := createHttpRequest(&httpRequestOpts{method: method, path: path, body: body, headers: headers})
+			assert.Nil(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res
+		}
+		headers := map[string]string{"Content-Type": "application/json"}
+		res := serve(http.MethodPost, "/classes", handler.CreateClassRequest{Name: "Analytics Spin", StartDate: date, EndDate: date, StartTime: "07:30", DurationMinutes: 45, Capacity: 1}, headers)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var class struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &class))
+		res = serve(http.MethodPost, "/bookings", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Rohit", Date: date}, map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + rohit})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		res = serve(http.MethodPost, "/bookings", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Someone", Date: date}, map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + someone})
+		assert.Equal(t, http.StatusConflict, res.Code)
+
+		stats := handler.OccupancyStatsResponse{Occurrences: 1, Capacity: 1, Booked: 1, FullOccurrences: 1, FullRejections: 1, FillRate: 1}
+		query := fmt.Sprintf("from=%s&to=%s&classId=%d", date, date, class.ID)
+		admin := map[string]string{"Authorization": "Bearer admin-token"}
+		tests := []struct {
+			name    string
+			path    string
+			headers map[string]string
+			want    int
+			wantRes any
+		}{
+			{name: "Missing token", path: "/admin/analytics/occupancy", want: http.StatusBadRequest},
+			{name: "Occupancy", path: "/admin/analytics/occupancy?" + query, headers: admin, want: http.StatusOK, wantRes: &handler.OccupancyResponse{From: date, To: date, Totals: stats, Classes: []handler.ClassOccupancyResponse{
+				{ClassID: class.ID, ClassName: "Analytics Spin", ClassCapacity: 1, OccupancyStatsResponse: stats},
+			}}},
+			{name: "Trend", path: "/admin/analytics/trend?" + query, headers: admin, want: http.StatusOK, wantRes: &handler.OccupancyTrendResponse{From: date, To: date, Period: "day", Periods: []handler.PeriodOccupancyResponse{
+				{Start: date, OccupancyStatsResponse: stats},
+			}}},
+			{name: "Heatmap", path: "/admin/analytics/heatmap?" + query, headers: admin, want: http.StatusOK, wantRes: &handler.OccupancyHeatmapResponse{From: date, To: date, Hours: []handler.HourOccupancyResponse{
+				{Weekday: time.Now().UTC().AddDate(0, 0, 3).Weekday().String(), Hour: 7, OccupancyStatsResponse: stats},
+			}}},
+			{name: "Empty range", path: "/admin/analytics/occupancy?from=2020-01-01&to=2020-01-02", headers: admin, want: http.StatusOK, wantRes: &handler.OccupancyResponse{From: "2020-01-01", To: "2020-01-02", Classes: []handler.ClassOccupancyResponse{}}},
+			{name: "Unknown period", path: "/admin/analytics/trend?period=month", headers: admin, want: http.StatusUnprocessableEntity},
+			{name: "Backwards range", path: "/admin/analytics/heatmap?from=2026-02-01&to=2026-01-01", headers: admin, want: http.StatusUnprocessableEntity},
+			{name: "Range too long", path: "/admin/analytics/occupancy?from=2025-01-01&to=2026-01-02", headers: admin, want: http.StatusUnprocessableEntity},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := serve(http.MethodGet, tt.path, nil, tt.headers)
+				assert.Equal(t, tt.want, res.Code, res.Body.String())
+				if tt.wantRes == nil {
+					return
+				}
+				got := reflect.New(reflect.TypeOf(tt.wantRes).Elem()).Interface()
+				assert.Nil(t, json.Unmarshal(res.Body.Bytes(), got))
+				assert.Equal(t, tt.wantRes, got)
+			})
+		}
+	})
+
+	t.Run("GET /admin/audit", func(t *testing.T) {
+		date := time.Now().UTC().AddDate(0, 0, 4).Format("2006-01-02")
+		req, err := createHttpRequest(&httpRequestOpts{method: http.MethodPost, path: "/classes", body: handler.CreateClassRequest{Name: "Audited Spin", StartDate: date, EndDate: date, Capacity: 2}, headers: map[string]string{"Content-Type": "application/json", "X-Request-Id": "audit-request"}})
+		assert.Nil(t, err)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		assert.Equal(t, "audit-request", res.Header().Get("X-Request-Id"))
+		var class struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &class))
+
+		// Held by the front desk and by a member with their access token
+		for requestID, headers := range map[string]map[string]string{
+			"audit-front-desk": {"Content-Type": "application/json", "X-Request-Id": "audit-front-desk", "Authorization": "Bearer front-desk-token"},
+			"audit-member":     {"Content-Type": "application/json", "X-Request-Id": "audit-member", "Authorization": "Bearer " + rohit},
+		} {
+			req, err = createHttpRequest(&httpRequestOpts{method: http.MethodPost, path: "/holds", body: handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Rohit", Date: date}, headers: headers})
+			assert.Nil(t, err)
+			res = httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusCreated, res.Code, requestID)
+		}
+
+		req, err = createHttpRequest(&httpRequestOpts{method: http.MethodPost, path: "/admin/members/Audited/calendar-token", headers: map[string]string{"Authorization": "Bearer admin-token"}})
+		assert.Nil(t, err)
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		// Generated when the client sends none
+		requestID := res.Header().Get("X-Request-Id")
+		assert.NotEmpty(t, requestID)
+
+		admin := map[string]string{"Authorization": "Bearer admin-token"}
+		tests := []struct {
+			name    string
+			query   map[string]string
+			headers map[string]string
+			want    int
+			check   func(t *testing.T, entries []handler.AuditEntryResponse)
+		}{
+			{name: "Missing token", want: http.StatusBadRequest},
+			{name: "Wrong token", headers: map[string]string{"Authorization": "Bearer wrong"}, want: http.StatusUnauthorized},
+			{name: "By request", query: map[string]string{"requestId": "audit-request"}, headers: admin, want: http.StatusOK, check: func(t *testing.T, entries []handler.AuditEntryResponse) {
+				if assert.Len(t, entries, 1) {
+					e := entries[0]
+					assert.Equal(t, "anonymous (ip 192.0.2.1)", e.Actor)
+					assert.Equal(t, repo.AuditActionCreate, e.Action)
+					assert.Equal(t, repo.AuditEntityClass, e.Entity)
+					assert.Equal(t, fmt.Sprint(class.ID), e.EntityID)
+					assert.JSONEq(t, "null", string(e.Before))
+					assert.Contains(t, string(e.After), `"Name":"Audited Spin"`)
+				}
+			}},
+			{name: "By actor", query: map[string]string{"actor": "admin", "entity": "member", "entityId": "Audited"}, headers: admin, want: http.StatusOK, check: func(t *testing.T, entries []handler.AuditEntryResponse) {
+				if assert.Len(t, entries, 1) {
+					assert.Equal(t, requestID, entries[0].RequestID)
+					// The token itself is not recorded
+					assert.JSONEq(t, `{"CalendarToken":"[redacted]"}`, string(entries[0].After))
+				}
+			}},
+			{name: "Front desk acting for a member", query: map[string]string{"requestId": "audit-front-desk"}, headers: admin, want: http.StatusOK, check: func(t *testing.T, entries []handler.AuditEntryResponse) {
+				if assert.Len(t, entries, 1) {
+					assert.Equal(t, "front-desk", entries[0].Actor)
+				}
+			}},
+			{name: "Member", query: map[string]string{"actor": "member:Rohit", "requestId": "audit-member"}, headers: admin, want: http.StatusOK, check: func(t *testing.T, entries []handler.AuditEntryResponse) {
+				assert.Len(t, entries, 1)
+			}},
+			{name: "Limit", query: map[string]string{"limit": "1"}, headers: admin, want: http.StatusOK, check: func(t *testing.T, entries []handler.AuditEntryResponse) {
+				assert.Len(t, entries, 1)
+			}},
+			{name: "Date range", query: map[string]string{"from": "2020-01-01", "to": "2020-01-02"}, headers: admin, want: http.StatusOK, check: func(t *testing.T, entries []handler.AuditEntryResponse) {
+				assert.Empty(t, entries)
+			}},
+			{name: "Unknown action", query: map[string]string{"action": "read"}, headers: admin, want: http.StatusUnprocessableEntity},
+			{name: "Limit too high", query: map[string]string{"limit": "1001"}, headers: admin, want: http.StatusUnprocessableEntity},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := createHttpRequest(&httpRequestOpts{method: http.MethodGet, path: "/admin/audit", query: tt.query, headers: tt.headers})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code, res.Body.String())
+				if tt.check == nil {
+					return
+				}
+				var entries []handler.AuditEntryResponse
+				assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &entries))
+				tt.check(t, entries)
+			})
+		}
+	})
+
+	t.Run("GET /classes/:id/availability/stream", func(t *testing.T) {
+		date := time.Now().UTC().AddDate(0, 0, 5).Format("2006-01-02")
+		// Sent with the front desk token, which may book for any member
+		serve := func(method string, path string, body any) *httptest.ResponseRecorder {
+			req, err := createHttpRequest(&httpRequestOpts{method: method, path: path, body: body, headers: map[string]string{"Content-Type": "application/json", "Authorization": "Bearer front-desk-token"}})
+			assert.Nil(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res
+		}
+		res := serve(http.MethodPost, "/classes", handler.CreateClassRequest{Name: "Streamed Spin", StartDate: date, EndDate: date, Capacity: 3})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var class struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &class))
+		path := fmt.Sprintf("/classes/%d/availability/stream", class.ID)
+
+		// Streamed over HTTP/2 without TLS like in production
+		srv := httptest.NewServer(h2c.NewHandler(h, &http2.Server{}))
+		defer srv.Close()
+		client := &http.Client{Transport: &http2.Transport{AllowHTTP: true, DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}}}
+
+		type sseEvent struct {
+			id, event, data string
+			comment         bool
+		}
+		open := func(t *testing.T, path string, lastEventID string) (*http.Response, func() sseEvent) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			t.Cleanup(cancel)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+			assert.Nil(t, err)
+			if lastEventID != "" {
+				req.Header.Set(handler.HeaderLastEventID, lastEventID)
+			}
+			res, err := client.Do(req)
+			if !assert.Nil(t, err) {
+				t.FailNow()
+			}
+			t.Cleanup(func() { res.Body.Close() })
+			assert.Equal(t, 2, res.ProtoMajor)
+			lines := bufio.NewReader(res.Body)
+			// next returns the next event or comment, skipping the retry field
+			next := func() sseEvent {
+				var e sseEvent
+				for {
+					line, err := lines.ReadString('\n')
+					if !assert.Nil(t, err) {
+						t.FailNow()
+					}
+					line = strings.TrimSuffix(line, "\n")
+					switch {
+					case line == "":
+						if e != (sseEvent{}) {
+							return e
+						}
+					case strings.HasPrefix(line, ":"):
+						e.comment = true
+					case strings.HasPrefix(line, "id: "):
+						e.id = strings.TrimPrefix(line, "id: ")
+					case strings.HasPrefix(line, "event: "):
+						e.event = strings.TrimPrefix(line, "event: ")
+					case strings.HasPrefix(line, "data: "):
+						e.data = strings.TrimPrefix(line, "data: ")
+					}
+				}
+			}
+			return res, next
+		}
+		// nextEvent skips heartbeats
+		nextEvent := func(next func() sseEvent) sseEvent {
+			for {
+				if e := next(); !e.comment {
+					return e
+				}
+			}
+		}
+		spots := func(remaining uint) string {
+			b, _ := json.Marshal([]handler.OccurrenceAvailabilityResponse{{Date: date, Capacity: 3, Taken: 3 - remaining, Remaining: remaining}})
+			return string(b)
+		}
+
+		res1, next := open(t, path, "")
+		assert.Equal(t, http.StatusOK, res1.StatusCode)
+		assert.Equal(t, handler.MIMETextEventStream, res1.Header.Get("Content-Type"))
+		first := nextEvent(next)
+		assert.Equal(t, "availability", first.event)
+		assert.Equal(t, spots(3), first.data)
+		// Kept open with heartbeats
+		assert.True(t, next().comment)
+
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/bookings", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Rohit", Date: date}).Code)
+		booked := nextEvent(next)
+		assert.Equal(t, spots(2), booked.data)
+		assert.NotEqual(t, first.id, booked.id)
+
+		// Reconnecting sends only what changed since the last event received
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/holds", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Someone", Date: date}).Code)
+		assert.Equal(t, spots(1), nextEvent(next).data)
+		_, resumed := open(t, path, booked.id)
+		assert.Equal(t, spots(1), nextEvent(resumed).data)
+		// Unknown IDs start over
+		_, restarted := open(t, path, "1-1")
+		assert.Equal(t, spots(1), nextEvent(restarted).data)
+
+		// Changes of other classes are left out
+		res = serve(http.MethodPost, "/classes", handler.CreateClassRequest{Name: "Other Spin", StartDate: date, EndDate: date, Capacity: 3})
+		assert.Equal(t, http.StatusCreated, res.Code)
+		var other struct{ ID uint64 }
+		assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &other))
+		_, filtered := open(t, path+"?from="+date+"&to="+date, "")
+		assert.Equal(t, spots(1), nextEvent(filtered).data)
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/holds", handler.CreateBookingRequest{ClassID: other.ID, MemberName: "Someone", Date: date}).Code)
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/holds", handler.CreateBookingRequest{ClassID: class.ID, MemberName: "Someone Else", Date: date}).Code)
+		assert.Equal(t, spots(0), nextEvent(filtered).data)
+
+		tests := []struct {
+			name string
+			path string
+			want int
+		}{
+			{name: "Unknown class", path: "/classes/999999/availability/stream", want: http.StatusNotFound},
+			{name: "Backwards range", path: path + "?from=2026-02-01&to=2026-01-01", want: http.StatusUnprocessableEntity},
+			{name: "Range too long", path: path + "?from=2026-01-01&to=2027-01-02", want: http.StatusUnprocessableEntity},
+			// Five streams are open, which is as many as a client may have
+			{name: "Too many streams", path: path, want: http.StatusTooManyRequests},
+		}
+		fifth, _ := open(t, path, "")
+		assert.Equal(t, http.StatusOK, fifth.StatusCode)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res, _ := open(t, tt.path, "")
+				assert.Equal(t, tt.want, res.StatusCode)
+			})
+		}
+
+		// Clients can't get around the limit by claiming another address, as no proxies are trusted
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		spoofed, err := client.Do(req)
+		assert.Nil(t, err)
+		spoofed.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, spoofed.StatusCode)
+	})
+
+	t.Run("GET /front-desk/ws", func(t *testing.T) {
+		// Sent with the front desk token, which may book for any member
+		serve := func(method string, path string, body any) *httptest.ResponseRecorder {
+			req, err := createHttpRequest(&httpRequestOpts{method: method, path: path, body: body, headers: map[string]string{"Content-Type": "application/json", "Authorization": "Bearer front-desk-token"}})
+			assert.Nil(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			return res
+		}
+		created := func(res *httptest.ResponseRecorder) uint64 {
+			assert.Equal(t, http.StatusCreated, res.Code)
+			var body struct{ ID uint64 }
+			assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &body))
+			return body.ID
+		}
+		// Starts soon enough to check in right away
+		start := time.Now().UTC().Add(30 * time.Minute)
+		date := start.Format("2006-01-02")
+		frontDesk := repo.Location{Name: "Front Desk", Timezone: "UTC", Address: "2 High Street"}
+		assert.Nil(t, r.CreateLocation(context.TODO(), &frontDesk))
+		room := repo.Room{LocationID: frontDesk.ID, Name: "Front Studio", Capacity: 5}
+		assert.Nil(t, r.CreateRoom(context.TODO(), &room))
+		locationID, roomID := frontDesk.ID, room.ID
+		// Created in the repo as the API only takes classes starting tomorrow or later
+		day := start.Truncate(24 * time.Hour)
+		class := repo.Class{Name: "Front Desk Yoga", StartDate: day.Unix(), EndDate: day.Unix(), StartTime: uint(start.Sub(day).Seconds()), Duration: 60 * 60, Capacity: 5, RoomID: roomID}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		other := repo.Class{Name: "Elsewhere Yoga", StartDate: day.Unix(), EndDate: day.Unix(), StartTime: class.StartTime, Duration: 60 * 60, Capacity: 5}
+		assert.Nil(t, r.CreateClass(context.TODO(), &other))
+		classID, otherID := class.ID, other.ID
+
+		srv := httptest.NewServer(h2c.NewHandler(h, &http2.Server{}))
+		defer srv.Close()
+		wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/front-desk/ws"
+
+		tests := []struct {
+			name    string
+			headers map[string]string
+			query   string
+			want    int
+		}{
+			{name: "Missing token", headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, want: http.StatusBadRequest},
+			{name: "Invalid token", headers: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, query: "?token=wrong", want: http.StatusUnauthorized},
+			{name: "Not a WebSocket", headers: map[string]string{"Authorization": "Bearer front-desk-token"}, want: http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := createHttpRequest(&httpRequestOpts{method: http.MethodGet, path: "/front-desk/ws" + tt.query, headers: tt.headers})
+				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				assert.Equal(t, tt.want, res.Code)
+			})
+		}
+
+		dial := func(t *testing.T, query string, headers map[string]string) *websocket.Conn {
+			config, err := websocket.NewConfig(wsURL+query, srv.URL)
+			assert.Nil(t, err)
+			for key, value := range headers {
+				config.Header.Set(key, value)
+			}
+			ws, err := websocket.DialConfig(config)
+			if !assert.Nil(t, err) {
+				t.FailNow()
+			}
+			t.Cleanup(func() { ws.Close() })
+			return ws
+		}
+		// next returns the next message other than a ping
+		next := func(t *testing.T, ws *websocket.Conn) handler.FrontDeskMessage {
+			assert.Nil(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+			for {
+				var msg handler.FrontDeskMessage
+				if !assert.Nil(t, websocket.JSON.Receive(ws, &msg)) {
+					t.FailNow()
+				}
+				if msg.Type != handler.FrontDeskPing {
+					return msg
+				}
+			}
+		}
+		send := func(t *testing.T, ws *websocket.Conn, cmd handler.FrontDeskCommand) handler.FrontDeskMessage {
+			assert.Nil(t, websocket.JSON.Send(ws, cmd))
+			return next(t, ws)
+		}
+
+		// The admin token works too
+		admin := dial(t, "", map[string]string{"Authorization": "Bearer admin-token"})
+		assert.Equal(t, handler.FrontDeskMessage{Type: handler.FrontDeskResult, ReplyTo: "1", Topics: []string{fmt.Sprintf("class:%d", otherID)}}, send(t, admin, handler.FrontDeskCommand{ID: "1", Type: handler.FrontDeskSubscribe, Topics: []string{fmt.Sprintf("class:%d", otherID)}}))
+		admin.Close()
+
+		ws := dial(t, "?token=front-desk-token", nil)
+		location := fmt.Sprintf("location:%d", locationID)
+		commands := []struct {
+			name string
+			cmd  handler.FrontDeskCommand
+			want handler.FrontDeskMessage
+		}{
+			{name: "Subscribe", cmd: handler.FrontDeskCommand{ID: "1", Type: handler.FrontDeskSubscribe, Topics: []string{location, "class:999999"}}, want: handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "1", Error: "Class not found"}},
+			{name: "Subscribe to location", cmd: handler.FrontDeskCommand{ID: "2", Type: handler.FrontDeskSubscribe, Topics: []string{location}}, want: handler.FrontDeskMessage{Type: handler.FrontDeskResult, ReplyTo: "2", Topics: []string{location}}},
+			{name: "Unknown location", cmd: handler.FrontDeskCommand{ID: "3", Type: handler.FrontDeskSubscribe, Topics: []string{"location:999999"}}, want: handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "3", Error: "Location not found"}},
+			{name: "Invalid topic", cmd: handler.FrontDeskCommand{ID: "4", Type: handler.FrontDeskSubscribe, Topics: []string{"room:1"}}, want: handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "4", Error: "Invalid topic 'room:1', expected class:<id> or location:<id>"}},
+			{name: "Unknown type", cmd: handler.FrontDeskCommand{ID: "5", Type: "shout"}, want: handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "5", Error: "Unknown message type 'shout'"}},
+			{name: "Check in without booking", cmd: handler.FrontDeskCommand{ID: "6", Type: handler.FrontDeskCheckIn, ClassID: classID, MemberName: "Nobody", Date: date}, want: handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "6", Error: "No active booking found"}},
+			{name: "Check in with invalid date", cmd: handler.FrontDeskCommand{ID: "7", Type: handler.FrontDeskCheckIn, ClassID: classID, MemberName: "Rohit", Date: "tomorrow"}, want: handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "7", Error: "Invalid date format"}},
+		}
+		for _, tt := range commands {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.want, send(t, ws, tt.cmd))
+			})
+		}
+		_, err := ws.Write([]byte("{"))
+		assert.Nil(t, err)
+		assert.Equal(t, handler.FrontDeskMessage{Type: handler.FrontDeskError, Error: "Invalid message"}, next(t, ws))
+
+		// Changes of classes at other locations are left out
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/holds", handler.CreateBookingRequest{ClassID: otherID, MemberName: "Someone", Date: date}).Code)
+		bookingID := created(serve(http.MethodPost, "/bookings", handler.CreateBookingRequest{ClassID: classID, MemberName: "Rohit", Date: date}))
+		assert.Equal(t, handler.FrontDeskMessage{Type: handler.FrontDeskEvent, Topic: location, Event: &handler.FrontDeskEventBody{Type: repo.ChangeBooked, ClassID: classID, Date: date, BookingID: bookingID, MemberName: "Rohit"}}, next(t, ws))
+
+		// The check-in is both replied to and sent as an event, in either order
+		assert.Nil(t, websocket.JSON.Send(ws, handler.FrontDeskCommand{ID: "8", Type: handler.FrontDeskCheckIn, ClassID: classID, MemberName: "Rohit", Date: date}))
+		got := []handler.FrontDeskMessage{next(t, ws), next(t, ws)}
+		assert.ElementsMatch(t, []handler.FrontDeskMessage{
+			{Type: handler.FrontDeskResult, ReplyTo: "8", BookingID: bookingID},
+			{Type: handler.FrontDeskEvent, Topic: location, Event: &handler.FrontDeskEventBody{Type: repo.ChangeCheckedIn, ClassID: classID, Date: date, BookingID: bookingID, MemberName: "Rohit"}},
+		}, got)
+		assert.Equal(t, handler.FrontDeskMessage{Type: handler.FrontDeskError, ReplyTo: "9", Error: "Check-in is not open for the class"}, send(t, ws, handler.FrontDeskCommand{ID: "9", Type: handler.FrontDeskCheckIn, BookingID: bookingID}))
+		entries, err := r.GetAuditLog(context.TODO(), repo.AuditFilter{Entity: repo.AuditEntityBooking, EntityID: fmt.Sprint(bookingID), Action: repo.AuditActionUpdate, Actor: "front-desk", Limit: 10})
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+
+		assert.Equal(t, handler.FrontDeskMessage{Type: handler.FrontDeskResult, ReplyTo: "10"}, send(t, ws, handler.FrontDeskCommand{ID: "10", Type: handler.FrontDeskUnsubscribe, Topics: []string{location}}))
+		assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/holds", handler.CreateBookingRequest{ClassID: classID, MemberName: "Someone", Date: date}).Code)
+		assert.Equal(t, handler.FrontDeskMessage{Type: handler.FrontDeskResult, ReplyTo: "11", Topics: []string{fmt.Sprintf("class:%d", otherID)}}, send(t, ws, handler.FrontDeskCommand{ID: "11", Type: handler.FrontDeskSubscribe, Topics: []string{fmt.Sprintf("class:%d", otherID)}}))
+
+		t.Run("Slow client", func(t *testing.T) {
+			slow := dial(t, "?token=front-desk-token", nil)
+			assert.Equal(t, handler.FrontDeskResult, send(t, slow, handler.FrontDeskCommand{ID: "1", Type: handler.FrontDeskSubscribe, Topics: []string{fmt.Sprintf("class:%d", otherID)}}).Type)
+			// More than the connection buffers while the client isn't reading
+			const published = 20000
+			name := strings.Repeat("x", 1000)
+			for i := 0; i < published; i++ {
+				r.Availability.Publish(repo.OccurrenceChange{Type: repo.ChangeHeld, ClassID: otherID, MemberName: name})
+			}
+			received := 0
+			assert.Nil(t, slow.SetReadDeadline(time.Now().Add(10*time.Second)))
+			for {
+				var msg handler.FrontDeskMessage
+				if err := websocket.JSON.Receive(slow, &msg); err != nil {
+					assert.Equal(t, io.EOF, err)
+					break
+				}
+				if msg.Type == handler.FrontDeskEvent {
+					received++
+				}
+			}
+			// The connection was closed instead of buffering everything
+			assert.Less(t, received, published)
+		})
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		rpc, healthServer := handler.NewGRPC(svc)
+		srv := httptest.NewServer(h2c.NewHandler(handler.Multiplex(h, rpc), &http2.Server{}))
+		defer srv.Close()
+		conn, err := grpc.NewClient(strings.TrimPrefix(srv.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer conn.Close()
+		classes := pb.NewClassServiceClient(conn)
+		bookings := pb.NewBookingServiceClient(conn)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// REST requests are still served on the same port
+		res, err := http.Get(srv.URL + "/classes")
+		assert.Nil(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		date := time.Now().UTC().AddDate(0, 0, 6).Format("2006-01-02")
+		in := &pb.CreateClassRequest{Name: "gRPC Pilates", StartDate: date, EndDate: date, StartTime: "08:00", DurationMinutes: 45, Capacity: 1, BookingWindow: &pb.BookingWindow{OpensDaysBefore: 7, OpensAt: "06:00"}, Price: 1200}
+		var header metadata.MD
+		created, err := classes.CreateClass(metadata.AppendToOutgoingContext(ctx, "x-request-id", "grpc-1"), in, grpc.Header(&header))
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"grpc-1"}, header.Get("x-request-id"))
+		entries, err := r.GetAuditLog(context.TODO(), repo.AuditFilter{RequestID: "grpc-1", Limit: 10})
+		assert.Nil(t, err)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, "anonymous (ip 127.0.0.1)", entries[0].Actor)
+		}
+
+		class, err := classes.GetClass(ctx, &pb.GetClassRequest{Id: created.Id})
+		assert.Nil(t, err)
+		assert.Equal(t, "gRPC Pilates", class.Name)
+		assert.Equal(t, date, class.StartDate)
+		assert.Equal(t, "08:00", class.StartTime)
+		assert.Equal(t, uint32(45), class.DurationMinutes)
+		assert.Equal(t, "06:00", class.BookingWindow.OpensAt)
+		list, err := classes.ListClasses(ctx, &pb.ListClassesRequest{})
+		assert.Nil(t, err)
+		listed := false
+		for _, c := range list.Classes {
+			listed = listed || proto.Equal(class, c)
+		}
+		assert.True(t, listed)
+		open, err := classes.CreateClass(ctx, &pb.CreateClassRequest{Name: "gRPC Barre", StartDate: date, EndDate: date, Capacity: 5})
+		assert.Nil(t, err)
+
+		asRohit := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+rohit)
+		asFrontDesk := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer front-desk-token")
+		booked, err := bookings.CreateBooking(asRohit, &pb.CreateBookingRequest{MemberName: "Rohit", Date: date, ClassId: created.Id})
+		assert.Nil(t, err)
+		booking, err := bookings.GetBooking(asRohit, &pb.GetBookingRequest{Id: booked.Id})
+		assert.Nil(t, err)
+		assert.Equal(t, string(repo.BookingStatusBooked), booking.Status)
+		assert.Equal(t, date, booking.Date)
+		roster, err := bookings.GetRoster(asFrontDesk, &pb.GetRosterRequest{ClassId: created.Id, Date: date})
+		assert.Nil(t, err)
+		assert.Equal(t, []uint64{booked.Id}, []uint64{roster.Bookings[0].Id})
+
+		tests := []struct {
+			name     string
+			call     func() error
+			wantCode codes.Code
+			wantMsg  string
+		}{
+			{name: "Class is full", call: func() error {
+				_, err := bookings.CreateBooking(asRohit, &pb.CreateBookingRequest{MemberName: "Rohit", Date: date, ClassId: created.Id})
+				return err
+			}, wantCode: codes.FailedPrecondition, wantMsg: "Class is full"},
+			{name: "Book without a token", call: func() error {
+				_, err := bookings.CreateBooking(ctx, &pb.CreateBookingRequest{MemberName: "Rohit", Date: date, ClassId: open.Id})
+				return err
+			}, wantCode: codes.Unauthenticated, wantMsg: "Missing or invalid token"},
+			{name: "Book for someone else", call: func() error {
+				_, err := bookings.CreateBooking(asRohit, &pb.CreateBookingRequest{MemberName: "Someone", Date: date, ClassId: open.Id})
+				return err
+			}, wantCode: codes.PermissionDenied, wantMsg: "Only the member or staff may do this"},
+			{name: "Date in the past", call: func() error {
+				_, err := bookings.CreateBooking(asRohit, &pb.CreateBookingRequest{MemberName: "Rohit", Date: "2020-01-01", ClassId: created.Id})
+				return err
+			}, wantCode: codes.InvalidArgument, wantMsg: "Date cannot be in the past"},
+			{name: "No membership", call: func() error {
+				_, err := bookings.CreateBooking(asFrontDesk, &pb.CreateBookingRequest{MemberName: "Nobody", Date: date, ClassId: open.Id})
+				return err
+			}, wantCode: codes.PermissionDenied, wantMsg: "Member has no active membership on the given date"},
+			{name: "Missing member name", call: func() error {
+				_, err := bookings.CreateBooking(ctx, &pb.CreateBookingRequest{Date: date, ClassId: created.Id})
+				return err
+			}, wantCode: codes.InvalidArgument, wantMsg: "Key: 'CreateBookingRequest.MemberName' Error:Field validation for 'MemberName' failed on the 'required' tag"},
+			{name: "Class in the past", call: func() error {
+				_, err := classes.CreateClass(ctx, &pb.CreateClassRequest{Name: "Old", StartDate: "2020-01-01", EndDate: date, Capacity: 1})
+				return err
+			}, wantCode: codes.InvalidArgument, wantMsg: "Start date cannot be in the past"},
+			{name: "Unknown room", call: func() error {
+				_, err := classes.CreateClass(ctx, &pb.CreateClassRequest{Name: "Nowhere", StartDate: date, EndDate: date, Capacity: 1, RoomId: 999999})
+				return err
+			}, wantCode: codes.NotFound, wantMsg: "Room not found"},
+			{name: "Unknown class", call: func() error {
+				_, err := classes.GetClass(ctx, &pb.GetClassRequest{Id: 999999})
+				return err
+			}, wantCode: codes.NotFound, wantMsg: "Class not found"},
+			{name: "Unknown booking", call: func() error {
+				_, err := bookings.GetBooking(ctx, &pb.GetBookingRequest{Id: 999999})
+				return err
+			}, wantCode: codes.NotFound, wantMsg: "Booking not found"},
+			{name: "Booking without a token", call: func() error {
+				_, err := bookings.GetBooking(ctx, &pb.GetBookingRequest{Id: booked.Id})
+				return err
+			}, wantCode: codes.Unauthenticated, wantMsg: "Missing or invalid token"},
+			{name: "Booking of someone else", call: func() error {
+				_, err := bookings.GetBooking(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+someone), &pb.GetBookingRequest{Id: booked.Id})
+				return err
+			}, wantCode: codes.PermissionDenied, wantMsg: "Only the member or staff may do this"},
+			{name: "Roster without a token", call: func() error {
+				_, err := bookings.GetRoster(ctx, &pb.GetRosterRequest{ClassId: created.Id, Date: date})
+				return err
+			}, wantCode: codes.Unauthenticated, wantMsg: "Missing or invalid token"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				st, _ := status.FromError(tt.call())
+				assert.Equal(t, tt.wantCode, st.Code())
+				assert.Equal(t, tt.wantMsg, st.Message())
+			})
+		}
+
+		t.Run("Health", func(t *testing.T) {
+			client := healthpb.NewHealthClient(conn)
+			res, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			assert.Nil(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+			healthServer.Shutdown()
+			res, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+			assert.Nil(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, res.Status)
+		})
+
+		t.Run("Reflection", func(t *testing.T) {
+			stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+			assert.Nil(t, err)
+			assert.Nil(t, stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}))
+			res, err := stream.Recv()
+			assert.Nil(t, err)
+			var services []string
+			for _, s := range res.GetListServicesResponse().GetService() {
+				services = append(services, s.Name)
+			}
+			assert.Subset(t, services, []string{"abc.v1.ClassService", "abc.v1.BookingService", "grpc.health.v1.Health"})
+			assert.Nil(t, stream.CloseSend())
+		})
+	})
+
+	t.Run("POST /graphql", func(t *testing.T) {
+		type result struct {
+			Data   map[string]any `json:"data"`
+			Errors []struct {
+				Message    string         `json:"message"`
+				Extensions map[string]any `json:"extensions"`
+			} `json:"errors"`
+		}
+		// doAs sends the request with the bearer token, unless it is empty
+		doAs := func(token string, method string, req handler.GraphQLRequest) (int, result) {
+			opts := &httpRequestOpts{method: method, path: "/graphql", headers: map[string]string{"Content-Type": "application/json"}}
+			if token != "" {
+				opts.headers["Authorization"] = "Bearer " + token
+			}
+			if method == http.MethodGet {
+				opts.query = map[string]string{"query": req.Query}
+			} else {
+				opts.body = req
+			}
+			httpReq, err := createHttpRequest(opts)
+			assert.Nil(t, err)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httpReq)
+			var res result
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			return rec.Code, res
+		}
+		do := func(method string, req handler.GraphQLRequest) (int, result) {
+			return doAs("", method, req)
+		}
+
+		start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 200)
+		from, to := start.Format("2006-01-02"), start.AddDate(0, 0, 2).Format("2006-01-02")
+		yoga := repo.Class{Name: "GraphQL Yoga", StartDate: start.Unix(), EndDate: start.AddDate(0, 0, 1).Unix(), StartTime: 9 * 3600, Duration: 3600, Capacity: 1}
+		assert.Nil(t, r.CreateClass(context.TODO(), &yoga))
+		spin := repo.Class{Name: "GraphQL Spin", StartDate: start.Unix(), EndDate: start.Unix(), Capacity: 3}
+		assert.Nil(t, r.CreateClass(context.TODO(), &spin))
+
+		code, res := doAs(rohit, http.MethodPost, handler.GraphQLRequest{
+			Query:     `mutation Book($classId: ID!, $date: String!) { createBooking(classId: $classId, memberName: "Rohit", date: $date) { id status date } }`,
+			Variables: map[string]any{"classId": fmt.Sprint(yoga.ID), "date": from},
+		})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, res.Errors)
+		booking := res.Data["createBooking"].(map[string]any)
+		assert.Equal(t, "booked", booking["status"])
+		assert.Equal(t, from, booking["date"])
+		spinBooking, err := r.CreateBooking(context.TODO(), spin.ID, "Rohit", start.Unix(), nil)
+		assert.Nil(t, err)
+
+		query := `query Timetable($from: String!, $to: String!) {
+			classes { id name occurrences(from: $from, to: $to) { date startsAt capacity taken remaining } }
+			member(name: "Rohit") { name bookings(from: $from) { id status class { name } occurrence { date remaining } } }
+		}`
+		for _, method := range []string{http.MethodPost, http.MethodGet} {
+			t.Run(method, func(t *testing.T) {
+				req := handler.GraphQLRequest{Query: query, Variables: map[string]any{"from": from, "to": to}}
+				if method == http.MethodGet {
+					req.Query = strings.NewReplacer("$from", `"`+from+`"`, "$to", `"`+to+`"`, "($from: String!, $to: String!)", "").Replace(query)
+				}
+				code, res := doAs(rohit, method, req)
+				assert.Equal(t, http.StatusOK, code)
+				assert.Empty(t, res.Errors)
+				occurrences := map[string]any{}
+				for _, c := range res.Data["classes"].([]any) {
+					c := c.(map[string]any)
+					occurrences[c["name"].(string)] = c["occurrences"]
+				}
+				assert.Equal(t, []any{
+					map[string]any{"date": from, "startsAt": start.Add(9 * time.Hour).Format(time.RFC3339), "capacity": 1.0, "taken": 1.0, "remaining": 0.0},
+					map[string]any{"date": start.AddDate(0, 0, 1).Format("2006-01-02"), "startsAt": start.AddDate(0, 0, 1).Add(9 * time.Hour).Format(time.RFC3339), "capacity": 1.0, "taken": 0.0, "remaining": 1.0},
+				}, occurrences["GraphQL Yoga"])
+				assert.Equal(t, []any{map[string]any{"date": from, "startsAt": start.Format(time.RFC3339), "capacity": 3.0, "taken": 1.0, "remaining": 2.0}}, occurrences["GraphQL Spin"])
+
+				member := res.Data["member"].(map[string]any)
+				assert.Equal(t, "Rohit", member["name"])
+				assert.Equal(t, []any{
+					map[string]any{"id": booking["id"], "status": "booked", "class": map[string]any{"name": "GraphQL Yoga"}, "occurrence": map[string]any{"date": from, "remaining": 0.0}},
+					map[string]any{"id": fmt.Sprint(spinBooking), "status": "booked", "class": map[string]any{"name": "GraphQL Spin"}, "occurrence": map[string]any{"date": from, "remaining": 2.0}},
+				}, member["bookings"])
+			})
+		}
+
+		code, res = do(http.MethodPost, handler.GraphQLRequest{Query: fmt.Sprintf(`{ class(id: "%d") { startTime timezone } }`, yoga.ID)})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, res.Errors)
+		assert.Equal(t, map[string]any{"startTime": "09:00", "timezone": "UTC"}, res.Data["class"])
+
+		tests := []struct {
+			name       string
+			token      string
+			method     string
+			req        handler.GraphQLRequest
+			wantStatus int
+			// Of the first error
+			wantMsg       string
+			wantExtStatus float64
+		}{
+			{
+				name:       "Class is full",
+				token:      rohit,
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`mutation { createBooking(classId: "%d", memberName: "Rohit", date: "%s") { id } }`, yoga.ID, from)},
+				wantStatus: http.StatusOK, wantMsg: "Class is full", wantExtStatus: http.StatusConflict,
+			},
+			{
+				name:       "Date in the past",
+				token:      rohit,
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`mutation { createBooking(classId: "%d", memberName: "Rohit", date: "2020-01-01") { id } }`, spin.ID)},
+				wantStatus: http.StatusOK, wantMsg: "Date cannot be in the past", wantExtStatus: http.StatusUnprocessableEntity,
+			},
+			{
+				name:       "Booking for someone else",
+				token:      someone,
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`mutation { createBooking(classId: "%d", memberName: "Rohit", date: "%s") { id } }`, spin.ID, from)},
+				wantStatus: http.StatusOK, wantMsg: "Only the member or staff may do this", wantExtStatus: http.StatusForbidden,
+			},
+			{
+				name:       "Unknown booking",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: `mutation { cancelBooking(id: "999999") { status } }`},
+				wantStatus: http.StatusOK, wantMsg: "Booking not found", wantExtStatus: http.StatusNotFound,
+			},
+			{
+				name:       "Cancelling without a token",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`mutation { cancelBooking(id: "%s") { status } }`, booking["id"])},
+				wantStatus: http.StatusOK, wantMsg: "Missing or invalid token", wantExtStatus: http.StatusUnauthorized,
+			},
+			{
+				name:       "Member bookings without a token",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: `{ member(name: "Rohit") { bookings { id } } }`},
+				wantStatus: http.StatusOK, wantMsg: "Missing or invalid token", wantExtStatus: http.StatusUnauthorized,
+			},
+			{
+				name:       "Member bookings of someone else",
+				token:      someone,
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: `{ member(name: "Rohit") { bookings { id } } }`},
+				wantStatus: http.StatusOK, wantMsg: "Only the member or staff may do this", wantExtStatus: http.StatusForbidden,
+			},
+			{
+				name:       "Booking without a token",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`{ booking(id: "%s") { status } }`, booking["id"])},
+				wantStatus: http.StatusOK, wantMsg: "Missing or invalid token", wantExtStatus: http.StatusUnauthorized,
+			},
+			{
+				name:       "Booking of someone else",
+				token:      someone,
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`{ booking(id: "%s") { status } }`, booking["id"])},
+				wantStatus: http.StatusOK, wantMsg: "Only the member or staff may do this", wantExtStatus: http.StatusForbidden,
+			},
+			{
+				name:       "Range too long",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`{ class(id: "%d") { occurrences(from: "2030-01-01", to: "2031-06-01") { date } } }`, yoga.ID)},
+				wantStatus: http.StatusOK, wantMsg: "Occurrences cover at most 366 days", wantExtStatus: http.StatusUnprocessableEntity,
+			},
+			{
+				name:       "Too complex",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: `{ classes { occurrences(from: "2030-01-01", to: "2030-03-31") { date taken remaining } } }`},
+				wantStatus: http.StatusBadRequest, wantMsg: "Query has a complexity of 5421, which exceeds the limit of 5000",
+			},
+			{
+				name:   "Too complex with variables",
+				method: http.MethodPost,
+				req: handler.GraphQLRequest{
+					Query:     `query ($to: String!) { classes { ...occurrences } } fragment occurrences on Class { occurrences(from: "2030-01-01", to: $to) { date taken remaining } }`,
+					Variables: map[string]any{"to": "2030-03-31"},
+				},
+				wantStatus: http.StatusBadRequest, wantMsg: "Query has a complexity of 5421, which exceeds the limit of 5000",
+			},
+			{
+				name:       "Too deep",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: fmt.Sprintf(`{ class(id: "%d") { %s } }`, yoga.ID, strings.Repeat(`occurrences(from: "2030-01-01", to: "2030-01-01") { class { `, 5)+"id"+strings.Repeat(" } }", 5))},
+				wantStatus: http.StatusBadRequest, wantMsg: "Query is nested 12 levels deep, which exceeds the limit of 10",
+			},
+			{
+				name:       "Invalid field",
+				method:     http.MethodPost,
+				req:        handler.GraphQLRequest{Query: `{ classes { secret } }`},
+				wantStatus: http.StatusBadRequest, wantMsg: `Cannot query field "secret" on type "Class".`,
+			},
+			{
+				name:       "Mutation over GET",
+				method:     http.MethodGet,
+				req:        handler.GraphQLRequest{Query: `mutation { cancelBooking(id: "1") { status } }`},
+				wantStatus: http.StatusMethodNotAllowed, wantMsg: "Mutations must be sent with POST",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				code, res := doAs(tt.token, tt.method, tt.req)
+				assert.Equal(t, tt.wantStatus, code)
+				if assert.NotEmpty(t, res.Errors) {
+					assert.Equal(t, tt.wantMsg, res.Errors[0].Message)
+					if tt.wantExtStatus != 0 {
+						assert.Equal(t, tt.wantExtStatus, res.Errors[0].Extensions["status"])
+					}
+				}
+			})
+		}
+
+		code, res = doAs("front-desk-token", http.MethodPost, handler.GraphQLRequest{Query: fmt.Sprintf(`{ booking(id: "%s") { status memberName } }`, booking["id"])})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, res.Errors)
+		assert.Equal(t, map[string]any{"status": "booked", "memberName": "Rohit"}, res.Data["booking"])
+
+		code, res = doAs(rohit, http.MethodPost, handler.GraphQLRequest{Query: fmt.Sprintf(`mutation { cancelBooking(id: "%s") { status occurrence { remaining } } }`, booking["id"])})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, res.Errors)
+		assert.Equal(t, map[string]any{"status": "cancelled", "occurrence": map[string]any{"remaining": 1.0}}, res.Data["cancelBooking"])
+	})
+
+	t.Run("POST /admin/members/:name/penalties/waive", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			headers map[string]string
+			want    int
+		}{
+			{name: "Missing token", want: http.StatusBadRequest},
+			{name: "Invalid token", headers: map[string]string{"Authorization": "Bearer wrong"}, want: http.StatusUnauthorized},
+			{name: "Valid request", headers: map[string]string{"Authorization": "Bearer admin-token"}, want: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := createHttpRequest(&httpRequestOpts{
+					method:  http.MethodPost,
+					path:    "/admin/members/Rohit/penalties/waive",
+					headers: tt.headers,
+				})
 				assert.Nil(t, err)
+				res := httptest.NewRecorder()
+				// Served through the router so that the admin middleware runs
+				h.ServeHTTP(res, req)
 				assert.Equal(t, tt.want, res.Code)
 			})
 		}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HoldResponse struct {
+	Message string `json:"message"`
+	ID      uint64 `json:"id"`
+	// The spot is released if the hold is not confirmed by then
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// @Summary Hold a spot in a class
+// @Description Reserves a spot in the occurrence of the class on the given date while the member checks out. The hold counts towards the capacity of the class until it is confirmed or expires.
+// @Description Only the member, with their access token, and staff may hold a spot for them.
+// @Tags Bookings
+// @Accept json
+// @Produce json
+// @Security MemberToken
+// @Param body body handler.CreateBookingRequest true "Request body"
+// @Success 201 {object} handler.HoldResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 403 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /holds [post]
+func CreateHold(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateBookingRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		if err := principalFrom(ctx).authorize(req.MemberName); err != nil {
+			return err
+		}
+		hold, err := svc.Service.CreateHold(ctx, req.newBooking())
+		if err != nil {
+			return serviceError(c, err)
+		}
+		return c.JSON(http.StatusCreated, HoldResponse{Message: "Spot held successfully", ID: hold.ID, ExpiresAt: hold.ExpiresAt})
+	}
+}
+
+type HoldIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+// @Summary Confirm a hold
+// @Description Turns the hold into a booking, which uses up a class of the member's membership like any other booking.
+// @Description Only the member of the hold, with their access token, and staff may confirm it.
+// @Tags Bookings
+// @Produce json
+// @Security MemberToken
+// @Param id path int true "Hold ID"
+// @Success 201 {object} createdResponse
+// @Failure 401 {object} response
+// @Failure 403 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 410 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /holds/{id}/confirm [post]
+func ConfirmHold(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(HoldIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		hold, err := svc.Service.GetHold(ctx, req.ID)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		if err := principalFrom(ctx).authorize(hold.MemberName); err != nil {
+			return err
+		}
+		id, err := svc.Service.ConfirmHold(ctx, req.ID)
+		if err != nil {
+			return serviceError(c, err)
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Booking created successfully", ID: id})
+	}
+}
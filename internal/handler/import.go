@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/ical"
+	"github.com/rohitxdev/abc-task/internal/service"
+)
+
+// Formats of timetables
+const (
+	TimetableFormatCSV = "csv"
+	TimetableFormatICS = "ics"
+)
+
+// Maximum size of an uploaded timetable in bytes
+const maxTimetableSize = 10 << 20
+
+// A row with a recurrence creates at most this many classes
+const maxOccurrencesPerRow = 366
+
+// Columns of CSV timetables. They are named after the fields of CreateClassRequest, plus an optional recurrence rule.
+var csvTimetableColumns = []string{"name", "startDate", "endDate", "startTime", "durationMinutes", "capacity", "freeCancelHoursBefore", "instructorId", "roomId", "price", "recurrence"}
+
+var requiredCSVTimetableColumns = []string{"name", "startDate", "endDate", "capacity"}
+
+type ImportClassesRequest struct {
+	// 'csv' or 'ics'. Taken from the Content-Type header when omitted.
+	Format string `query:"format" validate:"omitempty,oneof=csv ics"`
+	// Only reports the errors without creating anything
+	DryRun bool `query:"dryRun"`
+	// Capacity of the classes of iCalendar events without an X-CAPACITY property
+	Capacity uint `query:"capacity"`
+}
+
+// ImportRowError is the error of a row of a timetable, or of the whole timetable if it can't be parsed.
+type ImportRowError struct {
+	// Line of the CSV row or of the BEGIN:VEVENT of the event
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("Line %d: %s", e.Line, e.Message)
+}
+
+type ImportClassesResponse struct {
+	Message string `json:"message"`
+	DryRun  bool   `json:"dryRun"`
+	// Number of classes created, or that would be created. A row whose recurrence is not every day creates a class per occurrence.
+	Classes int `json:"classes"`
+	// IDs of the created classes. Empty on dry runs and when nothing was created.
+	IDs []uint64 `json:"ids"`
+	// Ordered by line
+	Errors []ImportRowError `json:"errors"`
+}
+
+// timetableRow is a class to import along with where it came from.
+type timetableRow struct {
+	line int
+	req  CreateClassRequest
+	// Limits the dates between the start and end date the class is held on. Nil if it is held on every day.
+	rule *ical.Rule
+	// Set if the row couldn't be parsed
+	err error
+}
+
+// ImportTimetable creates the classes of the timetable read from 'src' in one transaction. Every row is checked by the same rules as CreateClass, and nothing is created if any row is invalid or on a dry run. The response lists the errors of all invalid rows.
+func ImportTimetable(ctx context.Context, svc *service.Service, src io.Reader, req *ImportClassesRequest) (*ImportClassesResponse, error) {
+	res := &ImportClassesResponse{DryRun: req.DryRun, IDs: []uint64{}, Errors: []ImportRowError{}}
+	var rows []timetableRow
+	var err error
+	switch req.Format {
+	case TimetableFormatCSV:
+		rows, err = readCSVTimetable(src)
+	case TimetableFormatICS:
+		rows, err = readICSTimetable(src, req.Capacity)
+	default:
+		return nil, fmt.Errorf("Unknown timetable format %q", req.Format)
+	}
+	if err != nil {
+		var rowErr *ImportRowError
+		if !errors.As(err, &rowErr) {
+			return nil, err
+		}
+		res.Errors = append(res.Errors, *rowErr)
+		res.Message = "Timetable could not be parsed, nothing was imported"
+		return res, nil
+	}
+
+	var classes []service.Class
+	// Line of every class
+	var lines []int
+	for i := range rows {
+		rowClasses, err := rows[i].classes(svc)
+		if err != nil {
+			res.Errors = append(res.Errors, ImportRowError{Line: rows[i].line, Message: err.Error()})
+			continue
+		}
+		classes = append(classes, rowClasses...)
+		for range rowClasses {
+			lines = append(lines, rows[i].line)
+		}
+	}
+	res.Classes = len(classes)
+
+	// The valid rows are checked against the database even if there are invalid ones, so that all errors are reported at once
+	classErrs, err := svc.CreateClasses(ctx, classes, req.DryRun || len(res.Errors) > 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, err := range classErrs {
+		// A row is reported once even if several of its classes can't be created
+		if err == nil || (i > 0 && classErrs[i-1] != nil && lines[i-1] == lines[i]) {
+			continue
+		}
+		res.Errors = append(res.Errors, ImportRowError{Line: lines[i], Message: err.Error()})
+	}
+	sort.SliceStable(res.Errors, func(i, j int) bool { return res.Errors[i].Line < res.Errors[j].Line })
+
+	switch {
+	case len(res.Errors) > 0:
+		res.Message = fmt.Sprintf("Timetable has %d invalid rows, nothing was imported", len(res.Errors))
+	case req.DryRun:
+		res.Message = "Timetable is valid"
+	default:
+		res.Message = "Classes imported successfully"
+		for i := range classes {
+			res.IDs = append(res.IDs, classes[i].ID)
+		}
+	}
+	return res, nil
+}
+
+// classes returns the classes to create for the row. The row is checked by the same rules as CreateClass.
+func (row *timetableRow) classes(svc *service.Service) ([]service.Class, error) {
+	if row.err != nil {
+		return nil, row.err
+	}
+	if err := validate.Struct(&row.req); err != nil {
+		return nil, err
+	}
+	class, err := svc.ParseClass(row.req.newClass())
+	if err != nil {
+		return nil, err
+	}
+	if row.rule == nil {
+		return []service.Class{*class}, nil
+	}
+	dates, err := row.rule.Dates(class.StartDate, class.EndDate, maxOccurrencesPerRow)
+	if err != nil {
+		return nil, err
+	}
+	if len(dates) == 0 {
+		return nil, errors.New("Recurrence has no occurrences")
+	}
+	if row.rule.EveryDay() {
+		class.EndDate = dates[len(dates)-1]
+		return []service.Class{*class}, nil
+	}
+	// Classes are held on every day from their start until their end date, so every other recurrence takes a class per occurrence
+	classes := make([]service.Class, 0, len(dates))
+	for _, date := range dates {
+		occurrence := *class
+		occurrence.StartDate = date
+		occurrence.EndDate = date
+		classes = append(classes, occurrence)
+	}
+	return classes, nil
+}
+
+// readCSVTimetable reads a CSV file with a header row naming its columns.
+func readCSVTimetable(src io.Reader) ([]timetableRow, error) {
+	cr := csv.NewReader(src)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, &ImportRowError{Line: 1, Message: "Timetable has no header row"}
+		}
+		return nil, csvError(err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if !slices.Contains(csvTimetableColumns, name) {
+			return nil, &ImportRowError{Line: 1, Message: fmt.Sprintf("Unknown column %q, columns must be one of %s", name, strings.Join(csvTimetableColumns, ", "))}
+		}
+		columns[name] = i
+	}
+	for _, name := range requiredCSVTimetableColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, &ImportRowError{Line: 1, Message: fmt.Sprintf("Missing column %q", name)}
+		}
+	}
+
+	rows := []timetableRow{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := timetableRow{line: line, req: CreateClassRequest{
+			Name:      get("name"),
+			StartDate: get("startDate"),
+			EndDate:   get("endDate"),
+			StartTime: get("startTime"),
+		}}
+		numbers := []struct {
+			column string
+			dst    any
+		}{
+			{column: "durationMinutes", dst: &row.req.DurationMinutes},
+			{column: "capacity", dst: &row.req.Capacity},
+			{column: "freeCancelHoursBefore", dst: &row.req.FreeCancelHoursBefore},
+			{column: "instructorId", dst: &row.req.InstructorID},
+			{column: "roomId", dst: &row.req.RoomID},
+			{column: "price", dst: &row.req.Price},
+		}
+		for _, n := range numbers {
+			if row.err = setNumber(n.column, get(n.column), n.dst); row.err != nil {
+				break
+			}
+		}
+		if recurrence := get("recurrence"); recurrence != "" && row.err == nil {
+			row.rule, row.err = ical.ParseRule(strings.TrimPrefix(recurrence, "RRULE:"))
+		}
+		rows = append(rows, row)
+	}
+}
+
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &ImportRowError{Line: parseErr.Line, Message: "Invalid CSV: " + parseErr.Err.Error()}
+	}
+	return err
+}
+
+// setNumber parses 'value' into 'dst', which must be a *uint, *uint64 or *int64. Empty values are left out.
+func setNumber(name string, value string, dst any) error {
+	if value == "" {
+		return nil
+	}
+	var err error
+	switch dst := dst.(type) {
+	case *uint:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 0)
+		*dst = uint(n)
+	case *uint64:
+		*dst, err = strconv.ParseUint(value, 10, 64)
+	case *int64:
+		*dst, err = strconv.ParseInt(value, 10, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid value %q for %s", value, name)
+	}
+	return nil
+}
+
+// readICSTimetable reads the events of an iCalendar file. Cancelled events are skipped.
+func readICSTimetable(src io.Reader, capacity uint) ([]timetableRow, error) {
+	events, err := ical.ReadEvents(src)
+	if err != nil {
+		var syntaxErr *ical.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, &ImportRowError{Line: syntaxErr.Line, Message: syntaxErr.Msg}
+		}
+		return nil, err
+	}
+	rows := make([]timetableRow, 0, len(events))
+	for i := range events {
+		if status := events[i].Get("STATUS"); status != nil && strings.EqualFold(status.Value, ical.StatusCancelled) {
+			continue
+		}
+		row := timetableRow{line: events[i].Line, req: CreateClassRequest{Capacity: capacity}}
+		row.err = row.readEvent(&events[i])
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readEvent fills in the row from the event. Classes start at the same time of day in UTC, so an event in a time zone with daylight saving time is imported at the UTC time of its first occurrence.
+func (row *timetableRow) readEvent(event *ical.Component) error {
+	if summary := event.Get("SUMMARY"); summary != nil {
+		row.req.Name = summary.Text()
+	}
+	dtstart := event.Get("DTSTART")
+	if dtstart == nil {
+		return errors.New("Event has no DTSTART")
+	}
+	start, err := dtstart.Time()
+	if err != nil {
+		return fmt.Errorf("Invalid DTSTART: %w", err)
+	}
+	var duration time.Duration
+	if dtend := event.Get("DTEND"); dtend != nil {
+		end, err := dtend.Time()
+		if err != nil {
+			return fmt.Errorf("Invalid DTEND: %w", err)
+		}
+		duration = end.Sub(start)
+	} else if d := event.Get("DURATION"); d != nil {
+		if duration, err = ical.ParseDuration(d.Value); err != nil {
+			return err
+		}
+	} else if dtstart.IsDate() {
+		// All-day events without an end last a day
+		duration = 24 * time.Hour
+	}
+	if duration < 0 {
+		return errors.New("Event ends before it starts")
+	}
+	row.req.StartDate = start.Format(time.DateOnly)
+	row.req.EndDate = row.req.StartDate
+	row.req.StartTime = start.Format("15:04")
+	row.req.DurationMinutes = uint(duration / time.Minute)
+	if capacity := event.Get("X-CAPACITY"); capacity != nil {
+		if err = setNumber("X-CAPACITY", capacity.Value, &row.req.Capacity); err != nil {
+			return err
+		}
+	}
+	if rrule := event.Get("RRULE"); rrule != nil {
+		if row.rule, err = ical.ParseRule(rrule.Value); err != nil {
+			return err
+		}
+		dates, err := row.rule.Dates(start, time.Time{}, maxOccurrencesPerRow)
+		if err != nil {
+			return err
+		}
+		if len(dates) == 0 {
+			return errors.New("Recurrence has no occurrences")
+		}
+		row.req.EndDate = dates[len(dates)-1].Format(time.DateOnly)
+	}
+	return nil
+}
+
+// @Summary Import a timetable
+// @Description Creates the classes of a CSV file or an iCalendar file in one transaction. Every row is checked by the same rules as POST /classes, and nothing is created if any row is invalid or on a dry run. The errors of all invalid rows are returned.
+// @Description CSV files start with a header row naming their columns: name, startDate, endDate and capacity, and optionally startTime, durationMinutes, freeCancelHoursBefore, instructorId, roomId, price and recurrence. Classes are held on every day from their start until their end date unless a recurrence rule such as 'FREQ=WEEKLY;BYDAY=MO,WE' limits the dates.
+// @Description iCalendar events become classes by their SUMMARY, DTSTART, DTEND or DURATION, RRULE and X-CAPACITY. Only daily and weekly recurrence rules are supported, and a class is created for every occurrence of a rule that doesn't repeat every day.
+// @Tags Admin
+// @Accept text/csv
+// @Accept text/calendar
+// @Produce json
+// @Security AdminToken
+// @Param format query string false "Format of the timetable, 'csv' or 'ics'. Taken from the Content-Type header when omitted."
+// @Param dryRun query bool false "Only report the errors"
+// @Param capacity query int false "Capacity of the classes of iCalendar events without an X-CAPACITY property"
+// @Param body body string true "Timetable"
+// @Success 200 {object} handler.ImportClassesResponse "Dry run of a valid timetable"
+// @Success 201 {object} handler.ImportClassesResponse
+// @Failure 401 {object} response
+// @Failure 413 {object} response
+// @Failure 415 {object} response
+// @Failure 422 {object} handler.ImportClassesResponse
+// @Failure 500 {object} response
+// @Router /admin/classes/import [post]
+func ImportClasses(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(ImportClassesRequest)
+		// The body is the timetable, which the default binder can't bind
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, req); err != nil {
+			return err
+		}
+		if err := c.Validate(req); err != nil {
+			return err
+		}
+		if req.Format == "" {
+			mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+			switch mediaType {
+			case "text/csv":
+				req.Format = TimetableFormatCSV
+			case "text/calendar":
+				req.Format = TimetableFormatICS
+			default:
+				return c.JSON(http.StatusUnsupportedMediaType, response{Message: "Timetable must be sent as text/csv or text/calendar"})
+			}
+		}
+		body := http.MaxBytesReader(c.Response(), c.Request().Body, maxTimetableSize)
+		res, err := ImportTimetable(c.Request().Context(), svc.Service, body, req)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return c.JSON(http.StatusRequestEntityTooLarge, response{Message: "Timetable is too large"})
+			}
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		switch {
+		case len(res.Errors) > 0:
+			return c.JSON(http.StatusUnprocessableEntity, res)
+		case req.DryRun:
+			return c.JSON(http.StatusOK, res)
+		default:
+			return c.JSON(http.StatusCreated, res)
+		}
+	}
+}
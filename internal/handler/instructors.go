@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+type CreateInstructorRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type InstructorResponse struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+type OccurrenceResponse struct {
+	ClassID   uint64    `json:"classId"`
+	ClassName string    `json:"className"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+func newOccurrenceResponses(occurrences []repo.Occurrence) []OccurrenceResponse {
+	res := make([]OccurrenceResponse, 0, len(occurrences))
+	for _, o := range occurrences {
+		res = append(res, OccurrenceResponse{ClassID: o.ClassID, ClassName: o.ClassName, Start: o.Start.UTC(), End: o.End.UTC()})
+	}
+	return res
+}
+
+type ScheduleConflictResponse struct {
+	Message string `json:"message"`
+	// Occurrences of other classes with the same instructor or room that overlap the class
+	Conflicts []OccurrenceResponse `json:"conflicts"`
+}
+
+// @Summary Create a new instructor
+// @Description Creates a new instructor with the given name.
+// @Tags Instructors
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param body body handler.CreateInstructorRequest true "Request body"
+// @Success 201 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/instructors [post]
+func CreateInstructor(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateInstructorRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		instructor := &repo.Instructor{Name: req.Name}
+		if err := svc.Repo.CreateInstructor(c.Request().Context(), instructor); err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Instructor created successfully", ID: instructor.ID})
+	}
+}
+
+// @Summary Get all instructors
+// @Description Returns all instructors.
+// @Tags Instructors
+// @Produce json
+// @Success 200 {array} handler.InstructorResponse
+// @Failure 500 {object} response
+// @Router /instructors [get]
+func GetInstructors(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		instructors, err := svc.Repo.GetInstructors(c.Request().Context())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]InstructorResponse, 0, len(instructors))
+		for _, instructor := range instructors {
+			res = append(res, InstructorResponse{ID: instructor.ID, Name: instructor.Name})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type InstructorIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+// @Summary Get an instructor
+// @Description Returns the instructor with the given ID.
+// @Tags Instructors
+// @Produce json
+// @Param id path int true "Instructor ID"
+// @Success 200 {object} handler.InstructorResponse
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /instructors/{id} [get]
+func GetInstructor(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(InstructorIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		instructor, err := svc.Repo.GetInstructor(c.Request().Context(), req.ID)
+		if err != nil {
+			switch err {
+			case repo.InstructorNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Instructor not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, InstructorResponse{ID: instructor.ID, Name: instructor.Name})
+	}
+}
+
+type GetInstructorScheduleRequest struct {
+	ID   uint64 `param:"id" validate:"required"`
+	From string `query:"from" validate:"required"`
+	To   string `query:"to" validate:"required"`
+}
+
+// @Summary Get the schedule of an instructor
+// @Description Returns the occurrences of all classes taught by the instructor between the given dates, both inclusive, ordered by start.
+// @Tags Instructors
+// @Produce json
+// @Param id path int true "Instructor ID"
+// @Param from query string true "First date in YYYY-MM-DD format"
+// @Param to query string true "Last date in YYYY-MM-DD format"
+// @Success 200 {array} handler.OccurrenceResponse
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /instructors/{id}/schedule [get]
+func GetInstructorSchedule(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(GetInstructorScheduleRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		from, err := time.Parse("2006-01-02", req.From)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format for from"})
+		}
+		to, err := time.Parse("2006-01-02", req.To)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format for to"})
+		}
+		if from.After(to) {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "To cannot be before from"})
+		}
+		occurrences, err := svc.Repo.GetInstructorSchedule(c.Request().Context(), req.ID, from, to.AddDate(0, 0, 1))
+		if err != nil {
+			switch err {
+			case repo.InstructorNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Instructor not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, newOccurrenceResponses(occurrences))
+	}
+}
+
+type AssignInstructorRequest struct {
+	ClassID uint64 `param:"id" json:"-" validate:"required"`
+	// Pass 0 to unassign the current instructor
+	InstructorID uint64 `json:"instructorId"`
+}
+
+// @Summary Assign an instructor to a class
+// @Description Makes the instructor teach the class, replacing the previous one. Rejected if any occurrence of the class overlaps another class of the instructor.
+// @Tags Instructors
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "Class ID"
+// @Param body body handler.AssignInstructorRequest true "Request body"
+// @Success 200 {object} response
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} handler.ScheduleConflictResponse
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/classes/{id}/instructor [put]
+func AssignInstructor(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(AssignInstructorRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if err := svc.Service.AssignInstructor(c.Request().Context(), req.ClassID, req.InstructorID); err != nil {
+			return serviceError(c, err)
+		}
+		return c.JSON(http.StatusOK, response{Message: "Instructor assigned successfully"})
+	}
+}
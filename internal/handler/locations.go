@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+	// Time zones are validated against the embedded database so that it works on hosts without one
+	_ "time/tzdata"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+type CreateLocationRequest struct {
+	Name string `json:"name" validate:"required"`
+	// IANA time zone name, e.g. Europe/London
+	Timezone string `json:"timezone" validate:"required"`
+	Address  string `json:"address" validate:"required"`
+}
+
+type LocationResponse struct {
+	ID       uint64 `json:"id"`
+	Name     string `json:"name"`
+	Timezone string `json:"timezone"`
+	Address  string `json:"address"`
+}
+
+func newLocationResponse(location *repo.Location) LocationResponse {
+	return LocationResponse{ID: location.ID, Name: location.Name, Timezone: location.Timezone, Address: location.Address}
+}
+
+// @Summary Create a new location
+// @Description Creates a new location with the given name, time zone and address.
+// @Tags Locations
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param body body handler.CreateLocationRequest true "Request body"
+// @Success 201 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/locations [post]
+func CreateLocation(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateLocationRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid time zone"})
+		}
+		location := &repo.Location{Name: req.Name, Timezone: req.Timezone, Address: req.Address}
+		if err := svc.Repo.CreateLocation(c.Request().Context(), location); err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Location created successfully", ID: location.ID})
+	}
+}
+
+// @Summary Get all locations
+// @Description Returns all locations.
+// @Tags Locations
+// @Produce json
+// @Success 200 {array} handler.LocationResponse
+// @Failure 500 {object} response
+// @Router /locations [get]
+func GetLocations(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		locations, err := svc.Repo.GetLocations(c.Request().Context())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]LocationResponse, 0, len(locations))
+		for i := range locations {
+			res = append(res, newLocationResponse(&locations[i]))
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type LocationIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+// @Summary Get a location
+// @Description Returns the location with the given ID.
+// @Tags Locations
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {object} handler.LocationResponse
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /locations/{id} [get]
+func GetLocation(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(LocationIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		location, err := svc.Repo.GetLocation(c.Request().Context(), req.ID)
+		if err != nil {
+			switch err {
+			case repo.LocationNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Location not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, newLocationResponse(location))
+	}
+}
+
+type CreateRoomRequest struct {
+	LocationID uint64 `param:"id" json:"-" validate:"required"`
+	Name       string `json:"name" validate:"required"`
+	// Maximum number of people the room physically fits
+	Capacity uint `json:"capacity" validate:"required"`
+}
+
+type RoomResponse struct {
+	ID         uint64 `json:"id"`
+	LocationID uint64 `json:"locationId"`
+	Name       string `json:"name"`
+	Capacity   uint   `json:"capacity"`
+}
+
+// @Summary Create a new room
+// @Description Creates a new room at the location with the given name and physical capacity.
+// @Tags Locations
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "Location ID"
+// @Param body body handler.CreateRoomRequest true "Request body"
+// @Success 201 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/locations/{id}/rooms [post]
+func CreateRoom(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateRoomRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		room := &repo.Room{LocationID: req.LocationID, Name: req.Name, Capacity: req.Capacity}
+		if err := svc.Repo.CreateRoom(c.Request().Context(), room); err != nil {
+			switch err {
+			case repo.LocationNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Location not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Room created successfully", ID: room.ID})
+	}
+}
+
+// @Summary Get the rooms of a location
+// @Description Returns all rooms at the location.
+// @Tags Locations
+// @Produce json
+// @Param id path int true "Location ID"
+// @Success 200 {array} handler.RoomResponse
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /locations/{id}/rooms [get]
+func GetRooms(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(LocationIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		rooms, err := svc.Repo.GetRooms(c.Request().Context(), req.ID)
+		if err != nil {
+			switch err {
+			case repo.LocationNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Location not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		res := make([]RoomResponse, 0, len(rooms))
+		for _, room := range rooms {
+			res = append(res, RoomResponse{ID: room.ID, LocationID: room.LocationID, Name: room.Name, Capacity: room.Capacity})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
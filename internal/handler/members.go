@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Roles of authenticated callers
+const (
+	roleAdmin     = "admin"
+	roleFrontDesk = "front-desk"
+	// Holders of the access token of a member
+	roleMember = "member"
+)
+
+// principal is who made a request, as told by the bearer token it came with.
+type principal struct {
+	// Empty if the request came without a known token
+	role string
+	// Set for members
+	memberName string
+	// Address of the client
+	ip string
+}
+
+// actor returns who the changes made by the principal are recorded as made by in the audit log. Anonymous callers are told apart by their address.
+func (p principal) actor() string {
+	switch {
+	case p.role == roleMember:
+		return actorMember + p.memberName
+	case p.role != "":
+		return p.role
+	default:
+		return fmt.Sprintf("%s (ip %s)", actorAnonymous, p.ip)
+	}
+}
+
+// staff reports whether the principal holds the admin or front desk token.
+func (p principal) staff() bool {
+	return p.role == roleAdmin || p.role == roleFrontDesk
+}
+
+// authorize returns the error to respond with unless the principal may act on behalf of the member, which staff may for every member.
+func (p principal) authorize(memberName string) *echo.HTTPError {
+	switch {
+	case p.staff() || (p.role == roleMember && p.memberName == memberName):
+		return nil
+	case p.role == "":
+		return echo.NewHTTPError(http.StatusUnauthorized, "Missing or invalid token")
+	default:
+		return echo.NewHTTPError(http.StatusForbidden, "Only the member or staff may do this")
+	}
+}
+
+type principalKey struct{}
+
+// principalFrom returns the principal identify found for the request 'ctx' belongs to.
+func principalFrom(ctx context.Context) principal {
+	p, _ := ctx.Value(principalKey{}).(principal)
+	return p
+}
+
+// identify finds out who made the request from the header 'Authorization: Bearer <token>', which may hold the admin token, the front desk token or the access token of a member, and records the changes made while handling it as made by them in the audit log, along with the ID of the request. Requests without a known token are let through as anonymous, so handlers decide what they may do. It must run after the request ID middleware.
+func identify(svc *Services) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			p, err := identifyBearer(req.Context(), svc, req.Header.Get(echo.HeaderAuthorization))
+			if err != nil {
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+			p.ip = c.RealIP()
+			ctx := context.WithValue(req.Context(), principalKey{}, p)
+			requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+			c.SetRequest(req.WithContext(repo.WithActor(ctx, p.actor(), requestID)))
+			return next(c)
+		}
+	}
+}
+
+// identifyBearer returns who holds the token of the authorization 'Bearer <token>'. Unknown tokens are held by anonymous callers.
+func identifyBearer(ctx context.Context, svc *Services, authorization string) (principal, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	switch {
+	case !ok || token == "":
+		return principal{}, nil
+	case matchesToken(token, svc.Config.AdminToken):
+		return principal{role: roleAdmin}, nil
+	case matchesToken(token, svc.Config.FrontDeskToken):
+		return principal{role: roleFrontDesk}, nil
+	}
+	name, ok, err := svc.Repo.MemberForAccessToken(ctx, token)
+	if err != nil || !ok {
+		return principal{}, err
+	}
+	return principal{role: roleMember, memberName: name}, nil
+}
+
+// matchesToken reports whether 'key' is 'token'. Empty tokens match no key.
+func matchesToken(key string, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1
+}
+
+type AccessTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// @Summary Issue an access token for a member
+// @Description Issues a new secret token to hand to the member, who sends it as 'Authorization: Bearer <token>' to manage their own bookings. The token issued before stops working.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Member name"
+// @Success 200 {object} handler.AccessTokenResponse
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/members/{name}/access-token [post]
+func ResetAccessToken(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(MemberRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		token, err := svc.Repo.ResetAccessToken(c.Request().Context(), req.Name)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		return c.JSON(http.StatusOK, AccessTokenResponse{Token: token})
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+type CreatePlanRequest struct {
+	Name string        `json:"name" validate:"required"`
+	Kind repo.PlanKind `json:"kind" validate:"required,oneof=unlimited weekly pack"`
+	// Required for weekly plans
+	ClassesPerWeek uint `json:"classesPerWeek" validate:"required_if=Kind weekly"`
+	// Required for class packs
+	Credits uint `json:"credits" validate:"required_if=Kind pack"`
+}
+
+type PlanResponse struct {
+	ID             uint64        `json:"id"`
+	Name           string        `json:"name"`
+	Kind           repo.PlanKind `json:"kind"`
+	ClassesPerWeek uint          `json:"classesPerWeek,omitempty"`
+	Credits        uint          `json:"credits,omitempty"`
+}
+
+// @Summary Create a new membership plan
+// @Description Creates a new plan that entitles members to unlimited classes, a number of classes per week or a pack of class credits.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param body body handler.CreatePlanRequest true "Request body"
+// @Success 201 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/plans [post]
+func CreatePlan(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreatePlanRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		plan := &repo.Plan{Name: req.Name, Kind: req.Kind}
+		switch req.Kind {
+		case repo.PlanKindWeekly:
+			plan.ClassesPerWeek = req.ClassesPerWeek
+		case repo.PlanKindPack:
+			plan.Credits = req.Credits
+		}
+		if err := svc.Repo.CreatePlan(c.Request().Context(), plan); err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Plan created successfully", ID: plan.ID})
+	}
+}
+
+// @Summary Get all membership plans
+// @Description Returns all membership plans.
+// @Tags Memberships
+// @Produce json
+// @Success 200 {array} handler.PlanResponse
+// @Failure 500 {object} response
+// @Router /plans [get]
+func GetPlans(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		plans, err := svc.Repo.GetPlans(c.Request().Context())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]PlanResponse, 0, len(plans))
+		for _, plan := range plans {
+			res = append(res, PlanResponse{ID: plan.ID, Name: plan.Name, Kind: plan.Kind, ClassesPerWeek: plan.ClassesPerWeek, Credits: plan.Credits})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type CreateSubscriptionRequest struct {
+	MemberName string `param:"name" json:"-" validate:"required"`
+	PlanID     uint64 `json:"planId" validate:"required"`
+	StartDate  string `json:"startDate" validate:"required"`
+	// Last day of the subscription
+	EndDate string `json:"endDate" validate:"required"`
+}
+
+type SubscriptionResponse struct {
+	ID         uint64 `json:"id"`
+	MemberName string `json:"memberName"`
+	PlanID     uint64 `json:"planId"`
+	StartDate  string `json:"startDate"`
+	EndDate    string `json:"endDate"`
+	// Only set for class packs
+	CreditsRemaining uint `json:"creditsRemaining"`
+}
+
+// @Summary Subscribe a member to a plan
+// @Description Entitles the member to book classes from the start date to the end date, both inclusive, according to the plan.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param name path string true "Member name"
+// @Param body body handler.CreateSubscriptionRequest true "Request body"
+// @Success 201 {object} createdResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/members/{name}/subscriptions [post]
+func CreateSubscription(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateSubscriptionRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		startDate, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format for start date"})
+		}
+		endDate, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "Invalid date format for end date"})
+		}
+		if startDate.After(endDate) {
+			return c.JSON(http.StatusUnprocessableEntity, response{Message: "End date cannot be before start date"})
+		}
+		subscription := &repo.Subscription{MemberName: req.MemberName, PlanID: req.PlanID, StartDate: startDate.Unix(), EndDate: endDate.Unix()}
+		if err := svc.Repo.CreateSubscription(c.Request().Context(), subscription); err != nil {
+			switch err {
+			case repo.PlanNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Plan not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusCreated, createdResponse{Message: "Subscription created successfully", ID: subscription.ID})
+	}
+}
+
+// @Summary Get the subscriptions of a member
+// @Description Returns all subscriptions of the member, including expired ones.
+// @Tags Memberships
+// @Produce json
+// @Param name path string true "Member name"
+// @Success 200 {array} handler.SubscriptionResponse
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /members/{name}/subscriptions [get]
+func GetSubscriptions(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(MemberRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		subscriptions, err := svc.Repo.GetSubscriptions(c.Request().Context(), req.Name)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]SubscriptionResponse, 0, len(subscriptions))
+		for _, s := range subscriptions {
+			res = append(res, SubscriptionResponse{
+				ID:               s.ID,
+				MemberName:       s.MemberName,
+				PlanID:           s.PlanID,
+				StartDate:        time.Unix(s.StartDate, 0).UTC().Format("2006-01-02"),
+				EndDate:          time.Unix(s.EndDate, 0).UTC().Format("2006-01-02"),
+				CreditsRemaining: s.CreditsRemaining,
+			})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+type OutboxMessageResponse struct {
+	ID        uint64          `json:"id"`
+	Type      repo.EventType  `json:"type"`
+	ClassID   uint64          `json:"classId"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Attempts  uint            `json:"attempts"`
+	LastError string          `json:"lastError"`
+}
+
+// @Summary Get dead-lettered events
+// @Description Returns the events that could not be published after all retries, newest first. Later events of the same class are published regardless.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {array} handler.OutboxMessageResponse
+// @Failure 401 {object} response
+// @Failure 500 {object} response
+// @Router /admin/outbox/dead [get]
+func GetDeadOutboxMessages(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		messages, err := svc.Repo.GetDeadOutboxMessages(c.Request().Context())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]OutboxMessageResponse, 0, len(messages))
+		for _, m := range messages {
+			res = append(res, OutboxMessageResponse{
+				ID:        m.ID,
+				Type:      m.Type,
+				ClassID:   m.ClassID,
+				Data:      m.Data,
+				CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+				Attempts:  m.Attempts,
+				LastError: m.LastError,
+			})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type OutboxMessageIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+// @Summary Retry a dead-lettered event
+// @Description Publishes the dead-lettered event again as soon as possible, with retries starting over.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "Outbox message ID"
+// @Success 202 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/outbox/{id}/retry [post]
+func RetryOutboxMessage(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(OutboxMessageIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if err := svc.Repo.RetryOutboxMessage(c.Request().Context(), req.ID); err != nil {
+			switch err {
+			case repo.OutboxMessageNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "No dead-lettered event found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusAccepted, response{Message: "Event queued for publishing"})
+	}
+}
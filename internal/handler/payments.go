@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+type DropInBookingResponse struct {
+	Message string `json:"message"`
+	ID      uint64 `json:"id"`
+	// Payment to be completed by the client before the hold expires
+	PaymentID    string `json:"paymentId"`
+	ClientSecret string `json:"clientSecret"`
+	// In the smallest unit of the currency, e.g. cents
+	Amount        int64     `json:"amount"`
+	Currency      string    `json:"currency"`
+	HoldExpiresAt time.Time `json:"holdExpiresAt"`
+}
+
+// @Summary Create a drop-in booking
+// @Description Books the class for a member paying its drop-in price instead of using a membership. The spot is held while the payment is pending and released if it is not completed in time.
+// @Description Only the member, with their access token, and staff may book for them.
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Security MemberToken
+// @Param body body handler.CreateBookingRequest true "Request body"
+// @Success 201 {object} handler.DropInBookingResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 403 {object} response
+// @Failure 404 {object} response
+// @Failure 409 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Failure 502 {object} response
+// @Router /bookings/drop-in [post]
+func CreateDropInBooking(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateBookingRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		if err := principalFrom(ctx).authorize(req.MemberName); err != nil {
+			return err
+		}
+		dropIn, err := svc.Service.CreateDropInBooking(ctx, req.newBooking())
+		if err != nil {
+			return serviceError(c, err)
+		}
+		return c.JSON(http.StatusCreated, DropInBookingResponse{
+			Message:       "Booking held until the payment is completed",
+			ID:            dropIn.ID,
+			PaymentID:     dropIn.PaymentID,
+			ClientSecret:  dropIn.ClientSecret,
+			Amount:        dropIn.Amount,
+			Currency:      dropIn.Currency,
+			HoldExpiresAt: dropIn.HoldExpiresAt,
+		})
+	}
+}
+
+// @Summary Receive payment events
+// @Description Confirms or releases drop-in bookings as their payments succeed or fail. Events must be signed with the Stripe-Signature header. Payments that arrive after the hold was released are refunded.
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param Stripe-Signature header string true "Event signature"
+// @Success 200 {object} response
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 500 {object} response
+// @Router /payments/webhook [post]
+func PaymentWebhook(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		payload, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, response{Message: "Failed to read request body"})
+		}
+		event, err := payment.ParseEvent(svc.Config.PaymentWebhookSecret, payload, c.Request().Header.Get("Stripe-Signature"), time.Now())
+		if err != nil {
+			switch err {
+			case payment.InvalidSignatureError:
+				return c.JSON(http.StatusUnauthorized, response{Message: "Invalid signature"})
+			case payment.UnknownEventError:
+				return c.JSON(http.StatusOK, response{Message: "Event ignored"})
+			default:
+				return c.JSON(http.StatusBadRequest, response{Message: "Invalid event"})
+			}
+		}
+
+		ctx := c.Request().Context()
+		switch event.Type {
+		case payment.EventPaymentSucceeded:
+			booking, err := svc.Repo.ConfirmPayment(ctx, event.PaymentID())
+			if err == repo.HoldExpiredError {
+				err = nil
+				// The spot may have been given to someone else already, so the payment is returned instead. Redelivered events find it refunded already.
+				if amount := booking.Amount - booking.RefundedAmount; amount > 0 {
+					if err = svc.Payments.Refund(ctx, event.PaymentID(), amount); err == nil {
+						err = svc.Repo.RecordRefund(ctx, booking.ID, amount)
+					}
+				}
+			}
+			if err != nil && err != repo.PaymentNotFoundError {
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		case payment.EventPaymentFailed, payment.EventPaymentCanceled:
+			if err := svc.Repo.ReleasePayment(ctx, event.PaymentID()); err != nil && err != repo.PaymentNotFoundError {
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, response{Message: "Event processed"})
+	}
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/webhook"
+)
+
+type CreateWebhookRequest struct {
+	URL string `json:"url" validate:"required,http_url"`
+	// Event types to deliver. All events are delivered when empty.
+	Events []webhook.EventType `json:"events" validate:"dive,oneof=booking.created booking.cancelled class.created class.full waitlist.promoted class.cancelled"`
+	// Key deliveries are signed with. A random secret is generated when empty.
+	Secret string `json:"secret"`
+}
+
+type CreateWebhookResponse struct {
+	Message string `json:"message"`
+	ID      uint64 `json:"id"`
+	// Verify the X-Webhook-Signature header of deliveries with it
+	Secret string `json:"secret"`
+}
+
+type WebhookResponse struct {
+	ID        uint64              `json:"id"`
+	URL       string              `json:"url"`
+	Events    []webhook.EventType `json:"events"`
+	CreatedAt time.Time           `json:"createdAt"`
+}
+
+// @Summary Create a webhook
+// @Description Subscribes the URL to events. Deliveries are POST requests with the event as JSON body, signed with HMAC-SHA256 in the X-Webhook-Signature header as 't=<timestamp>,v1=<hex signature of "<timestamp>.<body>">'. Failed deliveries are retried with exponential backoff.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param body body handler.CreateWebhookRequest true "Request body"
+// @Success 201 {object} handler.CreateWebhookResponse
+// @Failure 400 {object} response
+// @Failure 401 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/webhooks [post]
+func CreateWebhook(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(CreateWebhookRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		w := &repo.Webhook{URL: req.URL, Secret: req.Secret}
+		for _, event := range req.Events {
+			w.Events = append(w.Events, string(event))
+		}
+		if w.Secret == "" {
+			secret, err := webhook.RandomSecret()
+			if err != nil {
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+			w.Secret = secret
+		}
+		if err := svc.Repo.CreateWebhook(c.Request().Context(), w); err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		return c.JSON(http.StatusCreated, CreateWebhookResponse{Message: "Webhook created successfully", ID: w.ID, Secret: w.Secret})
+	}
+}
+
+// @Summary Get all webhooks
+// @Description Returns all webhooks without their secrets.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {array} handler.WebhookResponse
+// @Failure 401 {object} response
+// @Failure 500 {object} response
+// @Router /admin/webhooks [get]
+func GetWebhooks(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		webhooks, err := svc.Repo.GetWebhooks(c.Request().Context())
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		res := make([]WebhookResponse, 0, len(webhooks))
+		for _, w := range webhooks {
+			events := []webhook.EventType{}
+			for _, event := range w.Events {
+				events = append(events, webhook.EventType(event))
+			}
+			res = append(res, WebhookResponse{ID: w.ID, URL: w.URL, Events: events, CreatedAt: time.Unix(w.CreatedAt, 0).UTC()})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type WebhookIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+// @Summary Delete a webhook
+// @Description Deletes the webhook together with its delivery log. Pending deliveries are dropped.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/webhooks/{id} [delete]
+func DeleteWebhook(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(WebhookIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if err := svc.Repo.DeleteWebhook(c.Request().Context(), req.ID); err != nil {
+			switch err {
+			case repo.WebhookNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Webhook not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusOK, response{Message: "Webhook deleted successfully"})
+	}
+}
+
+type WebhookAttemptResponse struct {
+	AttemptedAt time.Time `json:"attemptedAt"`
+	// Omitted if no response was received
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID    uint64 `json:"id"`
+	Event string `json:"event"`
+	// One of pending, delivered or failed
+	Status repo.WebhookDeliveryStatus `json:"status"`
+	// Omitted once the delivery is no longer pending
+	NextAttemptAt *time.Time               `json:"nextAttemptAt,omitempty"`
+	CreatedAt     time.Time                `json:"createdAt"`
+	Attempts      []WebhookAttemptResponse `json:"attempts"`
+}
+
+// @Summary Get the deliveries of a webhook
+// @Description Returns the deliveries of the webhook, newest first, with a log of every attempt to send them.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "Webhook ID"
+// @Success 200 {array} handler.WebhookDeliveryResponse
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/webhooks/{id}/deliveries [get]
+func GetWebhookDeliveries(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(WebhookIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		if _, err := svc.Repo.GetWebhook(ctx, req.ID); err != nil {
+			switch err {
+			case repo.WebhookNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Webhook not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		deliveries, err := svc.Repo.GetWebhookDeliveries(ctx, req.ID)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		attempts, err := svc.Repo.GetWebhookAttempts(ctx, req.ID)
+		if err != nil {
+			slog.Error(err.Error())
+			return echo.ErrInternalServerError
+		}
+		attemptsByDelivery := map[uint64][]WebhookAttemptResponse{}
+		for _, a := range attempts {
+			attemptsByDelivery[a.DeliveryID] = append(attemptsByDelivery[a.DeliveryID], WebhookAttemptResponse{
+				AttemptedAt: time.Unix(a.AttemptedAt, 0).UTC(),
+				StatusCode:  a.StatusCode,
+				Error:       a.Error,
+				DurationMs:  a.DurationMs,
+			})
+		}
+		res := make([]WebhookDeliveryResponse, 0, len(deliveries))
+		for _, d := range deliveries {
+			delivery := WebhookDeliveryResponse{
+				ID:        d.ID,
+				Event:     d.Event,
+				Status:    d.Status,
+				CreatedAt: time.Unix(d.CreatedAt, 0).UTC(),
+				Attempts:  attemptsByDelivery[d.ID],
+			}
+			if delivery.Attempts == nil {
+				delivery.Attempts = []WebhookAttemptResponse{}
+			}
+			if d.Status == repo.WebhookDeliveryStatusPending {
+				delivery.NextAttemptAt = optionalTime(d.NextAttemptAt)
+			}
+			res = append(res, delivery)
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+type WebhookDeliveryIDRequest struct {
+	ID uint64 `param:"id" validate:"required"`
+}
+
+// @Summary Replay a webhook delivery
+// @Description Sends the delivery again as soon as possible, with retries starting over, e.g. after a receiver outage.
+// @Tags Admin
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "Delivery ID"
+// @Success 202 {object} response
+// @Failure 401 {object} response
+// @Failure 404 {object} response
+// @Failure 422 {object} response
+// @Failure 500 {object} response
+// @Router /admin/webhook-deliveries/{id}/replay [post]
+func ReplayWebhookDelivery(svc *Services) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(WebhookDeliveryIDRequest)
+		if err := bindAndValidate(c, req); err != nil {
+			return err
+		}
+		if err := svc.Repo.ReplayWebhookDelivery(c.Request().Context(), req.ID); err != nil {
+			switch err {
+			case repo.WebhookDeliveryNotFoundError:
+				return c.JSON(http.StatusNotFound, response{Message: "Webhook delivery not found"})
+			default:
+				slog.Error(err.Error())
+				return echo.ErrInternalServerError
+			}
+		}
+		return c.JSON(http.StatusAccepted, response{Message: "Webhook delivery queued for replay"})
+	}
+}
@@ -0,0 +1,128 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can subscribe to.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar feeds.
+const ContentType = "text/calendar; charset=utf-8"
+
+// Event statuses
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// Calendar is a feed of events.
+type Calendar struct {
+	// Shown by calendar apps as the name of the subscription
+	Name   string
+	Events []Event
+}
+
+// Event is a VEVENT. Calendar apps identify events by UID, and replace an event they know with one of a higher Sequence.
+type Event struct {
+	UID      string
+	Sequence uint
+	// When the event was last modified, or when the feed was generated if that is not known
+	Stamp       time.Time
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	// One of the Status constants. Omitted when empty.
+	Status string
+	// Repeats the event every day until the start of the last repetition when not zero
+	RepeatDailyUntil time.Time
+	// Starts of further repetitions. Unlike with RepeatDailyUntil, which repeats at the same time in UTC, their times of day may differ, e.g. across daylight saving time changes.
+	RepeatOn []time.Time
+}
+
+const timeFormat = "20060102T150405Z"
+
+// Write writes the calendar in iCalendar format.
+func (c *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	lw := &lineWriter{w: bw}
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", "-//abc-task//Classes//EN")
+	lw.line("CALSCALE", "GREGORIAN")
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME", escape(c.Name))
+	}
+	for i := range c.Events {
+		e := &c.Events[i]
+		lw.line("BEGIN", "VEVENT")
+		lw.line("UID", escape(e.UID))
+		lw.line("SEQUENCE", strconv.FormatUint(uint64(e.Sequence), 10))
+		lw.line("DTSTAMP", e.Stamp.UTC().Format(timeFormat))
+		lw.line("DTSTART", e.Start.UTC().Format(timeFormat))
+		lw.line("DTEND", e.End.UTC().Format(timeFormat))
+		if !e.RepeatDailyUntil.IsZero() {
+			lw.line("RRULE", "FREQ=DAILY;UNTIL="+e.RepeatDailyUntil.UTC().Format(timeFormat))
+		}
+		if len(e.RepeatOn) > 0 {
+			dates := make([]string, 0, len(e.RepeatOn))
+			for _, t := range e.RepeatOn {
+				dates = append(dates, t.UTC().Format(timeFormat))
+			}
+			lw.line("RDATE", strings.Join(dates, ","))
+		}
+		lw.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			lw.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Status != "" {
+			lw.line("STATUS", e.Status)
+		}
+		lw.line("END", "VEVENT")
+	}
+	lw.line("END", "VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+// lineWriter writes content lines, keeping the first error.
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes the property folded into lines of at most 75 octets, as the RFC requires. Lines are only broken between characters so that multi-byte characters stay intact.
+func (lw *lineWriter) line(name, value string) {
+	if lw.err != nil {
+		return
+	}
+	s := name + ":" + value
+	limit := 75
+	for len(s) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		if _, lw.err = lw.w.WriteString(s[:n] + "\r\n "); lw.err != nil {
+			return
+		}
+		s = s[n:]
+		// The space the continuation line starts with counts towards its length
+		limit = 74
+	}
+	_, lw.err = lw.w.WriteString(s + "\r\n")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
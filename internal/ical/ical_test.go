@@ -0,0 +1,176 @@
+package ical_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/ical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	start := time.Date(2026, 1, 2, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		event ical.Event
+		want  []string
+	}{
+		{
+			name:  "Times are in UTC",
+			event: ical.Event{UID: "a@test", Start: start.In(time.FixedZone("X", 3600)), End: start.Add(time.Hour), Stamp: start, Summary: "Yoga"},
+			want:  []string{"UID:a@test", "DTSTART:20260102T183000Z", "DTEND:20260102T193000Z", "DTSTAMP:20260102T183000Z", "SEQUENCE:0", "SUMMARY:Yoga"},
+		},
+		{
+			name:  "Text is escaped",
+			event: ical.Event{UID: "b@test", Start: start, End: start, Stamp: start, Summary: `Yoga; Pilates, \ Core`, Description: "Line 1\nLine 2"},
+			want:  []string{`SUMMARY:Yoga\; Pilates\, \\ Core`, `DESCRIPTION:Line 1\nLine 2`},
+		},
+		{
+			name:  "Repeating cancelled event",
+			event: ical.Event{UID: "c@test", Sequence: 2, Start: start, End: start, Stamp: start, Summary: "Yoga", Status: ical.StatusCancelled, RepeatDailyUntil: start.AddDate(0, 0, 6)},
+			want:  []string{"SEQUENCE:2", "RRULE:FREQ=DAILY;UNTIL=20260108T183000Z", "STATUS:CANCELLED"},
+		},
+		{
+			name:  "Repetitions at other times",
+			event: ical.Event{UID: "e@test", Start: start, End: start, Stamp: start, Summary: "Yoga", RepeatOn: []time.Time{start.AddDate(0, 0, 1), start.AddDate(0, 0, 2).Add(-time.Hour)}},
+			want:  []string{"RDATE:20260103T183000Z,20260104T173000Z"},
+		},
+		{
+			name:  "Long lines are folded",
+			event: ical.Event{UID: "d@test", Start: start, End: start, Stamp: start, Summary: strings.Repeat("é", 50)},
+			want:  []string{"SUMMARY:" + strings.Repeat("é", 33) + "\r\n " + strings.Repeat("é", 17)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			assert.Nil(t, (&ical.Calendar{Name: "Test", Events: []ical.Event{tt.event}}).Write(&b))
+			out := b.String()
+			assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+			assert.True(t, strings.HasSuffix(out, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+			for _, want := range tt.want {
+				assert.Contains(t, out, "\r\n"+want+"\r\n")
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+				assert.LessOrEqual(t, len(line), 75)
+			}
+		})
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	feed := "\ufeffBEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Yoga\\, gentle\r\n" +
+		"DTSTART;TZID=Europe/London:20260701T183000\r\n" +
+		"DESCRIPTION:A long description that is folded onto\r\n" +
+		"  a second line\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\n" +
+		"DTSTART;VALUE=DATE:20260702\n" +
+		"END:VEVENT\n" +
+		"END:VCALENDAR\r\n"
+	events, err := ical.ReadEvents(strings.NewReader(feed))
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, 3, events[0].Line)
+	assert.Equal(t, "Yoga, gentle", events[0].Get("SUMMARY").Text())
+	assert.Equal(t, "A long description that is folded onto a second line", events[0].Get("DESCRIPTION").Text())
+	assert.Nil(t, events[0].Get("ACTION"), "Properties of nested components are skipped")
+	start, err := events[0].Get("DTSTART").Time()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 7, 1, 17, 30, 0, 0, time.UTC), start)
+	assert.True(t, events[1].Get("DTSTART").IsDate())
+	start, err = events[1].Get("DTSTART").Time()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 7, 2, 0, 0, 0, 0, time.UTC), start)
+
+	tests := []struct {
+		name string
+		feed string
+		line int
+	}{
+		{name: "Content outside of the calendar", feed: "VERSION:2.0\n", line: 1},
+		{name: "Invalid content line", feed: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY\n", line: 3},
+		{name: "Mismatched end", feed: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n", line: 3},
+		{name: "Missing end", feed: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VEVENT\n", line: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ical.ReadEvents(strings.NewReader(tt.feed))
+			var syntaxErr *ical.SyntaxError
+			assert.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.line, syntaxErr.Line)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "PT1H30M", want: 90 * time.Minute},
+		{value: "P1DT2H", want: 26 * time.Hour},
+		{value: "P2W", want: 14 * 24 * time.Hour},
+		{value: "PT45S", want: 45 * time.Second},
+		{value: "1H", wantErr: true},
+		{value: "PT1D", wantErr: true},
+		{value: "P", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ical.ParseDuration(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRule(t *testing.T) {
+	date := func(day int) time.Time {
+		return time.Date(2026, 6, day, 0, 0, 0, 0, time.UTC)
+	}
+	// Monday
+	start := time.Date(2026, 6, 1, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rule    string
+		last    time.Time
+		limit   int
+		want    []time.Time
+		wantErr bool
+	}{
+		{name: "Daily until", rule: "FREQ=DAILY;UNTIL=20260603T235959Z", limit: 10, want: []time.Time{date(1), date(2), date(3)}},
+		{name: "Every other day", rule: "FREQ=DAILY;INTERVAL=2;COUNT=3", limit: 10, want: []time.Time{date(1), date(3), date(5)}},
+		{name: "Weekly on the day of the start", rule: "FREQ=WEEKLY", last: date(15), limit: 10, want: []time.Time{date(1), date(8), date(15)}},
+		{name: "Weekly on several days", rule: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", limit: 10, want: []time.Time{date(1), date(3), date(8), date(10)}},
+		{name: "Fortnightly", rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR,MO;UNTIL=20260620", limit: 10, want: []time.Time{date(1), date(5), date(15), date(19)}},
+		{name: "Last date cuts off the rule", rule: "FREQ=DAILY;UNTIL=20260630", last: date(2), limit: 10, want: []time.Time{date(1), date(2)}},
+		{name: "No end", rule: "FREQ=DAILY", limit: 10, wantErr: true},
+		{name: "Too many occurrences", rule: "FREQ=DAILY;COUNT=11", limit: 10, wantErr: true},
+		{name: "Unsupported frequency", rule: "FREQ=MONTHLY;COUNT=2", limit: 10, wantErr: true},
+		{name: "Unsupported part", rule: "FREQ=WEEKLY;BYMONTH=6;COUNT=2", limit: 10, wantErr: true},
+		{name: "Count and until", rule: "FREQ=DAILY;COUNT=2;UNTIL=20260630", limit: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ical.ParseRule(tt.rule)
+			if err == nil {
+				var dates []time.Time
+				dates, err = rule.Dates(start, tt.last, tt.limit)
+				if err == nil {
+					assert.Equal(t, tt.want, dates)
+				}
+			}
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyntaxError is returned when a calendar can't be parsed.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Line %d: %s", e.Line, e.Msg)
+}
+
+// Component is a parsed component of a calendar, such as a VEVENT.
+type Component struct {
+	Name string
+	// Line of the file the component begins on
+	Line int
+	// In the order they appear
+	Properties []Property
+}
+
+// Get returns the first property named 'name', or nil if there is none.
+func (c *Component) Get(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Property is a content line, e.g. 'DTSTART;TZID=Europe/London:20260102T183000'.
+type Property struct {
+	Name   string
+	Params map[string]string
+	// As it appears in the file. Use Text to unescape TEXT values.
+	Value string
+}
+
+var unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// Text returns the value unescaped.
+func (p *Property) Text() string {
+	return unescaper.Replace(p.Value)
+}
+
+// IsDate reports whether the value is a date without a time, as is the case for all-day events.
+func (p *Property) IsDate() bool {
+	return p.Params["VALUE"] == "DATE" || len(p.Value) == len("20060102")
+}
+
+// Time returns the value as a DATE-TIME. Times with a TZID are converted from that time zone, and floating times are taken to be in UTC. Dates are returned as midnight UTC.
+func (p *Property) Time() (time.Time, error) {
+	if p.IsDate() {
+		return time.Parse("20060102", p.Value)
+	}
+	if strings.HasSuffix(p.Value, "Z") {
+		return time.Parse(timeFormat, p.Value)
+	}
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, fmt.Errorf("Unknown time zone %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", p.Value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// ParseDuration parses a DURATION value, e.g. 'PT1H30M'. Only weeks, days, hours, minutes and seconds are allowed, as the RFC requires.
+func ParseDuration(s string) (time.Duration, error) {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(s, "+"), "P")
+	if !ok || rest == "" {
+		return 0, fmt.Errorf("Invalid duration %q", s)
+	}
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	var d time.Duration
+	for rest != "" {
+		if rest[0] == 'T' {
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+			rest = rest[1:]
+			continue
+		}
+		i := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("Invalid duration %q", s)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		unit, ok := units[rest[i]]
+		if err != nil || !ok {
+			return 0, fmt.Errorf("Invalid duration %q", s)
+		}
+		d += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+	return d, nil
+}
+
+// ReadEvents returns the VEVENTs of the calendar in 'r'. Components nested in them, such as alarms, are skipped.
+func ReadEvents(r io.Reader) ([]Component, error) {
+	events := []Component{}
+	var event *Component
+	// Names of the components the line is in
+	var stack []string
+	lines := 0
+	err := readLines(r, func(line int, s string) error {
+		lines = line
+		p, err := parseProperty(s)
+		if err != nil {
+			return &SyntaxError{Line: line, Msg: err.Error()}
+		}
+		switch p.Name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.Value))
+			if len(stack) == 2 && stack[0] == "VCALENDAR" && stack[1] == "VEVENT" {
+				event = &Component{Name: "VEVENT", Line: line}
+			}
+			return nil
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(p.Value) {
+				return &SyntaxError{Line: line, Msg: "Unexpected END:" + p.Value}
+			}
+			if len(stack) == 2 && event != nil {
+				events = append(events, *event)
+				event = nil
+			}
+			stack = stack[:len(stack)-1]
+			return nil
+		}
+		if len(stack) == 0 {
+			return &SyntaxError{Line: line, Msg: "Content outside of VCALENDAR"}
+		}
+		if len(stack) == 2 && event != nil {
+			event.Properties = append(event.Properties, *p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stack) > 0 {
+		return nil, &SyntaxError{Line: lines, Msg: "Missing END:" + stack[len(stack)-1]}
+	}
+	return events, nil
+}
+
+// readLines calls 'fn' with every unfolded content line and the line of the file it begins on.
+func readLines(r io.Reader, fn func(line int, s string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	var current strings.Builder
+	start, n := 0, 0
+	for scanner.Scan() {
+		n++
+		s := strings.TrimSuffix(scanner.Text(), "\r")
+		if n == 1 {
+			s = strings.TrimPrefix(s, "\ufeff")
+		}
+		if strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t") {
+			current.WriteString(s[1:])
+			continue
+		}
+		if current.Len() > 0 {
+			if err := fn(start, current.String()); err != nil {
+				return err
+			}
+		}
+		current.Reset()
+		current.WriteString(s)
+		start = n
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if current.Len() > 0 {
+		return fn(start, current.String())
+	}
+	return nil
+}
+
+// parseProperty parses 'NAME;PARAM=value;PARAM="quoted value":value'.
+func parseProperty(s string) (*Property, error) {
+	p := Property{Params: map[string]string{}}
+	quoted := false
+	end := strings.IndexFunc(s, func(r rune) bool {
+		if r == '"' {
+			quoted = !quoted
+		}
+		return !quoted && r == ':'
+	})
+	if end < 0 {
+		return nil, fmt.Errorf("Invalid content line %q", s)
+	}
+	p.Value = s[end+1:]
+	parts := strings.Split(s[:end], ";")
+	p.Name = strings.ToUpper(parts[0])
+	if p.Name == "" {
+		return nil, fmt.Errorf("Invalid content line %q", s)
+	}
+	for _, param := range parts[1:] {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid parameter %q", param)
+		}
+		p.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return &p, nil
+}
@@ -0,0 +1,154 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	FreqDaily  = "DAILY"
+	FreqWeekly = "WEEKLY"
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rule is a recurrence rule (RRULE) that repeats an event on whole days, e.g. 'FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20260630'. Only daily and weekly rules are supported.
+type Rule struct {
+	// FreqDaily or FreqWeekly
+	Freq string
+	// Every how many days or weeks the event repeats
+	Interval int
+	// Days of the week a weekly rule repeats on. The weekday of the first occurrence when empty.
+	ByDay []time.Weekday
+	// Date of the last possible occurrence. Zero if the rule doesn't end on a date.
+	Until time.Time
+	// Number of occurrences. Zero if the rule doesn't end after a number of occurrences.
+	Count int
+}
+
+// ParseRule parses the value of an RRULE property.
+func ParseRule(s string) (*Rule, error) {
+	rule := Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid recurrence rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+			if rule.Freq != FreqDaily && rule.Freq != FreqWeekly {
+				return nil, fmt.Errorf("Unsupported recurrence frequency %q, only DAILY and WEEKLY are supported", value)
+			}
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(value); err != nil || rule.Interval < 1 {
+				return nil, fmt.Errorf("Invalid recurrence interval %q", value)
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(value); err != nil || rule.Count < 1 {
+				return nil, fmt.Errorf("Invalid recurrence count %q", value)
+			}
+		case "UNTIL":
+			// Only the date matters as occurrences are whole days
+			if len(value) < len("20060102") {
+				return nil, fmt.Errorf("Invalid recurrence end %q", value)
+			}
+			if rule.Until, err = time.Parse("20060102", value[:8]); err != nil {
+				return nil, fmt.Errorf("Invalid recurrence end %q", value)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("Unsupported recurrence day %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "WKST":
+			// Weeks start on Monday, which only makes a difference for weekly rules with an interval and several days
+		default:
+			return nil, fmt.Errorf("Unsupported recurrence rule part %q", name)
+		}
+	}
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("Recurrence rule %q has no frequency", s)
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != FreqWeekly {
+		return nil, errors.New("BYDAY is only supported in weekly recurrence rules")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("Recurrence rule cannot have both COUNT and UNTIL")
+	}
+	return &rule, nil
+}
+
+// EveryDay reports whether the rule repeats the event on every day.
+func (r *Rule) EveryDay() bool {
+	return r.Freq == FreqDaily && r.Interval == 1
+}
+
+// Dates returns the dates of the occurrences of an event that first occurs on the date of 'start' and repeats by the rule, as midnight UTC. Occurrences after the date of 'last' are left out, and rules that don't end are cut off there. An error is returned if there is no end, or if there would be more than 'limit' occurrences.
+func (r *Rule) Dates(start time.Time, last time.Time, limit int) ([]time.Time, error) {
+	start = start.UTC().Truncate(24 * time.Hour)
+	end := r.Until
+	if !last.IsZero() {
+		if last = last.UTC().Truncate(24 * time.Hour); end.IsZero() || last.Before(end) {
+			end = last
+		}
+	}
+	if end.IsZero() && r.Count == 0 {
+		return nil, errors.New("Recurrence rule must end with UNTIL or COUNT")
+	}
+
+	var dates []time.Time
+	// add returns false once the occurrences have run out
+	add := func(date time.Time) (bool, error) {
+		if (!end.IsZero() && date.After(end)) || (r.Count > 0 && len(dates) == r.Count) {
+			return false, nil
+		}
+		if len(dates) == limit {
+			return false, fmt.Errorf("Recurrence has more than %d occurrences", limit)
+		}
+		dates = append(dates, date)
+		return true, nil
+	}
+	if r.Freq == FreqDaily {
+		for date := start; ; date = date.AddDate(0, 0, r.Interval) {
+			if ok, err := add(date); !ok {
+				return dates, err
+			}
+		}
+	}
+
+	days := r.ByDay
+	if len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+	// Monday of the week of the first occurrence
+	week := start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	for ; ; week = week.AddDate(0, 0, 7*r.Interval) {
+		for offset := 0; offset < 7; offset++ {
+			date := week.AddDate(0, 0, offset)
+			if date.Before(start) || !slices.Contains(days, date.Weekday()) {
+				continue
+			}
+			if ok, err := add(date); !ok {
+				return dates, err
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a schedule in the five-field cron format 'minute hour day-of-month month day-of-week', in UTC. Fields are '*', numbers, ranges like '1-5' and lists like '1,15', each optionally with a step like '*/15'. A day matches if either day field matches, unless one of them is '*'. The shorthands @hourly, @daily, @weekly and @monthly are supported too, as is '@every <duration>' for work that runs more often than every minute, e.g. '@every 5s'.
+type Cron struct {
+	// Bit sets of the matching values of each field
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	// Set for '@every' schedules, which ignore the fields
+	every time.Duration
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func ParseCron(spec string) (*Cron, error) {
+	if s, ok := cronShorthands[spec]; ok {
+		spec = s
+	}
+	if s, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid duration in cron spec %q", spec)
+		}
+		// Runs are scheduled in whole seconds
+		if every < time.Second {
+			return nil, fmt.Errorf("Cron spec %q must be at least a second apart", spec)
+		}
+		return &Cron{every: every}, nil
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Cron spec %q must have 5 fields", spec)
+	}
+	var c Cron
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 are Sunday
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Cron spec %q never matches", spec)
+	}
+	return &c, nil
+}
+
+func parseCronField(field string, min, max uint64) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := uint64(1)
+		if hasStep {
+			var err error
+			if step, err = strconv.ParseUint(stepStr, 10, 0); err != nil || step == 0 {
+				return 0, fmt.Errorf("Invalid step in cron field %q", field)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.ParseUint(loStr, 10, 0); err != nil {
+				return 0, fmt.Errorf("Invalid cron field %q", field)
+			}
+			switch {
+			case isRange:
+				if hi, err = strconv.ParseUint(hiStr, 10, 0); err != nil {
+					return 0, fmt.Errorf("Invalid cron field %q", field)
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("Cron field %q is out of range %d-%d", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after 'after' that matches the schedule, or the zero time if there is none within 5 years.
+func (c *Cron) Next(after time.Time) time.Time {
+	if c.every > 0 {
+		return after.UTC().Truncate(c.every).Add(c.every)
+	}
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,240 @@
+// Package jobs contains the work that runs in the background next to the HTTP server, and the scheduler that runs it.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/notify"
+	"github.com/rohitxdev/abc-task/internal/outbox"
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/webhook"
+)
+
+// Kinds of the recurring jobs
+const (
+	KindMarkNoShows            = "mark-no-shows"
+	KindReleaseExpiredPayments = "release-expired-payments"
+	KindReleaseExpiredHolds    = "release-expired-holds"
+	KindDeleteFinishedJobs     = "delete-finished-jobs"
+	KindDeleteAuditEntries     = "delete-audit-entries"
+	KindRelayOutbox            = "relay-outbox"
+	KindDeliverWebhooks        = "deliver-webhooks"
+	KindSendEmails             = "send-emails"
+)
+
+// Finished jobs are kept this long for troubleshooting
+const finishedJobRetention = 7 * 24 * time.Hour
+
+// Register makes 's' run the jobs the repo schedules and the recurring upkeep of the database.
+func Register(ctx context.Context, s *Scheduler, r *repo.Repo, notifier *notify.Notifier, payments payment.Provider) error {
+	s.Handle(repo.JobKindReminder, SendReminder(r, notifier))
+	s.Handle(repo.JobKindRefund, Refund(r, payments))
+	return every(ctx, s, []recurring{
+		{kind: KindMarkNoShows, spec: "* * * * *", maxAttempts: 3, h: MarkNoShows(r)},
+		{kind: KindReleaseExpiredPayments, spec: "* * * * *", maxAttempts: 3, h: ReleaseExpiredPayments(r)},
+		{kind: KindReleaseExpiredHolds, spec: "* * * * *", maxAttempts: 3, h: ReleaseExpiredHolds(r)},
+		{kind: KindDeleteFinishedJobs, spec: "@daily", maxAttempts: 3, h: DeleteFinishedJobs(r)},
+		{kind: KindDeleteAuditEntries, spec: "@daily", maxAttempts: 3, h: DeleteExpiredAuditEntries(r)},
+	})
+}
+
+// RegisterQueues makes 's' publish the outbox and send the queued webhook deliveries and emails every few seconds. Each queue is worked on by one scheduler at a time, as its job is leased while it runs, and the scheduler waits for it on shutdown. A run that fails is not retried, as the next one follows shortly.
+func RegisterQueues(ctx context.Context, s *Scheduler, relay *outbox.Relay, webhooks *webhook.Dispatcher, mailer *notify.Mailer) error {
+	return every(ctx, s, []recurring{
+		{kind: KindRelayOutbox, spec: "@every 1s", maxAttempts: 1, h: RelayOutbox(relay)},
+		{kind: KindDeliverWebhooks, spec: "@every 5s", maxAttempts: 1, h: DeliverWebhooks(webhooks)},
+		{kind: KindSendEmails, spec: "@every 5s", maxAttempts: 1, h: SendEmails(mailer)},
+	})
+}
+
+type recurring struct {
+	kind        string
+	spec        string
+	maxAttempts uint
+	h           Handler
+}
+
+func every(ctx context.Context, s *Scheduler, jobs []recurring) error {
+	for _, job := range jobs {
+		if err := s.Every(ctx, job.kind, job.spec, job.maxAttempts, job.h); err != nil {
+			return fmt.Errorf("Failed to schedule job %s: %w", job.kind, err)
+		}
+	}
+	return nil
+}
+
+// MarkNoShows marks unattended bookings as no-show once their occurrence has ended.
+func MarkNoShows(r *repo.Repo) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := r.MarkNoShows(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to mark no-shows: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Marked %d bookings as no-show", n))
+		}
+		return nil
+	}
+}
+
+// ReleaseExpiredPayments releases the spots held by drop-in bookings whose payment did not arrive in time.
+func ReleaseExpiredPayments(r *repo.Repo) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := r.ReleaseExpiredPayments(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to release expired payments: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Released %d expired payment holds", n))
+		}
+		return nil
+	}
+}
+
+// ReleaseExpiredHolds deletes seat holds that were not confirmed in time.
+func ReleaseExpiredHolds(r *repo.Repo) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := r.ReleaseExpiredHolds(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to release expired holds: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Released %d expired seat holds", n))
+		}
+		return nil
+	}
+}
+
+// DeleteFinishedJobs deletes the jobs that finished longer than a week ago.
+func DeleteFinishedJobs(r *repo.Repo) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := r.DeleteFinishedJobs(ctx, time.Now().Add(-finishedJobRetention))
+		if err != nil {
+			return fmt.Errorf("Failed to delete finished jobs: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Deleted %d finished jobs", n))
+		}
+		return nil
+	}
+}
+
+// DeleteExpiredAuditEntries deletes the audit log entries older than the retention of the repo.
+func DeleteExpiredAuditEntries(r *repo.Repo) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := r.DeleteExpiredAuditEntries(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to delete expired audit entries: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Deleted %d expired audit entries", n))
+		}
+		return nil
+	}
+}
+
+// RelayOutbox publishes the outbox messages that are due to the sinks of 'relay'.
+func RelayOutbox(relay *outbox.Relay) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := relay.Relay(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to relay outbox: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Published %d outbox messages", n))
+		}
+		return nil
+	}
+}
+
+// DeliverWebhooks sends the webhook deliveries that are due.
+func DeliverWebhooks(webhooks *webhook.Dispatcher) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := webhooks.Deliver(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to deliver webhooks: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Attempted %d webhook deliveries", n))
+		}
+		return nil
+	}
+}
+
+// SendEmails sends the queued emails that are due.
+func SendEmails(mailer *notify.Mailer) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		n, err := mailer.Send(ctx)
+		if err != nil {
+			return fmt.Errorf("Failed to send emails: %w", err)
+		}
+		if n > 0 {
+			slog.Debug(fmt.Sprintf("Sent %d emails", n))
+		}
+		return nil
+	}
+}
+
+// SendReminder emails the member of the booking in the job's payload that their class starts soon. Nothing is sent if the booking is no longer active, and the reminder is rescheduled if the occurrence was moved later.
+func SendReminder(r *repo.Repo, notifier *notify.Notifier) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		var payload repo.ReminderPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return fmt.Errorf("Failed to decode reminder payload: %w", err)
+		}
+		booking, err := r.GetBooking(ctx, payload.BookingID)
+		if err != nil {
+			if err == repo.BookingNotFoundError {
+				return nil
+			}
+			return err
+		}
+		if booking.Status != repo.BookingStatusBooked {
+			return nil
+		}
+		class, err := r.GetClass(ctx, booking.ClassID)
+		if err != nil {
+			return err
+		}
+		occurrence := class.Occurrence(booking.Date)
+		now := time.Now()
+		// The occurrence was moved later since the reminder was scheduled. The minute of slack keeps rounding from rescheduling it.
+		if now.Before(occurrence.Add(-r.ReminderLead - time.Minute)) {
+			return r.ScheduleReminder(ctx, booking.ID)
+		}
+		if !now.Before(occurrence) {
+			return nil
+		}
+		return notifier.Remind(ctx, booking, class)
+	}
+}
+
+// Refund refunds what is still due of the drop-in payment of the cancelled booking in the job's payload. Stripe performs a refund of the same amount of a payment only once, so a refund that succeeded but wasn't recorded isn't made twice.
+func Refund(r *repo.Repo, payments payment.Provider) Handler {
+	return func(ctx context.Context, job *repo.Job) error {
+		var payload repo.RefundPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return fmt.Errorf("Failed to decode refund payload: %w", err)
+		}
+		booking, err := r.GetBooking(ctx, payload.BookingID)
+		if err != nil {
+			if err == repo.BookingNotFoundError {
+				return nil
+			}
+			return err
+		}
+		amount := booking.RefundDue()
+		if amount == 0 {
+			return nil
+		}
+		if err = payments.Refund(ctx, booking.PaymentID, amount); err != nil {
+			return fmt.Errorf("Failed to refund booking %d: %w", booking.ID, err)
+		}
+		return r.RecordRefund(ctx, booking.ID, amount)
+	}
+}
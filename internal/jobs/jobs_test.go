@@ -0,0 +1,405 @@
+package jobs_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/jobs"
+	"github.com/rohitxdev/abc-task/internal/notify"
+	"github.com/rohitxdev/abc-task/internal/outbox"
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, 1, 1, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+		err  bool
+	}{
+		{spec: "* * * * *", want: time.Date(2025, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2025, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 9-17/4 * * *", want: time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{spec: "@monthly", want: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 8 * * 1,5", want: time.Date(2025, 1, 3, 8, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{spec: "0 0 15 * 4", want: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 5s", want: time.Date(2025, 1, 1, 10, 30, 20, 0, time.UTC)},
+		{spec: "@every 1m", want: time.Date(2025, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{spec: "@every 1ms", err: true},
+		{spec: "@every soon", err: true},
+		{spec: "0 0 30 2 *", err: true},
+		{spec: "60 * * * *", err: true},
+		{spec: "* * * *", err: true},
+		{spec: "*/0 * * * *", err: true},
+		{spec: "5-1 * * * *", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			cron, err := jobs.ParseCron(tt.spec)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, cron.Next(from))
+		})
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+
+	s := jobs.NewScheduler(r)
+	// Retries are due right away so that they can be run without waiting
+	s.Backoff.Base = 0
+	failures := map[string]int{}
+	runs := map[string]int{}
+	s.Handle("test", func(ctx context.Context, job *repo.Job) error {
+		runs[job.Key]++
+		if failures[job.Key] > 0 {
+			failures[job.Key]--
+			if job.Payload == "panic" {
+				panic("Boom")
+			}
+			return errors.New("Not yet")
+		}
+		return nil
+	})
+	now := time.Now().Unix()
+
+	t.Run("Retries until done", func(t *testing.T) {
+		failures["retried"] = 1
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "test", Key: "retried", RunAt: now, MaxAttempts: 3}))
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "test", Key: "later", RunAt: now + 3600, MaxAttempts: 3}))
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "unhandled", Key: "unhandled", RunAt: now, MaxAttempts: 3}))
+		for range 2 {
+			n, err := s.RunDue(context.TODO())
+			assert.Nil(t, err)
+			assert.Equal(t, 1, n)
+		}
+		job, err := r.GetJob(context.TODO(), "retried")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusDone, job.Status)
+		assert.Equal(t, uint(2), job.Attempts)
+		assert.Equal(t, 2, runs["retried"])
+		assert.Zero(t, runs["later"])
+	})
+
+	t.Run("Gives up after the last attempt", func(t *testing.T) {
+		failures["panicking"] = 5
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "test", Key: "panicking", Payload: "panic", RunAt: now, MaxAttempts: 2}))
+		for range 3 {
+			_, err := s.RunDue(context.TODO())
+			assert.Nil(t, err)
+		}
+		job, err := r.GetJob(context.TODO(), "panicking")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusFailed, job.Status)
+		assert.Equal(t, "Job panicked: Boom", job.LastError)
+		assert.Equal(t, 2, runs["panicking"])
+
+		// Scheduling it again starts over
+		failures["panicking"] = 0
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "test", Key: "panicking", RunAt: now, MaxAttempts: 2}))
+		_, err = s.RunDue(context.TODO())
+		assert.Nil(t, err)
+		job, err = r.GetJob(context.TODO(), "panicking")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusDone, job.Status)
+	})
+
+	t.Run("Expired leases are run again", func(t *testing.T) {
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "test", Key: "abandoned", RunAt: now, MaxAttempts: 3}))
+		// Another scheduler leased the job and died
+		leased, err := r.LeaseJobs(context.TODO(), []string{"test"}, 10, 0)
+		assert.Nil(t, err)
+		assert.Len(t, leased, 1)
+		n, err := s.RunDue(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		// The dead scheduler can no longer finish the job
+		assert.Nil(t, r.FailJob(context.TODO(), &leased[0], "Too late"))
+		job, err := r.GetJob(context.TODO(), "abandoned")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusDone, job.Status)
+	})
+
+	t.Run("Jobs are handed back on shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		s.Handle("shutdown", func(jobCtx context.Context, job *repo.Job) error {
+			// Shutting down doesn't interrupt the running job
+			cancel()
+			return jobCtx.Err()
+		})
+		for _, key := range []string{"running", "waiting"} {
+			assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: "shutdown", Key: key, RunAt: now, MaxAttempts: 3}))
+		}
+		n, err := s.RunDue(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		job, err := r.GetJob(context.TODO(), "running")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusDone, job.Status)
+		job, err = r.GetJob(context.TODO(), "waiting")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusPending, job.Status)
+		assert.Zero(t, job.Attempts)
+	})
+
+	t.Run("Recurring", func(t *testing.T) {
+		calls := 0
+		every := func() error {
+			return s.Every(context.TODO(), "recurring", "0 0 1 1 *", 2, func(ctx context.Context, job *repo.Job) error {
+				calls++
+				return errors.New("Failed")
+			})
+		}
+		assert.Nil(t, every())
+		job, err := r.GetJob(context.TODO(), "recurring")
+		assert.Nil(t, err)
+		next := time.Date(time.Now().UTC().Year()+1, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+		assert.Equal(t, next, job.RunAt)
+
+		// Make the run due, like after a restart that missed it
+		job.RunAt = now
+		assert.Nil(t, r.ScheduleJob(context.TODO(), job))
+		assert.Nil(t, every())
+		job, err = r.GetJob(context.TODO(), "recurring")
+		assert.Nil(t, err)
+		assert.Equal(t, now, job.RunAt)
+
+		for range 2 {
+			_, err := s.RunDue(context.TODO())
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, 2, calls)
+		// The failed run is skipped rather than given up on
+		job, err = r.GetJob(context.TODO(), "recurring")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusPending, job.Status)
+		assert.Equal(t, next, job.RunAt)
+		assert.Equal(t, "Failed", job.LastError)
+		assert.Zero(t, job.Attempts)
+	})
+}
+
+func TestReminders(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+	r.ReminderLead = 2 * time.Hour
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	date := today.Unix() + 2*24*60*60
+	plan := repo.Plan{Name: "Unlimited", Kind: repo.PlanKindUnlimited}
+	assert.Nil(t, r.CreatePlan(context.TODO(), &plan))
+	assert.Nil(t, r.CreateSubscription(context.TODO(), &repo.Subscription{MemberName: "Rohit", PlanID: plan.ID, StartDate: today.Unix(), EndDate: date}))
+	assert.Nil(t, r.SetMemberEmail(context.TODO(), "Rohit", "rohit@example.com"))
+	class := repo.Class{Name: "Yoga", StartDate: date, EndDate: date, StartTime: 18 * 60 * 60, Capacity: 5}
+	assert.Nil(t, r.CreateClass(context.TODO(), &class))
+
+	s := jobs.NewScheduler(r)
+	s.Handle(repo.JobKindReminder, jobs.SendReminder(r, &notify.Notifier{Repo: r}))
+	capture := &notify.Capture{}
+	mailer := notify.NewMailer(r, capture, "hello@abc.fit")
+
+	kept, err := r.CreateBooking(context.TODO(), class.ID, "Rohit", date, nil)
+	assert.Nil(t, err)
+	cancelled, err := r.CreateBooking(context.TODO(), class.ID, "Rohit", date, nil)
+	assert.Nil(t, err)
+
+	t.Run("Scheduled before the occurrence", func(t *testing.T) {
+		job, err := r.GetJob(context.TODO(), fmt.Sprintf("reminder/%d", kept))
+		assert.Nil(t, err)
+		assert.Equal(t, class.Occurrence(date).Add(-2*time.Hour).Unix(), job.RunAt)
+	})
+
+	t.Run("Cancelled with the booking", func(t *testing.T) {
+		_, err := r.CancelBooking(context.TODO(), cancelled)
+		assert.Nil(t, err)
+		_, err = r.GetJob(context.TODO(), fmt.Sprintf("reminder/%d", cancelled))
+		assert.Equal(t, repo.JobNotFoundError, err)
+	})
+
+	t.Run("Rescheduled when due too early", func(t *testing.T) {
+		payload, err := json.Marshal(repo.ReminderPayload{BookingID: kept})
+		assert.Nil(t, err)
+		key := fmt.Sprintf("reminder/%d", kept)
+		assert.Nil(t, r.ScheduleJob(context.TODO(), &repo.Job{Kind: repo.JobKindReminder, Key: key, Payload: string(payload), RunAt: time.Now().Unix(), MaxAttempts: 3}))
+		n, err := s.RunDue(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		job, err := r.GetJob(context.TODO(), key)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusPending, job.Status)
+		assert.Equal(t, class.Occurrence(date).Add(-2*time.Hour).Unix(), job.RunAt)
+	})
+
+	t.Run("Sent when due", func(t *testing.T) {
+		// The occurrence is within the lead from now on
+		r.ReminderLead = 72 * time.Hour
+		job, err := r.GetJob(context.TODO(), fmt.Sprintf("reminder/%d", kept))
+		assert.Nil(t, err)
+		job.RunAt = time.Now().Unix()
+		assert.Nil(t, r.ScheduleJob(context.TODO(), job))
+		n, err := s.RunDue(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		_, err = mailer.Send(context.TODO())
+		assert.Nil(t, err)
+
+		messages := capture.Messages()
+		// Only the booking confirmations would be sent by the outbox, which isn't running here
+		assert.Len(t, messages, 1)
+		assert.Equal(t, "Your class Yoga starts soon", messages[0].Subject)
+		assert.Contains(t, messages[0].HTML, "at 18:00 UTC")
+		job, err = r.GetJob(context.TODO(), fmt.Sprintf("reminder/%d", kept))
+		assert.Nil(t, err)
+		assert.Equal(t, repo.JobStatusDone, job.Status)
+	})
+}
+
+// failingPayments can't refund payments.
+type failingPayments struct {
+	payment.Provider
+}
+
+func (failingPayments) Refund(ctx context.Context, paymentID string, amount int64) error {
+	return errors.New("Payment provider unavailable")
+}
+
+// countingPayments counts the refunds made.
+type countingPayments struct {
+	payment.Provider
+	refunds int
+}
+
+func (p *countingPayments) Refund(ctx context.Context, paymentID string, amount int64) error {
+	p.refunds++
+	return p.Provider.Refund(ctx, paymentID, amount)
+}
+
+func TestRefunds(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+
+	date := time.Now().UTC().Truncate(24*time.Hour).Unix() + 2*24*60*60
+	class := repo.Class{Name: "Yoga", StartDate: date, EndDate: date, StartTime: 18 * 60 * 60, Capacity: 5, Price: 1500}
+	assert.Nil(t, r.CreateClass(context.TODO(), &class))
+	payments := payment.NewFake("secret")
+	booking, err := r.CreateDropInBooking(context.TODO(), class.ID, "Rohit", date, time.Hour, nil)
+	assert.Nil(t, err)
+	p, err := payments.CreatePayment(context.TODO(), payment.Request{Amount: booking.Amount, Currency: "usd", BookingID: booking.ID})
+	assert.Nil(t, err)
+	assert.Nil(t, r.SetBookingPayment(context.TODO(), booking.ID, p.ID))
+	_, err = r.ConfirmPayment(context.TODO(), p.ID)
+	assert.Nil(t, err)
+
+	// The refund is due right away and retried when it fails
+	_, err = r.CancelBooking(context.TODO(), booking.ID)
+	assert.Nil(t, err)
+	key := fmt.Sprintf("refund/%d", booking.ID)
+	job, err := r.GetJob(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, job.RunAt, time.Now().Unix())
+
+	s := jobs.NewScheduler(r)
+	s.Handle(repo.JobKindRefund, jobs.Refund(r, failingPayments{}))
+	n, err := s.RunDue(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	job, err = r.GetJob(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, repo.JobStatusPending, job.Status)
+	assert.Contains(t, job.LastError, "Payment provider unavailable")
+
+	counting := &countingPayments{Provider: payments}
+	s.Handle(repo.JobKindRefund, jobs.Refund(r, counting))
+	job.RunAt = time.Now().Unix()
+	assert.Nil(t, r.ScheduleJob(context.TODO(), job))
+	n, err = s.RunDue(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(1500), payments.Refunded(p.ID))
+	refunded, err := r.GetBooking(context.TODO(), booking.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1500), refunded.RefundedAmount)
+	job, err = r.GetJob(context.TODO(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, repo.JobStatusDone, job.Status)
+
+	// The cancellation is refunded exactly once, even if the job runs again
+	job.RunAt = time.Now().Unix()
+	assert.Nil(t, r.ScheduleJob(context.TODO(), job))
+	n, err = s.RunDue(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, counting.refunds)
+	assert.Equal(t, int64(1500), payments.Refunded(p.ID))
+}
+
+func TestQueues(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+
+	var published bytes.Buffer
+	s := jobs.NewScheduler(r)
+	relay := outbox.NewRelay(r, &outbox.WriterSink{W: &published})
+	assert.Nil(t, jobs.RegisterQueues(context.TODO(), s, relay, webhook.NewDispatcher(r), notify.NewMailer(r, &notify.Capture{}, "hello@abc.fit")))
+	date := time.Now().UTC().Truncate(24*time.Hour).Unix() + 2*24*60*60
+	assert.Nil(t, r.CreateClass(context.TODO(), &repo.Class{Name: "Yoga", StartDate: date, EndDate: date, Capacity: 5}))
+
+	job, err := r.GetJob(context.TODO(), jobs.KindRelayOutbox)
+	assert.Nil(t, err)
+	job.RunAt = time.Now().Unix()
+	assert.Nil(t, r.ScheduleJob(context.TODO(), job))
+	n, err := s.RunDue(context.TODO())
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+	assert.Contains(t, published.String(), `"type":"class.created"`)
+	job, err = r.GetJob(context.TODO(), jobs.KindRelayOutbox)
+	assert.Nil(t, err)
+	// The next run follows within a second
+	assert.Equal(t, repo.JobStatusPending, job.Status)
+	assert.InDelta(t, time.Now().Unix()+1, job.RunAt, 1)
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/backoff"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Handler runs a job. Returning an error retries it with backoff until the job runs out of attempts.
+type Handler func(ctx context.Context, job *repo.Job) error
+
+// Scheduler runs the jobs persisted in the database once they are due. Jobs are leased while they run, so that jobs of a scheduler that died are picked up again once their lease expires.
+type Scheduler struct {
+	Repo *repo.Repo
+	// How long a job may run before it is assumed to have died and is run again
+	Lease time.Duration
+	// Delays the retries of failed jobs
+	Backoff backoff.Exponential
+	// Maximum number of jobs run per tick
+	BatchSize int
+
+	handlers  map[string]Handler
+	recurring map[string]*Cron
+}
+
+func NewScheduler(r *repo.Repo) *Scheduler {
+	return &Scheduler{
+		Repo:      r,
+		Lease:     5 * time.Minute,
+		Backoff:   backoff.Exponential{Base: 30 * time.Second, Max: 30 * time.Minute},
+		BatchSize: 20,
+		handlers:  map[string]Handler{},
+		recurring: map[string]*Cron{},
+	}
+}
+
+// Handle makes the scheduler run the jobs of 'kind' with 'h'. Jobs of kinds without a handler are left alone.
+func (s *Scheduler) Handle(kind string, h Handler) {
+	s.handlers[kind] = h
+}
+
+// Every runs 'h' on the cron schedule 'spec' as the job 'kind'. The job is persisted like any other, so runs missed while the process was down are made up for once, and a run that fails is retried up to 'maxAttempts' times before it is skipped.
+func (s *Scheduler) Every(ctx context.Context, kind string, spec string, maxAttempts uint, h Handler) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	s.Handle(kind, h)
+	s.recurring[kind] = cron
+	// The job keeps its schedule across restarts unless it changed
+	job, err := s.Repo.GetJob(ctx, kind)
+	if err == nil && job.Payload == spec && (job.Status == repo.JobStatusPending || job.Status == repo.JobStatusRunning) {
+		return nil
+	}
+	if err != nil && err != repo.JobNotFoundError {
+		return err
+	}
+	return s.Repo.ScheduleJob(ctx, &repo.Job{Kind: kind, Key: kind, Payload: spec, RunAt: cron.Next(time.Now()).Unix(), MaxAttempts: maxAttempts})
+}
+
+// RunDue runs the jobs that are due one after the other and returns how many were run. Once 'ctx' is cancelled the job that is running is allowed to finish, and the jobs that haven't started are handed back.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	kinds := make([]string, 0, len(s.handlers))
+	for kind := range s.handlers {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	jobs, err := s.Repo.LeaseJobs(ctx, kinds, s.BatchSize, s.Lease)
+	if err != nil {
+		return 0, err
+	}
+	finishCtx := context.WithoutCancel(ctx)
+	for i := range jobs {
+		if ctx.Err() != nil {
+			for _, job := range jobs[i:] {
+				if err = s.Repo.ReleaseJob(finishCtx, &job); err != nil {
+					return i, err
+				}
+			}
+			return i, nil
+		}
+		if err = s.run(finishCtx, &jobs[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(jobs), nil
+}
+
+// run runs the leased job and records the outcome.
+func (s *Scheduler) run(ctx context.Context, job *repo.Job) error {
+	// The job has to finish before its lease expires and it is run again
+	runCtx, cancel := context.WithTimeout(ctx, s.Lease)
+	err := s.call(runCtx, job)
+	cancel()
+	now := time.Now()
+
+	if cron, ok := s.recurring[job.Kind]; ok {
+		switch {
+		case err == nil:
+			return s.Repo.RescheduleJob(ctx, job, "", cron.Next(now))
+		case job.Attempts < job.MaxAttempts:
+			return s.Repo.RetryJob(ctx, job, err.Error(), now.Add(s.Backoff.Delay(job.Attempts)))
+		default:
+			slog.Error(fmt.Sprintf("Skipped run of job %s after %d attempts: %s", job.Kind, job.Attempts, err.Error()))
+			return s.Repo.RescheduleJob(ctx, job, err.Error(), cron.Next(now))
+		}
+	}
+	switch {
+	case err == nil:
+		return s.Repo.CompleteJob(ctx, job)
+	case job.Attempts < job.MaxAttempts:
+		return s.Repo.RetryJob(ctx, job, err.Error(), now.Add(s.Backoff.Delay(job.Attempts)))
+	default:
+		slog.Error(fmt.Sprintf("Gave up on job %d (%s) after %d attempts: %s", job.ID, job.Kind, job.Attempts, err.Error()))
+		return s.Repo.FailJob(ctx, job, err.Error())
+	}
+}
+
+// call runs the handler of the job, turning a panic into an error so that it is retried like any other failure. Changes the handler makes are recorded in the audit log as made by 'job:<kind>'.
+func (s *Scheduler) call(ctx context.Context, job *repo.Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("Job panicked: %v", v)
+		}
+	}()
+	return s.handlers[job.Kind](repo.WithActor(ctx, "job:"+job.Kind, ""), job)
+}
+
+// Run runs due jobs every 'interval' until 'ctx' is cancelled. Jobs that are running by then are allowed to finish, so Run returning means the scheduler can be shut down safely.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.RunDue(ctx)
+			if err != nil {
+				slog.Error("Failed to run jobs: " + err.Error())
+				continue
+			}
+			if n > 0 {
+				slog.Debug(fmt.Sprintf("Ran %d jobs", n))
+			}
+		}
+	}
+}
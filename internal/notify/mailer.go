@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/backoff"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Message is an email as handed to a Sender.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	// HTML body
+	HTML string
+}
+
+// Sender sends an email once.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Mailer sends queued emails through Sender.
+type Mailer struct {
+	Repo   *repo.Repo
+	Sender Sender
+	// Address emails are sent from
+	From string
+	// Emails are given up on after this many failed attempts
+	MaxAttempts uint
+	// Delays the retries of failed emails
+	Backoff backoff.Exponential
+	// Maximum number of emails sent per run
+	BatchSize int
+}
+
+func NewMailer(r *repo.Repo, sender Sender, from string) *Mailer {
+	return &Mailer{
+		Repo:        r,
+		Sender:      sender,
+		From:        from,
+		MaxAttempts: 6,
+		Backoff:     backoff.Exponential{Base: time.Minute, Max: time.Hour},
+		BatchSize:   20,
+	}
+}
+
+// Send sends the emails that are due and returns how many were sent. Failed emails are scheduled for a retry until MaxAttempts is reached.
+func (m *Mailer) Send(ctx context.Context) (int, error) {
+	emails, err := m.Repo.GetDueEmails(ctx, m.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, email := range emails {
+		msg := &Message{From: m.From, To: email.Recipient, Subject: email.Subject, HTML: email.Body}
+		if err = m.Sender.Send(ctx, msg); err != nil {
+			failed := email.Attempts+1 >= m.MaxAttempts
+			if failed {
+				slog.Error(fmt.Sprintf("Gave up on email %d to %s: %s", email.ID, email.Recipient, err.Error()))
+			}
+			if err = m.Repo.MarkEmailFailed(ctx, email.ID, err.Error(), time.Now().Add(m.Backoff.Delay(email.Attempts+1)), failed); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err = m.Repo.MarkEmailSent(ctx, email.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,149 @@
+// Package notify emails members about their bookings, such as confirmations and reminders. Emails are queued in the database and sent in the background with retries, so a slow mail server never holds up requests.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Template names an email members are sent.
+type Template string
+
+const (
+	TemplateBookingConfirmed Template = "booking_confirmed"
+	TemplateBookingCancelled Template = "booking_cancelled"
+	TemplateWaitlistPromoted Template = "waitlist_promoted"
+	TemplateClassCancelled   Template = "class_cancelled"
+	TemplateClassReminder    Template = "class_reminder"
+)
+
+// TemplateData is what templates are rendered with.
+type TemplateData struct {
+	Subject    string
+	MemberName string
+	ClassName  string
+	// e.g. 'Monday, 2 January 2006'
+	Date string
+	// In the time zone of the class, e.g. '15:04 UTC' or '18:30 BST'
+	StartTime string
+}
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// Every template is rendered inside the layout, which expects it to define 'content'.
+var templates = map[Template]*template.Template{}
+
+var subjects = map[Template]string{
+	TemplateBookingConfirmed: "Your booking for %s is confirmed",
+	TemplateBookingCancelled: "Your booking for %s is cancelled",
+	TemplateWaitlistPromoted: "You got a spot in %s",
+	TemplateClassCancelled:   "%s is cancelled",
+	TemplateClassReminder:    "Your class %s starts soon",
+}
+
+func init() {
+	for name := range subjects {
+		templates[name] = template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/"+string(name)+".html"))
+	}
+}
+
+// Render returns the subject and HTML body of the email.
+func Render(name Template, data *TemplateData) (string, string, error) {
+	t, ok := templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("Unknown email template %q", name)
+	}
+	data.Subject = fmt.Sprintf(subjects[name], data.ClassName)
+	var body bytes.Buffer
+	if err := t.ExecuteTemplate(&body, "layout.html", data); err != nil {
+		return "", "", fmt.Errorf("Failed to render email template %q: %w", name, err)
+	}
+	return data.Subject, body.String(), nil
+}
+
+// Notifier turns events into emails to the members they concern.
+type Notifier struct {
+	Repo *repo.Repo
+}
+
+// Notify queues the emails due for the event. Members who haven't given an email address are skipped, and so are events nobody is emailed about. Notifying about the same event again queues nothing.
+func (n *Notifier) Notify(ctx context.Context, eventID string, eventType repo.EventType, data json.RawMessage) error {
+	switch eventType {
+	case repo.EventBookingCreated, repo.EventBookingCancelled, repo.EventWaitlistPromoted:
+		var event repo.BookingEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("Failed to decode %s event: %w", eventType, err)
+		}
+		name := TemplateBookingConfirmed
+		switch eventType {
+		case repo.EventBookingCancelled:
+			name = TemplateBookingCancelled
+		case repo.EventWaitlistPromoted:
+			name = TemplateWaitlistPromoted
+		}
+		return n.enqueue(ctx, eventID, name, event.ClassID, event.Date, event.MemberName)
+	case repo.EventClassCancelled:
+		var event repo.OccurrenceEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("Failed to decode %s event: %w", eventType, err)
+		}
+		date, err := time.Parse(time.DateOnly, event.Date)
+		if err != nil {
+			return err
+		}
+		bookings, err := n.Repo.GetRoster(ctx, event.ClassID, date.Unix())
+		if err != nil {
+			return err
+		}
+		for _, booking := range bookings {
+			if booking.Status != repo.BookingStatusBooked {
+				continue
+			}
+			if err = n.enqueue(ctx, eventID, TemplateClassCancelled, event.ClassID, event.Date, booking.MemberName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Remind queues the reminder of the booking of the occurrence of 'class'. Reminding of the same occurrence again queues nothing.
+func (n *Notifier) Remind(ctx context.Context, booking *repo.Booking, class *repo.Class) error {
+	id := fmt.Sprintf("reminder_%d_%d", booking.ID, class.Occurrence(booking.Date).Unix())
+	return n.enqueue(ctx, id, TemplateClassReminder, class.ID, time.Unix(booking.Date, 0).UTC().Format(time.DateOnly), booking.MemberName)
+}
+
+// enqueue renders the email about the occurrence of the class on 'date' and queues it for the member.
+func (n *Notifier) enqueue(ctx context.Context, eventID string, name Template, classID uint64, date string, memberName string) error {
+	to, err := n.Repo.GetMemberEmail(ctx, memberName)
+	if err != nil || to == "" {
+		return err
+	}
+	class, err := n.Repo.GetClass(ctx, classID)
+	if err != nil {
+		return err
+	}
+	day, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return err
+	}
+	subject, body, err := Render(name, &TemplateData{
+		MemberName: memberName,
+		ClassName:  class.Name,
+		Date:       day.Format("Monday, 2 January 2006"),
+		StartTime:  class.Occurrence(day.Unix()).In(class.Location()).Format("15:04 MST"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = n.Repo.EnqueueEmail(ctx, &repo.Email{Key: eventID + "/" + memberName, Recipient: to, Subject: subject, Body: body})
+	return err
+}
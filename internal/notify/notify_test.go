@@ -0,0 +1,217 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/notify"
+	"github.com/rohitxdev/abc-task/internal/outbox"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingSender fails the first 'failures' emails it is asked to send.
+type failingSender struct {
+	failures int
+	notify.Capture
+}
+
+func (s *failingSender) Send(ctx context.Context, msg *notify.Message) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("Mail server unavailable")
+	}
+	return s.Capture.Send(ctx, msg)
+}
+
+func TestNotifications(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	date := today.Unix() + 24*60*60
+	plan := repo.Plan{Name: "Unlimited", Kind: repo.PlanKindUnlimited}
+	assert.Nil(t, r.CreatePlan(context.TODO(), &plan))
+	for _, member := range []string{"Rohit", "Silent"} {
+		assert.Nil(t, r.CreateSubscription(context.TODO(), &repo.Subscription{MemberName: member, PlanID: plan.ID, StartDate: today.Unix(), EndDate: date}))
+	}
+	class := repo.Class{Name: "Yoga <Flow>", StartDate: date, EndDate: date, StartTime: 18 * 60 * 60, Capacity: 5}
+	assert.Nil(t, r.CreateClass(context.TODO(), &class))
+	assert.Nil(t, r.SetMemberEmail(context.TODO(), "Rohit", "old@example.com"))
+	assert.Nil(t, r.SetMemberEmail(context.TODO(), "Rohit", "rohit@example.com"))
+
+	notifier := &notify.Notifier{Repo: r}
+	relay := outbox.NewRelay(r, &outbox.EmailSink{Notifier: notifier})
+	sender := &failingSender{failures: 1}
+	mailer := notify.NewMailer(r, sender, "hello@abc.fit")
+	// Retries are due right away so that they can be sent without waiting
+	mailer.Backoff.Base = 0
+	mailer.MaxAttempts = 2
+
+	t.Run("Booking confirmation", func(t *testing.T) {
+		id, err := r.CreateBooking(context.TODO(), class.ID, "Rohit", date, nil)
+		assert.Nil(t, err)
+		_, err = r.CreateBooking(context.TODO(), class.ID, "Silent", date, nil)
+		assert.Nil(t, err)
+		_, err = relay.Relay(context.TODO())
+		assert.Nil(t, err)
+
+		// The first attempt fails and is retried
+		n, err := mailer.Send(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+		n, err = mailer.Send(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		messages := sender.Messages()
+		assert.Len(t, messages, 1)
+		assert.Equal(t, "hello@abc.fit", messages[0].From)
+		assert.Equal(t, "rohit@example.com", messages[0].To)
+		assert.Equal(t, "Your booking for Yoga <Flow> is confirmed", messages[0].Subject)
+		assert.Contains(t, messages[0].HTML, "Hi Rohit,")
+		assert.Contains(t, messages[0].HTML, "Yoga &lt;Flow&gt;")
+		assert.Contains(t, messages[0].HTML, time.Unix(date, 0).UTC().Format("Monday, 2 January 2006")+" at 18:00 UTC")
+
+		_, err = r.CancelBooking(context.TODO(), id)
+		assert.Nil(t, err)
+		_, err = relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		n, err = mailer.Send(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "Your booking for Yoga <Flow> is cancelled", sender.Messages()[1].Subject)
+	})
+
+	t.Run("Events are notified about once", func(t *testing.T) {
+		data, err := json.Marshal(repo.BookingEvent{ID: 1, ClassID: class.ID, MemberName: "Rohit", Date: time.Unix(date, 0).UTC().Format(time.DateOnly)})
+		assert.Nil(t, err)
+		for range 2 {
+			assert.Nil(t, notifier.Notify(context.TODO(), "evt_waitlist", repo.EventWaitlistPromoted, data))
+		}
+		emails, err := r.GetEmails(context.TODO(), "rohit@example.com")
+		assert.Nil(t, err)
+		assert.Len(t, emails, 3)
+		assert.Equal(t, "You got a spot in Yoga <Flow>", emails[2].Subject)
+	})
+
+	t.Run("Class cancellation", func(t *testing.T) {
+		assert.Nil(t, r.SetMemberEmail(context.TODO(), "Silent", "silent@example.com"))
+		data, err := json.Marshal(repo.OccurrenceEvent{ClassID: class.ID, Date: time.Unix(date, 0).UTC().Format(time.DateOnly)})
+		assert.Nil(t, err)
+		assert.Nil(t, notifier.Notify(context.TODO(), "evt_cancel", repo.EventClassCancelled, data))
+		// Rohit cancelled, so only Silent is booked
+		emails, err := r.GetEmails(context.TODO(), "silent@example.com")
+		assert.Nil(t, err)
+		assert.Len(t, emails, 1)
+		assert.Equal(t, "Yoga <Flow> is cancelled", emails[0].Subject)
+	})
+
+	t.Run("Given up on after the last attempt", func(t *testing.T) {
+		// The waitlist and class cancellation emails fail twice each
+		sender.failures = 4
+		for range 2 {
+			n, err := mailer.Send(context.TODO())
+			assert.Nil(t, err)
+			assert.Equal(t, 0, n)
+		}
+		emails, err := r.GetEmails(context.TODO(), "silent@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.EmailStatusFailed, emails[0].Status)
+		assert.Equal(t, uint(2), emails[0].Attempts)
+		assert.Equal(t, "Mail server unavailable", emails[0].LastError)
+		n, err := mailer.Send(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+	})
+}
+
+// serveSMTP accepts a single SMTP session on 'ls' and sends the data of the email it receives on 'data'.
+func serveSMTP(ls net.Listener, data chan<- string) {
+	conn, err := ls.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	reply := func(line string) {
+		rw.WriteString(line + "\r\n")
+		rw.Flush()
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var b strings.Builder
+			for {
+				line, err := rw.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				b.WriteString(line)
+			}
+			data <- b.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ls.Close()
+	data := make(chan string, 1)
+	go serveSMTP(ls, data)
+
+	sender := &notify.SMTPSender{Addr: ls.Addr().String(), Timeout: 5 * time.Second}
+	msg := &notify.Message{From: "hello@abc.fit", To: "rohit@example.com", Subject: "Your booking for Yoga is confirmed", HTML: "<p>Hi Rohit,</p>"}
+	assert.Nil(t, sender.Send(context.TODO(), msg))
+	email := <-data
+	assert.Contains(t, email, "To: rohit@example.com\r\n")
+	assert.Contains(t, email, "Subject: Your booking for Yoga is confirmed\r\n")
+	assert.Contains(t, email, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, email, "<p>Hi Rohit,</p>")
+
+	// Nothing is listening anymore
+	ls.Close()
+	assert.NotNil(t, sender.Send(context.TODO(), msg))
+}
+
+func TestFileSender(t *testing.T) {
+	dir := t.TempDir()
+	sender := &notify.FileSender{Dir: dir}
+	assert.Nil(t, sender.Send(context.TODO(), &notify.Message{From: "hello@abc.fit", To: "rohit@example.com", Subject: "Hi", HTML: "<p>Hi</p>"}))
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), ".eml"))
+}
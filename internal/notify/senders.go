@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Format encodes the message as an RFC 5322 email with a quoted-printable HTML body.
+func Format(msg *Message, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(&b)
+	w.Write([]byte(msg.HTML))
+	w.Close()
+	return b.Bytes()
+}
+
+// SMTPSender sends emails through an SMTP server, upgrading the connection with STARTTLS when the server supports it.
+type SMTPSender struct {
+	// host:port of the server
+	Addr string
+	// Used for PLAIN authentication when set
+	Username string
+	Password string
+	// Limits how long sending an email may take. No limit when zero.
+	Timeout time.Duration
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	// The SMTP client doesn't take a context, so the connection is bounded by its deadline instead
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(msg.From); err != nil {
+		return err
+	}
+	if err = c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(Format(msg, time.Now())); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// FileSender writes every email to a .eml file in Dir instead of sending it, for development.
+type FileSender struct {
+	Dir string
+}
+
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.WriteFile(filepath.Join(s.Dir, fmt.Sprintf("%d.eml", now.UnixNano())), Format(msg, now), 0644)
+}
+
+// LogSender logs emails instead of sending them, for development.
+type LogSender struct{}
+
+func (s *LogSender) Send(ctx context.Context, msg *Message) error {
+	slog.Info(fmt.Sprintf("Email to %s: %s", msg.To, msg.Subject))
+	return nil
+}
+
+// Capture keeps emails in memory instead of sending them, for tests.
+type Capture struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *Capture) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, *msg)
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first.
+func (s *Capture) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
@@ -0,0 +1,104 @@
+// Package outbox publishes the events the repo records together with the changes they describe. Events are published at least once: a message is retried until every sink has accepted it, so sinks may see it more than once and should deduplicate by event ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/backoff"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Event is how messages are handed to sinks.
+type Event struct {
+	// Derived from the outbox message, so retries carry the same ID
+	ID        string          `json:"id"`
+	Type      repo.EventType  `json:"type"`
+	ClassID   uint64          `json:"classId"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func newEvent(m *repo.OutboxMessage) *Event {
+	return &Event{
+		ID:        fmt.Sprintf("evt_%d", m.ID),
+		Type:      m.Type,
+		ClassID:   m.ClassID,
+		CreatedAt: time.Unix(m.CreatedAt, 0).UTC(),
+		Data:      m.Data,
+	}
+}
+
+// Sink is a destination events are published to.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event *Event) error
+}
+
+// Relay publishes pending outbox messages to its sinks.
+type Relay struct {
+	Repo  *repo.Repo
+	Sinks []Sink
+	// Messages are dead-lettered after this many failed attempts
+	MaxAttempts uint
+	// Delays the retries of failed messages
+	Backoff backoff.Exponential
+	// How many messages are published per run
+	BatchSize int
+}
+
+func NewRelay(r *repo.Repo, sinks ...Sink) *Relay {
+	return &Relay{
+		Repo:        r,
+		Sinks:       sinks,
+		MaxAttempts: 10,
+		Backoff:     backoff.Exponential{Base: 5 * time.Second, Max: time.Hour},
+		BatchSize:   100,
+	}
+}
+
+// Relay publishes the messages that are due and returns how many were published. Once a message of a class fails, later messages of the class wait until it has been published or dead-lettered.
+func (rl *Relay) Relay(ctx context.Context) (int, error) {
+	messages, err := rl.Repo.GetDueOutboxMessages(ctx, rl.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	blocked := map[uint64]bool{}
+	for _, m := range messages {
+		if blocked[m.ClassID] {
+			continue
+		}
+		if err = rl.publish(ctx, newEvent(&m)); err != nil {
+			blocked[m.ClassID] = true
+			dead := m.Attempts+1 >= rl.MaxAttempts
+			if dead {
+				slog.Error(fmt.Sprintf("Dead-lettered outbox message %d: %s", m.ID, err.Error()))
+			}
+			if err = rl.Repo.MarkOutboxFailed(ctx, m.ID, err.Error(), time.Now().Add(rl.Backoff.Delay(m.Attempts+1)), dead); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err = rl.Repo.MarkOutboxPublished(ctx, m.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// publish hands the event to every sink, including those after a failing one, and returns the errors of all failing sinks.
+func (rl *Relay) publish(ctx context.Context, event *Event) error {
+	var errs []error
+	for _, sink := range rl.Sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package outbox_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/outbox"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySink records the events it is sent and fails for the classes in 'failing'.
+type memorySink struct {
+	failing map[uint64]bool
+	events  []*outbox.Event
+}
+
+func (s *memorySink) Name() string {
+	return "memory"
+}
+
+func (s *memorySink) Publish(ctx context.Context, event *outbox.Event) error {
+	if s.failing[event.ClassID] {
+		return errors.New("Sink unavailable")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+
+	date := time.Now().UTC().Truncate(24*time.Hour).Unix() + 24*60*60
+	classes := make([]repo.Class, 2)
+	for i := range classes {
+		classes[i] = repo.Class{Name: "Relayed", StartDate: date, EndDate: date, Capacity: 5}
+		assert.Nil(t, r.CreateClass(context.TODO(), &classes[i]))
+	}
+
+	sink := &memorySink{failing: map[uint64]bool{classes[0].ID: true}}
+	var out bytes.Buffer
+	relay := outbox.NewRelay(r, sink, &outbox.WriterSink{W: &out})
+	// Retries are due right away so that they can be made without waiting
+	relay.Backoff.Base = 0
+	relay.MaxAttempts = 2
+
+	t.Run("Failures hold back their class only", func(t *testing.T) {
+		n, err := relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		assert.Len(t, sink.events, 1)
+		assert.Equal(t, classes[1].ID, sink.events[0].ClassID)
+		assert.Equal(t, repo.EventClassCreated, sink.events[0].Type)
+	})
+
+	t.Run("Dead-lettered after the last attempt", func(t *testing.T) {
+		n, err := relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+		dead, err := r.GetDeadOutboxMessages(context.TODO())
+		assert.Nil(t, err)
+		assert.Len(t, dead, 1)
+		assert.Contains(t, dead[0].LastError, "memory: Sink unavailable")
+	})
+
+	t.Run("Retried dead letters are published again", func(t *testing.T) {
+		sink.failing = nil
+		dead, err := r.GetDeadOutboxMessages(context.TODO())
+		assert.Nil(t, err)
+		assert.Nil(t, r.RetryOutboxMessage(context.TODO(), dead[0].ID))
+		n, err := relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, classes[0].ID, sink.events[1].ClassID)
+		// The writer sink saw every attempt, as sinks are retried together
+		assert.Equal(t, 4, bytes.Count(out.Bytes(), []byte("\n")))
+	})
+
+	t.Run("NATS", func(t *testing.T) {
+		ns, conn, err := outbox.StartEmbeddedNATS()
+		assert.Nil(t, err)
+		defer ns.Shutdown()
+		defer conn.Close()
+		sub, err := conn.SubscribeSync("abc.>")
+		assert.Nil(t, err)
+
+		relay := outbox.NewRelay(r, &outbox.NATSSink{Conn: conn, Prefix: "abc"})
+		_, err = r.CreateBooking(context.TODO(), classes[1].ID, "Rohit", date, nil)
+		assert.Equal(t, repo.NoActiveMembershipError, err)
+		class := repo.Class{Name: "Announced", StartDate: date, EndDate: date, Capacity: 5}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		n, err := relay.Relay(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		msg, err := sub.NextMsg(time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc.class.created", msg.Subject)
+		var event outbox.Event
+		assert.Nil(t, json.Unmarshal(msg.Data, &event))
+		assert.Equal(t, class.ID, event.ClassID)
+		assert.Equal(t, event.ID, msg.Header.Get(nats.MsgIdHdr))
+	})
+}
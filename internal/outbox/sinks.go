@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/rohitxdev/abc-task/internal/notify"
+	"github.com/rohitxdev/abc-task/internal/webhook"
+)
+
+// WebhookSink queues events for delivery to the webhooks subscribed to them.
+type WebhookSink struct {
+	Dispatcher *webhook.Dispatcher
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event *Event) error {
+	return s.Dispatcher.Enqueue(ctx, &webhook.Event{ID: event.ID, Type: event.Type, CreatedAt: event.CreatedAt, Data: event.Data})
+}
+
+// EmailSink queues emails to the members events concern.
+type EmailSink struct {
+	Notifier *notify.Notifier
+}
+
+func (s *EmailSink) Name() string {
+	return "email"
+}
+
+func (s *EmailSink) Publish(ctx context.Context, event *Event) error {
+	return s.Notifier.Notify(ctx, event.ID, event.Type, event.Data)
+}
+
+// WriterSink writes events to W as newline delimited JSON, e.g. to stdout.
+type WriterSink struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+func (s *WriterSink) Name() string {
+	return "stdout"
+}
+
+func (s *WriterSink) Publish(ctx context.Context, event *Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.W.Write(append(b, '\n'))
+	return err
+}
+
+// NATSSink publishes events to NATS on the subject '<Prefix>.<event type>', e.g. 'abc.booking.created'.
+type NATSSink struct {
+	Conn   *nats.Conn
+	Prefix string
+}
+
+func (s *NATSSink) Name() string {
+	return "nats"
+}
+
+func (s *NATSSink) Publish(ctx context.Context, event *Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.Prefix + "." + string(event.Type))
+	msg.Data = b
+	// Lets JetStream streams deduplicate redeliveries
+	msg.Header.Set(nats.MsgIdHdr, event.ID)
+	if err = s.Conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	// Publishing is asynchronous, so the message only counts as published once the server has seen it
+	if _, ok := ctx.Deadline(); !ok {
+		return s.Conn.FlushTimeout(5 * time.Second)
+	}
+	return s.Conn.FlushWithContext(ctx)
+}
+
+// StartEmbeddedNATS runs a NATS server inside the process that is only reachable through the returned connection. Shutting down the server closes the connection.
+func StartEmbeddedNATS() (*server.Server, *nats.Conn, error) {
+	ns, err := server.NewServer(&server.Options{DontListen: true, NoSigs: true, NoLog: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create NATS server: %w", err)
+	}
+	ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		ns.Shutdown()
+		return nil, nil, fmt.Errorf("NATS server did not start in time")
+	}
+	conn, err := nats.Connect("", nats.InProcessServer(ns))
+	if err != nil {
+		ns.Shutdown()
+		return nil, nil, fmt.Errorf("Failed to connect to NATS server: %w", err)
+	}
+	return ns, conn, nil
+}
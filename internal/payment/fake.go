@@ -0,0 +1,62 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Fake keeps payments in memory. Nothing is charged; events for its payments are produced with Event.
+type Fake struct {
+	// Secret the events are signed with
+	WebhookSecret string
+
+	mu       sync.Mutex
+	payments map[string]Request
+	refunds  map[string]int64
+}
+
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{WebhookSecret: webhookSecret, payments: map[string]Request{}, refunds: map[string]int64{}}
+}
+
+func (f *Fake) CreatePayment(ctx context.Context, req Request) (*Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("pi_fake_%d", len(f.payments)+1)
+	f.payments[id] = req
+	return &Payment{ID: id, ClientSecret: id + "_secret"}, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, paymentID string, amount int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req, ok := f.payments[paymentID]
+	if !ok {
+		return fmt.Errorf("Failed to refund payment: no such payment %s", paymentID)
+	}
+	if f.refunds[paymentID]+amount > req.Amount {
+		return fmt.Errorf("Failed to refund payment: refunds exceed the amount of %s", paymentID)
+	}
+	f.refunds[paymentID] += amount
+	return nil
+}
+
+// Refunded returns the total amount refunded for the payment.
+func (f *Fake) Refunded(paymentID string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refunds[paymentID]
+}
+
+// Event returns the payload of a webhook event of 'eventType' for the payment and its Stripe-Signature header.
+func (f *Fake) Event(eventType EventType, paymentID string, now time.Time) ([]byte, string) {
+	var event Event
+	event.ID = fmt.Sprintf("evt_%s_%d", paymentID, now.UnixNano())
+	event.Type = eventType
+	event.Data.Object.ID = paymentID
+	payload, _ := json.Marshal(event)
+	return payload, SignatureHeader(f.WebhookSecret, payload, now)
+}
@@ -0,0 +1,125 @@
+// Package payment takes payments for drop-in bookings through a payment provider.
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidSignatureError = errors.New("Webhook signature is invalid")
+	UnknownEventError     = errors.New("Webhook event type is not handled")
+)
+
+// How old a signed webhook event may be before it is rejected as a replay
+const WebhookTolerance = 5 * time.Minute
+
+// Request describes a payment to be collected from a member.
+type Request struct {
+	// In the smallest unit of the currency, e.g. cents
+	Amount   int64
+	Currency string
+	// Stored with the payment and sent back in webhook events
+	BookingID   uint64
+	Description string
+}
+
+type Payment struct {
+	ID string
+	// Handed to the client to complete the payment
+	ClientSecret string
+}
+
+// Provider collects and refunds payments. Their outcome is reported asynchronously through webhook events.
+type Provider interface {
+	CreatePayment(ctx context.Context, req Request) (*Payment, error)
+	// Refund returns 'amount' of the payment to the member.
+	Refund(ctx context.Context, paymentID string, amount int64) error
+}
+
+type EventType string
+
+const (
+	EventPaymentSucceeded EventType = "payment_intent.succeeded"
+	EventPaymentFailed    EventType = "payment_intent.payment_failed"
+	EventPaymentCanceled  EventType = "payment_intent.canceled"
+)
+
+// Event is a webhook event in the Stripe format, reduced to the fields used here.
+type Event struct {
+	ID   string    `json:"id"`
+	Type EventType `json:"type"`
+	Data struct {
+		Object struct {
+			// ID of the payment
+			ID string `json:"id"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// PaymentID returns the ID of the payment the event is about.
+func (e *Event) PaymentID() string {
+	return e.Data.Object.ID
+}
+
+func sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader returns the value of the Stripe-Signature header for 'payload' sent at 'now'.
+func SignatureHeader(secret string, payload []byte, now time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%s", now.Unix(), sign(secret, now.Unix(), payload))
+}
+
+// ParseEvent verifies 'header', the Stripe-Signature header of a webhook request, and decodes 'payload'. Events signed more than WebhookTolerance before 'now' are rejected. UnknownEventError is returned for well-formed events of other types.
+func ParseEvent(secret string, payload []byte, header string, now time.Time) (*Event, error) {
+	if secret == "" {
+		return nil, InvalidSignatureError
+	}
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || now.Sub(time.Unix(timestamp, 0)).Abs() > WebhookTolerance {
+		return nil, InvalidSignatureError
+	}
+	want := sign(secret, timestamp, payload)
+	valid := false
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(want)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, InvalidSignatureError
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("Failed to decode webhook event: %w", err)
+	}
+	switch event.Type {
+	case EventPaymentSucceeded, EventPaymentFailed, EventPaymentCanceled:
+		return &event, nil
+	default:
+		return nil, UnknownEventError
+	}
+}
@@ -0,0 +1,96 @@
+package payment_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEvent(t *testing.T) {
+	now := time.Now()
+	fake := payment.NewFake("secret")
+	payload, header := fake.Event(payment.EventPaymentSucceeded, "pi_1", now)
+	unknown, unknownHeader := fake.Event("charge.refunded", "pi_1", now)
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		want    error
+	}{
+		{name: "Valid event", secret: "secret", payload: payload, header: header, now: now},
+		{name: "Wrong secret", secret: "other", payload: payload, header: header, now: now, want: payment.InvalidSignatureError},
+		{name: "No secret", payload: payload, header: header, now: now, want: payment.InvalidSignatureError},
+		{name: "Tampered payload", secret: "secret", payload: append([]byte(" "), payload...), header: header, now: now, want: payment.InvalidSignatureError},
+		{name: "Missing header", secret: "secret", payload: payload, now: now, want: payment.InvalidSignatureError},
+		{name: "Replayed event", secret: "secret", payload: payload, header: header, now: now.Add(payment.WebhookTolerance + time.Second), want: payment.InvalidSignatureError},
+		{name: "Unknown event", secret: "secret", payload: unknown, header: unknownHeader, now: now, want: payment.UnknownEventError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := payment.ParseEvent(tt.secret, tt.payload, tt.header, tt.now)
+			assert.Equal(t, tt.want, err)
+			if tt.want == nil {
+				assert.Equal(t, payment.EventPaymentSucceeded, event.Type)
+				assert.Equal(t, "pi_1", event.PaymentID())
+			}
+		})
+	}
+}
+
+func TestFake(t *testing.T) {
+	fake := payment.NewFake("secret")
+	p, err := fake.CreatePayment(context.TODO(), payment.Request{Amount: 1000, Currency: "usd", BookingID: 1})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, p.ClientSecret)
+
+	assert.Nil(t, fake.Refund(context.TODO(), p.ID, 600))
+	assert.NotNil(t, fake.Refund(context.TODO(), p.ID, 600), "Refunds cannot exceed the amount")
+	assert.Nil(t, fake.Refund(context.TODO(), p.ID, 400))
+	assert.Equal(t, int64(1000), fake.Refunded(p.ID))
+	assert.NotNil(t, fake.Refund(context.TODO(), "pi_unknown", 1))
+}
+
+func TestStripe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _, _ := r.BasicAuth()
+		if key != "sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Invalid API key"}}`))
+			return
+		}
+		assert.Nil(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/v1/payment_intents":
+			assert.Equal(t, "1500", r.PostForm.Get("amount"))
+			assert.Equal(t, "usd", r.PostForm.Get("currency"))
+			assert.Equal(t, "7", r.PostForm.Get("metadata[booking_id]"))
+			assert.Equal(t, "booking-7", r.Header.Get("Idempotency-Key"))
+			w.Write([]byte(`{"id":"pi_123","client_secret":"pi_123_secret"}`))
+		case "/v1/refunds":
+			assert.Equal(t, "pi_123", r.PostForm.Get("payment_intent"))
+			assert.Equal(t, "1500", r.PostForm.Get("amount"))
+			assert.Equal(t, "refund-pi_123-1500", r.Header.Get("Idempotency-Key"))
+			w.Write([]byte(`{"id":"re_123"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s := payment.NewStripe("sk_test", srv.URL)
+	p, err := s.CreatePayment(context.TODO(), payment.Request{Amount: 1500, Currency: "usd", BookingID: 7})
+	assert.Nil(t, err)
+	assert.Equal(t, &payment.Payment{ID: "pi_123", ClientSecret: "pi_123_secret"}, p)
+	assert.Nil(t, s.Refund(context.TODO(), p.ID, 1500))
+
+	_, err = payment.NewStripe("sk_wrong", srv.URL).CreatePayment(context.TODO(), payment.Request{Amount: 1500, Currency: "usd", BookingID: 7})
+	assert.ErrorContains(t, err, "Invalid API key")
+}
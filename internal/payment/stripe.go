@@ -0,0 +1,97 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultStripeURL = "https://api.stripe.com"
+
+// Stripe talks to the Stripe API, or any server compatible with its payment intents and refunds endpoints.
+type Stripe struct {
+	APIKey string
+	// Defaults to DefaultStripeURL
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewStripe(apiKey string, baseURL string) *Stripe {
+	if baseURL == "" {
+		baseURL = DefaultStripeURL
+	}
+	return &Stripe{APIKey: apiKey, BaseURL: strings.TrimSuffix(baseURL, "/"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type stripeError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// post sends a form encoded request to 'path' and decodes the JSON response into 'res'. Requests with the same 'idempotencyKey' are performed only once by Stripe.
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string, res any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.APIKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to call Stripe: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed to read Stripe response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var e stripeError
+		json.Unmarshal(body, &e)
+		return fmt.Errorf("Stripe responded with %d: %s", resp.StatusCode, e.Error.Message)
+	}
+	if err = json.Unmarshal(body, res); err != nil {
+		return fmt.Errorf("Failed to decode Stripe response: %w", err)
+	}
+	return nil
+}
+
+func (s *Stripe) CreatePayment(ctx context.Context, req Request) (*Payment, error) {
+	bookingID := strconv.FormatUint(req.BookingID, 10)
+	form := url.Values{
+		"amount":               {strconv.FormatInt(req.Amount, 10)},
+		"currency":             {req.Currency},
+		"description":          {req.Description},
+		"metadata[booking_id]": {bookingID},
+	}
+	var res struct {
+		ID           string `json:"id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := s.post(ctx, "/v1/payment_intents", form, "booking-"+bookingID, &res); err != nil {
+		return nil, err
+	}
+	return &Payment{ID: res.ID, ClientSecret: res.ClientSecret}, nil
+}
+
+func (s *Stripe) Refund(ctx context.Context, paymentID string, amount int64) error {
+	form := url.Values{
+		"payment_intent": {paymentID},
+		"amount":         {strconv.FormatInt(amount, 10)},
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	// Retries of a refund are performed once, while a later refund of another amount is not mistaken for one
+	return s.post(ctx, "/v1/refunds", form, fmt.Sprintf("refund-%s-%d", paymentID, amount), &res)
+}
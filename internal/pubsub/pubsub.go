@@ -0,0 +1,137 @@
+// Package pubsub passes messages from publishers to subscribers within the process. Messages are numbered and the latest ones are kept, so that subscribers that lost their connection can catch up on what they missed.
+package pubsub
+
+import (
+	"sync"
+	"time"
+)
+
+// Messages are buffered for each subscriber up to this many. Subscribers that fall further behind are dropped.
+const subscriberBuffer = 64
+
+type Message[T any] struct {
+	// Numbers messages in the order they were published, starting from 1
+	Seq   uint64
+	Value T
+}
+
+// Broker fans out published messages to the subscribers they match. The zero value is not usable, brokers are created with NewBroker.
+type Broker[T any] struct {
+	// Tells the brokers of different processes apart, as their numbering starts over
+	Epoch int64
+
+	mu     sync.Mutex
+	seq    uint64
+	size   int
+	recent []Message[T]
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+}
+
+// NewBroker returns a broker that keeps the latest 'size' messages for subscribers to catch up on.
+func NewBroker[T any](size int) *Broker[T] {
+	return &Broker[T]{Epoch: time.Now().UnixNano(), size: size, subs: map[*Subscription[T]]struct{}{}}
+}
+
+// Subscription receives the messages matching its filter until it is closed.
+type Subscription[T any] struct {
+	// Receives the messages. It is closed when the subscription or the broker is closed, or when the subscriber falls too far behind to be sent the next message.
+	C <-chan Message[T]
+	// Number of the last message published before the subscription started
+	Start uint64
+
+	c     chan Message[T]
+	b     *Broker[T]
+	match func(T) bool
+}
+
+// Publish sends 'value' to the matching subscribers without waiting for them, and returns the number of the message.
+func (b *Broker[T]) Publish(value T) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return b.seq
+	}
+	b.seq++
+	msg := Message[T]{Seq: b.seq, Value: value}
+	if b.size > 0 {
+		if len(b.recent) == b.size {
+			b.recent = append(b.recent[:0], b.recent[1:]...)
+		}
+		b.recent = append(b.recent, msg)
+	}
+	for sub := range b.subs {
+		if !sub.match(value) {
+			continue
+		}
+		select {
+		case sub.c <- msg:
+		default:
+			// The subscriber has to catch up through Subscribe again
+			b.unsubscribe(sub)
+		}
+	}
+	return b.seq
+}
+
+// Subscribe starts a subscription to the messages 'match' returns true for, nil matching all of them. Kept messages published after the message numbered 'after' are returned as well, so that the subscriber misses none of them in between. ok is false if some of those messages are no longer kept, or 'after' was never published, in which case the subscriber has to start over from Subscription.Start.
+func (b *Broker[T]) Subscribe(after uint64, match func(T) bool) (sub *Subscription[T], missed []Message[T], ok bool) {
+	if match == nil {
+		match = func(T) bool { return true }
+	}
+	c := make(chan Message[T], subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub = &Subscription[T]{C: c, Start: b.seq, c: c, b: b, match: match}
+	if b.closed {
+		close(c)
+		return sub, nil, false
+	}
+	b.subs[sub] = struct{}{}
+
+	// Messages are kept from 'oldest' on
+	oldest := b.seq + 1
+	if len(b.recent) > 0 {
+		oldest = b.recent[0].Seq
+	}
+	if after > b.seq || after+1 < oldest {
+		return sub, nil, false
+	}
+	for _, msg := range b.recent {
+		if msg.Seq > after && match(msg.Value) {
+			missed = append(missed, msg)
+		}
+	}
+	return sub, missed, true
+}
+
+// Seq returns the number of the last message published.
+func (b *Broker[T]) Seq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Close closes all subscriptions and stops publishing, e.g. so that long-lived streams end on shutdown. Subscriptions started later are closed right away.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.unsubscribe(sub)
+	}
+}
+
+func (b *Broker[T]) unsubscribe(sub *Subscription[T]) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.unsubscribe(s)
+}
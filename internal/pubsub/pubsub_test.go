@@ -0,0 +1,89 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"github.com/rohitxdev/abc-task/internal/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	even := func(n int) bool { return n%2 == 0 }
+
+	t.Run("Publish", func(t *testing.T) {
+		b := pubsub.NewBroker[int](10)
+		all, _, _ := b.Subscribe(0, nil)
+		evens, _, _ := b.Subscribe(0, even)
+		defer all.Close()
+		defer evens.Close()
+		for i := 1; i <= 4; i++ {
+			assert.Equal(t, uint64(i), b.Publish(i))
+		}
+		assert.Equal(t, uint64(4), b.Seq())
+		for i := 1; i <= 4; i++ {
+			assert.Equal(t, pubsub.Message[int]{Seq: uint64(i), Value: i}, <-all.C)
+		}
+		assert.Equal(t, pubsub.Message[int]{Seq: 2, Value: 2}, <-evens.C)
+		assert.Equal(t, pubsub.Message[int]{Seq: 4, Value: 4}, <-evens.C)
+	})
+
+	t.Run("Catch up", func(t *testing.T) {
+		b := pubsub.NewBroker[int](3)
+		for i := 1; i <= 5; i++ {
+			b.Publish(i)
+		}
+		tests := []struct {
+			name       string
+			after      uint64
+			match      func(int) bool
+			wantMissed []pubsub.Message[int]
+			wantOk     bool
+		}{
+			{name: "Up to date", after: 5, wantOk: true},
+			{name: "Kept", after: 2, wantMissed: []pubsub.Message[int]{{Seq: 3, Value: 3}, {Seq: 4, Value: 4}, {Seq: 5, Value: 5}}, wantOk: true},
+			{name: "Filtered", after: 2, match: even, wantMissed: []pubsub.Message[int]{{Seq: 4, Value: 4}}, wantOk: true},
+			{name: "No longer kept", after: 1, wantOk: false},
+			{name: "Never published", after: 6, wantOk: false},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				sub, missed, ok := b.Subscribe(tt.after, tt.match)
+				defer sub.Close()
+				assert.Equal(t, tt.wantOk, ok)
+				assert.Equal(t, tt.wantMissed, missed)
+				assert.Equal(t, uint64(5), sub.Start)
+			})
+		}
+	})
+
+	t.Run("Slow subscriber", func(t *testing.T) {
+		b := pubsub.NewBroker[int](0)
+		sub, _, _ := b.Subscribe(0, nil)
+		for i := 0; i < 100; i++ {
+			b.Publish(i)
+		}
+		n := 0
+		for range sub.C {
+			n++
+		}
+		// Dropped once its buffer was full
+		assert.Less(t, n, 100)
+		sub.Close()
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		b := pubsub.NewBroker[int](10)
+		sub, _, _ := b.Subscribe(0, nil)
+		b.Close()
+		_, open := <-sub.C
+		assert.False(t, open)
+		sub.Close()
+
+		late, _, ok := b.Subscribe(0, nil)
+		assert.False(t, ok)
+		_, open = <-late.C
+		assert.False(t, open)
+		b.Publish(1)
+		assert.Equal(t, uint64(0), b.Seq())
+	})
+}
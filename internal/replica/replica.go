@@ -0,0 +1,187 @@
+// Package replica continuously ships the SQLite write-ahead log to a Destination so that the database can be restored to any point in time, in the spirit of Litestream.
+//
+// Replicas are organised in generations. A generation starts with a raw copy of the database file and is followed by the WAL segments committed after it. A new generation is started whenever the WAL restarts after a checkpoint, since the frames of a restarted WAL cannot be replayed on top of the previous snapshot anymore.
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Pragma must be passed to database.NewSQLite for replicated databases. It disables automatic checkpoints so that the Replicator is the only one moving frames out of the WAL.
+const Pragma = "wal_autocheckpoint(0)"
+
+const (
+	DefaultInterval       = time.Second
+	DefaultCheckpointSize = 4 << 20
+)
+
+type generation struct {
+	id       string
+	salt     [2]uint32
+	offset   int64
+	checksum [2]uint32
+}
+
+type Replicator struct {
+	// How often the WAL is shipped when started with Run
+	Interval time.Duration
+	// WAL size in bytes after which the WAL is checkpointed and a new generation is started
+	CheckpointSize int64
+
+	// Must be opened with Pragma
+	db *sql.DB
+	// Checkpoints the WAL while 'db' holds the write lock
+	checkpointer *sql.DB
+	path         string
+	dest         Destination
+	now          func() time.Time
+
+	mu  sync.Mutex
+	gen *generation
+}
+
+// 'path' is the location of the database file that 'db' and 'checkpointer' are opened on. 'checkpointer' must be a separate pool, such as the readers of the database, as SQLite can't checkpoint on a connection that is in a transaction.
+func New(db, checkpointer *sql.DB, path string, dest Destination) (*Replicator, error) {
+	if path == ":memory:" {
+		return nil, errors.New("In-memory databases cannot be replicated")
+	}
+	return &Replicator{
+		Interval:       DefaultInterval,
+		CheckpointSize: DefaultCheckpointSize,
+		db:             db,
+		checkpointer:   checkpointer,
+		path:           path,
+		dest:           dest,
+		now:            time.Now,
+	}, nil
+}
+
+// Run ships the WAL every Interval until 'ctx' is cancelled, after which it syncs one last time.
+func (r *Replicator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return r.Sync(context.Background())
+		case <-ticker.C:
+			if err := r.Sync(ctx); err != nil {
+				slog.Error("Failed to sync replica: " + err.Error())
+			}
+		}
+	}
+}
+
+// Sync ships the frames committed since the last sync and checkpoints the WAL once it has grown past CheckpointSize.
+func (r *Replicator) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Holding the write lock guarantees that the WAL ends on a commit frame while it is being copied, and that nothing is committed between the copy and the checkpoint.
+	if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE;"); err != nil {
+		return fmt.Errorf("Failed to acquire write lock: %w", err)
+	}
+	err = r.ship(ctx)
+	if err == nil && r.gen.offset >= r.CheckpointSize {
+		err = r.checkpoint(ctx)
+	}
+	if _, rbErr := conn.ExecContext(context.Background(), "ROLLBACK;"); rbErr != nil {
+		return errors.Join(err, rbErr)
+	}
+	return err
+}
+
+// checkpoint must be called with the write lock held, once the WAL has been shipped. A passive checkpoint doesn't need the write lock, and it copies every frame to the database file unless a reader still uses them. The next commit then restarts the WAL, which starts a new generation. Frames that could not be copied are left for the next sync.
+func (r *Replicator) checkpoint(ctx context.Context) error {
+	var busy, logFrames, checkpointed int
+	if err := r.checkpointer.QueryRowContext(ctx, "PRAGMA wal_checkpoint(PASSIVE);").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("Failed to checkpoint WAL: %w", err)
+	}
+	return nil
+}
+
+// ship must be called with the write lock held.
+func (r *Replicator) ship(ctx context.Context) error {
+	t := r.now()
+
+	wal, err := os.Open(r.path + "-wal")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var size int64
+	var h *walHeader
+	if wal != nil {
+		defer wal.Close()
+		info, err := wal.Stat()
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+		if size >= walHeaderSize {
+			if h, err = readWALHeader(wal); err != nil && !errors.Is(err, errInvalidWALHeader) {
+				return err
+			}
+		}
+	}
+
+	// The WAL has been restarted or truncated since the last sync, so the shipped segments no longer line up with it.
+	if r.gen == nil || (r.gen.offset > 0 && (h == nil || size < r.gen.offset || [2]uint32{h.salt1, h.salt2} != r.gen.salt)) {
+		if err = r.snapshot(ctx, t); err != nil {
+			return err
+		}
+	}
+	if h == nil {
+		return nil
+	}
+
+	start, checksum := r.gen.offset, r.gen.checksum
+	if start == 0 {
+		r.gen.salt = [2]uint32{h.salt1, h.salt2}
+		start, checksum = walHeaderSize, h.checksum
+	}
+	end, checksum, err := lastCommit(wal, h, start, checksum)
+	if err != nil {
+		return err
+	}
+	if end == start {
+		return nil
+	}
+
+	key := segmentKey(r.gen.id, r.gen.offset, t)
+	if err = r.dest.Put(ctx, key, io.NewSectionReader(wal, r.gen.offset, end-r.gen.offset)); err != nil {
+		return fmt.Errorf("Failed to put WAL segment: %w", err)
+	}
+	r.gen.offset, r.gen.checksum = end, checksum
+	return nil
+}
+
+// snapshot must be called with the write lock held. Only the Replicator checkpoints, so the database file cannot change underneath it.
+func (r *Replicator) snapshot(ctx context.Context, t time.Time) error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gen := &generation{id: formatTime(t)}
+	if err = r.dest.Put(ctx, snapshotKey(gen.id), f); err != nil {
+		return fmt.Errorf("Failed to put snapshot: %w", err)
+	}
+	r.gen = gen
+	slog.Debug("Started replica generation " + gen.id)
+	return nil
+}
@@ -0,0 +1,96 @@
+package replica_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/replica"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplica(t *testing.T) {
+	db, err := database.NewSQLite("test.db", replica.Pragma)
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+
+	dest := &replica.DirDestination{Root: t.TempDir()}
+	r, err := replica.New(db.Writer, db.Reader, database.Path("test.db"), dest)
+	assert.Nil(t, err)
+
+	_, err = db.Writer.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY);")
+	assert.Nil(t, err)
+
+	before := time.Now()
+
+	// Each insert is followed by a sync, and the time after each sync is a restore point with one more row than the previous one.
+	var restorePoints []time.Time
+	for i := range 4 {
+		// Checkpoint after the second sync so that the last rows end up in a new generation.
+		if i == 1 {
+			r.CheckpointSize = 1
+		} else {
+			r.CheckpointSize = replica.DefaultCheckpointSize
+		}
+		_, err = db.Writer.Exec("INSERT INTO items (id) VALUES (?);", i+1)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Sync(context.TODO()))
+		restorePoints = append(restorePoints, time.Now())
+	}
+
+	// The WAL restarted after the checkpoint, which started a second generation
+	keys, err := dest.List(context.TODO(), "")
+	assert.Nil(t, err)
+	var snapshots int
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/snapshot.db") {
+			snapshots++
+		}
+	}
+	assert.Equal(t, 2, snapshots)
+
+	t.Run("Restore", func(t *testing.T) {
+		tests := []struct {
+			name string
+			at   time.Time
+			want int
+			err  error
+		}{
+			{name: "Before first snapshot", at: before, err: replica.NoSnapshotError},
+			{name: "First sync", at: restorePoints[0], want: 1},
+			{name: "Before checkpoint", at: restorePoints[1], want: 2},
+			{name: "After checkpoint", at: restorePoints[2], want: 3},
+			{name: "Latest", at: restorePoints[3], want: 4},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "restored.db")
+				err := replica.Restore(context.TODO(), dest, path, tt.at)
+				assert.Equal(t, tt.err, err)
+				if tt.err != nil {
+					return
+				}
+
+				restored, err := sql.Open("sqlite", path)
+				assert.Nil(t, err)
+				defer restored.Close()
+				var count int
+				assert.Nil(t, restored.QueryRow("SELECT COUNT(*) FROM items;").Scan(&count))
+				assert.Equal(t, tt.want, count)
+			})
+		}
+	})
+
+	t.Run("Restore to existing path", func(t *testing.T) {
+		err := replica.Restore(context.TODO(), dest, database.Path("test.db"), time.Now())
+		assert.NotNil(t, err)
+	})
+}
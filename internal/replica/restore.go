@@ -0,0 +1,129 @@
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var NoSnapshotError = errors.New("No snapshot is available before the given time")
+
+const generationsPrefix = "generations/"
+
+func formatTime(t time.Time) string {
+	return fmt.Sprintf("%016x", t.UnixNano())
+}
+
+func parseTime(s string) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 16, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, n), nil
+}
+
+func snapshotKey(gen string) string {
+	return generationsPrefix + gen + "/snapshot.db"
+}
+
+// Segments sort by their offset in the WAL, followed by the time they were shipped at.
+func segmentKey(gen string, offset int64, t time.Time) string {
+	return fmt.Sprintf("%s%s/wal/%016x-%s.wal", generationsPrefix, gen, offset, formatTime(t))
+}
+
+// Restore writes the state of the replicated database as it was at 'at' to 'path', which must not exist yet.
+func Restore(ctx context.Context, dest Destination, path string, at time.Time) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	// Leftovers of a previously removed database would be replayed on top of the snapshot.
+	for _, suffix := range [...]string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	keys, err := dest.List(ctx, generationsPrefix)
+	if err != nil {
+		return fmt.Errorf("Failed to list replicas: %w", err)
+	}
+
+	// Generation IDs are timestamps, so the latest generation that started before 'at' is the last matching one.
+	var gen string
+	for _, key := range keys {
+		id, file, ok := strings.Cut(strings.TrimPrefix(key, generationsPrefix), "/")
+		if !ok || file != "snapshot.db" {
+			continue
+		}
+		t, err := parseTime(id)
+		if err != nil {
+			return fmt.Errorf("Invalid generation %s: %w", id, err)
+		}
+		if !t.After(at) {
+			gen = id
+		}
+	}
+	if gen == "" {
+		return NoSnapshotError
+	}
+
+	if err = copyObject(ctx, dest, snapshotKey(gen), path, os.O_CREATE|os.O_EXCL|os.O_WRONLY); err != nil {
+		return err
+	}
+
+	segmentPrefix := generationsPrefix + gen + "/wal/"
+	for _, key := range keys {
+		name, ok := strings.CutPrefix(key, segmentPrefix)
+		if !ok {
+			continue
+		}
+		_, ts, _ := strings.Cut(strings.TrimSuffix(name, ".wal"), "-")
+		t, err := parseTime(ts)
+		if err != nil {
+			return fmt.Errorf("Invalid WAL segment %s: %w", key, err)
+		}
+		if t.After(at) {
+			break
+		}
+		if err = copyObject(ctx, dest, key, path+"-wal", os.O_CREATE|os.O_APPEND|os.O_WRONLY); err != nil {
+			return err
+		}
+	}
+
+	// Opening the database replays the WAL, and the checkpoint folds it into the database file.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err = db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		return fmt.Errorf("Failed to apply WAL: %w", err)
+	}
+	return nil
+}
+
+func copyObject(ctx context.Context, dest Destination, key string, path string, flag int) error {
+	src, err := dest.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("Failed to get %s: %w", key, err)
+	}
+	defer src.Close()
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
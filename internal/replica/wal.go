@@ -0,0 +1,92 @@
+package replica
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// See https://www.sqlite.org/fileformat2.html#the_write_ahead_log for the WAL file format.
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	walMagicLE         = 0x377f0682
+	walMagicBE         = 0x377f0683
+)
+
+var errInvalidWALHeader = errors.New("Invalid WAL header")
+
+type walHeader struct {
+	order    binary.ByteOrder
+	pageSize uint32
+	salt1    uint32
+	salt2    uint32
+	checksum [2]uint32
+}
+
+func (h *walHeader) frameSize() int64 {
+	return walFrameHeaderSize + int64(h.pageSize)
+}
+
+func readWALHeader(r io.ReaderAt) (*walHeader, error) {
+	b := make([]byte, walHeaderSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, err
+	}
+
+	h := &walHeader{}
+	switch binary.BigEndian.Uint32(b[0:]) {
+	case walMagicLE:
+		h.order = binary.LittleEndian
+	case walMagicBE:
+		h.order = binary.BigEndian
+	default:
+		return nil, errInvalidWALHeader
+	}
+
+	h.pageSize = binary.BigEndian.Uint32(b[8:])
+	h.salt1 = binary.BigEndian.Uint32(b[16:])
+	h.salt2 = binary.BigEndian.Uint32(b[20:])
+	h.checksum = walChecksum(h.order, [2]uint32{}, b[:24])
+	if h.checksum[0] != binary.BigEndian.Uint32(b[24:]) || h.checksum[1] != binary.BigEndian.Uint32(b[28:]) {
+		return nil, errInvalidWALHeader
+	}
+	return h, nil
+}
+
+// walChecksum continues the running checksum 's' over 'b'. len(b) must be a multiple of 8.
+func walChecksum(order binary.ByteOrder, s [2]uint32, b []byte) [2]uint32 {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s[0] += order.Uint32(b[i:]) + s[1]
+		s[1] += order.Uint32(b[i+4:]) + s[0]
+	}
+	return s
+}
+
+// lastCommit walks the frames of the WAL starting at 'offset', whose preceding running checksum is 'checksum', and returns the end offset of the last valid commit frame along with the running checksum at that point. If there are no new committed frames, 'offset' and 'checksum' are returned as is.
+func lastCommit(r io.ReaderAt, h *walHeader, offset int64, checksum [2]uint32) (int64, [2]uint32, error) {
+	end, endChecksum := offset, checksum
+	frame := make([]byte, h.frameSize())
+	for {
+		if _, err := r.ReadAt(frame, offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				return end, endChecksum, nil
+			}
+			return 0, checksum, err
+		}
+		// Frames left over from before the last WAL restart carry stale salts and terminate the log.
+		if binary.BigEndian.Uint32(frame[8:]) != h.salt1 || binary.BigEndian.Uint32(frame[12:]) != h.salt2 {
+			return end, endChecksum, nil
+		}
+		checksum = walChecksum(h.order, checksum, frame[:8])
+		checksum = walChecksum(h.order, checksum, frame[walFrameHeaderSize:])
+		if checksum[0] != binary.BigEndian.Uint32(frame[16:]) || checksum[1] != binary.BigEndian.Uint32(frame[20:]) {
+			return end, endChecksum, nil
+		}
+		offset += h.frameSize()
+		// A non-zero database size marks a commit frame.
+		if binary.BigEndian.Uint32(frame[4:]) != 0 {
+			end, endChecksum = offset, checksum
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AnalyticsFilter selects the occurrences analytics are computed over.
+type AnalyticsFilter struct {
+	// UNIX timestamps of the first and the last date, both inclusive
+	From int64
+	To   int64
+	// Only the occurrences of the class when not zero
+	ClassID uint64
+}
+
+// OccupancyStats sums up a set of occurrences.
+type OccupancyStats struct {
+	Occurrences uint
+	// Spots of all occurrences together
+	Capacity uint
+	// Spots taken by bookings, including attended ones and no-shows
+	Booked    uint
+	CheckedIn uint
+	NoShows   uint
+	// Occurrences all spots of which were taken
+	FullOccurrences uint
+	// Bookings, holds and drop-ins that were rejected because the occurrence was full
+	FullRejections uint
+}
+
+// FillRate returns the share of spots that were taken, between 0 and 1.
+func (s *OccupancyStats) FillRate() float64 {
+	if s.Capacity == 0 {
+		return 0
+	}
+	return float64(s.Booked) / float64(s.Capacity)
+}
+
+// NoShowRate returns the share of attended or missed bookings that were missed, between 0 and 1. Bookings whose occurrence hasn't been marked yet don't count.
+func (s *OccupancyStats) NoShowRate() float64 {
+	if s.CheckedIn+s.NoShows == 0 {
+		return 0
+	}
+	return float64(s.NoShows) / float64(s.CheckedIn+s.NoShows)
+}
+
+type ClassOccupancy struct {
+	ClassID   uint64
+	ClassName string
+	Capacity  uint
+	OccupancyStats
+}
+
+// Periods occupancy trends are grouped by
+type Period string
+
+const (
+	PeriodDay  Period = "day"
+	PeriodWeek Period = "week"
+)
+
+type PeriodOccupancy struct {
+	// UNIX timestamp of the date the period begins on. Weeks begin on Monday.
+	Start int64
+	OccupancyStats
+}
+
+// HourOccupancy sums up the occurrences that start within an hour of a day of the week.
+type HourOccupancy struct {
+	Weekday time.Weekday
+	// 0-23, in UTC
+	Hour uint
+	OccupancyStats
+}
+
+// occurrenceStats is a WITH clause naming the table 'occurrences', which holds a row with the counts of every occurrence in the range. It takes From, To and ClassID of an AnalyticsFilter as the parameters ?1, ?2 and ?3.
+const occurrenceStats = `
+	WITH RECURSIVE dates (date) AS (
+		SELECT ?1
+		UNION ALL
+		SELECT date + 86400 FROM dates WHERE date + 86400 <= ?2
+	),
+	booking_counts AS (
+		SELECT class_id, date, SUM(` + occupyingStatuses + `) AS booked, SUM(status = 'checked_in') AS checked_in, SUM(status = 'no_show') AS no_shows
+		FROM bookings WHERE date BETWEEN ?1 AND ?2
+		GROUP BY class_id, date
+	),
+	rejection_counts AS (
+		SELECT class_id, date, COUNT(*) AS rejections
+		FROM full_rejections WHERE date BETWEEN ?1 AND ?2
+		GROUP BY class_id, date
+	),
+	occurrences AS (
+		SELECT c.id AS class_id, c.name AS class_name, c.capacity, c.start_time, d.date,
+			COALESCE(b.booked, 0) AS booked, COALESCE(b.checked_in, 0) AS checked_in, COALESCE(b.no_shows, 0) AS no_shows, COALESCE(r.rejections, 0) AS rejections
+		FROM classes c
+		JOIN dates d ON d.date BETWEEN c.start_date AND c.end_date
+		LEFT JOIN booking_counts b ON b.class_id = c.id AND b.date = d.date
+		LEFT JOIN rejection_counts r ON r.class_id = c.id AND r.date = d.date
+		WHERE ?3 = 0 OR c.id = ?3
+	)`
+
+// occupancyColumns aggregates the rows of 'occurrences' into OccupancyStats, in the order of OccupancyStats.scanDest.
+const occupancyColumns = "COUNT(*), COALESCE(SUM(capacity), 0), COALESCE(SUM(booked), 0), COALESCE(SUM(checked_in), 0), COALESCE(SUM(no_shows), 0), COALESCE(SUM(booked >= capacity), 0), COALESCE(SUM(rejections), 0)"
+
+func (s *OccupancyStats) scanDest() []any {
+	return []any{&s.Occurrences, &s.Capacity, &s.Booked, &s.CheckedIn, &s.NoShows, &s.FullOccurrences, &s.FullRejections}
+}
+
+// queryOccupancy runs 'query', which selects from 'occurrences', for the filter and calls 'scan' with every row.
+func (r *Repo) queryOccupancy(ctx context.Context, filter AnalyticsFilter, query string, scan func(row scanner) error) error {
+	if filter.From > filter.To {
+		return errors.New("Analytics range ends before it begins")
+	}
+	rows, err := r.db.Reader.QueryContext(ctx, occurrenceStats+query, filter.From, filter.To, filter.ClassID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetOccupancyTotals sums up all occurrences in the range.
+func (r *Repo) GetOccupancyTotals(ctx context.Context, filter AnalyticsFilter) (*OccupancyStats, error) {
+	return cached(r, "totals", filter, func() (*OccupancyStats, error) {
+		var stats OccupancyStats
+		err := r.queryOccupancy(ctx, filter, " SELECT "+occupancyColumns+" FROM occurrences;", func(row scanner) error {
+			return row.Scan(stats.scanDest()...)
+		})
+		return &stats, err
+	})
+}
+
+// GetClassOccupancy sums up the occurrences in the range by class, ordered by fill rate from highest to lowest.
+func (r *Repo) GetClassOccupancy(ctx context.Context, filter AnalyticsFilter) ([]ClassOccupancy, error) {
+	return cached(r, "classes", filter, func() ([]ClassOccupancy, error) {
+		query := " SELECT class_id, class_name, capacity, " + occupancyColumns + " FROM occurrences GROUP BY class_id ORDER BY CAST(SUM(booked) AS REAL) / MAX(SUM(capacity), 1) DESC, class_id;"
+		classes := []ClassOccupancy{}
+		err := r.queryOccupancy(ctx, filter, query, func(row scanner) error {
+			var class ClassOccupancy
+			if err := row.Scan(append([]any{&class.ClassID, &class.ClassName, &class.Capacity}, class.scanDest()...)...); err != nil {
+				return err
+			}
+			classes = append(classes, class)
+			return nil
+		})
+		return classes, err
+	})
+}
+
+// GetOccupancyTrend sums up the occurrences in the range by day or by week, ordered by date. Periods without occurrences are left out.
+func (r *Repo) GetOccupancyTrend(ctx context.Context, filter AnalyticsFilter, period Period) ([]PeriodOccupancy, error) {
+	start := "date"
+	switch period {
+	case PeriodDay:
+	case PeriodWeek:
+		// Back to Monday. The UNIX epoch was a Thursday.
+		start = "date - (date / 86400 + 3) % 7 * 86400"
+	default:
+		return nil, fmt.Errorf("Unknown period %q", period)
+	}
+	return cached(r, "trend:"+string(period), filter, func() ([]PeriodOccupancy, error) {
+		query := " SELECT " + start + " AS start, " + occupancyColumns + " FROM occurrences GROUP BY start ORDER BY start;"
+		periods := []PeriodOccupancy{}
+		err := r.queryOccupancy(ctx, filter, query, func(row scanner) error {
+			var p PeriodOccupancy
+			if err := row.Scan(append([]any{&p.Start}, p.scanDest()...)...); err != nil {
+				return err
+			}
+			periods = append(periods, p)
+			return nil
+		})
+		return periods, err
+	})
+}
+
+// GetOccupancyHeatmap sums up the occurrences in the range by the day of the week and the hour they start at, ordered by day from Sunday and then by hour. Hours without occurrences are left out.
+func (r *Repo) GetOccupancyHeatmap(ctx context.Context, filter AnalyticsFilter) ([]HourOccupancy, error) {
+	return cached(r, "heatmap", filter, func() ([]HourOccupancy, error) {
+		// The UNIX epoch was a Thursday
+		query := " SELECT (date / 86400 + 4) % 7 AS weekday, start_time / 3600 AS hour, " + occupancyColumns + " FROM occurrences GROUP BY weekday, hour ORDER BY weekday, hour;"
+		hours := []HourOccupancy{}
+		err := r.queryOccupancy(ctx, filter, query, func(row scanner) error {
+			var h HourOccupancy
+			if err := row.Scan(append([]any{&h.Weekday, &h.Hour}, h.scanDest()...)...); err != nil {
+				return err
+			}
+			hours = append(hours, h)
+			return nil
+		})
+		return hours, err
+	})
+}
+
+// analyticsCache keeps computed analytics for Repo.AnalyticsTTL, as they scan every booking in their range.
+type analyticsCache struct {
+	mu      sync.Mutex
+	entries map[string]analyticsEntry
+}
+
+type analyticsEntry struct {
+	value     any
+	expiresAt time.Time
+}
+
+// cached returns the value 'compute' returned for the same report and filter within the last Repo.AnalyticsTTL, or computes it. Errors aren't cached.
+func cached[T any](r *Repo, report string, filter AnalyticsFilter, compute func() (T, error)) (T, error) {
+	if r.AnalyticsTTL <= 0 {
+		return compute()
+	}
+	key := fmt.Sprintf("%s:%d:%d:%d", report, filter.From, filter.To, filter.ClassID)
+	now := r.now()
+	c := &r.analytics
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.value.(T), nil
+	}
+
+	value, err := compute()
+	if err != nil {
+		return value, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]analyticsEntry{}
+	}
+	// Filters are chosen by clients, so expired entries are dropped to keep the cache from growing
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = analyticsEntry{value: value, expiresAt: now.Add(r.AnalyticsTTL)}
+	return value, nil
+}
+
+// recordFullRejection records that the member was turned away from the occurrence on 'date' because it was full, if 'err' is ClassFullError. It writes outside of the transaction that found the occurrence full, so it must be deferred before that transaction's rollback to run after it. Failing to record the rejection only skews the analytics, so it is logged instead of failing the request.
+func (r *Repo) recordFullRejection(ctx context.Context, err *error, classID uint64, memberName string, date int64) {
+	if *err != ClassFullError {
+		return
+	}
+	query := "INSERT INTO full_rejections (class_id, member_name, date, rejected_at) VALUES (?, ?, ?, ?);"
+	if _, e := r.db.Writer.ExecContext(ctx, query, classID, memberName, date, r.now().Unix()); e != nil {
+		slog.Error(fmt.Sprintf("Failed to record full class rejection: %s", e.Error()))
+	}
+}
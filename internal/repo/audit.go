@@ -0,0 +1,259 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+)
+
+// Entities changes are recorded for
+const (
+	AuditEntityClass           = "class"
+	AuditEntityBooking         = "booking"
+	AuditEntityHold            = "hold"
+	AuditEntityInstructor      = "instructor"
+	AuditEntityLocation        = "location"
+	AuditEntityRoom            = "room"
+	AuditEntityPlan            = "plan"
+	AuditEntitySubscription    = "subscription"
+	AuditEntityMember          = "member"
+	AuditEntityPenaltyWaiver   = "penalty_waiver"
+	AuditEntityWebhook         = "webhook"
+	AuditEntityWebhookDelivery = "webhook_delivery"
+	AuditEntityOutboxMessage   = "outbox_message"
+)
+
+// ActorSystem is the actor of changes made under a context without one, such as those of background jobs.
+const ActorSystem = "system"
+
+// redacted replaces secrets in the audit log.
+const redacted = "[redacted]"
+
+// AuditEntry records a change to an entity. Entries are never changed, and are only deleted once they are older than Repo.AuditRetention.
+type AuditEntry struct {
+	ID uint64
+	// UNIX timestamp of the change
+	CreatedAt int64
+	// Who made the change, e.g. 'admin'
+	Actor string
+	// ID of the request the change was made in. Empty for changes made outside of requests.
+	RequestID string
+	Action    AuditAction
+	Entity    string
+	EntityID  string
+	// JSON objects of the fields that changed, as they were before and after the change. Before is empty for creates and After for deletes, which hold every field instead.
+	Before string
+	After  string
+}
+
+type actorKey struct{}
+
+type actor struct {
+	name      string
+	requestID string
+}
+
+// WithActor returns a copy of 'ctx' under which changes are recorded as made by 'name' while serving the request 'requestID', which may be empty.
+func WithActor(ctx context.Context, name string, requestID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{name: name, requestID: requestID})
+}
+
+// ActorFrom returns the name and the request ID 'ctx' was given by WithActor, or ActorSystem and an empty ID.
+func ActorFrom(ctx context.Context) (string, string) {
+	a := actorFrom(ctx)
+	return a.name, a.requestID
+}
+
+// actorFrom returns the actor 'ctx' was given by WithActor, or ActorSystem.
+func actorFrom(ctx context.Context) actor {
+	if a, ok := ctx.Value(actorKey{}).(actor); ok {
+		return a
+	}
+	return actor{name: ActorSystem}
+}
+
+// audit records the change of the entity from 'before' to 'after' in 'tx', which makes the change, so that the entry exists if and only if the change is committed. 'before' is nil for creates and 'after' for deletes, nil pointers included. Both are encoded as JSON objects, of which only the fields that differ are kept for updates. Updates that change nothing are not recorded.
+func (r *Repo) audit(ctx context.Context, tx *sql.Tx, entity string, id any, before any, after any) error {
+	if isNil(before) {
+		before = nil
+	}
+	if isNil(after) {
+		after = nil
+	}
+	action := AuditActionUpdate
+	switch {
+	case before == nil:
+		action = AuditActionCreate
+	case after == nil:
+		action = AuditActionDelete
+	}
+	oldValues, newValues, err := auditDiff(before, after)
+	if err != nil {
+		return fmt.Errorf("Failed to encode audit entry: %w", err)
+	}
+	if action == AuditActionUpdate && oldValues == "{}" && newValues == "{}" {
+		return nil
+	}
+	a := actorFrom(ctx)
+	query := "INSERT INTO audit_log (created_at, actor, request_id, action, entity, entity_id, old_values, new_values) VALUES (?, ?, ?, ?, ?, ?, ?, ?);"
+	_, err = tx.ExecContext(ctx, query, r.now().Unix(), a.name, a.requestID, action, entity, fmt.Sprint(id), oldValues, newValues)
+	return err
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// auditDiff encodes 'before' and 'after' as JSON objects. If both are given, only the fields whose values differ are kept. Nil values are encoded as empty strings.
+func auditDiff(before any, after any) (string, string, error) {
+	var oldFields, newFields map[string]json.RawMessage
+	if err := toJSONObject(before, &oldFields); err != nil {
+		return "", "", err
+	}
+	if err := toJSONObject(after, &newFields); err != nil {
+		return "", "", err
+	}
+	if oldFields != nil && newFields != nil {
+		for name, value := range oldFields {
+			if newValue, ok := newFields[name]; ok && bytes.Equal(value, newValue) {
+				delete(oldFields, name)
+				delete(newFields, name)
+			}
+		}
+	}
+	oldValues, err := encodeJSONObject(oldFields)
+	if err != nil {
+		return "", "", err
+	}
+	newValues, err := encodeJSONObject(newFields)
+	return oldValues, newValues, err
+}
+
+func toJSONObject(v any, fields *map[string]json.RawMessage) error {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, fields)
+}
+
+func encodeJSONObject(fields map[string]json.RawMessage) (string, error) {
+	if fields == nil {
+		return "", nil
+	}
+	// Maps are encoded with sorted keys
+	b, err := json.Marshal(fields)
+	return string(b), err
+}
+
+// AuditFilter narrows down the entries returned by GetAuditLog. Zero values don't filter.
+type AuditFilter struct {
+	Entity    string
+	EntityID  string
+	Actor     string
+	RequestID string
+	Action    AuditAction
+	// UNIX timestamps of the earliest and the latest change, both inclusive
+	From int64
+	To   int64
+	// Only entries older than this one, for paging through the log
+	BeforeID uint64
+	// Maximum number of entries returned
+	Limit int
+}
+
+const auditColumns = "id, created_at, actor, request_id, action, entity, entity_id, old_values, new_values"
+
+// GetAuditLog returns the entries matching the filter, newest first.
+func (r *Repo) GetAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := `
+	SELECT ` + auditColumns + ` FROM audit_log
+	WHERE (?1 = '' OR entity = ?1) AND (?2 = '' OR entity_id = ?2) AND (?3 = '' OR actor = ?3) AND (?4 = '' OR request_id = ?4) AND (?5 = '' OR action = ?5)
+		AND (?6 = 0 OR created_at >= ?6) AND (?7 = 0 OR created_at <= ?7) AND (?8 = 0 OR id < ?8)
+	ORDER BY id DESC
+	LIMIT ?9;`
+	rows, err := r.db.Reader.QueryContext(ctx, query, filter.Entity, filter.EntityID, filter.Actor, filter.RequestID, filter.Action, filter.From, filter.To, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err = rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.RequestID, &e.Action, &e.Entity, &e.EntityID, &e.Before, &e.After); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteExpiredAuditEntries deletes the entries older than Repo.AuditRetention and returns how many were deleted. Nothing is deleted if the retention is zero.
+func (r *Repo) DeleteExpiredAuditEntries(ctx context.Context) (int64, error) {
+	if r.AuditRetention <= 0 {
+		return 0, nil
+	}
+	res, err := r.db.Writer.ExecContext(ctx, "DELETE FROM audit_log WHERE created_at < ?;", r.now().Add(-r.AuditRetention).Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// updateBooking applies 'set' to the booking and records the change. The booking as it is after the change is returned.
+func (r *Repo) updateBooking(ctx context.Context, tx *sql.Tx, before *Booking, set string, args ...any) (*Booking, error) {
+	if _, err := tx.ExecContext(ctx, "UPDATE bookings SET "+set+" WHERE id = ?;", append(args, before.ID)...); err != nil {
+		return nil, err
+	}
+	after, err := scanBooking(tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?;", before.ID))
+	if err != nil {
+		return nil, err
+	}
+	return after, r.audit(ctx, tx, AuditEntityBooking, before.ID, before, after)
+}
+
+// updateBookings applies 'set' to every booking matching 'where' and records every change. The bookings are returned as they are after the change.
+func (r *Repo) updateBookings(ctx context.Context, tx *sql.Tx, where string, whereArgs []any, set string, args ...any) ([]*Booking, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE "+where+";", whereArgs...)
+	if err != nil {
+		return nil, err
+	}
+	var bookings []*Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, booking := range bookings {
+		if bookings[i], err = r.updateBooking(ctx, tx, booking, set, args...); err != nil {
+			return nil, err
+		}
+	}
+	return bookings, nil
+}
@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Changes are kept this many at a time for streams that reconnect to catch up on
+const availabilityBacklog = 1024
+
+// GetTaken looks up at most this many occurrences per query, to stay within the limit on query parameters
+const takenBatchSize = 500
+
+// ChangeType tells what happened to a booking or seat hold of an occurrence.
+type ChangeType string
+
+const (
+	// A booking was made, including drop-ins awaiting payment and confirmed holds
+	ChangeBooked    ChangeType = "booked"
+	ChangeCancelled ChangeType = "cancelled"
+	ChangeHeld      ChangeType = "held"
+	// A seat hold expired or the payment of a drop-in failed, freeing its spot
+	ChangeReleased  ChangeType = "released"
+	ChangeCheckedIn ChangeType = "checked_in"
+	ChangeNoShow    ChangeType = "no_show"
+)
+
+// TakesSpots reports whether changes of the type may change the spots taken in the occurrence. Check-ins and no-shows don't, as the booking keeps its spot.
+func (t ChangeType) TakesSpots() bool {
+	return t != ChangeCheckedIn && t != ChangeNoShow
+}
+
+// OccurrenceChange is published to Repo.Availability when a booking or seat hold of the occurrence of the class on Date, which is in UNIX timestamp format, changes.
+type OccurrenceChange struct {
+	Type    ChangeType
+	ClassID uint64
+	Date    int64
+	// Zero for seat holds
+	BookingID  uint64
+	MemberName string
+}
+
+// OccurrenceAvailability counts the spots of an occurrence.
+type OccurrenceAvailability struct {
+	// UNIX timestamp of the occurrence
+	Date     int64
+	Capacity uint
+	// Spots taken by bookings and seat holds
+	Taken uint
+}
+
+// Remaining returns how many spots are left.
+func (a *OccurrenceAvailability) Remaining() uint {
+	if a.Taken >= a.Capacity {
+		return 0
+	}
+	return a.Capacity - a.Taken
+}
+
+// publishChanges tells subscribers of Repo.Availability about changes of bookings or holds. It must only be called once the change is committed.
+func (r *Repo) publishChanges(changes ...OccurrenceChange) {
+	for _, change := range changes {
+		r.Availability.Publish(change)
+	}
+}
+
+func bookingChange(t ChangeType, b *Booking) OccurrenceChange {
+	return OccurrenceChange{Type: t, ClassID: b.ClassID, Date: b.Date, BookingID: b.ID, MemberName: b.MemberName}
+}
+
+func holdChange(t ChangeType, h *Hold) OccurrenceChange {
+	return OccurrenceChange{Type: t, ClassID: h.ClassID, Date: h.Date, MemberName: h.MemberName}
+}
+
+// bookingChanges returns changes of type 't' for the bookings.
+func bookingChanges(t ChangeType, bookings []*Booking) []OccurrenceChange {
+	changes := make([]OccurrenceChange, 0, len(bookings))
+	for _, b := range bookings {
+		changes = append(changes, bookingChange(t, b))
+	}
+	return changes
+}
+
+// GetClassLocation returns the ID of the location of the room of the class, or zero if the class has no room.
+func (r *Repo) GetClassLocation(ctx context.Context, classID uint64) (uint64, error) {
+	var locationID uint64
+	row := r.db.Reader.QueryRowContext(ctx, "SELECT COALESCE(rooms.location_id, 0) FROM classes LEFT JOIN rooms ON rooms.id = classes.room_id WHERE classes.id = ?;", classID)
+	if err := row.Scan(&locationID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ClassNotFoundError
+		}
+		return 0, err
+	}
+	return locationID, nil
+}
+
+// GetAvailability returns the spots of every occurrence of the class from 'from' to 'to', both inclusive and in UNIX timestamp format, ordered by date.
+func (r *Repo) GetAvailability(ctx context.Context, classID uint64, from int64, to int64) ([]OccurrenceAvailability, error) {
+	class, err := scanClass(r.db.Reader.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", classID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ClassNotFoundError
+		}
+		return nil, err
+	}
+	from, to = max(from, class.StartDate), min(to, class.EndDate)
+	availability := []OccurrenceAvailability{}
+	if from > to {
+		return availability, nil
+	}
+	query := `
+	WITH RECURSIVE dates (date) AS (
+		SELECT ?1
+		UNION ALL
+		SELECT date + 86400 FROM dates WHERE date + 86400 <= ?2
+	)
+	SELECT date,
+		(SELECT COUNT(*) FROM bookings b WHERE b.class_id = ?3 AND b.date = dates.date AND ` + occupyingStatuses + `) +
+		(SELECT COUNT(*) FROM holds h WHERE h.class_id = ?3 AND h.date = dates.date AND h.expires_at > ?4)
+	FROM dates ORDER BY date;`
+	rows, err := r.db.Reader.QueryContext(ctx, query, from, to, classID, r.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := OccurrenceAvailability{Capacity: class.Capacity}
+		if err = rows.Scan(&a.Date, &a.Taken); err != nil {
+			return nil, err
+		}
+		availability = append(availability, a)
+	}
+	return availability, rows.Err()
+}
+
+// OccurrenceKey identifies the occurrence of a class on a date, which is in UNIX timestamp format.
+type OccurrenceKey struct {
+	ClassID uint64
+	Date    int64
+}
+
+// GetTaken returns the spots taken by bookings and seat holds in each of the occurrences, looking them up together rather than one by one.
+func (r *Repo) GetTaken(ctx context.Context, keys []OccurrenceKey) (map[OccurrenceKey]uint, error) {
+	taken := make(map[OccurrenceKey]uint, len(keys))
+	now := r.now().Unix()
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), takenBatchSize)]
+		keys = keys[len(batch):]
+
+		args := make([]any, 0, 2*len(batch)+1)
+		for _, key := range batch {
+			args = append(args, key.ClassID, key.Date)
+		}
+		args = append(args, now)
+		query := `
+		WITH occurrences (class_id, date) AS (VALUES (?, ?)` + strings.Repeat(", (?, ?)", len(batch)-1) + `)
+		SELECT class_id, date,
+			(SELECT COUNT(*) FROM bookings b WHERE b.class_id = o.class_id AND b.date = o.date AND ` + occupyingStatuses + `) +
+			(SELECT COUNT(*) FROM holds h WHERE h.class_id = o.class_id AND h.date = o.date AND h.expires_at > ?)
+		FROM occurrences o;`
+		if err := r.queryTaken(ctx, query, args, taken); err != nil {
+			return nil, err
+		}
+	}
+	return taken, nil
+}
+
+func (r *Repo) queryTaken(ctx context.Context, query string, args []any, taken map[OccurrenceKey]uint) error {
+	rows, err := r.db.Reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key OccurrenceKey
+		var n uint
+		if err = rows.Scan(&key.ClassID, &key.Date, &n); err != nil {
+			return err
+		}
+		taken[key] = n
+	}
+	return rows.Err()
+}
@@ -0,0 +1,468 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type BookingStatus string
+
+const (
+	BookingStatusBooked        BookingStatus = "booked"
+	BookingStatusCancelled     BookingStatus = "cancelled"
+	BookingStatusLateCancelled BookingStatus = "late_cancelled"
+	BookingStatusNoShow        BookingStatus = "no_show"
+	BookingStatusCheckedIn     BookingStatus = "checked_in"
+	// A drop-in booking holds its spot until the payment succeeds or the hold expires
+	BookingStatusPendingPayment BookingStatus = "pending_payment"
+	// The payment of a drop-in booking failed or didn't succeed in time
+	BookingStatusPaymentFailed BookingStatus = "payment_failed"
+)
+
+// Check-in opens this long before an occurrence starts and closes when it ends.
+const CheckInOpensBefore = time.Hour
+
+// Cancelled bookings and failed drop-ins don't take up a spot. This is an SQL condition on the status column.
+const occupyingStatuses = "status NOT IN ('cancelled', 'late_cancelled', 'payment_failed')"
+
+type Booking struct {
+	ID         uint64
+	ClassID    uint64
+	MemberName string
+	// UNIX timestamp of the date of the occurrence
+	Date   int64
+	Status BookingStatus
+	// UNIX timestamps of the status transitions. Zero if the transition didn't happen, or for CreatedAt if the booking predates it being recorded.
+	CreatedAt   int64
+	CheckedInAt int64
+	CancelledAt int64
+	NoShowAt    int64
+	// Subscription that paid for the booking. Zero for drop-ins and bookings that predate memberships.
+	SubscriptionID uint64
+	// Set for drop-ins only. 'Amount' and 'RefundedAmount' are in the smallest unit of the currency.
+	PaymentID      string
+	Amount         int64
+	RefundedAmount int64
+	// UNIX timestamp until which a drop-in holds its spot while the payment is pending
+	HoldExpiresAt int64
+	// Incremented whenever the status changes, for calendar clients to pick up the change
+	Sequence uint
+}
+
+const bookingColumns = "id, class_id, member_name, date, status, COALESCE(created_at, 0), COALESCE(checked_in_at, 0), COALESCE(cancelled_at, 0), COALESCE(no_show_at, 0), COALESCE(subscription_id, 0), COALESCE(payment_id, ''), amount, refunded_amount, COALESCE(hold_expires_at, 0), sequence"
+
+func scanBooking(row scanner) (*Booking, error) {
+	var booking Booking
+	if err := row.Scan(&booking.ID, &booking.ClassID, &booking.MemberName, &booking.Date, &booking.Status, &booking.CreatedAt, &booking.CheckedInAt, &booking.CancelledAt, &booking.NoShowAt, &booking.SubscriptionID, &booking.PaymentID, &booking.Amount, &booking.RefundedAmount, &booking.HoldExpiresAt, &booking.Sequence); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func (r *Repo) GetBooking(ctx context.Context, id uint64) (*Booking, error) {
+	booking, err := scanBooking(r.db.Reader.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, BookingNotFoundError
+		}
+		return nil, err
+	}
+	return booking, nil
+}
+
+// 'date' is in UNIX timestamp format. The member needs a subscription covering 'date' that entitles them to another class, which is used up together with the spot. The ID of the new booking is returned. 'email' is stored for the member along with the booking if it is not nil.
+func (r *Repo) CreateBooking(ctx context.Context, classID uint64, memberName string, date int64, email *MemberEmail) (_ uint64, err error) {
+	defer r.recordFullRejection(ctx, &err, classID, memberName, date)
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := r.createBooking(ctx, tx, classID, memberName, date)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.setMemberEmail(ctx, tx, memberName, email); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.publishChanges(OccurrenceChange{Type: ChangeBooked, ClassID: classID, Date: date, BookingID: id, MemberName: memberName})
+	return id, nil
+}
+
+func (r *Repo) createBooking(ctx context.Context, tx *sql.Tx, classID uint64, memberName string, date int64) (uint64, error) {
+	if _, err := r.checkBookable(ctx, tx, classID, memberName, date); err != nil {
+		return 0, err
+	}
+	subscriptionID, err := r.consumeEntitlement(ctx, tx, memberName, date)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO bookings (class_id, member_name, date, created_at, subscription_id) VALUES (?, ?, ?, ?, ?);", classID, memberName, date, r.now().Unix(), subscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err = r.auditCreatedBooking(ctx, tx, uint64(id)); err != nil {
+		return 0, err
+	}
+	if err = r.recordBooked(ctx, tx, uint64(id)); err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
+
+// checkBookable checks that the member may book the occurrence of the class on 'date', which is in UNIX timestamp format, and that it has a spot left. Spots are taken by bookings and by seat holds that have not expired. Payment holds of the occurrence that have expired are released first.
+func (r *Repo) checkBookable(ctx context.Context, tx *sql.Tx, classID uint64, memberName string, date int64) (*Class, error) {
+	class, err := scanClass(tx.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", classID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ClassNotFoundError
+		}
+		return nil, err
+	}
+	now := r.now()
+	// Today can still be booked until the booking window of the class closes
+	if date < class.DateOf(now) {
+		return nil, DateInPastError
+	}
+	if class.StartDate > date || class.EndDate < date {
+		return nil, InvalidDateRangeError
+	}
+	if opensAt := class.BookingOpensAt(date); now.Before(opensAt) {
+		return nil, BookingNotOpenYetError
+	}
+	if !now.Before(class.BookingClosesAt(date)) {
+		return nil, BookingClosedError
+	}
+
+	blocked, err := r.isBlocked(ctx, tx, memberName, now)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, MemberBlockedError
+	}
+
+	if _, err = r.updateBookings(ctx, tx, "class_id = ? AND date = ? AND status = 'pending_payment' AND hold_expires_at <= ?", []any{classID, date, now.Unix()}, "status = 'payment_failed', sequence = sequence + 1"); err != nil {
+		return nil, err
+	}
+	taken, err := occupancy(ctx, tx, classID, date, now)
+	if err != nil {
+		return nil, err
+	}
+	if taken >= class.Capacity {
+		return nil, ClassFullError
+	}
+	return class, nil
+}
+
+// Occupancy returns how many spots of the occurrence on 'date', which is in UNIX timestamp format, are taken by bookings and seat holds.
+func (r *Repo) Occupancy(ctx context.Context, classID uint64, date int64) (uint, error) {
+	return occupancy(ctx, r.db.Reader, classID, date, r.now())
+}
+
+func occupancy(ctx context.Context, db querier, classID uint64, date int64, now time.Time) (uint, error) {
+	query := `
+	SELECT
+		(SELECT COUNT(*) FROM bookings WHERE class_id = ? AND date = ? AND ` + occupyingStatuses + `) +
+		(SELECT COUNT(*) FROM holds WHERE class_id = ? AND date = ? AND expires_at > ?);`
+	var n uint
+	if err := db.QueryRowContext(ctx, query, classID, date, classID, date, now.Unix()).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// isBlocked reports whether the member has reached the penalty limit within the penalty window. Penalties from before the last waiver don't count.
+func (r *Repo) isBlocked(ctx context.Context, tx *sql.Tx, memberName string, now time.Time) (bool, error) {
+	if r.Penalties.Limit == 0 {
+		return false, nil
+	}
+	query := `
+	SELECT COUNT(*) FROM bookings
+	WHERE member_name = ?
+		AND ((status = 'late_cancelled' AND cancelled_at > ?) OR (status = 'no_show' AND no_show_at > ?))
+		AND NOT EXISTS (SELECT 1 FROM penalty_waivers WHERE member_name = bookings.member_name AND waived_at >= COALESCE(cancelled_at, no_show_at));`
+	since := now.Add(-r.Penalties.Window).Unix()
+	var penalties uint
+	if err := tx.QueryRowContext(ctx, query, memberName, since, since).Scan(&penalties); err != nil {
+		return false, err
+	}
+	return penalties >= r.Penalties.Limit, nil
+}
+
+// CancelBooking cancels the booking and returns its new status, which is BookingStatusLateCancelled if the free cancellation period of the class is over. The class is given back to the subscription that paid for it either way, and a refund job is scheduled for drop-ins cancelled in time.
+func (r *Repo) CancelBooking(ctx context.Context, id uint64) (BookingStatus, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	booking, class, err := getBookingWithClass(ctx, tx, id)
+	if err != nil {
+		return "", err
+	}
+	now := r.now()
+	occurrence := class.Occurrence(booking.Date)
+	if booking.Status != BookingStatusBooked || !now.Before(occurrence) {
+		return "", BookingNotCancellableError
+	}
+
+	status := BookingStatusCancelled
+	if !now.Before(occurrence.Add(-time.Duration(class.FreeCancelBefore) * time.Second)) {
+		status = BookingStatusLateCancelled
+	}
+	cancelled, err := r.updateBooking(ctx, tx, booking, "status = ?, cancelled_at = ?, sequence = sequence + 1", status, now.Unix())
+	if err != nil {
+		return "", err
+	}
+	if err = r.refundEntitlement(ctx, tx, booking); err != nil {
+		return "", err
+	}
+	if err = r.cancelReminder(ctx, tx, id); err != nil {
+		return "", err
+	}
+	if cancelled.RefundDue() > 0 {
+		if err = r.scheduleRefund(ctx, tx, cancelled); err != nil {
+			return "", err
+		}
+	}
+	if err = r.recordEvent(ctx, tx, EventBookingCancelled, booking.ClassID, newBookingEvent(cancelled)); err != nil {
+		return "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	r.publishChanges(bookingChange(ChangeCancelled, cancelled))
+	return status, nil
+}
+
+// MarkNoShow records that the member didn't attend the occurrence. It counts as a penalty.
+func (r *Repo) MarkNoShow(ctx context.Context, id uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booking, class, err := getBookingWithClass(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	now := r.now()
+	if booking.Status != BookingStatusBooked || now.Before(class.Occurrence(booking.Date)) {
+		return BookingNotMarkableError
+	}
+	if _, err = r.updateBooking(ctx, tx, booking, "status = ?, no_show_at = ?, sequence = sequence + 1", BookingStatusNoShow, now.Unix()); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	r.publishChanges(bookingChange(ChangeNoShow, booking))
+	return nil
+}
+
+// MarkNoShows marks every active booking whose occurrence has ended as no-show and returns how many were marked.
+func (r *Repo) MarkNoShows(ctx context.Context) (int64, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := r.now().Unix()
+	where := "status = 'booked' AND date + (SELECT start_time + duration FROM classes WHERE classes.id = bookings.class_id) <= ?"
+	marked, err := r.updateBookings(ctx, tx, where, []any{now}, "status = 'no_show', no_show_at = ?, sequence = sequence + 1", now)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.publishChanges(bookingChanges(ChangeNoShow, marked)...)
+	return int64(len(marked)), nil
+}
+
+// CheckIn records that the member attended the occurrence of the booking.
+func (r *Repo) CheckIn(ctx context.Context, id uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booking, class, err := getBookingWithClass(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err = r.checkIn(ctx, tx, booking, class); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	r.publishChanges(bookingChange(ChangeCheckedIn, booking))
+	return nil
+}
+
+// CheckInMember checks in the first active booking of the member for the occurrence of the class on 'date', which is in UNIX timestamp format. The ID of the booking is returned.
+func (r *Repo) CheckInMember(ctx context.Context, classID uint64, memberName string, date int64) (uint64, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE class_id = ? AND member_name = ? AND date = ? AND status = 'booked' ORDER BY id LIMIT 1;", classID, memberName, date)
+	booking, err := scanBooking(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, BookingNotFoundError
+		}
+		return 0, err
+	}
+	class, err := scanClass(tx.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", classID))
+	if err != nil {
+		return 0, err
+	}
+	if err = r.checkIn(ctx, tx, booking, class); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.publishChanges(bookingChange(ChangeCheckedIn, booking))
+	return booking.ID, nil
+}
+
+// CheckInWithToken checks in the booking of a check-in token whose signature has already been verified. The token must be for today's occurrence of 'classID' on 'date', which is in UNIX timestamp format. 'nonce' is recorded so that the token can't be replayed, unless the check-in fails.
+func (r *Repo) CheckInWithToken(ctx context.Context, bookingID uint64, classID uint64, date int64, nonce string) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booking, class, err := getBookingWithClass(ctx, tx, bookingID)
+	if err != nil {
+		return err
+	}
+	now := r.now()
+	if booking.ClassID != classID || booking.Date != date || date != class.DateOf(now) {
+		return TokenOccurrenceMismatchError
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO checkin_token_uses (nonce, booking_id, used_at) VALUES (?, ?, ?) ON CONFLICT (nonce) DO NOTHING;", nonce, bookingID, now.Unix())
+	if err != nil {
+		return err
+	}
+	used, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return TokenAlreadyUsedError
+	}
+	if err = r.checkIn(ctx, tx, booking, class); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	r.publishChanges(bookingChange(ChangeCheckedIn, booking))
+	return nil
+}
+
+func (r *Repo) checkIn(ctx context.Context, tx *sql.Tx, booking *Booking, class *Class) error {
+	now := r.now()
+	if booking.Status != BookingStatusBooked || now.Before(class.Occurrence(booking.Date).Add(-CheckInOpensBefore)) || !now.Before(class.OccurrenceEnd(booking.Date)) {
+		return CheckInNotAllowedError
+	}
+	_, err := r.updateBooking(ctx, tx, booking, "status = ?, checked_in_at = ?, sequence = sequence + 1", BookingStatusCheckedIn, now.Unix())
+	return err
+}
+
+// GetRoster returns all bookings of the occurrence of the class on 'date', which is in UNIX timestamp format, including cancelled ones.
+func (r *Repo) GetRoster(ctx context.Context, classID uint64, date int64) ([]Booking, error) {
+	if _, err := r.GetClass(ctx, classID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE class_id = ? AND date = ? ORDER BY id;", classID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []Booking{}
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, *booking)
+	}
+	return bookings, rows.Err()
+}
+
+// WaivePenalties lifts a block by discarding all penalties of the member up to now.
+func (r *Repo) WaivePenalties(ctx context.Context, memberName string) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type waiver struct {
+		MemberName string
+		WaivedAt   int64
+	}
+	var before *waiver
+	var waivedAt int64
+	if err = tx.QueryRowContext(ctx, "SELECT waived_at FROM penalty_waivers WHERE member_name = ?;", memberName).Scan(&waivedAt); err == nil {
+		before = &waiver{MemberName: memberName, WaivedAt: waivedAt}
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	after := waiver{MemberName: memberName, WaivedAt: r.now().Unix()}
+	query := "INSERT INTO penalty_waivers (member_name, waived_at) VALUES (?, ?) ON CONFLICT (member_name) DO UPDATE SET waived_at = excluded.waived_at;"
+	if _, err = tx.ExecContext(ctx, query, memberName, after.WaivedAt); err != nil {
+		return err
+	}
+	if err = r.audit(ctx, tx, AuditEntityPenaltyWaiver, memberName, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// auditCreatedBooking records the creation of the booking.
+func (r *Repo) auditCreatedBooking(ctx context.Context, tx *sql.Tx, id uint64) error {
+	booking, err := scanBooking(tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?;", id))
+	if err != nil {
+		return err
+	}
+	return r.audit(ctx, tx, AuditEntityBooking, id, nil, booking)
+}
+
+func getBookingWithClass(ctx context.Context, tx *sql.Tx, id uint64) (*Booking, *Class, error) {
+	booking, err := scanBooking(tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, BookingNotFoundError
+		}
+		return nil, nil, err
+	}
+	class, err := scanClass(tx.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", booking.ClassID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return booking, class, nil
+}
@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+)
+
+// ResetCalendarToken issues a new secret token for the member's bookings calendar feed and returns it. The token issued before stops working.
+func (r *Repo) ResetCalendarToken(ctx context.Context, memberName string) (string, error) {
+	return r.resetMemberToken(ctx, memberName, "calendar_token", "CalendarToken")
+}
+
+// CheckCalendarToken reports whether 'token' is the calendar token of the member.
+func (r *Repo) CheckCalendarToken(ctx context.Context, memberName string, token string) (bool, error) {
+	var want sql.NullString
+	if err := r.db.Reader.QueryRowContext(ctx, "SELECT calendar_token FROM members WHERE name = ?;", memberName).Scan(&want); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return want.Valid && subtle.ConstantTimeCompare([]byte(want.String), []byte(token)) == 1, nil
+}
+
+// GetMemberBookings returns the bookings of the member for the dates since 'since', which is in UNIX timestamp format, ordered by date. Cancelled bookings are included.
+func (r *Repo) GetMemberBookings(ctx context.Context, memberName string, since int64) ([]Booking, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE member_name = ? AND date >= ? ORDER BY date, id;", memberName, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []Booking{}
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, *booking)
+	}
+	return bookings, rows.Err()
+}
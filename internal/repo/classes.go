@@ -0,0 +1,319 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BookingWindow limits when an occurrence of a class can be booked. All values are relative to the occurrence and in the time zone of the class.
+type BookingWindow struct {
+	// Booking opens this many days before the date of the occurrence...
+	OpensDaysBefore uint
+	// ...at this many seconds after midnight
+	OpensAt uint
+	// Booking closes this many seconds before the occurrence starts
+	ClosesBefore uint
+}
+
+type Class struct {
+	ID   uint64
+	Name string
+	// 'StartDate' and 'EndDate' are in UNIX timestamp format
+	StartDate int64
+	EndDate   int64
+	// Seconds after midnight in the time zone of the class at which every occurrence starts
+	StartTime uint
+	// Length of every occurrence in seconds
+	Duration uint
+	Capacity uint
+	// Booking is open from the moment the class is created until its occurrence starts when nil
+	BookingWindow *BookingWindow
+	// Bookings can be cancelled free of charge until this many seconds before the occurrence starts. Later cancellations are flagged as late.
+	FreeCancelBefore uint
+	// Zero if no instructor is assigned
+	InstructorID uint64
+	// Zero if the class is not held in a room. Capacity must not exceed the capacity of the room.
+	RoomID uint64
+	// Drop-in price in the smallest unit of the currency. Zero if the class can only be booked with a membership.
+	Price int64
+	// Incremented whenever the class changes, for calendar clients to pick up the change
+	Sequence uint
+	// IANA time zone name of the location of the room, which the dates and times of the class are in. Empty for UTC if the class is not held in a room. It is not stored with the class but looked up through the room.
+	Timezone string
+}
+
+// Occurrence is a single session of a class.
+type Occurrence struct {
+	ClassID   uint64
+	ClassName string
+	Start     time.Time
+	End       time.Time
+}
+
+// timezones caches the loaded time zones by name
+var timezones sync.Map
+
+// Location returns the time zone of the class. UTC is returned if the class has none, or if it can't be loaded.
+func (c *Class) Location() *time.Location {
+	if c.Timezone == "" {
+		return time.UTC
+	}
+	if loc, ok := timezones.Load(c.Timezone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	timezones.Store(c.Timezone, loc)
+	return loc
+}
+
+// atDay returns the time that is 'offset' after midnight in the time zone of the class on the day 'days' after 'date', which is in UNIX timestamp format. Offsets are wall clock times, so they don't move with daylight saving time.
+func (c *Class) atDay(date int64, days int, offset uint) time.Time {
+	y, m, d := time.Unix(date, 0).UTC().Date()
+	return time.Date(y, m, d+days, 0, 0, int(offset), 0, c.Location()).UTC()
+}
+
+// DateOf returns the date of 't' in the time zone of the class, in UNIX timestamp format.
+func (c *Class) DateOf(t time.Time) int64 {
+	y, m, d := t.In(c.Location()).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()
+}
+
+// Occurrence returns the start of the occurrence on 'date', which is in UNIX timestamp format.
+func (c *Class) Occurrence(date int64) time.Time {
+	return c.atDay(date, 0, c.StartTime)
+}
+
+// OccurrenceEnd returns the end of the occurrence on 'date', which is in UNIX timestamp format.
+func (c *Class) OccurrenceEnd(date int64) time.Time {
+	return c.Occurrence(date).Add(time.Duration(c.Duration) * time.Second)
+}
+
+// Occurrences returns the occurrences of the class that overlap the period from 'from' until 'to', ordered by start.
+func (c *Class) Occurrences(from, to time.Time) []Occurrence {
+	const day = 24 * 60 * 60
+	// Skip the dates whose occurrence ends before 'from', leaving a day for the offset of the time zone
+	date := c.StartDate
+	if first := from.Unix() - int64(c.StartTime) - int64(c.Duration) - day; first > date {
+		date += (first - date) / day * day
+	}
+	var occurrences []Occurrence
+	for ; date <= c.EndDate; date += day {
+		start, end := c.Occurrence(date), c.OccurrenceEnd(date)
+		if !start.Before(to) {
+			break
+		}
+		if end.After(from) {
+			occurrences = append(occurrences, Occurrence{ClassID: c.ID, ClassName: c.Name, Start: start, End: end})
+		}
+	}
+	return occurrences
+}
+
+// BookingOpensAt returns when booking opens for the occurrence on 'date'. The zero time is returned if the class has no booking window.
+func (c *Class) BookingOpensAt(date int64) time.Time {
+	if c.BookingWindow == nil {
+		return time.Time{}
+	}
+	return c.atDay(date, -int(c.BookingWindow.OpensDaysBefore), c.BookingWindow.OpensAt)
+}
+
+// BookingClosesAt returns when booking closes for the occurrence on 'date'.
+func (c *Class) BookingClosesAt(date int64) time.Time {
+	closesAt := c.Occurrence(date)
+	if c.BookingWindow != nil {
+		closesAt = closesAt.Add(-time.Duration(c.BookingWindow.ClosesBefore) * time.Second)
+	}
+	return closesAt
+}
+
+// CreateClass sets the ID of 'class' on success. A *ScheduleConflictError is returned if the instructor or the room of the class is already taken at the same time.
+func (r *Repo) CreateClass(ctx context.Context, class *Class) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := r.createClass(ctx, tx, class)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	class.ID = id
+	return nil
+}
+
+// CreateClasses creates all the classes in one transaction and sets their IDs. The classes are checked against each other as well as the existing ones. If any of them can't be created, nothing is and the returned slice holds the error of every such class at its index, e.g. a *ScheduleConflictError. Nothing is created on a dry run either, which only reports the errors.
+func (r *Repo) CreateClasses(ctx context.Context, classes []Class, dryRun bool) ([]error, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var classErrs []error
+	ids := make([]uint64, len(classes))
+	for i := range classes {
+		id, err := r.createClass(ctx, tx, &classes[i])
+		if err != nil {
+			var conflict *ScheduleConflictError
+			if !errors.As(err, &conflict) && err != InstructorNotFoundError && err != RoomNotFoundError && err != RoomCapacityExceededError {
+				return nil, err
+			}
+			if classErrs == nil {
+				classErrs = make([]error, len(classes))
+			}
+			classErrs[i] = err
+			continue
+		}
+		ids[i] = id
+	}
+	if classErrs != nil || dryRun {
+		return classErrs, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	for i := range classes {
+		classes[i].ID = ids[i]
+	}
+	return nil, nil
+}
+
+// createClass creates the class in 'tx' and returns its ID.
+func (r *Repo) createClass(ctx context.Context, tx *sql.Tx, class *Class) (uint64, error) {
+	// Needed to tell when the occurrences are. checkRoom reports unknown rooms.
+	if err := tx.QueryRowContext(ctx, roomTimezoneQuery, class.RoomID).Scan(&class.Timezone); err != nil {
+		return 0, err
+	}
+	if err := checkInstructorSchedule(ctx, tx, class); err != nil {
+		return 0, err
+	}
+	if err := checkRoom(ctx, tx, class); err != nil {
+		return 0, err
+	}
+	var opensDaysBefore, opensAt, closesBefore sql.NullInt64
+	if w := class.BookingWindow; w != nil {
+		opensDaysBefore = sql.NullInt64{Int64: int64(w.OpensDaysBefore), Valid: true}
+		opensAt = sql.NullInt64{Int64: int64(w.OpensAt), Valid: true}
+		closesBefore = sql.NullInt64{Int64: int64(w.ClosesBefore), Valid: true}
+	}
+	query := "INSERT INTO classes (name, start_date, end_date, start_time, duration, capacity, booking_opens_days_before, booking_opens_at, booking_closes_before, free_cancel_before, instructor_id, room_id, price) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
+	res, err := tx.ExecContext(ctx, query, class.Name, class.StartDate, class.EndDate, class.StartTime, class.Duration, class.Capacity, opensDaysBefore, opensAt, closesBefore, class.FreeCancelBefore, nullID(class.InstructorID), nullID(class.RoomID), class.Price)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	created := *class
+	created.ID = uint64(id)
+	if err = r.audit(ctx, tx, AuditEntityClass, created.ID, nil, created); err != nil {
+		return 0, err
+	}
+	if err = r.recordEvent(ctx, tx, EventClassCreated, created.ID, newClassEvent(&created)); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// nullID stores the zero ID as NULL.
+func nullID(id uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+const classColumns = "id, name, start_date, end_date, start_time, duration, capacity, booking_opens_days_before, booking_opens_at, booking_closes_before, free_cancel_before, COALESCE(instructor_id, 0), COALESCE(room_id, 0), price, sequence, " + classTimezone
+
+// classTimezone selects the time zone of a class from its room
+const classTimezone = "COALESCE((SELECT locations.timezone FROM rooms JOIN locations ON locations.id = rooms.location_id WHERE rooms.id = classes.room_id), '')"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanClass(row scanner) (*Class, error) {
+	var class Class
+	var opensDaysBefore, opensAt, closesBefore sql.NullInt64
+	if err := row.Scan(&class.ID, &class.Name, &class.StartDate, &class.EndDate, &class.StartTime, &class.Duration, &class.Capacity, &opensDaysBefore, &opensAt, &closesBefore, &class.FreeCancelBefore, &class.InstructorID, &class.RoomID, &class.Price, &class.Sequence, &class.Timezone); err != nil {
+		return nil, err
+	}
+	if opensDaysBefore.Valid {
+		class.BookingWindow = &BookingWindow{
+			OpensDaysBefore: uint(opensDaysBefore.Int64),
+			OpensAt:         uint(opensAt.Int64),
+			ClosesBefore:    uint(closesBefore.Int64),
+		}
+	}
+	return &class, nil
+}
+
+func (r *Repo) GetClass(ctx context.Context, id uint64) (*Class, error) {
+	class, err := scanClass(r.db.Reader.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ClassNotFoundError
+		}
+		return nil, err
+	}
+	return class, nil
+}
+
+// ClassFilter narrows down the classes returned by GetClasses. Zero values don't filter.
+type ClassFilter struct {
+	LocationID uint64
+}
+
+func (r *Repo) GetClasses(ctx context.Context, filter ClassFilter) ([]Class, error) {
+	query := "SELECT " + classColumns + " FROM classes WHERE (? = 0 OR room_id IN (SELECT id FROM rooms WHERE location_id = ?)) ORDER BY start_date, id;"
+	rows, err := r.db.Reader.QueryContext(ctx, query, filter.LocationID, filter.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	classes := []Class{}
+	for rows.Next() {
+		class, err := scanClass(rows)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, *class)
+	}
+	return classes, rows.Err()
+}
+
+// GetClassesByID returns the classes with the IDs, in no particular order. Unknown IDs are skipped.
+func (r *Repo) GetClassesByID(ctx context.Context, ids []uint64) ([]Class, error) {
+	classes := []Class{}
+	if len(ids) == 0 {
+		return classes, nil
+	}
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+");", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		class, err := scanClass(rows)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, *class)
+	}
+	return classes, rows.Err()
+}
@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MemberEmail is an address given for the member along with a booking.
+type MemberEmail struct {
+	Address string
+	// Replaces the address stored for the member. Otherwise it is only stored if the member has none yet, so that someone else booking in their name can't redirect their notifications.
+	Replace bool
+}
+
+// SetMemberEmail sets the address notifications for the member are sent to, replacing any earlier one.
+func (r *Repo) SetMemberEmail(ctx context.Context, memberName string, email string) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = r.setMemberEmail(ctx, tx, memberName, &MemberEmail{Address: email, Replace: true}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setMemberEmail stores the address of the member in 'tx'. Nothing is stored if 'email' is nil.
+func (r *Repo) setMemberEmail(ctx context.Context, tx *sql.Tx, memberName string, email *MemberEmail) error {
+	if email == nil || email.Address == "" {
+		return nil
+	}
+	type memberEmail struct{ Email string }
+	var before *memberEmail
+	var old string
+	switch err := tx.QueryRowContext(ctx, "SELECT email FROM members WHERE name = ?;", memberName).Scan(&old); err {
+	case nil:
+		if old != "" && !email.Replace {
+			return nil
+		}
+		before = &memberEmail{Email: old}
+	case sql.ErrNoRows:
+	default:
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO members (name, email) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET email = excluded.email;", memberName, email.Address); err != nil {
+		return err
+	}
+	return r.audit(ctx, tx, AuditEntityMember, memberName, before, memberEmail{Email: email.Address})
+}
+
+// GetMemberEmail returns the address notifications for the member are sent to, or an empty string if they haven't given one.
+func (r *Repo) GetMemberEmail(ctx context.Context, memberName string) (string, error) {
+	var email string
+	if err := r.db.Reader.QueryRowContext(ctx, "SELECT email FROM members WHERE name = ?;", memberName).Scan(&email); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return email, nil
+}
+
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	// Given up on after the last retry
+	EmailStatusFailed EmailStatus = "failed"
+)
+
+// Email is a rendered notification waiting to be sent.
+type Email struct {
+	ID uint64
+	// Identifies what the email is about, e.g. an event and its recipient. Queuing an email with a key that was queued before is a no-op, so the same notification is never sent twice.
+	Key       string
+	Recipient string
+	Subject   string
+	// HTML body
+	Body      string
+	CreatedAt int64
+	Status    EmailStatus
+	Attempts  uint
+	// UNIX timestamp of when the email is due to be (re)tried
+	NextAttemptAt int64
+	LastError     string
+}
+
+const emailColumns = "id, key, recipient, subject, body, created_at, status, attempts, next_attempt_at, last_error"
+
+func scanEmail(row scanner) (*Email, error) {
+	var email Email
+	if err := row.Scan(&email.ID, &email.Key, &email.Recipient, &email.Subject, &email.Body, &email.CreatedAt, &email.Status, &email.Attempts, &email.NextAttemptAt, &email.LastError); err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// EnqueueEmail queues the email to be sent right away and reports whether it was queued, which it isn't if an email with the same key was queued before.
+func (r *Repo) EnqueueEmail(ctx context.Context, email *Email) (bool, error) {
+	now := r.now().Unix()
+	res, err := r.db.Writer.ExecContext(ctx, "INSERT INTO emails (key, recipient, subject, body, created_at, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (key) DO NOTHING;", email.Key, email.Recipient, email.Subject, email.Body, now, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	email.ID = uint64(id)
+	email.CreatedAt = now
+	email.Status = EmailStatusPending
+	email.NextAttemptAt = now
+	return true, nil
+}
+
+// GetDueEmails returns up to 'limit' pending emails whose next attempt is due, oldest first.
+func (r *Repo) GetDueEmails(ctx context.Context, limit int) ([]Email, error) {
+	return r.getEmails(ctx, "SELECT "+emailColumns+" FROM emails WHERE status = 'pending' AND next_attempt_at <= ? ORDER BY id LIMIT ?;", r.now().Unix(), limit)
+}
+
+// GetEmails returns the emails queued for 'recipient', oldest first.
+func (r *Repo) GetEmails(ctx context.Context, recipient string) ([]Email, error) {
+	return r.getEmails(ctx, "SELECT "+emailColumns+" FROM emails WHERE recipient = ? ORDER BY id;", recipient)
+}
+
+func (r *Repo) getEmails(ctx context.Context, query string, args ...any) ([]Email, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := []Email{}
+	for rows.Next() {
+		email, err := scanEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, *email)
+	}
+	return emails, rows.Err()
+}
+
+// MarkEmailSent records that the email was handed to the mail server.
+func (r *Repo) MarkEmailSent(ctx context.Context, id uint64) error {
+	_, err := r.db.Writer.ExecContext(ctx, "UPDATE emails SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = ? WHERE id = ?;", r.now().Unix(), id)
+	return err
+}
+
+// MarkEmailFailed records a failed attempt to send the email. It is retried at 'nextAttemptAt' unless 'failed' gives up on it.
+func (r *Repo) MarkEmailFailed(ctx context.Context, id uint64, lastError string, nextAttemptAt time.Time, failed bool) error {
+	status := EmailStatusPending
+	if failed {
+		status = EmailStatusFailed
+	}
+	_, err := r.db.Writer.ExecContext(ctx, "UPDATE emails SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?;", status, lastError, nextAttemptAt.Unix(), id)
+	return err
+}
@@ -0,0 +1,8 @@
+package repo
+
+import "time"
+
+// SetNow replaces the clock of the repo in tests.
+func (r *Repo) SetNow(now func() time.Time) {
+	r.now = now
+}
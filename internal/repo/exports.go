@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+)
+
+// ExportFilter narrows down exports. Zero values don't filter.
+type ExportFilter struct {
+	// UNIX timestamps of the first and the last date
+	From int64
+	To   int64
+	// Only the class, or the bookings of the class
+	ClassID uint64
+}
+
+// BookingExport is a booking along with the class it is for.
+type BookingExport struct {
+	Booking
+	ClassName      string
+	ClassStartTime uint
+	ClassDuration  uint
+	InstructorID   uint64
+	RoomID         uint64
+}
+
+// extraScanner scans the columns that follow the ones a scan function knows about into 'extra'.
+type extraScanner struct {
+	scanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// ExportBookings calls 'fn' with every booking for a date in the filter's range, ordered by date. The bookings are read from the database one at a time as 'fn' returns, so exports of any size take little memory. 'export' is reused between calls. Returning an error from 'fn' stops the export and returns the error.
+func (r *Repo) ExportBookings(ctx context.Context, filter ExportFilter, fn func(export *BookingExport) error) error {
+	query := `
+	SELECT ` + bookingColumns + `, class_name, class_start_time, class_duration, instructor_id, room_id FROM (
+		SELECT b.*, c.name AS class_name, c.start_time AS class_start_time, c.duration AS class_duration, COALESCE(c.instructor_id, 0) AS instructor_id, COALESCE(c.room_id, 0) AS room_id
+		FROM bookings b JOIN classes c ON c.id = b.class_id
+		WHERE (? = 0 OR b.date >= ?) AND (? = 0 OR b.date <= ?) AND (? = 0 OR b.class_id = ?)
+	)
+	ORDER BY date, id;`
+	rows, err := r.db.Reader.QueryContext(ctx, query, filter.From, filter.From, filter.To, filter.To, filter.ClassID, filter.ClassID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var export BookingExport
+	s := extraScanner{scanner: rows, extra: []any{&export.ClassName, &export.ClassStartTime, &export.ClassDuration, &export.InstructorID, &export.RoomID}}
+	for rows.Next() {
+		booking, err := scanBooking(s)
+		if err != nil {
+			return err
+		}
+		export.Booking = *booking
+		if err = fn(&export); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportClasses calls 'fn' with every class held on any date in the filter's range, ordered by start date. Like ExportBookings, the classes are read one at a time as 'fn' returns.
+func (r *Repo) ExportClasses(ctx context.Context, filter ExportFilter, fn func(class *Class) error) error {
+	query := "SELECT " + classColumns + " FROM classes WHERE (? = 0 OR end_date >= ?) AND (? = 0 OR start_date <= ?) AND (? = 0 OR id = ?) ORDER BY start_date, id;"
+	rows, err := r.db.Reader.QueryContext(ctx, query, filter.From, filter.From, filter.To, filter.To, filter.ClassID, filter.ClassID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		class, err := scanClass(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(class); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Hold reserves a spot in an occurrence of a class for a member until it expires or is confirmed.
+type Hold struct {
+	ID         uint64
+	ClassID    uint64
+	MemberName string
+	// UNIX timestamp of the occurrence
+	Date      int64
+	CreatedAt int64
+	ExpiresAt int64
+}
+
+// CreateHold reserves a spot in the occurrence on 'date', which is in UNIX timestamp format, for 'ttl'. The member must be allowed to book the occurrence, but their membership is only checked once the hold is confirmed. 'email' is stored for the member along with the hold if it is not nil.
+func (r *Repo) CreateHold(ctx context.Context, classID uint64, memberName string, date int64, ttl time.Duration, email *MemberEmail) (_ *Hold, err error) {
+	defer r.recordFullRejection(ctx, &err, classID, memberName, date)
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = r.checkBookable(ctx, tx, classID, memberName, date); err != nil {
+		return nil, err
+	}
+	now := r.now()
+	hold := &Hold{ClassID: classID, MemberName: memberName, Date: date, CreatedAt: now.Unix(), ExpiresAt: now.Add(ttl).Unix()}
+	res, err := tx.ExecContext(ctx, "INSERT INTO holds (class_id, member_name, date, created_at, expires_at) VALUES (?, ?, ?, ?, ?);", hold.ClassID, hold.MemberName, hold.Date, hold.CreatedAt, hold.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	hold.ID = uint64(id)
+	if err = r.audit(ctx, tx, AuditEntityHold, hold.ID, nil, hold); err != nil {
+		return nil, err
+	}
+	if err = r.setMemberEmail(ctx, tx, memberName, email); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	r.publishChanges(holdChange(ChangeHeld, hold))
+	return hold, nil
+}
+
+// GetHold returns the hold, which may have expired. HoldNotFoundError is returned once it is confirmed or released.
+func (r *Repo) GetHold(ctx context.Context, id uint64) (*Hold, error) {
+	var hold Hold
+	row := r.db.Reader.QueryRowContext(ctx, "SELECT id, class_id, member_name, date, created_at, expires_at FROM holds WHERE id = ?;", id)
+	if err := row.Scan(&hold.ID, &hold.ClassID, &hold.MemberName, &hold.Date, &hold.CreatedAt, &hold.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, HoldNotFoundError
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ConfirmHold turns the hold into a booking and returns the ID of the booking. The booking is subject to the same checks as CreateBooking, with the held spot counting as free. HoldReleasedError is returned if the hold has expired.
+func (r *Repo) ConfirmHold(ctx context.Context, id uint64) (uint64, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var hold Hold
+	row := tx.QueryRowContext(ctx, "SELECT id, class_id, member_name, date, created_at, expires_at FROM holds WHERE id = ?;", id)
+	if err = row.Scan(&hold.ID, &hold.ClassID, &hold.MemberName, &hold.Date, &hold.CreatedAt, &hold.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, HoldNotFoundError
+		}
+		return 0, err
+	}
+	if hold.ExpiresAt <= r.now().Unix() {
+		return 0, HoldReleasedError
+	}
+	// The hold gives way to the booking so that its spot is free again
+	if _, err = tx.ExecContext(ctx, "DELETE FROM holds WHERE id = ?;", id); err != nil {
+		return 0, err
+	}
+	if err = r.audit(ctx, tx, AuditEntityHold, id, hold, nil); err != nil {
+		return 0, err
+	}
+	bookingID, err := r.createBooking(ctx, tx, hold.ClassID, hold.MemberName, hold.Date)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.publishChanges(OccurrenceChange{Type: ChangeBooked, ClassID: hold.ClassID, Date: hold.Date, BookingID: bookingID, MemberName: hold.MemberName})
+	return bookingID, nil
+}
+
+// ReleaseExpiredHolds deletes all seat holds that have expired and returns how many were deleted. Expired holds don't take up spots either way.
+func (r *Repo) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, class_id, member_name, date, created_at, expires_at FROM holds WHERE expires_at <= ?;", r.now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	var holds []Hold
+	for rows.Next() {
+		var hold Hold
+		if err = rows.Scan(&hold.ID, &hold.ClassID, &hold.MemberName, &hold.Date, &hold.CreatedAt, &hold.ExpiresAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		holds = append(holds, hold)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, hold := range holds {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM holds WHERE id = ?;", hold.ID); err != nil {
+			return 0, err
+		}
+		if err = r.audit(ctx, tx, AuditEntityHold, hold.ID, hold, nil); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, hold := range holds {
+		r.publishChanges(holdChange(ChangeReleased, &hold))
+	}
+	return int64(len(holds)), nil
+}
@@ -0,0 +1,211 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Instructor struct {
+	ID   uint64
+	Name string
+}
+
+// Resources that can't be used by two classes at the same time
+const (
+	ResourceInstructor = "instructor"
+	ResourceRoom       = "room"
+)
+
+// ScheduleConflictError is returned when a class would make its instructor teach, or its room host, two occurrences at the same time. It lists the clashing occurrences of the other classes.
+type ScheduleConflictError struct {
+	// Either ResourceInstructor or ResourceRoom
+	Resource    string
+	Occurrences []Occurrence
+}
+
+func (e *ScheduleConflictError) Error() string {
+	return fmt.Sprintf("Class overlaps %d occurrences of other classes with the same %s", len(e.Occurrences), e.Resource)
+}
+
+// CreateInstructor sets the ID of 'instructor' on success.
+func (r *Repo) CreateInstructor(ctx context.Context, instructor *Instructor) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO instructors (name) VALUES (?);", instructor.Name)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created := Instructor{ID: uint64(id), Name: instructor.Name}
+	if err = r.audit(ctx, tx, AuditEntityInstructor, created.ID, nil, created); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	instructor.ID = created.ID
+	return nil
+}
+
+func (r *Repo) GetInstructor(ctx context.Context, id uint64) (*Instructor, error) {
+	var instructor Instructor
+	if err := r.db.Reader.QueryRowContext(ctx, "SELECT id, name FROM instructors WHERE id = ?;", id).Scan(&instructor.ID, &instructor.Name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, InstructorNotFoundError
+		}
+		return nil, err
+	}
+	return &instructor, nil
+}
+
+func (r *Repo) GetInstructors(ctx context.Context) ([]Instructor, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT id, name FROM instructors ORDER BY id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	instructors := []Instructor{}
+	for rows.Next() {
+		var instructor Instructor
+		if err = rows.Scan(&instructor.ID, &instructor.Name); err != nil {
+			return nil, err
+		}
+		instructors = append(instructors, instructor)
+	}
+	return instructors, rows.Err()
+}
+
+// AssignInstructor makes the instructor teach the class, replacing the previous one. Pass 0 as 'instructorID' to unassign. A *ScheduleConflictError is returned if the instructor is already teaching at the same time.
+func (r *Repo) AssignInstructor(ctx context.Context, classID uint64, instructorID uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	class, err := scanClass(tx.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", classID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ClassNotFoundError
+		}
+		return err
+	}
+	before := *class
+	class.InstructorID = instructorID
+	if err = checkInstructorSchedule(ctx, tx, class); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE classes SET instructor_id = ?, sequence = sequence + 1 WHERE id = ?;", nullID(instructorID), classID); err != nil {
+		return err
+	}
+	after, err := scanClass(tx.QueryRowContext(ctx, "SELECT "+classColumns+" FROM classes WHERE id = ?;", classID))
+	if err != nil {
+		return err
+	}
+	if err = r.audit(ctx, tx, AuditEntityClass, classID, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetInstructorSchedule returns the occurrences of all classes taught by the instructor that overlap the period from 'from' until 'to', ordered by start.
+func (r *Repo) GetInstructorSchedule(ctx context.Context, id uint64, from, to time.Time) ([]Occurrence, error) {
+	if _, err := r.GetInstructor(ctx, id); err != nil {
+		return nil, err
+	}
+	classes, err := getClassesBy(ctx, r.db.Reader, "instructor_id", id)
+	if err != nil {
+		return nil, err
+	}
+	occurrences := []Occurrence{}
+	for i := range classes {
+		occurrences = append(occurrences, classes[i].Occurrences(from, to)...)
+	}
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+	return occurrences, nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getClassesBy returns the classes whose 'column' equals 'id'. 'column' must not come from user input.
+func getClassesBy(ctx context.Context, db querier, column string, id uint64) ([]Class, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+classColumns+" FROM classes WHERE "+column+" = ? ORDER BY start_date, id;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var classes []Class
+	for rows.Next() {
+		class, err := scanClass(rows)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, *class)
+	}
+	return classes, rows.Err()
+}
+
+// checkInstructorSchedule returns InstructorNotFoundError if the instructor of 'class' doesn't exist, or a *ScheduleConflictError if any occurrence of 'class' overlaps an occurrence of another class of the instructor.
+func checkInstructorSchedule(ctx context.Context, tx *sql.Tx, class *Class) error {
+	if class.InstructorID == 0 {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM instructors WHERE id = ?);", class.InstructorID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return InstructorNotFoundError
+	}
+
+	others, err := getClassesBy(ctx, tx, "instructor_id", class.InstructorID)
+	if err != nil {
+		return err
+	}
+	if conflicts := findConflicts(class, others); len(conflicts) > 0 {
+		return &ScheduleConflictError{Resource: ResourceInstructor, Occurrences: conflicts}
+	}
+	return nil
+}
+
+// findConflicts returns the occurrences of 'others' that overlap any occurrence of 'class', ordered by start. 'class' itself is skipped if it is among 'others'.
+func findConflicts(class *Class, others []Class) []Occurrence {
+	var conflicts []Occurrence
+	for i := range others {
+		if others[i].ID == class.ID {
+			continue
+		}
+		// Every occurrence of the other class is listed once, even if it overlaps several occurrences of 'class'
+		seen := map[int64]bool{}
+		for _, occurrence := range class.Occurrences(time.Unix(class.StartDate, 0), time.Unix(class.EndDate, 0).AddDate(0, 0, 1)) {
+			for _, clash := range others[i].Occurrences(occurrence.Start, occurrence.End) {
+				if !seen[clash.Start.Unix()] {
+					seen[clash.Start.Unix()] = true
+					conflicts = append(conflicts, clash)
+				}
+			}
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].Start.Before(conflicts[j].Start)
+	})
+	return conflicts
+}
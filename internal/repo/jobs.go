@@ -0,0 +1,239 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobStatusPending JobStatus = "pending"
+	// Leased by a scheduler that is running it
+	JobStatusRunning JobStatus = "running"
+	JobStatusDone    JobStatus = "done"
+	// Given up on after the last retry
+	JobStatusFailed JobStatus = "failed"
+)
+
+// Kinds of jobs scheduled by the repo
+const (
+	// Reminds the member of a booking shortly before the occurrence. The payload is a ReminderPayload.
+	JobKindReminder = "reminder"
+	// Refunds what is due of the drop-in payment of a cancelled booking. The payload is a RefundPayload.
+	JobKindRefund = "refund"
+)
+
+// Job is work to be run in the background at RunAt.
+type Job struct {
+	ID   uint64
+	Kind string
+	// Identifies the job so that it can be rescheduled or cancelled. Scheduling a job with the key of an existing one replaces it. Optional.
+	Key     string
+	Payload string
+	// UNIX timestamp of when the job is due to be (re)tried
+	RunAt  int64
+	Status JobStatus
+	// Attempts made so far, including a running one
+	Attempts    uint
+	MaxAttempts uint
+	// UNIX timestamp until which a running job belongs to the scheduler that leased it. The job is run again if it hasn't finished by then.
+	LeaseUntil int64
+	LastError  string
+	CreatedAt  int64
+}
+
+const jobColumns = "id, kind, COALESCE(key, ''), payload, run_at, status, attempts, max_attempts, COALESCE(lease_until, 0), last_error, created_at"
+
+func scanJob(row scanner) (*Job, error) {
+	var job Job
+	if err := row.Scan(&job.ID, &job.Kind, &job.Key, &job.Payload, &job.RunAt, &job.Status, &job.Attempts, &job.MaxAttempts, &job.LeaseUntil, &job.LastError, &job.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ScheduleJob queues the job to run at job.RunAt, replacing the job with the same key if there is one. Retries of the replaced job start over. The ID of 'job' is set on success.
+func (r *Repo) ScheduleJob(ctx context.Context, job *Job) error {
+	return r.scheduleJob(ctx, r.db.Writer, job)
+}
+
+func (r *Repo) scheduleJob(ctx context.Context, db querier, job *Job) error {
+	query := `
+	INSERT INTO jobs (kind, key, payload, run_at, max_attempts, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (key) DO UPDATE SET kind = excluded.kind, payload = excluded.payload, run_at = excluded.run_at, max_attempts = excluded.max_attempts,
+		status = 'pending', attempts = 0, lease_until = NULL, last_error = '', finished_at = NULL
+	RETURNING id, status, created_at;`
+	key := sql.NullString{String: job.Key, Valid: job.Key != ""}
+	return db.QueryRowContext(ctx, query, job.Kind, key, job.Payload, job.RunAt, job.MaxAttempts, r.now().Unix()).Scan(&job.ID, &job.Status, &job.CreatedAt)
+}
+
+func (r *Repo) GetJob(ctx context.Context, key string) (*Job, error) {
+	job, err := scanJob(r.db.Reader.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE key = ?;", key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, JobNotFoundError
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// LeaseJobs marks up to 'limit' due jobs of the kinds as running for 'lease' and returns them, earliest first. Running jobs whose lease has expired are due again, as their scheduler is assumed to have died.
+func (r *Repo) LeaseJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]Job, error) {
+	if len(kinds) == 0 {
+		return []Job{}, nil
+	}
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := r.now()
+	args := []any{}
+	for _, kind := range kinds {
+		args = append(args, kind)
+	}
+	args = append(args, now.Unix(), now.Unix(), limit)
+	query := fmt.Sprintf(`
+	SELECT %s FROM jobs
+	WHERE kind IN (?%s) AND ((status = 'pending' AND run_at <= ?) OR (status = 'running' AND lease_until <= ?))
+	ORDER BY run_at, id
+	LIMIT ?;`, jobColumns, strings.Repeat(", ?", len(kinds)-1))
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease).Unix()
+	for i := range jobs {
+		if _, err = tx.ExecContext(ctx, "UPDATE jobs SET status = 'running', attempts = attempts + 1, lease_until = ? WHERE id = ?;", leaseUntil, jobs[i].ID); err != nil {
+			return nil, err
+		}
+		jobs[i].Status = JobStatusRunning
+		jobs[i].Attempts++
+		jobs[i].LeaseUntil = leaseUntil
+	}
+	return jobs, tx.Commit()
+}
+
+// finishJob updates a leased job unless it was leased again or rescheduled in the meantime, which changes its attempts.
+func (r *Repo) finishJob(ctx context.Context, job *Job, set string, args ...any) error {
+	args = append(args, job.ID, job.Attempts)
+	_, err := r.db.Writer.ExecContext(ctx, "UPDATE jobs SET "+set+", lease_until = NULL WHERE id = ? AND status = 'running' AND attempts = ?;", args...)
+	return err
+}
+
+// CompleteJob records that the leased job ran successfully.
+func (r *Repo) CompleteJob(ctx context.Context, job *Job) error {
+	return r.finishJob(ctx, job, "status = 'done', last_error = '', finished_at = ?", r.now().Unix())
+}
+
+// RetryJob records that the leased job failed and queues it to be tried again at 'runAt'.
+func (r *Repo) RetryJob(ctx context.Context, job *Job, lastError string, runAt time.Time) error {
+	return r.finishJob(ctx, job, "status = 'pending', last_error = ?, run_at = ?", lastError, runAt.Unix())
+}
+
+// FailJob records that the leased job failed for the last time.
+func (r *Repo) FailJob(ctx context.Context, job *Job, lastError string) error {
+	return r.finishJob(ctx, job, "status = 'failed', last_error = ?, finished_at = ?", lastError, r.now().Unix())
+}
+
+// RescheduleJob queues the leased job to run again at 'runAt' with its attempts starting over, e.g. the next run of a recurring job. 'lastError' is empty if it ran successfully.
+func (r *Repo) RescheduleJob(ctx context.Context, job *Job, lastError string, runAt time.Time) error {
+	return r.finishJob(ctx, job, "status = 'pending', attempts = 0, last_error = ?, run_at = ?", lastError, runAt.Unix())
+}
+
+// ReleaseJob hands the leased job back without counting the attempt, e.g. on shutdown before it started running.
+func (r *Repo) ReleaseJob(ctx context.Context, job *Job) error {
+	return r.finishJob(ctx, job, "status = 'pending', attempts = attempts - 1")
+}
+
+// DeleteFinishedJobs deletes the jobs that finished before 'before' and returns how many were deleted.
+func (r *Repo) DeleteFinishedJobs(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.Writer.ExecContext(ctx, "DELETE FROM jobs WHERE status IN ('done', 'failed') AND finished_at < ?;", before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ReminderPayload is the payload of reminder jobs.
+type ReminderPayload struct {
+	BookingID uint64 `json:"bookingId"`
+}
+
+func reminderKey(bookingID uint64) string {
+	return fmt.Sprintf("%s/%d", JobKindReminder, bookingID)
+}
+
+// ScheduleReminder schedules the reminder of the booking ReminderLead before its occurrence, replacing the one scheduled before, e.g. after its class was moved. Nothing is scheduled if that time has passed already.
+func (r *Repo) ScheduleReminder(ctx context.Context, bookingID uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booking, class, err := getBookingWithClass(ctx, tx, bookingID)
+	if err != nil {
+		return err
+	}
+	if err = r.scheduleReminder(ctx, tx, booking, class); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repo) scheduleReminder(ctx context.Context, tx *sql.Tx, booking *Booking, class *Class) error {
+	if r.ReminderLead <= 0 {
+		return nil
+	}
+	runAt := class.Occurrence(booking.Date).Add(-r.ReminderLead)
+	if runAt.Before(r.now()) {
+		return nil
+	}
+	b, err := json.Marshal(ReminderPayload{BookingID: booking.ID})
+	if err != nil {
+		return err
+	}
+	return r.scheduleJob(ctx, tx, &Job{Kind: JobKindReminder, Key: reminderKey(booking.ID), Payload: string(b), RunAt: runAt.Unix(), MaxAttempts: 3})
+}
+
+func (r *Repo) cancelReminder(ctx context.Context, tx *sql.Tx, bookingID uint64) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM jobs WHERE key = ? AND status = 'pending';", reminderKey(bookingID))
+	return err
+}
+
+// RefundPayload is the payload of refund jobs.
+type RefundPayload struct {
+	BookingID uint64 `json:"bookingId"`
+}
+
+// scheduleRefund schedules the refund due for the cancelled booking right away. The job is the only place cancellations are refunded, so the payment is refunded once.
+func (r *Repo) scheduleRefund(ctx context.Context, tx *sql.Tx, booking *Booking) error {
+	b, err := json.Marshal(RefundPayload{BookingID: booking.ID})
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/%d", JobKindRefund, booking.ID)
+	return r.scheduleJob(ctx, tx, &Job{Kind: JobKindRefund, Key: key, Payload: string(b), RunAt: r.now().Unix(), MaxAttempts: 10})
+}
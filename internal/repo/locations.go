@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Location struct {
+	ID   uint64
+	Name string
+	// IANA time zone name, e.g. Europe/London
+	Timezone string
+	Address  string
+}
+
+// Room is a space at a location. Classes held in it can't have more spots than its capacity.
+type Room struct {
+	ID         uint64
+	LocationID uint64
+	Name       string
+	Capacity   uint
+}
+
+// CreateLocation sets the ID of 'location' on success.
+func (r *Repo) CreateLocation(ctx context.Context, location *Location) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO locations (name, timezone, address) VALUES (?, ?, ?);", location.Name, location.Timezone, location.Address)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created := *location
+	created.ID = uint64(id)
+	if err = r.audit(ctx, tx, AuditEntityLocation, created.ID, nil, created); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	location.ID = created.ID
+	return nil
+}
+
+func (r *Repo) GetLocation(ctx context.Context, id uint64) (*Location, error) {
+	var location Location
+	if err := r.db.Reader.QueryRowContext(ctx, "SELECT id, name, timezone, address FROM locations WHERE id = ?;", id).Scan(&location.ID, &location.Name, &location.Timezone, &location.Address); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, LocationNotFoundError
+		}
+		return nil, err
+	}
+	return &location, nil
+}
+
+func (r *Repo) GetLocations(ctx context.Context) ([]Location, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT id, name, timezone, address FROM locations ORDER BY id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []Location{}
+	for rows.Next() {
+		var location Location
+		if err = rows.Scan(&location.ID, &location.Name, &location.Timezone, &location.Address); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, rows.Err()
+}
+
+// CreateRoom sets the ID of 'room' on success.
+func (r *Repo) CreateRoom(ctx context.Context, room *Room) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM locations WHERE id = ?);", room.LocationID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return LocationNotFoundError
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO rooms (location_id, name, capacity) VALUES (?, ?, ?);", room.LocationID, room.Name, room.Capacity)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created := *room
+	created.ID = uint64(id)
+	if err = r.audit(ctx, tx, AuditEntityRoom, created.ID, nil, created); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	room.ID = created.ID
+	return nil
+}
+
+// roomTimezoneQuery selects the time zone of the location of a room, or the empty string if there is no such room
+const roomTimezoneQuery = "SELECT COALESCE((SELECT locations.timezone FROM rooms JOIN locations ON locations.id = rooms.location_id WHERE rooms.id = ?), '');"
+
+// GetRoomTimezone returns the time zone of the location of the room, which is the time zone of its classes. The empty string, for UTC, is returned for unknown rooms and the zero ID.
+func (r *Repo) GetRoomTimezone(ctx context.Context, roomID uint64) (string, error) {
+	var timezone string
+	err := r.db.Reader.QueryRowContext(ctx, roomTimezoneQuery, roomID).Scan(&timezone)
+	return timezone, err
+}
+
+// GetRooms returns the rooms of the location.
+func (r *Repo) GetRooms(ctx context.Context, locationID uint64) ([]Room, error) {
+	if _, err := r.GetLocation(ctx, locationID); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT id, location_id, name, capacity FROM rooms WHERE location_id = ? ORDER BY id;", locationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []Room{}
+	for rows.Next() {
+		var room Room
+		if err = rows.Scan(&room.ID, &room.LocationID, &room.Name, &room.Capacity); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// checkRoom returns RoomNotFoundError if the room of 'class' doesn't exist, RoomCapacityExceededError if the class has more spots than the room, or a *ScheduleConflictError if any occurrence of 'class' overlaps an occurrence of another class in the room.
+func checkRoom(ctx context.Context, tx *sql.Tx, class *Class) error {
+	if class.RoomID == 0 {
+		return nil
+	}
+	var capacity uint
+	if err := tx.QueryRowContext(ctx, "SELECT capacity FROM rooms WHERE id = ?;", class.RoomID).Scan(&capacity); err != nil {
+		if err == sql.ErrNoRows {
+			return RoomNotFoundError
+		}
+		return err
+	}
+	if class.Capacity > capacity {
+		return RoomCapacityExceededError
+	}
+
+	others, err := getClassesBy(ctx, tx, "room_id", class.RoomID)
+	if err != nil {
+		return err
+	}
+	if conflicts := findConflicts(class, others); len(conflicts) > 0 {
+		return &ScheduleConflictError{Resource: ResourceRoom, Occurrences: conflicts}
+	}
+	return nil
+}
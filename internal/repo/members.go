@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// resetMemberToken stores a new secret token of the member in 'column' of the members table and returns it. 'field' names the token in the audit log, which only shows that it changed.
+func (r *Repo) resetMemberToken(ctx context.Context, memberName string, column string, field string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM members WHERE name = ?);", memberName).Scan(&exists); err != nil {
+		return "", err
+	}
+	query := fmt.Sprintf("INSERT INTO members (name, email, %[1]s) VALUES (?, '', ?) ON CONFLICT (name) DO UPDATE SET %[1]s = excluded.%[1]s;", column)
+	if _, err = tx.ExecContext(ctx, query, memberName, token); err != nil {
+		return "", err
+	}
+	var before any
+	if exists {
+		before = map[string]string{}
+	}
+	if err = r.audit(ctx, tx, AuditEntityMember, memberName, before, map[string]string{field: redacted}); err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// ResetAccessToken issues a new secret token the member authenticates with and returns it. The token issued before stops working.
+func (r *Repo) ResetAccessToken(ctx context.Context, memberName string) (string, error) {
+	return r.resetMemberToken(ctx, memberName, "access_token", "AccessToken")
+}
+
+// MemberForAccessToken returns the name of the member 'token' is the access token of. It reports false if it is no member's token.
+func (r *Repo) MemberForAccessToken(ctx context.Context, token string) (string, bool, error) {
+	if token == "" {
+		return "", false, nil
+	}
+	var name string
+	if err := r.db.Reader.QueryRowContext(ctx, "SELECT name FROM members WHERE access_token = ?;", token).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return name, true, nil
+}
@@ -0,0 +1,236 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type PlanKind string
+
+const (
+	// Any number of classes
+	PlanKindUnlimited PlanKind = "unlimited"
+	// Up to Plan.ClassesPerWeek classes per week, starting on Monday
+	PlanKindWeekly PlanKind = "weekly"
+	// Plan.Credits classes in total, one credit per class
+	PlanKindPack PlanKind = "pack"
+)
+
+type Plan struct {
+	ID   uint64
+	Name string
+	Kind PlanKind
+	// Only used by weekly plans
+	ClassesPerWeek uint
+	// Only used by class packs
+	Credits uint
+}
+
+// Subscription entitles a member to book occurrences from StartDate to EndDate, both inclusive, according to its plan.
+type Subscription struct {
+	ID         uint64
+	MemberName string
+	PlanID     uint64
+	// 'StartDate' and 'EndDate' are in UNIX timestamp format
+	StartDate int64
+	EndDate   int64
+	// Credits left on a class pack. Always zero for other plans.
+	CreditsRemaining uint
+}
+
+// CreatePlan sets the ID of 'plan' on success.
+func (r *Repo) CreatePlan(ctx context.Context, plan *Plan) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO plans (name, kind, classes_per_week, credits) VALUES (?, ?, ?, ?);", plan.Name, plan.Kind, plan.ClassesPerWeek, plan.Credits)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created := *plan
+	created.ID = uint64(id)
+	if err = r.audit(ctx, tx, AuditEntityPlan, created.ID, nil, created); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	plan.ID = created.ID
+	return nil
+}
+
+func (r *Repo) GetPlans(ctx context.Context) ([]Plan, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT id, name, kind, classes_per_week, credits FROM plans ORDER BY id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []Plan{}
+	for rows.Next() {
+		var plan Plan
+		if err = rows.Scan(&plan.ID, &plan.Name, &plan.Kind, &plan.ClassesPerWeek, &plan.Credits); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// CreateSubscription sets the ID and, for class packs, the credits of 'subscription' on success.
+func (r *Repo) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var plan Plan
+	if err = tx.QueryRowContext(ctx, "SELECT kind, credits FROM plans WHERE id = ?;", subscription.PlanID).Scan(&plan.Kind, &plan.Credits); err != nil {
+		if err == sql.ErrNoRows {
+			return PlanNotFoundError
+		}
+		return err
+	}
+	var credits uint
+	if plan.Kind == PlanKindPack {
+		credits = plan.Credits
+	}
+	query := "INSERT INTO subscriptions (member_name, plan_id, start_date, end_date, credits_remaining) VALUES (?, ?, ?, ?, ?);"
+	res, err := tx.ExecContext(ctx, query, subscription.MemberName, subscription.PlanID, subscription.StartDate, subscription.EndDate, credits)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created := *subscription
+	created.ID = uint64(id)
+	created.CreditsRemaining = credits
+	if err = r.audit(ctx, tx, AuditEntitySubscription, created.ID, nil, created); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	*subscription = created
+	return nil
+}
+
+// GetSubscriptions returns all subscriptions of the member, including expired ones.
+func (r *Repo) GetSubscriptions(ctx context.Context, memberName string) ([]Subscription, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT id, member_name, plan_id, start_date, end_date, credits_remaining FROM subscriptions WHERE member_name = ? ORDER BY start_date, id;", memberName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []Subscription{}
+	for rows.Next() {
+		var s Subscription
+		if err = rows.Scan(&s.ID, &s.MemberName, &s.PlanID, &s.StartDate, &s.EndDate, &s.CreditsRemaining); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// consumeEntitlement picks the subscription that pays for a booking of the member on 'date' and uses up one of its classes. Unlimited plans are preferred over weekly plans, and class packs are used last. The ID of the subscription is returned.
+func (r *Repo) consumeEntitlement(ctx context.Context, tx *sql.Tx, memberName string, date int64) (uint64, error) {
+	query := `
+	SELECT s.id, p.kind, p.classes_per_week, s.credits_remaining FROM subscriptions s
+	JOIN plans p ON p.id = s.plan_id
+	WHERE s.member_name = ? AND s.start_date <= ? AND s.end_date >= ?
+	ORDER BY CASE p.kind WHEN 'unlimited' THEN 0 WHEN 'weekly' THEN 1 ELSE 2 END, s.end_date, s.id;`
+	rows, err := tx.QueryContext(ctx, query, memberName, date, date)
+	if err != nil {
+		return 0, err
+	}
+	type candidate struct {
+		id             uint64
+		kind           PlanKind
+		classesPerWeek uint
+		credits        uint
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err = rows.Scan(&c.id, &c.kind, &c.classesPerWeek, &c.credits); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Reported if no subscription can pay for the booking
+	err = NoActiveMembershipError
+	for _, c := range candidates {
+		switch c.kind {
+		case PlanKindUnlimited:
+			return c.id, nil
+		case PlanKindWeekly:
+			monday := weekStart(date)
+			var used uint
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM bookings WHERE subscription_id = ? AND date >= ? AND date < ? AND "+occupyingStatuses+";", c.id, monday, monday+7*24*60*60).Scan(&used); err != nil {
+				return 0, err
+			}
+			if used < c.classesPerWeek {
+				return c.id, nil
+			}
+			err = WeeklyLimitReachedError
+		case PlanKindPack:
+			if c.credits > 0 {
+				if _, err := tx.ExecContext(ctx, "UPDATE subscriptions SET credits_remaining = credits_remaining - 1 WHERE id = ?;", c.id); err != nil {
+					return 0, err
+				}
+				return c.id, r.audit(ctx, tx, AuditEntitySubscription, c.id, subscriptionCredits{c.credits}, subscriptionCredits{c.credits - 1})
+			}
+			err = CreditsExhaustedError
+		}
+	}
+	return 0, err
+}
+
+// refundEntitlement gives the class used by a cancelled booking back to its subscription. Weekly plans count active bookings only, so nothing needs to be done for them.
+func (r *Repo) refundEntitlement(ctx context.Context, tx *sql.Tx, booking *Booking) error {
+	if booking.SubscriptionID == 0 {
+		return nil
+	}
+	var credits uint
+	err := tx.QueryRowContext(ctx, "SELECT s.credits_remaining FROM subscriptions s JOIN plans p ON p.id = s.plan_id WHERE s.id = ? AND p.kind = 'pack';", booking.SubscriptionID).Scan(&credits)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE subscriptions SET credits_remaining = credits_remaining + 1 WHERE id = ?;", booking.SubscriptionID); err != nil {
+		return err
+	}
+	return r.audit(ctx, tx, AuditEntitySubscription, booking.SubscriptionID, subscriptionCredits{credits}, subscriptionCredits{credits + 1})
+}
+
+// subscriptionCredits is the part of a subscription that bookings change, as recorded in the audit log.
+type subscriptionCredits struct {
+	CreditsRemaining uint
+}
+
+// weekStart returns the Monday of the week of 'date'. Both are in UNIX timestamp format.
+func weekStart(date int64) int64 {
+	t := time.Unix(date, 0).UTC().Truncate(24 * time.Hour)
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7).Unix()
+}
@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migrations are applied in order and only once. The number of applied migrations is stored in the user_version of the database. Never edit a migration that has been released, append a new one instead.
+var migrations = [...]string{
+	`
+	CREATE TABLE IF NOT EXISTS classes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		start_date INTEGER NOT NULL,
+		end_date INTEGER NOT NULL,
+		capacity INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS bookings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		class_id INTEGER NOT NULL,
+		member_name TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		FOREIGN KEY (class_id) REFERENCES classes(id)
+	);`,
+	`
+	ALTER TABLE classes ADD COLUMN start_time INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE classes ADD COLUMN booking_opens_days_before INTEGER;
+	ALTER TABLE classes ADD COLUMN booking_opens_at INTEGER;
+	ALTER TABLE classes ADD COLUMN booking_closes_before INTEGER;`,
+	`
+	ALTER TABLE classes ADD COLUMN free_cancel_before INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookings ADD COLUMN status TEXT NOT NULL DEFAULT 'booked';
+	ALTER TABLE bookings ADD COLUMN cancelled_at INTEGER;
+	ALTER TABLE bookings ADD COLUMN no_show_at INTEGER;
+	CREATE INDEX bookings_member_name ON bookings (member_name);
+	CREATE TABLE penalty_waivers (
+		member_name TEXT PRIMARY KEY,
+		waived_at INTEGER NOT NULL
+	);`,
+	`
+	ALTER TABLE classes ADD COLUMN duration INTEGER NOT NULL DEFAULT 3600;
+	ALTER TABLE bookings ADD COLUMN created_at INTEGER;
+	ALTER TABLE bookings ADD COLUMN checked_in_at INTEGER;
+	CREATE INDEX bookings_class_id_date ON bookings (class_id, date);`,
+	`
+	CREATE TABLE checkin_token_uses (
+		nonce TEXT PRIMARY KEY,
+		booking_id INTEGER NOT NULL,
+		used_at INTEGER NOT NULL,
+		FOREIGN KEY (booking_id) REFERENCES bookings(id)
+	);`,
+	`
+	CREATE TABLE instructors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL
+	);
+	ALTER TABLE classes ADD COLUMN instructor_id INTEGER REFERENCES instructors(id);
+	CREATE INDEX classes_instructor_id ON classes (instructor_id);`,
+	`
+	CREATE TABLE locations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		timezone TEXT NOT NULL,
+		address TEXT NOT NULL
+	);
+	CREATE TABLE rooms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		location_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		capacity INTEGER NOT NULL,
+		FOREIGN KEY (location_id) REFERENCES locations(id)
+	);
+	CREATE INDEX rooms_location_id ON rooms (location_id);
+	ALTER TABLE classes ADD COLUMN room_id INTEGER REFERENCES rooms(id);
+	CREATE INDEX classes_room_id ON classes (room_id);`,
+	`
+	CREATE TABLE plans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		classes_per_week INTEGER NOT NULL DEFAULT 0,
+		credits INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		member_name TEXT NOT NULL,
+		plan_id INTEGER NOT NULL,
+		start_date INTEGER NOT NULL,
+		end_date INTEGER NOT NULL,
+		credits_remaining INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (plan_id) REFERENCES plans(id)
+	);
+	CREATE INDEX subscriptions_member_name ON subscriptions (member_name);
+	ALTER TABLE bookings ADD COLUMN subscription_id INTEGER REFERENCES subscriptions(id);
+	CREATE INDEX bookings_subscription_id ON bookings (subscription_id);`,
+	`
+	ALTER TABLE classes ADD COLUMN price INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookings ADD COLUMN payment_id TEXT;
+	ALTER TABLE bookings ADD COLUMN amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookings ADD COLUMN hold_expires_at INTEGER;
+	ALTER TABLE bookings ADD COLUMN refunded_amount INTEGER NOT NULL DEFAULT 0;
+	CREATE UNIQUE INDEX bookings_payment_id ON bookings (payment_id);`,
+	`CREATE TABLE holds (
+		id INTEGER PRIMARY KEY,
+		class_id INTEGER NOT NULL REFERENCES classes (id),
+		member_name TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	);
+	CREATE INDEX holds_class_id_date ON holds (class_id, date);`,
+	`CREATE TABLE webhooks (
+		id INTEGER PRIMARY KEY,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		secret TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE TABLE webhook_deliveries (
+		id INTEGER PRIMARY KEY,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX webhook_deliveries_status_next_attempt_at ON webhook_deliveries (status, next_attempt_at);
+	CREATE TABLE webhook_attempts (
+		id INTEGER PRIMARY KEY,
+		delivery_id INTEGER NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+		attempted_at INTEGER NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		duration_ms INTEGER NOT NULL
+	);
+	CREATE INDEX webhook_attempts_delivery_id ON webhook_attempts (delivery_id);`,
+	`CREATE TABLE outbox (
+		id INTEGER PRIMARY KEY,
+		type TEXT NOT NULL,
+		class_id INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		published_at INTEGER
+	);
+	CREATE INDEX outbox_status_class_id ON outbox (status, class_id);`,
+	`
+	CREATE TABLE members (
+		name TEXT PRIMARY KEY,
+		email TEXT NOT NULL
+	);
+	CREATE TABLE emails (
+		id INTEGER PRIMARY KEY,
+		key TEXT NOT NULL UNIQUE,
+		recipient TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		sent_at INTEGER
+	);
+	CREATE INDEX emails_status_next_attempt_at ON emails (status, next_attempt_at);`,
+	`
+	CREATE TABLE jobs (
+		id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL,
+		key TEXT UNIQUE,
+		payload TEXT NOT NULL DEFAULT '',
+		run_at INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		lease_until INTEGER,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		finished_at INTEGER
+	);
+	CREATE INDEX jobs_status_run_at ON jobs (status, run_at);`,
+	`
+	ALTER TABLE classes ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookings ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE members ADD COLUMN calendar_token TEXT;
+	CREATE UNIQUE INDEX members_calendar_token ON members (calendar_token);`,
+	`
+	CREATE TABLE full_rejections (
+		id INTEGER PRIMARY KEY,
+		class_id INTEGER NOT NULL REFERENCES classes(id),
+		member_name TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		rejected_at INTEGER NOT NULL
+	);
+	CREATE INDEX full_rejections_date_class_id ON full_rejections (date, class_id);
+	CREATE INDEX bookings_date ON bookings (date);`,
+	`
+	CREATE TABLE audit_log (
+		id INTEGER PRIMARY KEY,
+		created_at INTEGER NOT NULL,
+		actor TEXT NOT NULL,
+		request_id TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		entity TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		old_values TEXT NOT NULL DEFAULT '',
+		new_values TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_log_entity_entity_id ON audit_log (entity, entity_id);
+	CREATE INDEX audit_log_created_at ON audit_log (created_at);
+	CREATE TRIGGER audit_log_append_only BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'Audit log entries cannot be changed');
+	END;`,
+	`
+	ALTER TABLE members ADD COLUMN access_token TEXT;
+	CREATE UNIQUE INDEX members_access_token ON members (access_token);`,
+}
+
+func MigrateUp(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to apply migration %d: %w", version+1, err)
+		}
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// EventType names a change to bookings or classes that is published to other systems.
+type EventType string
+
+const (
+	EventBookingCreated   EventType = "booking.created"
+	EventBookingCancelled EventType = "booking.cancelled"
+	EventClassCreated     EventType = "class.created"
+	// Recorded when a booking takes the last spot of an occurrence
+	EventClassFull EventType = "class.full"
+	// Reserved for when waitlists are added. Nothing records it yet.
+	EventWaitlistPromoted EventType = "waitlist.promoted"
+	// Reserved for when occurrences can be cancelled. Nothing records it yet.
+	EventClassCancelled EventType = "class.cancelled"
+)
+
+// BookingEvent is the data of booking events.
+type BookingEvent struct {
+	ID         uint64        `json:"id"`
+	ClassID    uint64        `json:"classId"`
+	MemberName string        `json:"memberName"`
+	Date       string        `json:"date"`
+	Status     BookingStatus `json:"status"`
+}
+
+// ClassEvent is the data of class events.
+type ClassEvent struct {
+	ID              uint64 `json:"id"`
+	Name            string `json:"name"`
+	StartDate       string `json:"startDate"`
+	EndDate         string `json:"endDate"`
+	StartTime       string `json:"startTime"`
+	DurationMinutes uint   `json:"durationMinutes"`
+	Capacity        uint   `json:"capacity"`
+	Price           int64  `json:"price"`
+}
+
+// OccurrenceEvent is the data of events about one occurrence of a class: class.full and class.cancelled.
+type OccurrenceEvent struct {
+	ClassID uint64 `json:"classId"`
+	Date    string `json:"date"`
+}
+
+func formatDate(date int64) string {
+	return time.Unix(date, 0).UTC().Format("2006-01-02")
+}
+
+func newBookingEvent(booking *Booking) BookingEvent {
+	return BookingEvent{ID: booking.ID, ClassID: booking.ClassID, MemberName: booking.MemberName, Date: formatDate(booking.Date), Status: booking.Status}
+}
+
+func newClassEvent(class *Class) ClassEvent {
+	return ClassEvent{
+		ID:              class.ID,
+		Name:            class.Name,
+		StartDate:       formatDate(class.StartDate),
+		EndDate:         formatDate(class.EndDate),
+		StartTime:       time.Unix(int64(class.StartTime), 0).UTC().Format("15:04"),
+		DurationMinutes: class.Duration / 60,
+		Capacity:        class.Capacity,
+		Price:           class.Price,
+	}
+}
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending   OutboxStatus = "pending"
+	OutboxStatusPublished OutboxStatus = "published"
+	// Given up on after the last retry
+	OutboxStatusDead OutboxStatus = "dead"
+)
+
+// OutboxMessage is an event recorded together with the change it describes, waiting to be published.
+type OutboxMessage struct {
+	ID   uint64
+	Type EventType
+	// Messages of the same class are published in the order they were recorded
+	ClassID uint64
+	// JSON encoded event data
+	Data      json.RawMessage
+	CreatedAt int64
+	Status    OutboxStatus
+	Attempts  uint
+	// UNIX timestamp of when the message is due to be (re)tried
+	NextAttemptAt int64
+	LastError     string
+}
+
+const outboxColumns = "id, type, class_id, data, created_at, status, attempts, next_attempt_at, last_error"
+
+func scanOutboxMessage(row scanner) (*OutboxMessage, error) {
+	var m OutboxMessage
+	var data string
+	if err := row.Scan(&m.ID, &m.Type, &m.ClassID, &data, &m.CreatedAt, &m.Status, &m.Attempts, &m.NextAttemptAt, &m.LastError); err != nil {
+		return nil, err
+	}
+	m.Data = json.RawMessage(data)
+	return &m, nil
+}
+
+// recordEvent adds an event to the outbox in the transaction of the change it describes, so that it is published if and only if the change is committed.
+func (r *Repo) recordEvent(ctx context.Context, tx *sql.Tx, eventType EventType, classID uint64, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := r.now().Unix()
+	_, err = tx.ExecContext(ctx, "INSERT INTO outbox (type, class_id, data, created_at, next_attempt_at) VALUES (?, ?, ?, ?, ?);", eventType, classID, string(b), now, now)
+	return err
+}
+
+// recordBooked records the events of a booking that now takes up a spot: booking.created, and class.full if it took the last one. It also schedules the reminder of the booking.
+func (r *Repo) recordBooked(ctx context.Context, tx *sql.Tx, bookingID uint64) error {
+	booking, class, err := getBookingWithClass(ctx, tx, bookingID)
+	if err != nil {
+		return err
+	}
+	if err = r.scheduleReminder(ctx, tx, booking, class); err != nil {
+		return err
+	}
+	if err = r.recordEvent(ctx, tx, EventBookingCreated, class.ID, newBookingEvent(booking)); err != nil {
+		return err
+	}
+	taken, err := occupancy(ctx, tx, class.ID, booking.Date, r.now())
+	if err != nil {
+		return err
+	}
+	if taken < class.Capacity {
+		return nil
+	}
+	return r.recordEvent(ctx, tx, EventClassFull, class.ID, OccurrenceEvent{ClassID: class.ID, Date: formatDate(booking.Date)})
+}
+
+// GetDueOutboxMessages returns up to 'limit' pending messages that are due, oldest first. Messages are held back while an earlier message of the same class is waiting for a retry, so that each class's events are published in order.
+func (r *Repo) GetDueOutboxMessages(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	query := `
+	SELECT ` + outboxColumns + ` FROM outbox o
+	WHERE status = 'pending' AND next_attempt_at <= ?
+		AND NOT EXISTS (SELECT 1 FROM outbox p WHERE p.status = 'pending' AND p.class_id = o.class_id AND p.id < o.id AND p.next_attempt_at > ?)
+	ORDER BY id
+	LIMIT ?;`
+	now := r.now().Unix()
+	rows, err := r.db.Reader.QueryContext(ctx, query, now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectOutboxMessages(rows)
+}
+
+// GetDeadOutboxMessages returns the messages that were given up on, newest first.
+func (r *Repo) GetDeadOutboxMessages(ctx context.Context) ([]OutboxMessage, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT "+outboxColumns+" FROM outbox WHERE status = 'dead' ORDER BY id DESC;")
+	if err != nil {
+		return nil, err
+	}
+	return collectOutboxMessages(rows)
+}
+
+func collectOutboxMessages(rows *sql.Rows) ([]OutboxMessage, error) {
+	defer rows.Close()
+	messages := []OutboxMessage{}
+	for rows.Next() {
+		m, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	return messages, rows.Err()
+}
+
+// MarkOutboxPublished records that the message was published to every sink.
+func (r *Repo) MarkOutboxPublished(ctx context.Context, id uint64) error {
+	_, err := r.db.Writer.ExecContext(ctx, "UPDATE outbox SET status = 'published', attempts = attempts + 1, last_error = '', published_at = ? WHERE id = ?;", r.now().Unix(), id)
+	return err
+}
+
+// MarkOutboxFailed records a failed attempt to publish the message. It is retried at 'nextAttemptAt', or dead-lettered if 'dead' is set.
+func (r *Repo) MarkOutboxFailed(ctx context.Context, id uint64, lastError string, nextAttemptAt time.Time, dead bool) error {
+	status := OutboxStatusPending
+	if dead {
+		status = OutboxStatusDead
+	}
+	_, err := r.db.Writer.ExecContext(ctx, "UPDATE outbox SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?;", status, lastError, nextAttemptAt.Unix(), id)
+	return err
+}
+
+// RetryOutboxMessage queues a dead-lettered message to be published again right away, with retries starting over.
+func (r *Repo) RetryOutboxMessage(ctx context.Context, id uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := retryState{Status: string(OutboxStatusDead)}
+	if err = tx.QueryRowContext(ctx, "SELECT attempts FROM outbox WHERE id = ? AND status = 'dead';", id).Scan(&before.Attempts); err != nil {
+		if err == sql.ErrNoRows {
+			return OutboxMessageNotFoundError
+		}
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE outbox SET status = 'pending', attempts = 0, next_attempt_at = ? WHERE id = ?;", r.now().Unix(), id); err != nil {
+		return err
+	}
+	if err = r.audit(ctx, tx, AuditEntityOutboxMessage, id, before, retryState{Status: string(OutboxStatusPending)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,192 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RefundDue returns how much of the drop-in payment of the booking is still to be refunded. Bookings cancelled free of charge are refunded in full, late cancellations are not refunded.
+func (b *Booking) RefundDue() int64 {
+	if b.PaymentID == "" || b.Status != BookingStatusCancelled {
+		return 0
+	}
+	return b.Amount - b.RefundedAmount
+}
+
+// CreateDropInBooking books the occurrence on 'date', which is in UNIX timestamp format, for a member paying the drop-in price of the class instead of using a membership. The booking holds its spot for 'holdFor' while the payment is pending. 'email' is stored for the member along with the booking if it is not nil.
+func (r *Repo) CreateDropInBooking(ctx context.Context, classID uint64, memberName string, date int64, holdFor time.Duration, email *MemberEmail) (_ *Booking, err error) {
+	defer r.recordFullRejection(ctx, &err, classID, memberName, date)
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	class, err := r.checkBookable(ctx, tx, classID, memberName, date)
+	if err != nil {
+		return nil, err
+	}
+	if class.Price <= 0 {
+		return nil, DropInNotAvailableError
+	}
+	now := r.now()
+	query := "INSERT INTO bookings (class_id, member_name, date, created_at, status, amount, hold_expires_at) VALUES (?, ?, ?, ?, ?, ?, ?);"
+	res, err := tx.ExecContext(ctx, query, classID, memberName, date, now.Unix(), BookingStatusPendingPayment, class.Price, now.Add(holdFor).Unix())
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	booking, err := scanBooking(tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?;", id))
+	if err != nil {
+		return nil, err
+	}
+	if err = r.audit(ctx, tx, AuditEntityBooking, booking.ID, nil, booking); err != nil {
+		return nil, err
+	}
+	if err = r.setMemberEmail(ctx, tx, memberName, email); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	r.publishChanges(bookingChange(ChangeBooked, booking))
+	return booking, nil
+}
+
+// SetBookingPayment links the drop-in booking to the payment collecting its price.
+func (r *Repo) SetBookingPayment(ctx context.Context, id uint64, paymentID string) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booking, err := scanBooking(tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE id = ?;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return BookingNotFoundError
+		}
+		return err
+	}
+	if _, err = r.updateBooking(ctx, tx, booking, "payment_id = ?", paymentID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConfirmPayment turns the pending drop-in booking of the payment into a regular booking. Confirming a payment again does nothing. HoldExpiredError is returned along with the booking if it was already released, in which case the payment should be refunded.
+func (r *Repo) ConfirmPayment(ctx context.Context, paymentID string) (*Booking, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	booking, err := getBookingByPayment(ctx, tx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	switch booking.Status {
+	case BookingStatusPaymentFailed:
+		return booking, HoldExpiredError
+	case BookingStatusPendingPayment:
+		// The spot is still held even if the hold has expired, as holds are only released in favour of someone else or by the sweeper
+		if booking, err = r.updateBooking(ctx, tx, booking, "status = ?, sequence = sequence + 1", BookingStatusBooked); err != nil {
+			return nil, err
+		}
+		if err = r.recordBooked(ctx, tx, booking.ID); err != nil {
+			return nil, err
+		}
+	}
+	return booking, tx.Commit()
+}
+
+// ReleasePayment gives up the spot held by the pending drop-in booking of a failed payment.
+func (r *Repo) ReleasePayment(ctx context.Context, paymentID string) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booking, err := getBookingByPayment(ctx, tx, paymentID)
+	if err != nil {
+		return err
+	}
+	if booking.Status != BookingStatusPendingPayment {
+		return nil
+	}
+	if _, err = r.updateBooking(ctx, tx, booking, "status = ?, sequence = sequence + 1", BookingStatusPaymentFailed); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	r.publishChanges(bookingChange(ChangeReleased, booking))
+	return nil
+}
+
+// ReleaseHold gives up the spot held by the pending drop-in booking, e.g. when its payment could not be created.
+func (r *Repo) ReleaseHold(ctx context.Context, id uint64) error {
+	released, err := r.updateBookingsInTx(ctx, "id = ? AND status = 'pending_payment'", []any{id}, "status = 'payment_failed', sequence = sequence + 1")
+	if err != nil {
+		return err
+	}
+	r.publishChanges(bookingChanges(ChangeReleased, released)...)
+	return nil
+}
+
+// ReleaseExpiredPayments releases the spots of all drop-in bookings whose hold has expired and returns how many were released.
+func (r *Repo) ReleaseExpiredPayments(ctx context.Context) (int64, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	released, err := r.updateBookings(ctx, tx, "status = 'pending_payment' AND hold_expires_at <= ?", []any{r.now().Unix()}, "status = 'payment_failed', sequence = sequence + 1")
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.publishChanges(bookingChanges(ChangeReleased, released)...)
+	return int64(len(released)), nil
+}
+
+// RecordRefund adds 'amount' to what has been refunded for the booking.
+func (r *Repo) RecordRefund(ctx context.Context, id uint64, amount int64) error {
+	_, err := r.updateBookingsInTx(ctx, "id = ?", []any{id}, "refunded_amount = refunded_amount + ?", amount)
+	return err
+}
+
+// updateBookingsInTx is updateBookings in a transaction of its own.
+func (r *Repo) updateBookingsInTx(ctx context.Context, where string, whereArgs []any, set string, args ...any) ([]*Booking, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	bookings, err := r.updateBookings(ctx, tx, where, whereArgs, set, args...)
+	if err != nil {
+		return nil, err
+	}
+	return bookings, tx.Commit()
+}
+
+func getBookingByPayment(ctx context.Context, tx *sql.Tx, paymentID string) (*Booking, error) {
+	booking, err := scanBooking(tx.QueryRowContext(ctx, "SELECT "+bookingColumns+" FROM bookings WHERE payment_id = ?;", paymentID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, PaymentNotFoundError
+		}
+		return nil, err
+	}
+	return booking, nil
+}
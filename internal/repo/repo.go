@@ -1,96 +1,84 @@
 package repo
 
 import (
-	"context"
-	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/pubsub"
 )
 
 var (
-	ClassNotFoundError    = errors.New("Class not found")
-	ClassFullError        = errors.New("Class is full")
-	InvalidDateRangeError = errors.New("No class is available on the given date")
+	ClassNotFoundError     = errors.New("Class not found")
+	ClassFullError         = errors.New("Class is full")
+	DateInPastError        = errors.New("Date cannot be in the past")
+	InvalidDateRangeError  = errors.New("No class is available on the given date")
+	BookingNotOpenYetError = errors.New("Booking is not open yet")
+	BookingClosedError     = errors.New("Booking is closed")
+	BookingNotFoundError   = errors.New("Booking not found")
+	// Returned when the booking is already cancelled or its occurrence has started
+	BookingNotCancellableError = errors.New("Booking can no longer be cancelled")
+	// Returned when the booking is cancelled or its occurrence has not started yet
+	BookingNotMarkableError = errors.New("Booking cannot be marked as no-show")
+	MemberBlockedError      = errors.New("Member is temporarily blocked from booking")
+	// Returned when the booking is not active or the check-in period of its occurrence is not running
+	CheckInNotAllowedError = errors.New("Booking cannot be checked in")
+	// Returned when a check-in token doesn't match its booking or is not for today's occurrence
+	TokenOccurrenceMismatchError = errors.New("Check-in token is not for today's occurrence of the class")
+	TokenAlreadyUsedError        = errors.New("Check-in token has already been used")
+	InstructorNotFoundError      = errors.New("Instructor not found")
+	LocationNotFoundError        = errors.New("Location not found")
+	RoomNotFoundError            = errors.New("Room not found")
+	RoomCapacityExceededError    = errors.New("Class capacity exceeds the capacity of the room")
+	PlanNotFoundError            = errors.New("Plan not found")
+	// Returned when the member has no subscription covering the date of the occurrence
+	NoActiveMembershipError = errors.New("Member has no active membership")
+	WeeklyLimitReachedError = errors.New("Member has reached the weekly class limit of their membership")
+	CreditsExhaustedError   = errors.New("Member has no class credits left")
+	DropInNotAvailableError = errors.New("Class has no drop-in price")
+	PaymentNotFoundError    = errors.New("No booking found for the payment")
+	// Returned when a payment succeeds after its booking was released
+	HoldExpiredError  = errors.New("Booking was released before the payment succeeded")
+	HoldNotFoundError = errors.New("Hold not found")
+	// Returned when a seat hold is confirmed after it has expired
+	HoldReleasedError            = errors.New("Hold has expired")
+	WebhookNotFoundError         = errors.New("Webhook not found")
+	WebhookDeliveryNotFoundError = errors.New("Webhook delivery not found")
+	OutboxMessageNotFoundError   = errors.New("No dead-lettered outbox message found")
+	JobNotFoundError             = errors.New("Job not found")
 )
 
-type Repo struct {
-	// Must be an active SQLite database
-	db *sql.DB
-}
-
-func New(db *sql.DB) (*Repo, error) {
-	if err := MigrateUp(db); err != nil {
-		return nil, err
-	}
-	return &Repo{db}, nil
+// PenaltyPolicy blocks members from booking once they have Limit late cancellations and no-shows within the last Window.
+type PenaltyPolicy struct {
+	Limit  uint
+	Window time.Duration
 }
 
-func MigrateUp(db *sql.DB) error {
-	if _, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS classes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		start_date INTEGER NOT NULL,
-		end_date INTEGER NOT NULL,
-		capacity INTEGER NOT NULL
-	);`); err != nil {
-		return err
-	}
-	if _, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS bookings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		class_id INTEGER NOT NULL,
-		member_name TEXT NOT NULL,
-		date INTEGER NOT NULL,
-		FOREIGN KEY (class_id) REFERENCES classes(id)
-	);`); err != nil {
-		return err
-	}
-	return nil
+var DefaultPenaltyPolicy = PenaltyPolicy{
+	Limit:  3,
+	Window: time.Hour * 24 * 30,
 }
 
-// 'startDate' and 'endDate' are in UNIX timestamp format
-func (r *Repo) CreateClass(ctx context.Context, name string, startDate int64, endDate int64, capacity uint) error {
-	query := "INSERT INTO classes (name, start_date, end_date, capacity) VALUES (?, ?, ?, ?);"
-	_, err := r.db.ExecContext(ctx, query, name, startDate, endDate, capacity)
-	return err
+type Repo struct {
+	// Must be an active SQLite database. Queries go to db.Reader and everything that writes goes to db.Writer.
+	db  *database.DB
+	now func() time.Time
+	// Applies to all classes
+	Penalties PenaltyPolicy
+	// Members are reminded of their bookings this long before the occurrence starts. No reminders are scheduled when zero.
+	ReminderLead time.Duration
+	// Analytics are cached for this long. They are computed on every request when zero.
+	AnalyticsTTL time.Duration
+	analytics    analyticsCache
+	// Audit entries are deleted once they are older than this. They are kept forever when zero.
+	AuditRetention time.Duration
+	// Receives the occurrences whose spots may have changed, once the change is committed
+	Availability *pubsub.Broker[OccurrenceChange]
 }
 
-// 'date' is in UNIX timestamp format
-func (r *Repo) CreateBooking(ctx context.Context, classID uint64, memberName string, date int64) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	row := tx.QueryRowContext(ctx, "SELECT start_date, end_date, capacity FROM classes WHERE id = ?;", classID)
-	var startDate int64
-	var endDate int64
-	var capacity uint
-	if err = row.Scan(&startDate, &endDate, &capacity); err != nil {
-		if err == sql.ErrNoRows {
-			return ClassNotFoundError
-		}
-		return err
-	}
-	if startDate > date || endDate < date {
-		return InvalidDateRangeError
-	}
-
-	row = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM bookings WHERE class_id = ? AND date = ?;", classID, date)
-	var occupancy uint
-	if err = row.Scan(&occupancy); err != nil {
-		return err
-	}
-
-	if occupancy >= capacity {
-		return ClassFullError
-	}
-	if _, err = tx.ExecContext(ctx, "INSERT INTO bookings (class_id, member_name, date) VALUES (?, ?, ?);", classID, memberName, date); err != nil {
-		return err
-	}
-	if err = tx.Commit(); err != nil {
-		return err
+func New(db *database.DB) (*Repo, error) {
+	if err := MigrateUp(db.Writer); err != nil {
+		return nil, err
 	}
-	return nil
+	return &Repo{db: db, now: time.Now, Penalties: DefaultPenaltyPolicy, Availability: pubsub.NewBroker[OccurrenceChange](availabilityBacklog)}, nil
 }
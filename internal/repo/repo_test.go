@@ -2,7 +2,13 @@ package repo_test
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,37 +28,96 @@ func TestRepo(t *testing.T) {
 	r, err := repo.New(db)
 	assert.Nil(t, err)
 
+	today := time.Now().UTC().Truncate(time.Hour * 24)
+	day := int64(24 * 60 * 60)
+
+	// Members need an active membership to book
+	unlimited := repo.Plan{Name: "Unlimited", Kind: repo.PlanKindUnlimited}
+	assert.Nil(t, r.CreatePlan(context.TODO(), &unlimited))
+	for _, member := range []string{"Rohit", "Late", "Other", "A", "B", "C"} {
+		assert.Nil(t, r.CreateSubscription(context.TODO(), &repo.Subscription{MemberName: member, PlanID: unlimited.ID, StartDate: today.Unix(), EndDate: today.Unix() + 365*day}))
+	}
+
 	t.Run("CreateClass", func(t *testing.T) {
-		type args struct {
-			name      string
-			startDate int64
-			endDate   int64
-			capacity  uint
-		}
 		tests := []struct {
-			name string
-			args args
-			want error
+			name  string
+			class repo.Class
+			want  error
 		}{
 			{
 				name: "Valid args",
-				args: args{
-					name:      "Yoga-1",
-					startDate: time.Now().Add(time.Hour * 24).Unix(),
-					endDate:   time.Now().Add(time.Hour * 24 * 2).Unix(),
-					capacity:  3,
+				class: repo.Class{
+					Name:      "Yoga-1",
+					StartDate: time.Now().Add(time.Hour * 24).Unix(),
+					EndDate:   time.Now().Add(time.Hour * 24 * 2).Unix(),
+					Capacity:  3,
+				},
+				want: nil,
+			},
+			{
+				name: "With booking window",
+				class: repo.Class{
+					Name:      "Yoga-2",
+					StartDate: today.Unix(),
+					EndDate:   today.Unix() + 20*day,
+					Capacity:  3,
+					BookingWindow: &repo.BookingWindow{
+						OpensDaysBefore: 7,
+						ClosesBefore:    uint(2 * day),
+					},
+				},
+				want: nil,
+			},
+			{
+				name: "With cancellation policy",
+				class: repo.Class{
+					Name:             "Yoga-3",
+					StartDate:        today.Unix() + day,
+					EndDate:          today.Unix() + 5*day,
+					Capacity:         1,
+					FreeCancelBefore: 2 * 60 * 60,
 				},
 				want: nil,
 			},
 		}
-		for _, tt := range tests {
+		for i, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				err := r.CreateClass(context.TODO(), tt.args.name, tt.args.startDate, tt.args.endDate, tt.args.capacity)
+				err := r.CreateClass(context.TODO(), &tt.class)
 				assert.Equal(t, tt.want, err)
+				assert.Equal(t, uint64(i+1), tt.class.ID)
 			})
 		}
 	})
 
+	t.Run("GetClass", func(t *testing.T) {
+		tests := []struct {
+			name string
+			id   uint64
+			want string
+			err  error
+		}{
+			{name: "Existing class", id: 1, want: "Yoga-1"},
+			{name: "Existing class with booking window", id: 2, want: "Yoga-2"},
+			{name: "Invalid id", id: 0, err: repo.ClassNotFoundError},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				class, err := r.GetClass(context.TODO(), tt.id)
+				assert.Equal(t, tt.err, err)
+				if tt.err == nil {
+					assert.Equal(t, tt.want, class.Name)
+					assert.Equal(t, tt.id == 2, class.BookingWindow != nil)
+				}
+			})
+		}
+	})
+
+	t.Run("GetClasses", func(t *testing.T) {
+		classes, err := r.GetClasses(context.TODO(), repo.ClassFilter{})
+		assert.Nil(t, err)
+		assert.Len(t, classes, 3)
+	})
+
 	t.Run("CreateBooking", func(t *testing.T) {
 		type args struct {
 			memberName string
@@ -82,6 +147,15 @@ func TestRepo(t *testing.T) {
 				},
 				want: repo.ClassNotFoundError,
 			},
+			{
+				name: "Date in the past",
+				args: args{
+					memberName: "Rohit",
+					date:       today.Unix() - day,
+					classID:    1,
+				},
+				want: repo.DateInPastError,
+			},
 			{
 				name: "Invalid date range",
 				args: args{
@@ -91,13 +165,1096 @@ func TestRepo(t *testing.T) {
 				},
 				want: repo.InvalidDateRangeError,
 			},
+			{
+				name: "Booking window closed",
+				args: args{
+					memberName: "Rohit",
+					date:       today.Unix() + day,
+					classID:    2,
+				},
+				want: repo.BookingClosedError,
+			},
+			{
+				name: "Booking window open",
+				args: args{
+					memberName: "Rohit",
+					date:       today.Unix() + 3*day,
+					classID:    2,
+				},
+				want: nil,
+			},
+			{
+				name: "Booking window not open yet",
+				args: args{
+					memberName: "Rohit",
+					date:       today.Unix() + 10*day,
+					classID:    2,
+				},
+				want: repo.BookingNotOpenYetError,
+			},
 		}
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				err := r.CreateBooking(context.TODO(), tt.args.classID, tt.args.memberName, tt.args.date)
+				_, err := r.CreateBooking(context.TODO(), tt.args.classID, tt.args.memberName, tt.args.date, nil)
 				assert.Equal(t, tt.want, err)
 			})
 		}
 
 	})
+
+	t.Run("Cancellation and penalties", func(t *testing.T) {
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		r.Penalties = repo.PenaltyPolicy{Limit: 2, Window: time.Hour * 24 * 30}
+		defer func() {
+			r.SetNow(time.Now)
+			r.Penalties = repo.DefaultPenaltyPolicy
+		}()
+		// Occurrences of class 3 start at midnight
+		occurrence := func(days int64) time.Time { return time.Unix(today.Unix()+days*day, 0) }
+
+		id, err := r.CreateBooking(context.TODO(), 3, "Late", today.Unix()+2*day, nil)
+		assert.Nil(t, err)
+		status, err := r.CancelBooking(context.TODO(), id)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusCancelled, status)
+		_, err = r.CancelBooking(context.TODO(), id)
+		assert.Equal(t, repo.BookingNotCancellableError, err)
+
+		// The cancelled booking no longer takes up the only spot
+		id, err = r.CreateBooking(context.TODO(), 3, "Late", today.Unix()+2*day, nil)
+		assert.Nil(t, err)
+		now = occurrence(2).Add(-time.Hour)
+		status, err = r.CancelBooking(context.TODO(), id)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusLateCancelled, status)
+
+		id, err = r.CreateBooking(context.TODO(), 3, "Late", today.Unix()+3*day, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingNotMarkableError, r.MarkNoShow(context.TODO(), id))
+		now = occurrence(3).Add(time.Hour)
+		_, err = r.CancelBooking(context.TODO(), id)
+		assert.Equal(t, repo.BookingNotCancellableError, err)
+		assert.Nil(t, r.MarkNoShow(context.TODO(), id))
+		assert.Equal(t, repo.BookingNotMarkableError, r.MarkNoShow(context.TODO(), id))
+		assert.Equal(t, repo.BookingNotFoundError, r.MarkNoShow(context.TODO(), 0))
+
+		booking, err := r.GetBooking(context.TODO(), id)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusNoShow, booking.Status)
+		assert.Equal(t, now.Unix(), booking.NoShowAt)
+
+		_, err = r.CreateBooking(context.TODO(), 3, "Late", today.Unix()+4*day, nil)
+		assert.Equal(t, repo.MemberBlockedError, err)
+		_, err = r.CreateBooking(context.TODO(), 3, "Other", today.Unix()+4*day, nil)
+		assert.Nil(t, err)
+
+		assert.Nil(t, r.WaivePenalties(context.TODO(), "Late"))
+		_, err = r.CreateBooking(context.TODO(), 3, "Late", today.Unix()+5*day, nil)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Attendance", func(t *testing.T) {
+		class := repo.Class{
+			Name:      "Yoga-4",
+			StartDate: today.Unix() + day,
+			EndDate:   today.Unix() + 3*day,
+			StartTime: 10 * 60 * 60,
+			Duration:  60 * 60,
+			Capacity:  5,
+		}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		date := today.Unix() + day
+		var ids []uint64
+		for _, member := range []string{"A", "B", "C"} {
+			id, err := r.CreateBooking(context.TODO(), class.ID, member, date, nil)
+			assert.Nil(t, err)
+			ids = append(ids, id)
+		}
+
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+
+		now = class.Occurrence(date).Add(-2 * time.Hour)
+		assert.Equal(t, repo.CheckInNotAllowedError, r.CheckIn(context.TODO(), ids[0]))
+
+		now = class.Occurrence(date).Add(-30 * time.Minute)
+		assert.Nil(t, r.CheckIn(context.TODO(), ids[0]))
+		assert.Equal(t, repo.CheckInNotAllowedError, r.CheckIn(context.TODO(), ids[0]))
+		assert.Equal(t, repo.BookingNotFoundError, r.CheckIn(context.TODO(), 0))
+		id, err := r.CheckInMember(context.TODO(), class.ID, "B", date)
+		assert.Nil(t, err)
+		assert.Equal(t, ids[1], id)
+		_, err = r.CheckInMember(context.TODO(), class.ID, "Nobody", date)
+		assert.Equal(t, repo.BookingNotFoundError, err)
+
+		now = class.OccurrenceEnd(date).Add(-time.Minute)
+		_, err = r.MarkNoShows(context.TODO())
+		assert.Nil(t, err)
+		roster, err := r.GetRoster(context.TODO(), class.ID, date)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusBooked, roster[2].Status)
+
+		now = class.OccurrenceEnd(date)
+		n, err := r.MarkNoShows(context.TODO())
+		assert.Nil(t, err)
+		assert.GreaterOrEqual(t, n, int64(1))
+		assert.Equal(t, repo.CheckInNotAllowedError, r.CheckIn(context.TODO(), ids[2]))
+
+		roster, err = r.GetRoster(context.TODO(), class.ID, date)
+		assert.Nil(t, err)
+		assert.Len(t, roster, 3)
+		for i, want := range []repo.BookingStatus{repo.BookingStatusCheckedIn, repo.BookingStatusCheckedIn, repo.BookingStatusNoShow} {
+			assert.Equal(t, want, roster[i].Status)
+		}
+		assert.NotZero(t, roster[0].CheckedInAt)
+		assert.Equal(t, now.Unix(), roster[2].NoShowAt)
+
+		_, err = r.GetRoster(context.TODO(), 0, date)
+		assert.Equal(t, repo.ClassNotFoundError, err)
+	})
+
+	t.Run("Check-in tokens", func(t *testing.T) {
+		class := repo.Class{
+			Name:      "Yoga-5",
+			StartDate: today.Unix(),
+			EndDate:   today.Unix() + day,
+			StartTime: 9 * 60 * 60,
+			Duration:  60 * 60,
+			Capacity:  5,
+		}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+
+		now := today.Add(7 * time.Hour)
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+
+		first, err := r.CreateBooking(context.TODO(), class.ID, "A", today.Unix(), nil)
+		assert.Nil(t, err)
+		second, err := r.CreateBooking(context.TODO(), class.ID, "B", today.Unix(), nil)
+		assert.Nil(t, err)
+		tomorrow, err := r.CreateBooking(context.TODO(), class.ID, "A", today.Unix()+day, nil)
+		assert.Nil(t, err)
+
+		// A failed check-in doesn't use up the token
+		assert.Equal(t, repo.CheckInNotAllowedError, r.CheckInWithToken(context.TODO(), first, class.ID, today.Unix(), "nonce-1"))
+		now = today.Add(8*time.Hour + 30*time.Minute)
+		assert.Nil(t, r.CheckInWithToken(context.TODO(), first, class.ID, today.Unix(), "nonce-1"))
+		assert.Equal(t, repo.TokenAlreadyUsedError, r.CheckInWithToken(context.TODO(), second, class.ID, today.Unix(), "nonce-1"))
+
+		tests := []struct {
+			name      string
+			bookingID uint64
+			classID   uint64
+			date      int64
+			want      error
+		}{
+			{name: "Other class", bookingID: second, classID: 1, date: today.Unix(), want: repo.TokenOccurrenceMismatchError},
+			{name: "Other date", bookingID: second, classID: class.ID, date: today.Unix() + day, want: repo.TokenOccurrenceMismatchError},
+			{name: "Not today", bookingID: tomorrow, classID: class.ID, date: today.Unix() + day, want: repo.TokenOccurrenceMismatchError},
+			{name: "Booking not found", bookingID: 0, classID: class.ID, date: today.Unix(), want: repo.BookingNotFoundError},
+			{name: "Valid token", bookingID: second, classID: class.ID, date: today.Unix(), want: nil},
+		}
+		for i, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := r.CheckInWithToken(context.TODO(), tt.bookingID, tt.classID, tt.date, fmt.Sprintf("nonce-%d", i+2))
+				assert.Equal(t, tt.want, err)
+			})
+		}
+	})
+
+	t.Run("Instructors", func(t *testing.T) {
+		instructor := repo.Instructor{Name: "Asha"}
+		assert.Nil(t, r.CreateInstructor(context.TODO(), &instructor))
+		got, err := r.GetInstructor(context.TODO(), instructor.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, instructor, *got)
+		_, err = r.GetInstructor(context.TODO(), 0)
+		assert.Equal(t, repo.InstructorNotFoundError, err)
+
+		// 10:00 to 11:00 on days 10 to 12
+		morning := repo.Class{Name: "Morning", StartDate: today.Unix() + 10*day, EndDate: today.Unix() + 12*day, StartTime: 10 * 60 * 60, Duration: 60 * 60, Capacity: 5, InstructorID: instructor.ID}
+		assert.Nil(t, r.CreateClass(context.TODO(), &morning))
+		// 23:30 to 00:30 on days 9 to 10, which ends right before the morning class starts
+		late := repo.Class{Name: "Late", StartDate: today.Unix() + 9*day, EndDate: today.Unix() + 10*day, StartTime: 23*60*60 + 30*60, Duration: 60 * 60, Capacity: 5, InstructorID: instructor.ID}
+		assert.Nil(t, r.CreateClass(context.TODO(), &late))
+
+		tests := []struct {
+			name  string
+			class repo.Class
+			want  []time.Time
+			err   error
+		}{
+			{
+				name:  "Unknown instructor",
+				class: repo.Class{Name: "Other", StartDate: today.Unix() + 10*day, EndDate: today.Unix() + 10*day, Duration: 60 * 60, Capacity: 5, InstructorID: 999},
+				err:   repo.InstructorNotFoundError,
+			},
+			{
+				name:  "Overlapping occurrences",
+				class: repo.Class{Name: "Overlap", StartDate: today.Unix() + 11*day, EndDate: today.Unix() + 20*day, StartTime: 10*60*60 + 30*60, Duration: 60 * 60, Capacity: 5, InstructorID: instructor.ID},
+				want:  []time.Time{morning.Occurrence(today.Unix() + 11*day), morning.Occurrence(today.Unix() + 12*day)},
+			},
+			{
+				name:  "Overlapping an occurrence that started the day before",
+				class: repo.Class{Name: "Overnight", StartDate: today.Unix() + 11*day, EndDate: today.Unix() + 11*day, Duration: 60 * 60, Capacity: 5, InstructorID: instructor.ID},
+				want:  []time.Time{late.Occurrence(today.Unix() + 10*day)},
+			},
+			{
+				name:  "Back to back",
+				class: repo.Class{Name: "Back to back", StartDate: today.Unix() + 10*day, EndDate: today.Unix() + 12*day, StartTime: 11 * 60 * 60, Duration: 60 * 60, Capacity: 5, InstructorID: instructor.ID},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := r.CreateClass(context.TODO(), &tt.class)
+				if tt.want == nil {
+					assert.Equal(t, tt.err, err)
+					return
+				}
+				conflict, ok := err.(*repo.ScheduleConflictError)
+				assert.True(t, ok)
+				if ok {
+					var starts []time.Time
+					for _, occurrence := range conflict.Occurrences {
+						starts = append(starts, occurrence.Start)
+					}
+					assert.Equal(t, tt.want, starts)
+				}
+			})
+		}
+
+		other := repo.Class{Name: "Unassigned", StartDate: today.Unix() + 10*day, EndDate: today.Unix() + 10*day, StartTime: 10 * 60 * 60, Duration: 30 * 60, Capacity: 5}
+		assert.Nil(t, r.CreateClass(context.TODO(), &other))
+		_, ok := r.AssignInstructor(context.TODO(), other.ID, instructor.ID).(*repo.ScheduleConflictError)
+		assert.True(t, ok)
+		assert.Equal(t, repo.ClassNotFoundError, r.AssignInstructor(context.TODO(), 0, instructor.ID))
+		// Reassigning a class to its own instructor doesn't clash with itself
+		assert.Nil(t, r.AssignInstructor(context.TODO(), morning.ID, instructor.ID))
+		assert.Nil(t, r.AssignInstructor(context.TODO(), morning.ID, 0))
+		assert.Nil(t, r.AssignInstructor(context.TODO(), other.ID, instructor.ID))
+
+		schedule, err := r.GetInstructorSchedule(context.TODO(), instructor.ID, time.Unix(today.Unix()+10*day, 0), time.Unix(today.Unix()+11*day, 0))
+		assert.Nil(t, err)
+		var names []string
+		for _, occurrence := range schedule {
+			names = append(names, occurrence.ClassName)
+		}
+		assert.Equal(t, []string{"Late", "Unassigned", "Back to back", "Late"}, names)
+		_, err = r.GetInstructorSchedule(context.TODO(), 0, time.Now(), time.Now())
+		assert.Equal(t, repo.InstructorNotFoundError, err)
+	})
+
+	t.Run("Locations and rooms", func(t *testing.T) {
+		location := repo.Location{Name: "Central", Timezone: "Europe/London", Address: "1 High Street"}
+		assert.Nil(t, r.CreateLocation(context.TODO(), &location))
+		got, err := r.GetLocation(context.TODO(), location.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, location, *got)
+		_, err = r.GetLocation(context.TODO(), 0)
+		assert.Equal(t, repo.LocationNotFoundError, err)
+
+		room := repo.Room{LocationID: location.ID, Name: "Studio A", Capacity: 10}
+		assert.Nil(t, r.CreateRoom(context.TODO(), &room))
+		assert.Equal(t, repo.LocationNotFoundError, r.CreateRoom(context.TODO(), &repo.Room{LocationID: 0, Name: "Nowhere", Capacity: 1}))
+		rooms, err := r.GetRooms(context.TODO(), location.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []repo.Room{room}, rooms)
+
+		// 18:00 to 19:00 on days 30 to 31
+		class := func(name string, startTime uint, capacity uint, roomID uint64) repo.Class {
+			return repo.Class{Name: name, StartDate: today.Unix() + 30*day, EndDate: today.Unix() + 31*day, StartTime: startTime, Duration: 60 * 60, Capacity: capacity, RoomID: roomID}
+		}
+		tests := []struct {
+			name     string
+			class    repo.Class
+			err      error
+			conflict bool
+		}{
+			{name: "Valid class", class: class("Evening", 18*60*60, 10, room.ID)},
+			{name: "Unknown room", class: class("Unknown room", 18*60*60, 10, 999), err: repo.RoomNotFoundError},
+			{name: "Over room capacity", class: class("Too big", 20*60*60, 11, room.ID), err: repo.RoomCapacityExceededError},
+			{name: "Overlapping class in the same room", class: class("Overlap", 18*60*60+30*60, 5, room.ID), conflict: true},
+			{name: "Back to back", class: class("After", 19*60*60, 5, room.ID)},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := r.CreateClass(context.TODO(), &tt.class)
+				if tt.conflict {
+					conflict, ok := err.(*repo.ScheduleConflictError)
+					assert.True(t, ok)
+					if ok {
+						assert.Equal(t, repo.ResourceRoom, conflict.Resource)
+						assert.Len(t, conflict.Occurrences, 2)
+					}
+					return
+				}
+				assert.Equal(t, tt.err, err)
+			})
+		}
+
+		classes, err := r.GetClasses(context.TODO(), repo.ClassFilter{LocationID: location.ID})
+		assert.Nil(t, err)
+		var names []string
+		for _, c := range classes {
+			names = append(names, c.Name)
+		}
+		assert.Equal(t, []string{"Evening", "After"}, names)
+		all, err := r.GetClasses(context.TODO(), repo.ClassFilter{})
+		assert.Nil(t, err)
+		assert.Greater(t, len(all), len(classes))
+	})
+
+	t.Run("Time zones", func(t *testing.T) {
+		location := repo.Location{Name: "Uptown", Timezone: "America/New_York", Address: "1 Broadway"}
+		assert.Nil(t, r.CreateLocation(context.TODO(), &location))
+		room := repo.Room{LocationID: location.ID, Name: "Studio B", Capacity: 10}
+		assert.Nil(t, r.CreateRoom(context.TODO(), &room))
+
+		// Daylight saving time starts in New York on 2030-03-10
+		saturday := time.Date(2030, 3, 9, 0, 0, 0, 0, time.UTC).Unix()
+		class := repo.Class{Name: "Spring Forward", StartDate: saturday, EndDate: saturday + day, StartTime: 18 * 60 * 60, Duration: 60 * 60, Capacity: 5, RoomID: room.ID, BookingWindow: &repo.BookingWindow{OpensDaysBefore: 1, OpensAt: 8 * 60 * 60}}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		assert.Equal(t, "America/New_York", class.Timezone)
+		got, err := r.GetClass(context.TODO(), class.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "America/New_York", got.Timezone)
+
+		// 18:00 is 23:00 in UTC before the change and 22:00 after it
+		assert.Equal(t, time.Date(2030, 3, 9, 23, 0, 0, 0, time.UTC), got.Occurrence(saturday))
+		assert.Equal(t, time.Date(2030, 3, 10, 22, 0, 0, 0, time.UTC), got.Occurrence(saturday+day))
+		assert.Equal(t, time.Date(2030, 3, 10, 23, 0, 0, 0, time.UTC), got.OccurrenceEnd(saturday+day))
+		assert.Equal(t, time.Date(2030, 3, 9, 13, 0, 0, 0, time.UTC), got.BookingOpensAt(saturday+day))
+		assert.Equal(t, saturday, got.DateOf(time.Date(2030, 3, 10, 3, 0, 0, 0, time.UTC)))
+		occurrences := got.Occurrences(time.Date(2030, 3, 9, 23, 30, 0, 0, time.UTC), time.Date(2030, 3, 11, 0, 0, 0, 0, time.UTC))
+		if assert.Len(t, occurrences, 2) {
+			assert.Equal(t, time.Date(2030, 3, 10, 22, 0, 0, 0, time.UTC), occurrences[1].Start)
+		}
+	})
+
+	t.Run("Memberships", func(t *testing.T) {
+		// Monday of a week well in the future
+		monday := today.Unix() + 40*day
+		for time.Unix(monday, 0).UTC().Weekday() != time.Monday {
+			monday += day
+		}
+		class := repo.Class{Name: "Barre", StartDate: monday, EndDate: monday + 13*day, StartTime: 12 * 60 * 60, Duration: 60 * 60, Capacity: 10}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+
+		weekly := repo.Plan{Name: "Twice a week", Kind: repo.PlanKindWeekly, ClassesPerWeek: 2}
+		assert.Nil(t, r.CreatePlan(context.TODO(), &weekly))
+		pack := repo.Plan{Name: "2-class pack", Kind: repo.PlanKindPack, Credits: 2}
+		assert.Nil(t, r.CreatePlan(context.TODO(), &pack))
+		plans, err := r.GetPlans(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, []repo.Plan{unlimited, weekly, pack}, plans)
+
+		subscribe := func(member string, planID uint64, endDate int64) *repo.Subscription {
+			s := &repo.Subscription{MemberName: member, PlanID: planID, StartDate: today.Unix(), EndDate: endDate}
+			assert.Nil(t, r.CreateSubscription(context.TODO(), s))
+			return s
+		}
+		subscribe("Weekly", weekly.ID, monday+13*day)
+		packSubscription := subscribe("Pack", pack.ID, monday+13*day)
+		assert.Equal(t, uint(2), packSubscription.CreditsRemaining)
+		subscribe("Expired", unlimited.ID, monday-day)
+		subscribe("Both", pack.ID, monday+13*day)
+		subscribe("Both", unlimited.ID, monday+13*day)
+		assert.Equal(t, repo.PlanNotFoundError, r.CreateSubscription(context.TODO(), &repo.Subscription{MemberName: "Weekly", PlanID: 999}))
+
+		var cancel uint64
+		tests := []struct {
+			name   string
+			member string
+			date   int64
+			cancel bool
+			want   error
+		}{
+			{name: "No membership", member: "Nobody", date: monday, want: repo.NoActiveMembershipError},
+			{name: "Expired membership", member: "Expired", date: monday, want: repo.NoActiveMembershipError},
+			{name: "First class of the week", member: "Weekly", date: monday, cancel: true},
+			{name: "Second class of the week", member: "Weekly", date: monday + day},
+			{name: "Third class of the week", member: "Weekly", date: monday + 2*day},
+			{name: "Weekly limit reached", member: "Weekly", date: monday + 3*day, want: repo.WeeklyLimitReachedError},
+			{name: "Next week", member: "Weekly", date: monday + 7*day},
+			{name: "First credit", member: "Pack", date: monday, cancel: true},
+			{name: "Second credit", member: "Pack", date: monday + day},
+			{name: "Refunded credit", member: "Pack", date: monday + 2*day},
+			{name: "Credits exhausted", member: "Pack", date: monday + 3*day, want: repo.CreditsExhaustedError},
+			{name: "Unlimited before credits", member: "Both", date: monday},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// Cancels the booking of the previous case, which frees up its class
+				if cancel != 0 {
+					_, err := r.CancelBooking(context.TODO(), cancel)
+					assert.Nil(t, err)
+					cancel = 0
+				}
+				id, err := r.CreateBooking(context.TODO(), class.ID, tt.member, tt.date, nil)
+				assert.Equal(t, tt.want, err)
+				if tt.cancel {
+					cancel = id
+				}
+			})
+		}
+
+		subscriptions, err := r.GetSubscriptions(context.TODO(), "Both")
+		assert.Nil(t, err)
+		assert.Len(t, subscriptions, 2)
+		assert.Equal(t, uint(2), subscriptions[0].CreditsRemaining)
+	})
+
+	t.Run("Drop-ins", func(t *testing.T) {
+		date := today.Unix() + 50*day
+		class := repo.Class{Name: "Drop-in", StartDate: date, EndDate: date, StartTime: 8 * 60 * 60, Duration: 60 * 60, Capacity: 1, Price: 1500}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		free := repo.Class{Name: "Members only", StartDate: date, EndDate: date, Capacity: 1}
+		assert.Nil(t, r.CreateClass(context.TODO(), &free))
+
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+
+		_, err := r.CreateDropInBooking(context.TODO(), free.ID, "Guest", date, 10*time.Minute, nil)
+		assert.Equal(t, repo.DropInNotAvailableError, err)
+
+		// The hold takes up the only spot until it expires
+		held, err := r.CreateDropInBooking(context.TODO(), class.ID, "Guest", date, 10*time.Minute, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusPendingPayment, held.Status)
+		assert.Equal(t, int64(1500), held.Amount)
+		assert.Nil(t, r.SetBookingPayment(context.TODO(), held.ID, "pi_1"))
+		_, err = r.CreateDropInBooking(context.TODO(), class.ID, "Guest-2", date, 10*time.Minute, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+
+		// An expired hold is released in favour of the next booking, and its payment is too late
+		now = now.Add(10 * time.Minute)
+		next, err := r.CreateDropInBooking(context.TODO(), class.ID, "Guest-2", date, 10*time.Minute, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, r.SetBookingPayment(context.TODO(), next.ID, "pi_2"))
+		booking, err := r.ConfirmPayment(context.TODO(), "pi_1")
+		assert.Equal(t, repo.HoldExpiredError, err)
+		assert.Equal(t, held.ID, booking.ID)
+
+		booking, err = r.ConfirmPayment(context.TODO(), "pi_2")
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusBooked, booking.Status)
+		_, err = r.ConfirmPayment(context.TODO(), "pi_2")
+		assert.Nil(t, err)
+		_, err = r.ConfirmPayment(context.TODO(), "pi_unknown")
+		assert.Equal(t, repo.PaymentNotFoundError, err)
+		assert.Nil(t, r.ReleasePayment(context.TODO(), "pi_2"))
+
+		// Free cancellations are refunded in full
+		_, err = r.CancelBooking(context.TODO(), next.ID)
+		assert.Nil(t, err)
+		booking, err = r.GetBooking(context.TODO(), next.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1500), booking.RefundDue())
+		assert.Nil(t, r.RecordRefund(context.TODO(), next.ID, booking.RefundDue()))
+		booking, err = r.GetBooking(context.TODO(), next.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), booking.RefundDue())
+
+		// Failed payments and the sweeper release holds
+		failed, err := r.CreateDropInBooking(context.TODO(), class.ID, "Guest-3", date, 10*time.Minute, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, r.SetBookingPayment(context.TODO(), failed.ID, "pi_3"))
+		assert.Nil(t, r.ReleasePayment(context.TODO(), "pi_3"))
+		unpaid, err := r.CreateDropInBooking(context.TODO(), class.ID, "Guest-5", date, 10*time.Minute, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, r.ReleaseHold(context.TODO(), unpaid.ID))
+		expired, err := r.CreateDropInBooking(context.TODO(), class.ID, "Guest-4", date, 10*time.Minute, nil)
+		assert.Nil(t, err)
+		now = now.Add(10 * time.Minute)
+		n, err := r.ReleaseExpiredPayments(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+		booking, err = r.GetBooking(context.TODO(), expired.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.BookingStatusPaymentFailed, booking.Status)
+	})
+
+	t.Run("Seat holds", func(t *testing.T) {
+		date := today.Unix() + 60*day
+		class := repo.Class{Name: "Holds", StartDate: date, EndDate: date, StartTime: 8 * 60 * 60, Duration: 60 * 60, Capacity: 2}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+
+		// Holds take up spots until they expire
+		first, err := r.CreateHold(context.TODO(), class.ID, "A", date, 5*time.Minute, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, now.Add(5*time.Minute).Unix(), first.ExpiresAt)
+		second, err := r.CreateHold(context.TODO(), class.ID, "B", date, 10*time.Minute, nil)
+		assert.Nil(t, err)
+		_, err = r.CreateBooking(context.TODO(), class.ID, "C", date, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+		_, err = r.CreateHold(context.TODO(), class.ID, "C", date, 5*time.Minute, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+
+		// Confirming turns the held spot into a booking
+		bookingID, err := r.ConfirmHold(context.TODO(), second.ID)
+		assert.Nil(t, err)
+		booking, err := r.GetBooking(context.TODO(), bookingID)
+		assert.Nil(t, err)
+		assert.Equal(t, "B", booking.MemberName)
+		assert.Equal(t, repo.BookingStatusBooked, booking.Status)
+		_, err = r.ConfirmHold(context.TODO(), second.ID)
+		assert.Equal(t, repo.HoldNotFoundError, err)
+
+		// An expired hold frees its spot before the sweeper deletes it, and can no longer be confirmed
+		now = now.Add(5 * time.Minute)
+		_, err = r.ConfirmHold(context.TODO(), first.ID)
+		assert.Equal(t, repo.HoldReleasedError, err)
+		third, err := r.CreateHold(context.TODO(), class.ID, "C", date, 5*time.Minute, nil)
+		assert.Nil(t, err)
+		n, err := r.ReleaseExpiredHolds(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+		_, err = r.ConfirmHold(context.TODO(), first.ID)
+		assert.Equal(t, repo.HoldNotFoundError, err)
+
+		// Confirmation still needs a membership
+		outsider, err := r.CreateHold(context.TODO(), class.ID, "Outsider", date, 5*time.Minute, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+		assert.Nil(t, outsider)
+		now = now.Add(5 * time.Minute)
+		outsider, err = r.CreateHold(context.TODO(), class.ID, "Outsider", date, 5*time.Minute, nil)
+		assert.Nil(t, err)
+		_, err = r.ConfirmHold(context.TODO(), outsider.ID)
+		assert.Equal(t, repo.NoActiveMembershipError, err)
+		_, err = r.ConfirmHold(context.TODO(), third.ID)
+		assert.Equal(t, repo.HoldReleasedError, err)
+
+		// A hold can't be confirmed once booking has closed, even if it hasn't expired yet
+		closing := repo.Class{Name: "Holds-Closing", StartDate: date, EndDate: date, StartTime: 8 * 60 * 60, Duration: 60 * 60, Capacity: 2, BookingWindow: &repo.BookingWindow{ClosesBefore: 2 * 60 * 60}}
+		assert.Nil(t, r.CreateClass(context.TODO(), &closing))
+		now = time.Unix(date+5*60*60, 0)
+		late, err := r.CreateHold(context.TODO(), closing.ID, "B", date, 2*time.Hour, nil)
+		assert.Nil(t, err)
+		now = now.Add(90 * time.Minute)
+		_, err = r.ConfirmHold(context.TODO(), late.ID)
+		assert.Equal(t, repo.BookingClosedError, err)
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		all := repo.Webhook{URL: "http://localhost/all", Secret: "secret"}
+		assert.Nil(t, r.CreateWebhook(context.TODO(), &all))
+		filtered := repo.Webhook{URL: "http://localhost/filtered", Events: []string{"class.created", "class.full"}, Secret: "secret"}
+		assert.Nil(t, r.CreateWebhook(context.TODO(), &filtered))
+		webhook, err := r.GetWebhook(context.TODO(), filtered.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, filtered.Events, webhook.Events)
+		_, err = r.GetWebhook(context.TODO(), 999)
+		assert.Equal(t, repo.WebhookNotFoundError, err)
+
+		n, err := r.EnqueueWebhookEvent(context.TODO(), "booking.created", `{"id":"evt_1"}`)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		n, err = r.EnqueueWebhookEvent(context.TODO(), "class.full", `{"id":"evt_2"}`)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+		due, err := r.GetDueWebhookDeliveries(context.TODO(), 10)
+		assert.Nil(t, err)
+		assert.Len(t, due, 3)
+
+		// Failed attempts are retried once they are due again
+		attempt := repo.WebhookAttempt{DeliveryID: due[0].ID, AttemptedAt: now.Unix(), StatusCode: 500, Error: "Receiver responded with 500"}
+		assert.Nil(t, r.RecordWebhookAttempt(context.TODO(), &attempt, repo.WebhookDeliveryStatusPending, now.Add(time.Minute)))
+		delivered := repo.WebhookAttempt{DeliveryID: due[1].ID, AttemptedAt: now.Unix(), StatusCode: 200}
+		assert.Nil(t, r.RecordWebhookAttempt(context.TODO(), &delivered, repo.WebhookDeliveryStatusDelivered, now))
+		due, err = r.GetDueWebhookDeliveries(context.TODO(), 10)
+		assert.Nil(t, err)
+		assert.Len(t, due, 1)
+		now = now.Add(time.Minute)
+		due, err = r.GetDueWebhookDeliveries(context.TODO(), 10)
+		assert.Nil(t, err)
+		assert.Len(t, due, 2)
+
+		// Replays send delivered deliveries again
+		assert.Nil(t, r.ReplayWebhookDelivery(context.TODO(), delivered.DeliveryID))
+		assert.Equal(t, repo.WebhookDeliveryNotFoundError, r.ReplayWebhookDelivery(context.TODO(), 999))
+		deliveries, err := r.GetWebhookDeliveries(context.TODO(), all.ID)
+		assert.Nil(t, err)
+		assert.Len(t, deliveries, 2)
+		assert.Equal(t, repo.WebhookDeliveryStatusPending, deliveries[0].Status)
+		attempts, err := r.GetWebhookAttempts(context.TODO(), all.ID)
+		assert.Nil(t, err)
+		assert.Len(t, attempts, 2)
+
+		// Deleting a webhook deletes its deliveries
+		assert.Nil(t, r.DeleteWebhook(context.TODO(), all.ID))
+		assert.Equal(t, repo.WebhookNotFoundError, r.DeleteWebhook(context.TODO(), all.ID))
+		deliveries, err = r.GetWebhookDeliveries(context.TODO(), all.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, deliveries)
+		assert.Nil(t, r.DeleteWebhook(context.TODO(), filtered.ID))
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		// Events of earlier tests are published first
+		pending, err := r.GetDueOutboxMessages(context.TODO(), 1000)
+		assert.Nil(t, err)
+		for _, m := range pending {
+			assert.Nil(t, r.MarkOutboxPublished(context.TODO(), m.ID))
+		}
+
+		date := today.Unix() + 70*day
+		class := repo.Class{Name: "Outbox", StartDate: date, EndDate: date, StartTime: 8 * 60 * 60, Duration: 60 * 60, Capacity: 1}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		id, err := r.CreateBooking(context.TODO(), class.ID, "Rohit", date, nil)
+		assert.Nil(t, err)
+		// Failed changes record nothing
+		_, err = r.CreateBooking(context.TODO(), class.ID, "Other", date, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+		_, err = r.CancelBooking(context.TODO(), id)
+		assert.Nil(t, err)
+		other := repo.Class{Name: "Outbox-2", StartDate: date, EndDate: date, Capacity: 1}
+		assert.Nil(t, r.CreateClass(context.TODO(), &other))
+
+		messages, err := r.GetDueOutboxMessages(context.TODO(), 10)
+		assert.Nil(t, err)
+		var types []repo.EventType
+		for _, m := range messages {
+			types = append(types, m.Type)
+		}
+		assert.Equal(t, []repo.EventType{repo.EventClassCreated, repo.EventBookingCreated, repo.EventClassFull, repo.EventBookingCancelled, repo.EventClassCreated}, types)
+		var booking repo.BookingEvent
+		assert.Nil(t, json.Unmarshal(messages[3].Data, &booking))
+		assert.Equal(t, repo.BookingEvent{ID: id, ClassID: class.ID, MemberName: "Rohit", Date: today.Add(70 * 24 * time.Hour).Format("2006-01-02"), Status: repo.BookingStatusCancelled}, booking)
+
+		// A message waiting for a retry holds back later messages of its class only
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+		assert.Nil(t, r.MarkOutboxFailed(context.TODO(), messages[0].ID, "Sink unavailable", now.Add(time.Minute), false))
+		due, err := r.GetDueOutboxMessages(context.TODO(), 10)
+		assert.Nil(t, err)
+		assert.Len(t, due, 1)
+		assert.Equal(t, other.ID, due[0].ClassID)
+
+		// Dead letters no longer hold back their class, and can be retried
+		assert.Nil(t, r.MarkOutboxFailed(context.TODO(), messages[0].ID, "Sink unavailable", now.Add(time.Minute), true))
+		due, err = r.GetDueOutboxMessages(context.TODO(), 10)
+		assert.Nil(t, err)
+		assert.Len(t, due, 4)
+		dead, err := r.GetDeadOutboxMessages(context.TODO())
+		assert.Nil(t, err)
+		assert.Len(t, dead, 1)
+		assert.Equal(t, "Sink unavailable", dead[0].LastError)
+		assert.Equal(t, uint(2), dead[0].Attempts)
+		assert.Nil(t, r.RetryOutboxMessage(context.TODO(), dead[0].ID))
+		assert.Equal(t, repo.OutboxMessageNotFoundError, r.RetryOutboxMessage(context.TODO(), dead[0].ID))
+		due, err = r.GetDueOutboxMessages(context.TODO(), 10)
+		assert.Nil(t, err)
+		assert.Len(t, due, 5)
+	})
+
+	t.Run("Exports", func(t *testing.T) {
+		date := today.Unix() + 80*day
+		classes := []repo.Class{
+			{Name: "Export-1", StartDate: date, EndDate: date + day, StartTime: 9 * 60 * 60, Duration: 60 * 60, Capacity: 5},
+			{Name: "Export-2", StartDate: date + day, EndDate: date + 2*day, Duration: 30 * 60, Capacity: 5},
+		}
+		for i := range classes {
+			assert.Nil(t, r.CreateClass(context.TODO(), &classes[i]))
+		}
+		var ids []uint64
+		for _, b := range []struct {
+			class *repo.Class
+			date  int64
+		}{{&classes[1], date + day}, {&classes[0], date + day}, {&classes[0], date}} {
+			id, err := r.CreateBooking(context.TODO(), b.class.ID, "Rohit", b.date, nil)
+			assert.Nil(t, err)
+			ids = append(ids, id)
+		}
+		_, err := r.CancelBooking(context.TODO(), ids[2])
+		assert.Nil(t, err)
+
+		tests := []struct {
+			name   string
+			filter repo.ExportFilter
+			want   []uint64
+		}{
+			{name: "Date range", filter: repo.ExportFilter{From: date, To: date + day}, want: []uint64{ids[2], ids[0], ids[1]}},
+			{name: "Class", filter: repo.ExportFilter{From: date, ClassID: classes[0].ID}, want: []uint64{ids[2], ids[1]}},
+			{name: "Single date", filter: repo.ExportFilter{From: date + day, To: date + day}, want: []uint64{ids[0], ids[1]}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got := []uint64{}
+				assert.Nil(t, r.ExportBookings(context.TODO(), tt.filter, func(export *repo.BookingExport) error {
+					got = append(got, export.ID)
+					class := classes[0]
+					if export.ClassID == classes[1].ID {
+						class = classes[1]
+					}
+					assert.Equal(t, class.Name, export.ClassName)
+					assert.Equal(t, class.StartTime, export.ClassStartTime)
+					assert.Equal(t, class.Duration, export.ClassDuration)
+					return nil
+				}))
+				assert.Equal(t, tt.want, got)
+			})
+		}
+
+		// The export stops at the first error
+		stop := errors.New("Stop")
+		calls := 0
+		err = r.ExportBookings(context.TODO(), repo.ExportFilter{From: date}, func(export *repo.BookingExport) error {
+			calls++
+			return stop
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 1, calls)
+
+		var names []string
+		assert.Nil(t, r.ExportClasses(context.TODO(), repo.ExportFilter{From: date + 2*day, To: date + 2*day}, func(class *repo.Class) error {
+			names = append(names, class.Name)
+			return nil
+		}))
+		assert.Equal(t, []string{"Export-2"}, names)
+	})
+
+	t.Run("Analytics", func(t *testing.T) {
+		date := today.Unix() + 100*day
+		class := repo.Class{Name: "Analytics-1", StartDate: date, EndDate: date + day, StartTime: 18 * 60 * 60, Duration: 60 * 60, Capacity: 2}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		var ids []uint64
+		for _, member := range []string{"A", "B"} {
+			id, err := r.CreateBooking(context.TODO(), class.ID, member, date, nil)
+			assert.Nil(t, err)
+			ids = append(ids, id)
+		}
+		// Both rejections are recorded
+		_, err := r.CreateBooking(context.TODO(), class.ID, "C", date, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+		_, err = r.CreateHold(context.TODO(), class.ID, "C", date, time.Minute, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+		_, err = r.CreateBooking(context.TODO(), class.ID, "C", date+day, nil)
+		assert.Nil(t, err)
+
+		now := time.Now()
+		r.SetNow(func() time.Time { return now })
+		defer r.SetNow(time.Now)
+		now = class.Occurrence(date).Add(-30 * time.Minute)
+		assert.Nil(t, r.CheckIn(context.TODO(), ids[0]))
+		now = class.OccurrenceEnd(date)
+		_, err = r.MarkNoShows(context.TODO())
+		assert.Nil(t, err)
+
+		filter := repo.AnalyticsFilter{From: date, To: date + day, ClassID: class.ID}
+		totals, err := r.GetOccupancyTotals(context.TODO(), filter)
+		assert.Nil(t, err)
+		assert.Equal(t, &repo.OccupancyStats{Occurrences: 2, Capacity: 4, Booked: 3, CheckedIn: 1, NoShows: 1, FullOccurrences: 1, FullRejections: 2}, totals)
+		assert.Equal(t, 0.75, totals.FillRate())
+		assert.Equal(t, 0.5, totals.NoShowRate())
+
+		classes, err := r.GetClassOccupancy(context.TODO(), filter)
+		assert.Nil(t, err)
+		assert.Equal(t, []repo.ClassOccupancy{{ClassID: class.ID, ClassName: class.Name, Capacity: 2, OccupancyStats: *totals}}, classes)
+
+		days, err := r.GetOccupancyTrend(context.TODO(), filter, repo.PeriodDay)
+		assert.Nil(t, err)
+		assert.Equal(t, []repo.PeriodOccupancy{
+			{Start: date, OccupancyStats: repo.OccupancyStats{Occurrences: 1, Capacity: 2, Booked: 2, CheckedIn: 1, NoShows: 1, FullOccurrences: 1, FullRejections: 2}},
+			{Start: date + day, OccupancyStats: repo.OccupancyStats{Occurrences: 1, Capacity: 2, Booked: 1}},
+		}, days)
+
+		weeks, err := r.GetOccupancyTrend(context.TODO(), filter, repo.PeriodWeek)
+		assert.Nil(t, err)
+		monday := func(date int64) int64 {
+			t := time.Unix(date, 0).UTC()
+			return t.AddDate(0, 0, -(int(t.Weekday())+6)%7).Unix()
+		}
+		if monday(date) == monday(date+day) {
+			assert.Equal(t, []repo.PeriodOccupancy{{Start: monday(date), OccupancyStats: *totals}}, weeks)
+		} else {
+			assert.Equal(t, []int64{monday(date), monday(date + day)}, []int64{weeks[0].Start, weeks[1].Start})
+		}
+
+		hours, err := r.GetOccupancyHeatmap(context.TODO(), filter)
+		assert.Nil(t, err)
+		if assert.Len(t, hours, 2) {
+			// Ordered from Sunday
+			first, second := time.Unix(date, 0).UTC().Weekday(), time.Unix(date+day, 0).UTC().Weekday()
+			if second < first {
+				hours[0], hours[1] = hours[1], hours[0]
+			}
+			assert.Equal(t, repo.HourOccupancy{Weekday: first, Hour: 18, OccupancyStats: days[0].OccupancyStats}, hours[0])
+			assert.Equal(t, repo.HourOccupancy{Weekday: second, Hour: 18, OccupancyStats: days[1].OccupancyStats}, hours[1])
+		}
+
+		_, err = r.GetOccupancyTrend(context.TODO(), filter, "month")
+		assert.NotNil(t, err)
+		_, err = r.GetOccupancyTotals(context.TODO(), repo.AnalyticsFilter{From: date + day, To: date})
+		assert.NotNil(t, err)
+
+		// Cached results are returned until they expire
+		r.AnalyticsTTL = time.Minute
+		defer func() { r.AnalyticsTTL = 0 }()
+		totals, err = r.GetOccupancyTotals(context.TODO(), filter)
+		assert.Nil(t, err)
+		_, err = r.CreateBooking(context.TODO(), class.ID, "Other", date+day, nil)
+		assert.Nil(t, err)
+		cached, err := r.GetOccupancyTotals(context.TODO(), filter)
+		assert.Nil(t, err)
+		assert.Equal(t, totals, cached)
+		now = now.Add(time.Minute)
+		fresh, err := r.GetOccupancyTotals(context.TODO(), filter)
+		assert.Nil(t, err)
+		assert.Equal(t, totals.Booked+1, fresh.Booked)
+	})
+
+	t.Run("Availability", func(t *testing.T) {
+		date := today.Unix() + 130*day
+		location := repo.Location{Name: "Availability", Timezone: "UTC"}
+		assert.Nil(t, r.CreateLocation(context.TODO(), &location))
+		room := repo.Room{LocationID: location.ID, Name: "Availability-1", Capacity: 2}
+		assert.Nil(t, r.CreateRoom(context.TODO(), &room))
+		class := repo.Class{Name: "Availability-1", StartDate: date, EndDate: date + day, Capacity: 2, RoomID: room.ID}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		sub, _, _ := r.Availability.Subscribe(r.Availability.Seq(), func(change repo.OccurrenceChange) bool { return change.ClassID == class.ID })
+		defer sub.Close()
+
+		id, err := r.CreateBooking(context.TODO(), class.ID, "A", date, nil)
+		assert.Nil(t, err)
+		_, err = r.CreateHold(context.TODO(), class.ID, "B", date+day, time.Minute, nil)
+		assert.Nil(t, err)
+		_, err = r.CancelBooking(context.TODO(), id)
+		assert.Nil(t, err)
+		// Failed changes are not published
+		_, err = r.CancelBooking(context.TODO(), id)
+		assert.NotNil(t, err)
+		want := []repo.OccurrenceChange{
+			{Type: repo.ChangeBooked, ClassID: class.ID, Date: date, BookingID: id, MemberName: "A"},
+			{Type: repo.ChangeHeld, ClassID: class.ID, Date: date + day, MemberName: "B"},
+			{Type: repo.ChangeCancelled, ClassID: class.ID, Date: date, BookingID: id, MemberName: "A"},
+		}
+		for _, want := range want {
+			assert.Equal(t, want, (<-sub.C).Value)
+		}
+		assert.Empty(t, sub.C)
+
+		availability, err := r.GetAvailability(context.TODO(), class.ID, date-day, date+2*day)
+		assert.Nil(t, err)
+		assert.Equal(t, []repo.OccurrenceAvailability{{Date: date, Capacity: 2}, {Date: date + day, Capacity: 2, Taken: 1}}, availability)
+		assert.Equal(t, uint(1), availability[1].Remaining())
+		availability, err = r.GetAvailability(context.TODO(), class.ID, date+2*day, date+3*day)
+		assert.Nil(t, err)
+		assert.Empty(t, availability)
+		_, err = r.GetAvailability(context.TODO(), 999999, date, date)
+		assert.Equal(t, repo.ClassNotFoundError, err)
+
+		locationID, err := r.GetClassLocation(context.TODO(), class.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, location.ID, locationID)
+		_, err = r.GetClassLocation(context.TODO(), 999999)
+		assert.Equal(t, repo.ClassNotFoundError, err)
+
+		keys := []repo.OccurrenceKey{{ClassID: class.ID, Date: date}, {ClassID: class.ID, Date: date + day}, {ClassID: 999999, Date: date}}
+		taken, err := r.GetTaken(context.TODO(), keys)
+		assert.Nil(t, err)
+		assert.Equal(t, map[repo.OccurrenceKey]uint{keys[0]: 0, keys[1]: 1, keys[2]: 0}, taken)
+
+		classes, err := r.GetClassesByID(context.TODO(), []uint64{class.ID, 999999})
+		assert.Nil(t, err)
+		if assert.Len(t, classes, 1) {
+			assert.Equal(t, class.Name, classes[0].Name)
+		}
+		classes, err = r.GetClassesByID(context.TODO(), nil)
+		assert.Nil(t, err)
+		assert.Empty(t, classes)
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		ctx := repo.WithActor(context.TODO(), "tester", "audit-1")
+		date := today.Unix() + 120*day
+		class := repo.Class{Name: "Audit-1", StartDate: date, EndDate: date, Capacity: 1}
+		assert.Nil(t, r.CreateClass(ctx, &class))
+		id, err := r.CreateBooking(ctx, class.ID, "A", date, nil)
+		assert.Nil(t, err)
+		_, err = r.CancelBooking(ctx, id)
+		assert.Nil(t, err)
+		// Failed changes aren't recorded
+		_, err = r.CancelBooking(ctx, id)
+		assert.NotNil(t, err)
+		assert.Nil(t, r.CreateWebhook(ctx, &repo.Webhook{URL: "http://localhost/audit", Secret: "secret"}))
+
+		entries, err := r.GetAuditLog(context.TODO(), repo.AuditFilter{RequestID: "audit-1", Limit: 10})
+		assert.Nil(t, err)
+		if assert.Len(t, entries, 4) {
+			for _, e := range entries {
+				assert.Equal(t, "tester", e.Actor)
+			}
+			// Newest first
+			webhook, cancelled, booked, created := entries[0], entries[1], entries[2], entries[3]
+			assert.Equal(t, repo.AuditEntityClass, created.Entity)
+			assert.Equal(t, fmt.Sprint(class.ID), created.EntityID)
+			assert.Equal(t, repo.AuditActionCreate, created.Action)
+			assert.Equal(t, "", created.Before)
+			assert.Contains(t, created.After, `"Name":"Audit-1"`)
+
+			assert.Equal(t, repo.AuditEntityBooking, booked.Entity)
+			assert.Equal(t, repo.AuditActionCreate, booked.Action)
+
+			assert.Equal(t, repo.AuditActionUpdate, cancelled.Action)
+			assert.Equal(t, fmt.Sprint(id), cancelled.EntityID)
+			var before, after map[string]any
+			assert.Nil(t, json.Unmarshal([]byte(cancelled.Before), &before))
+			assert.Nil(t, json.Unmarshal([]byte(cancelled.After), &after))
+			assert.Equal(t, "booked", before["Status"])
+			assert.Equal(t, "cancelled", after["Status"])
+			// Only the fields that changed are kept
+			assert.NotContains(t, before, "MemberName")
+			assert.NotContains(t, after, "MemberName")
+
+			assert.Equal(t, repo.AuditEntityWebhook, webhook.Entity)
+			assert.NotContains(t, webhook.After, "secret")
+		}
+
+		// Bookings rejected because the class is full leave no entry
+		_, err = r.CreateBooking(ctx, class.ID, "B", date, nil)
+		assert.Nil(t, err)
+		_, err = r.CreateBooking(repo.WithActor(context.TODO(), "tester", "audit-2"), class.ID, "C", date, nil)
+		assert.Equal(t, repo.ClassFullError, err)
+		entries, err = r.GetAuditLog(context.TODO(), repo.AuditFilter{RequestID: "audit-2", Limit: 10})
+		assert.Nil(t, err)
+		assert.Empty(t, entries)
+
+		// Changes made without an actor are the system's
+		entries, err = r.GetAuditLog(context.TODO(), repo.AuditFilter{Actor: repo.ActorSystem, Entity: repo.AuditEntityPlan, Limit: 1})
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+
+		// Filters combine and page through the log
+		entries, err = r.GetAuditLog(context.TODO(), repo.AuditFilter{Entity: repo.AuditEntityBooking, EntityID: fmt.Sprint(id), Limit: 1})
+		assert.Nil(t, err)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, repo.AuditActionUpdate, entries[0].Action)
+			entries, err = r.GetAuditLog(context.TODO(), repo.AuditFilter{Entity: repo.AuditEntityBooking, EntityID: fmt.Sprint(id), BeforeID: entries[0].ID, Limit: 10})
+			assert.Nil(t, err)
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, repo.AuditActionCreate, entries[0].Action)
+			}
+		}
+
+		// Entries can't be changed
+		_, err = db.Writer.Exec("UPDATE audit_log SET actor = 'someone else';")
+		assert.NotNil(t, err)
+
+		// Entries are kept forever without a retention
+		n, err := r.DeleteExpiredAuditEntries(context.TODO())
+		assert.Nil(t, err)
+		assert.Zero(t, n)
+		// Earlier tests made changes up to a few months ahead
+		r.AuditRetention = 365 * 24 * time.Hour
+		defer func() { r.AuditRetention = 0 }()
+		n, err = r.DeleteExpiredAuditEntries(context.TODO())
+		assert.Nil(t, err)
+		assert.Zero(t, n)
+		r.SetNow(func() time.Time { return time.Now().AddDate(2, 0, 0) })
+		defer r.SetNow(time.Now)
+		n, err = r.DeleteExpiredAuditEntries(context.TODO())
+		assert.Nil(t, err)
+		assert.Positive(t, n)
+		entries, err = r.GetAuditLog(context.TODO(), repo.AuditFilter{Limit: 10})
+		assert.Nil(t, err)
+		assert.Empty(t, entries)
+	})
+	t.Run("Member emails", func(t *testing.T) {
+		date := today.Unix() + 130*day
+		class := repo.Class{Name: "Emails-1", StartDate: date, EndDate: date, Capacity: 3}
+		assert.Nil(t, r.CreateClass(context.TODO(), &class))
+		tests := []struct {
+			name   string
+			member string
+			email  repo.MemberEmail
+			err    error
+			want   string
+		}{
+			{name: "Stored with the booking", member: "C", email: repo.MemberEmail{Address: "c@example.com"}, want: "c@example.com"},
+			{name: "Kept if it may not be replaced", member: "C", email: repo.MemberEmail{Address: "someone@example.com"}, want: "c@example.com"},
+			{name: "Replaced if it may", member: "C", email: repo.MemberEmail{Address: "new@example.com", Replace: true}, want: "new@example.com"},
+			{name: "Not stored if the booking fails", member: "B", email: repo.MemberEmail{Address: "b@example.com", Replace: true}, err: repo.ClassFullError, want: ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := r.CreateBooking(context.TODO(), class.ID, tt.member, date, &tt.email)
+				assert.Equal(t, tt.err, err)
+				email, err := r.GetMemberEmail(context.TODO(), tt.member)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, email)
+			})
+		}
+	})
+}
+
+// BenchmarkRepo runs a mixed workload of reads and booking writes, once with reads and writes sharing a single pool like before and once with the split pools of database.DB. Each run gets a fresh database so that neither is slowed down by the bookings of the other.
+func BenchmarkRepo(b *testing.B) {
+	assert.Nil(b, os.MkdirAll(database.DirName, 0755))
+	defer func() {
+		assert.Nil(b, os.RemoveAll(database.DirName))
+	}()
+
+	// The benchmark function is run several times against the same database, so every run must book the same class on the same date.
+	date := time.Now().Add(time.Hour * 24).Unix()
+
+	benchmarks := []struct {
+		name string
+		open func(dbName string) (*database.DB, error)
+	}{
+		{name: "Shared pool", open: func(dbName string) (*database.DB, error) {
+			db, err := sql.Open("sqlite", database.Path(dbName)+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=synchronous(NORMAL)")
+			return &database.DB{Writer: db, Reader: db}, err
+		}},
+		{name: "Split pools", open: func(dbName string) (*database.DB, error) {
+			return database.NewSQLite(dbName)
+		}},
+	}
+	for i, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			db, err := bb.open(fmt.Sprintf("bench-%d.db", i))
+			assert.Nil(b, err)
+			defer db.Close()
+
+			r, err := repo.New(db)
+			assert.Nil(b, err)
+			assert.Nil(b, r.CreateClass(context.TODO(), &repo.Class{Name: "Yoga-1", StartDate: date, EndDate: date, Capacity: math.MaxInt32}))
+			plan := repo.Plan{Name: "Unlimited", Kind: repo.PlanKindUnlimited}
+			assert.Nil(b, r.CreatePlan(context.TODO(), &plan))
+			assert.Nil(b, r.CreateSubscription(context.TODO(), &repo.Subscription{MemberName: "Rohit", PlanID: plan.ID, StartDate: date, EndDate: date}))
+
+			var failures atomic.Int64
+			var n atomic.Int64
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var err error
+				for pb.Next() {
+					// One write for every 10 reads
+					if n.Add(1)%10 == 0 {
+						_, err = r.CreateBooking(context.TODO(), 1, "Rohit", date, nil)
+					} else {
+						_, err = r.GetClasses(context.TODO(), repo.ClassFilter{})
+					}
+					if err != nil {
+						failures.Add(1)
+					}
+				}
+			})
+			b.ReportMetric(float64(failures.Load())/float64(b.N), "failures/op")
+			// Failed writes return early, so ns/op alone flatters the shared pool.
+			b.ReportMetric(float64(int64(b.N)-failures.Load())/b.Elapsed().Seconds(), "ok-ops/s")
+		})
+	}
 }
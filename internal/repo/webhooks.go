@@ -0,0 +1,315 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook is a subscription of a URL to events.
+type Webhook struct {
+	ID  uint64
+	URL string
+	// Types of events to deliver. All events are delivered when empty.
+	Events []string
+	// Key deliveries are signed with
+	Secret    string
+	CreatedAt int64
+}
+
+// Wants reports whether the webhook is subscribed to events of 'eventType'.
+func (w *Webhook) Wants(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	// Given up on after the last retry
+	WebhookDeliveryStatusFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event to be sent to a webhook.
+type WebhookDelivery struct {
+	ID        uint64
+	WebhookID uint64
+	Event     string
+	// JSON request body
+	Payload  string
+	Status   WebhookDeliveryStatus
+	Attempts uint
+	// UNIX timestamp of when the delivery is due to be (re)tried
+	NextAttemptAt int64
+	CreatedAt     int64
+}
+
+// WebhookAttempt records the outcome of sending a delivery once.
+type WebhookAttempt struct {
+	ID          uint64
+	DeliveryID  uint64
+	AttemptedAt int64
+	// 0 if no response was received
+	StatusCode int
+	Error      string
+	DurationMs int64
+}
+
+const webhookDeliveryColumns = "id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at"
+
+func scanWebhookDelivery(row scanner) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var w Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &events, &w.Secret, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return &w, nil
+}
+
+// CreateWebhook sets the ID of 'webhook' on success.
+func (r *Repo) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	createdAt := r.now().Unix()
+	res, err := tx.ExecContext(ctx, "INSERT INTO webhooks (url, events, secret, created_at) VALUES (?, ?, ?, ?);", webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, createdAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created := *webhook
+	created.ID = uint64(id)
+	created.CreatedAt = createdAt
+	if err = r.audit(ctx, tx, AuditEntityWebhook, created.ID, nil, redactWebhook(created)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	*webhook = created
+	return nil
+}
+
+// redactWebhook returns the webhook without its secret, for the audit log.
+func redactWebhook(webhook Webhook) Webhook {
+	webhook.Secret = redacted
+	return webhook
+}
+
+func (r *Repo) GetWebhook(ctx context.Context, id uint64) (*Webhook, error) {
+	webhook, err := scanWebhook(r.db.Reader.QueryRowContext(ctx, "SELECT id, url, events, secret, created_at FROM webhooks WHERE id = ?;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, WebhookNotFoundError
+		}
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *Repo) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT id, url, events, secret, created_at FROM webhooks ORDER BY id;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes the webhook together with its deliveries.
+func (r *Repo) DeleteWebhook(ctx context.Context, id uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	webhook, err := scanWebhook(tx.QueryRowContext(ctx, "SELECT id, url, events, secret, created_at FROM webhooks WHERE id = ?;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return WebhookNotFoundError
+		}
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?;", id); err != nil {
+		return err
+	}
+	if err = r.audit(ctx, tx, AuditEntityWebhook, id, redactWebhook(*webhook), nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// retryState is the part of a queued delivery or message that replaying it changes, for the audit log.
+type retryState struct {
+	Status   string
+	Attempts uint
+}
+
+// EnqueueWebhookEvent queues a delivery of 'payload' to every webhook subscribed to 'eventType' and returns how many were queued.
+func (r *Repo) EnqueueWebhookEvent(ctx context.Context, eventType string, payload string) (int, error) {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, url, events, secret, created_at FROM webhooks;")
+	if err != nil {
+		return 0, err
+	}
+	var ids []uint64
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if webhook.Wants(eventType) {
+			ids = append(ids, webhook.ID)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := r.now().Unix()
+	for _, id := range ids {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?);", id, eventType, payload, now, now); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// GetDueWebhookDeliveries returns up to 'limit' pending deliveries whose next attempt is due, oldest first.
+func (r *Repo) GetDueWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= ? ORDER BY id LIMIT ?;", r.now().Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+// GetWebhookDeliveries returns the deliveries of the webhook, newest first.
+func (r *Repo) GetWebhookDeliveries(ctx context.Context, webhookID uint64) ([]WebhookDelivery, error) {
+	rows, err := r.db.Reader.QueryContext(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC;", webhookID)
+	if err != nil {
+		return nil, err
+	}
+	return collectWebhookDeliveries(rows)
+}
+
+func collectWebhookDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookAttempts returns the attempts of all deliveries of the webhook in the order they were made.
+func (r *Repo) GetWebhookAttempts(ctx context.Context, webhookID uint64) ([]WebhookAttempt, error) {
+	query := `
+	SELECT a.id, a.delivery_id, a.attempted_at, a.status_code, a.error, a.duration_ms
+	FROM webhook_attempts a JOIN webhook_deliveries d ON d.id = a.delivery_id
+	WHERE d.webhook_id = ?
+	ORDER BY a.id;`
+	rows, err := r.db.Reader.QueryContext(ctx, query, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err = rows.Scan(&a.ID, &a.DeliveryID, &a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMs); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// RecordWebhookAttempt logs 'attempt' and moves its delivery to 'status'. Pending deliveries are retried at 'nextAttemptAt'.
+func (r *Repo) RecordWebhookAttempt(ctx context.Context, attempt *WebhookAttempt, status WebhookDeliveryStatus, nextAttemptAt time.Time) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms) VALUES (?, ?, ?, ?, ?);", attempt.DeliveryID, attempt.AttemptedAt, attempt.StatusCode, attempt.Error, attempt.DurationMs)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, next_attempt_at = ? WHERE id = ?;", status, nextAttemptAt.Unix(), attempt.DeliveryID); err != nil {
+		return err
+	}
+	attempt.ID = uint64(id)
+	return tx.Commit()
+}
+
+// ReplayWebhookDelivery queues the delivery to be sent again right away, whatever its outcome so far. Retries start over, while the attempts made so far are kept.
+func (r *Repo) ReplayWebhookDelivery(ctx context.Context, id uint64) error {
+	tx, err := r.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before retryState
+	if err = tx.QueryRowContext(ctx, "SELECT status, attempts FROM webhook_deliveries WHERE id = ?;", id).Scan(&before.Status, &before.Attempts); err != nil {
+		if err == sql.ErrNoRows {
+			return WebhookDeliveryNotFoundError
+		}
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = ? WHERE id = ?;", r.now().Unix(), id); err != nil {
+		return err
+	}
+	if err = r.audit(ctx, tx, AuditEntityWebhookDelivery, id, before, retryState{Status: string(WebhookDeliveryStatusPending)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
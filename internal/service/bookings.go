@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+type BookingStatus string
+
+const (
+	BookingStatusBooked        BookingStatus = "booked"
+	BookingStatusCancelled     BookingStatus = "cancelled"
+	BookingStatusLateCancelled BookingStatus = "late_cancelled"
+	BookingStatusNoShow        BookingStatus = "no_show"
+	BookingStatusCheckedIn     BookingStatus = "checked_in"
+	// A drop-in booking holds its spot until the payment succeeds or the hold expires
+	BookingStatusPendingPayment BookingStatus = "pending_payment"
+	// The payment of a drop-in booking failed or didn't succeed in time
+	BookingStatusPaymentFailed BookingStatus = "payment_failed"
+)
+
+type Booking struct {
+	ID         uint64
+	ClassID    uint64
+	MemberName string
+	// Midnight in UTC of the day of the occurrence in the time zone of the class
+	Date   time.Time
+	Status BookingStatus
+	// Times of the status transitions. Zero if the transition didn't happen, or for CreatedAt if the booking predates it being recorded.
+	CreatedAt   time.Time
+	CheckedInAt time.Time
+	CancelledAt time.Time
+	NoShowAt    time.Time
+	// Set for drop-ins only. 'Amount' and 'RefundedAmount' are in the smallest unit of the currency.
+	PaymentID      string
+	Amount         int64
+	RefundedAmount int64
+	// Until when a drop-in holds its spot while the payment is pending
+	HoldExpiresAt time.Time
+}
+
+// timestamp converts a UNIX timestamp that is zero when unset.
+func timestamp(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0).UTC()
+}
+
+func newBooking(booking *repo.Booking) *Booking {
+	return &Booking{
+		ID:             booking.ID,
+		ClassID:        booking.ClassID,
+		MemberName:     booking.MemberName,
+		Date:           time.Unix(booking.Date, 0).UTC(),
+		Status:         BookingStatus(booking.Status),
+		CreatedAt:      timestamp(booking.CreatedAt),
+		CheckedInAt:    timestamp(booking.CheckedInAt),
+		CancelledAt:    timestamp(booking.CancelledAt),
+		NoShowAt:       timestamp(booking.NoShowAt),
+		PaymentID:      booking.PaymentID,
+		Amount:         booking.Amount,
+		RefundedAmount: booking.RefundedAmount,
+		HoldExpiresAt:  timestamp(booking.HoldExpiresAt),
+	}
+}
+
+// NewBooking is a booking of the occurrence of a class as a client asks for it, also used for seat holds and drop-ins.
+type NewBooking struct {
+	ClassID    uint64
+	MemberName string
+	// In YYYY-MM-DD format
+	Date string
+	// Remembered for the notifications about the bookings of the member if set and the booking succeeds
+	MemberEmail string
+	// Whether MemberEmail may replace the address remembered for the member, which it may only if the client is known to be the member or staff. Otherwise it is only remembered if the member has none yet.
+	ReplaceEmail bool
+}
+
+// email returns the address of the member the store remembers along with the booking, or nil if none was given.
+func (n *NewBooking) email() *repo.MemberEmail {
+	if n.MemberEmail == "" {
+		return nil
+	}
+	return &repo.MemberEmail{Address: n.MemberEmail, Replace: n.ReplaceEmail}
+}
+
+// bookable validates 'n' and returns its date in UNIX timestamp format. The rules of the class, the member and the capacity of the class are left to the store, which checks them in the transaction that books the occurrence.
+func (s *Service) bookable(n *NewBooking) (int64, error) {
+	if n.MemberName == "" {
+		return 0, invalid("Member name is required")
+	}
+	date, err := time.Parse("2006-01-02", n.Date)
+	if err != nil {
+		return 0, invalid("Invalid date format")
+	}
+	return date.Unix(), nil
+}
+
+// CreateBooking books the occurrence for the member and returns the ID of the booking. The member needs an active membership that entitles them to another class, which is used up by the booking.
+func (s *Service) CreateBooking(ctx context.Context, n *NewBooking) (uint64, error) {
+	date, err := s.bookable(n)
+	if err != nil {
+		return 0, err
+	}
+	id, err := s.store.CreateBooking(ctx, n.ClassID, n.MemberName, date, n.email())
+	if err != nil {
+		return 0, fromStore(err)
+	}
+	return id, nil
+}
+
+func (s *Service) GetBooking(ctx context.Context, id uint64) (*Booking, error) {
+	booking, err := s.store.GetBooking(ctx, id)
+	if err != nil {
+		return nil, fromStore(err)
+	}
+	return newBooking(booking), nil
+}
+
+// CancelBooking cancels the booking and returns its new status, which is BookingStatusLateCancelled if the free cancellation period of the class is over. The class is given back to the membership that paid for it, and the store schedules the refund of drop-ins cancelled in time.
+func (s *Service) CancelBooking(ctx context.Context, id uint64) (BookingStatus, error) {
+	status, err := s.store.CancelBooking(ctx, id)
+	if err != nil {
+		return "", fromStore(err)
+	}
+	return BookingStatus(status), nil
+}
+
+// GetRoster returns all bookings for the occurrence of the class on 'date', which is in YYYY-MM-DD format, including cancelled ones.
+func (s *Service) GetRoster(ctx context.Context, classID uint64, date string) ([]Booking, error) {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, invalid("Invalid date format")
+	}
+	bookings, err := s.store.GetRoster(ctx, classID, d.Unix())
+	if err != nil {
+		return nil, fromStore(err)
+	}
+	res := make([]Booking, 0, len(bookings))
+	for i := range bookings {
+		res = append(res, *newBooking(&bookings[i]))
+	}
+	return res, nil
+}
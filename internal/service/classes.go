@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// BookingWindow limits when an occurrence of a class can be booked. All values are relative to the occurrence and in the time zone of the class.
+type BookingWindow struct {
+	// Booking opens this many days before the date of the occurrence...
+	OpensDaysBefore uint
+	// ...at this time after midnight
+	OpensAt time.Duration
+	// Booking closes this long before the occurrence starts
+	ClosesBefore time.Duration
+}
+
+type Class struct {
+	ID   uint64
+	Name string
+	// Midnight in UTC of the first and the last day the class is held on, which are days in the time zone of the class
+	StartDate time.Time
+	EndDate   time.Time
+	// Time after midnight in the time zone of the class at which every occurrence starts
+	StartTime time.Duration
+	// Length of every occurrence
+	Duration time.Duration
+	Capacity uint
+	// Booking is open from the moment the class is created until its occurrence starts when nil
+	BookingWindow *BookingWindow
+	// Bookings can be cancelled free of charge until this long before the occurrence starts. Later cancellations are flagged as late.
+	FreeCancelBefore time.Duration
+	// Zero if no instructor is assigned
+	InstructorID uint64
+	// Zero if the class is not held in a room
+	RoomID uint64
+	// Drop-in price in the smallest unit of the currency. Zero if the class can only be booked with a membership.
+	Price int64
+	// IANA time zone name of the location of the room. Empty for UTC if the class is not held in a room. Set by the store.
+	Timezone string
+}
+
+// Occurrence returns the start of the occurrence on 'date', which is midnight in UTC.
+func (c *Class) Occurrence(date time.Time) time.Time {
+	return c.record().Occurrence(date.Unix())
+}
+
+// OccurrenceEnd returns the end of the occurrence on 'date', which is midnight in UTC.
+func (c *Class) OccurrenceEnd(date time.Time) time.Time {
+	return c.Occurrence(date).Add(c.Duration)
+}
+
+// BookingOpensAt returns when booking opens for the occurrence on 'date'. The zero time is returned if the class has no booking window.
+func (c *Class) BookingOpensAt(date time.Time) time.Time {
+	return c.record().BookingOpensAt(date.Unix())
+}
+
+// BookingClosesAt returns when booking closes for the occurrence on 'date'.
+func (c *Class) BookingClosesAt(date time.Time) time.Time {
+	return c.record().BookingClosesAt(date.Unix())
+}
+
+// Today returns midnight in UTC of the day it is at 'now' in the time zone of the class.
+func (c *Class) Today(now time.Time) time.Time {
+	return time.Unix(c.record().DateOf(now), 0).UTC()
+}
+
+// NextBookingOpensAt returns when booking opens for the next occurrence that has not started by 'now'. It reports false if booking is always open or the class is over.
+func (c *Class) NextBookingOpensAt(now time.Time) (time.Time, bool) {
+	if c.BookingWindow == nil {
+		return time.Time{}, false
+	}
+	for date := c.StartDate; !date.After(c.EndDate); date = date.AddDate(0, 0, 1) {
+		if c.Occurrence(date).After(now) {
+			return c.BookingOpensAt(date), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func newClass(class *repo.Class) *Class {
+	res := &Class{
+		ID:               class.ID,
+		Name:             class.Name,
+		StartDate:        time.Unix(class.StartDate, 0).UTC(),
+		EndDate:          time.Unix(class.EndDate, 0).UTC(),
+		StartTime:        time.Duration(class.StartTime) * time.Second,
+		Duration:         time.Duration(class.Duration) * time.Second,
+		Capacity:         class.Capacity,
+		FreeCancelBefore: time.Duration(class.FreeCancelBefore) * time.Second,
+		InstructorID:     class.InstructorID,
+		RoomID:           class.RoomID,
+		Price:            class.Price,
+		Timezone:         class.Timezone,
+	}
+	if w := class.BookingWindow; w != nil {
+		res.BookingWindow = &BookingWindow{
+			OpensDaysBefore: w.OpensDaysBefore,
+			OpensAt:         time.Duration(w.OpensAt) * time.Second,
+			ClosesBefore:    time.Duration(w.ClosesBefore) * time.Second,
+		}
+	}
+	return res
+}
+
+// record returns the class as it is stored.
+func (c *Class) record() *repo.Class {
+	res := &repo.Class{
+		ID:               c.ID,
+		Name:             c.Name,
+		StartDate:        c.StartDate.Unix(),
+		EndDate:          c.EndDate.Unix(),
+		StartTime:        uint(c.StartTime / time.Second),
+		Duration:         uint(c.Duration / time.Second),
+		Capacity:         c.Capacity,
+		FreeCancelBefore: uint(c.FreeCancelBefore / time.Second),
+		InstructorID:     c.InstructorID,
+		RoomID:           c.RoomID,
+		Price:            c.Price,
+		Timezone:         c.Timezone,
+	}
+	if w := c.BookingWindow; w != nil {
+		res.BookingWindow = &repo.BookingWindow{
+			OpensDaysBefore: w.OpensDaysBefore,
+			OpensAt:         uint(w.OpensAt / time.Second),
+			ClosesBefore:    uint(w.ClosesBefore / time.Second),
+		}
+	}
+	return res
+}
+
+// NewBookingWindow is the booking window of a NewClass.
+type NewBookingWindow struct {
+	OpensDaysBefore uint
+	// Time of day in 24-hour HH:MM format
+	OpensAt             string
+	ClosesMinutesBefore uint
+}
+
+// NewClass is a class to be created as a client asks for it. Dates are in YYYY-MM-DD format and times of day in 24-hour HH:MM format, all in the time zone of the location of the room, or UTC if the class is not held in a room.
+type NewClass struct {
+	Name      string
+	StartDate string
+	EndDate   string
+	// Defaults to midnight
+	StartTime string
+	// Defaults to 60 minutes
+	DurationMinutes       uint
+	Capacity              uint
+	BookingWindow         *NewBookingWindow
+	FreeCancelHoursBefore uint
+	InstructorID          uint64
+	RoomID                uint64
+	Price                 int64
+}
+
+// parseTimeOfDay parses a time of day in 24-hour HH:MM format into the time after midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseClass returns the class 'n' asks for, or an error saying which field is invalid. Nothing is created. Whether the class starts in the past is checked when it is created, as that depends on the time zone of its room.
+func (s *Service) ParseClass(n *NewClass) (*Class, error) {
+	if n.Name == "" {
+		return nil, invalid("Name is required")
+	}
+	if n.Capacity == 0 {
+		return nil, invalid("Capacity is required")
+	}
+	if n.Price < 0 {
+		return nil, invalid("Price cannot be negative")
+	}
+	startDate, err := time.Parse("2006-01-02", n.StartDate)
+	if err != nil {
+		return nil, invalid("Invalid date format for start date")
+	}
+	endDate, err := time.Parse("2006-01-02", n.EndDate)
+	if err != nil {
+		return nil, invalid("Invalid date format for end date")
+	}
+	if startDate.After(endDate) {
+		return nil, invalid("End date cannot be before start date")
+	}
+
+	class := &Class{
+		Name:             n.Name,
+		StartDate:        startDate,
+		EndDate:          endDate,
+		Duration:         time.Hour,
+		Capacity:         n.Capacity,
+		FreeCancelBefore: time.Duration(n.FreeCancelHoursBefore) * time.Hour,
+		InstructorID:     n.InstructorID,
+		RoomID:           n.RoomID,
+		Price:            n.Price,
+	}
+	if n.DurationMinutes > 0 {
+		class.Duration = time.Duration(n.DurationMinutes) * time.Minute
+	}
+	if n.StartTime != "" {
+		if class.StartTime, err = parseTimeOfDay(n.StartTime); err != nil {
+			return nil, invalid("Invalid time format for start time")
+		}
+	}
+	if n.BookingWindow != nil {
+		opensAt, err := parseTimeOfDay(n.BookingWindow.OpensAt)
+		if err != nil {
+			return nil, invalid("Invalid time format for booking opening time")
+		}
+		class.BookingWindow = &BookingWindow{
+			OpensDaysBefore: n.BookingWindow.OpensDaysBefore,
+			OpensAt:         opensAt,
+			ClosesBefore:    time.Duration(n.BookingWindow.ClosesMinutesBefore) * time.Minute,
+		}
+	}
+	return class, nil
+}
+
+// checkStartDate sets the time zone of the class to that of its room, which 'timezones' caches by room ID, and returns StartDateInPastError unless the class starts after today in that time zone.
+func (s *Service) checkStartDate(ctx context.Context, class *Class, timezones map[uint64]string) error {
+	timezone, ok := timezones[class.RoomID]
+	if !ok {
+		var err error
+		if timezone, err = s.store.GetRoomTimezone(ctx, class.RoomID); err != nil {
+			return err
+		}
+		timezones[class.RoomID] = timezone
+	}
+	class.Timezone = timezone
+	if !class.StartDate.After(class.Today(s.Now())) {
+		return StartDateInPastError
+	}
+	return nil
+}
+
+// CreateClass returns the created class. A *ScheduleConflictError is returned if its instructor or room is already taken at the same time.
+func (s *Service) CreateClass(ctx context.Context, n *NewClass) (*Class, error) {
+	class, err := s.ParseClass(n)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkStartDate(ctx, class, map[uint64]string{}); err != nil {
+		return nil, err
+	}
+	record := class.record()
+	if err = s.store.CreateClass(ctx, record); err != nil {
+		return nil, fromStore(err)
+	}
+	class.ID = record.ID
+	class.Timezone = record.Timezone
+	return class, nil
+}
+
+// CreateClasses creates all the classes, which must have been returned by ParseClass, or none of them. If any of them can't be created, the returned slice holds the error of every such class at its index. Nothing is created on a dry run either, which only reports the errors. The IDs of the classes are set on success.
+func (s *Service) CreateClasses(ctx context.Context, classes []Class, dryRun bool) ([]error, error) {
+	var classErrs []error
+	timezones := map[uint64]string{}
+	records := make([]repo.Class, 0, len(classes))
+	for i := range classes {
+		if err := s.checkStartDate(ctx, &classes[i], timezones); err != nil {
+			if err != StartDateInPastError {
+				return nil, err
+			}
+			if classErrs == nil {
+				classErrs = make([]error, len(classes))
+			}
+			classErrs[i] = err
+		}
+		records = append(records, *classes[i].record())
+	}
+	// The other classes are still checked by the store, so that all errors are reported at once
+	storeErrs, err := s.store.CreateClasses(ctx, records, dryRun || classErrs != nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range storeErrs {
+		if storeErrs[i] == nil {
+			continue
+		}
+		if classErrs == nil {
+			classErrs = make([]error, len(classes))
+		}
+		if classErrs[i] == nil {
+			classErrs[i] = fromStore(storeErrs[i])
+		}
+	}
+	if classErrs == nil && !dryRun {
+		for i := range classes {
+			classes[i].ID = records[i].ID
+			classes[i].Timezone = records[i].Timezone
+		}
+	}
+	return classErrs, nil
+}
+
+func (s *Service) GetClass(ctx context.Context, id uint64) (*Class, error) {
+	class, err := s.store.GetClass(ctx, id)
+	if err != nil {
+		return nil, fromStore(err)
+	}
+	return newClass(class), nil
+}
+
+// GetClasses returns all classes ordered by start date, only those held at the location unless 'locationID' is zero.
+func (s *Service) GetClasses(ctx context.Context, locationID uint64) ([]Class, error) {
+	classes, err := s.store.GetClasses(ctx, repo.ClassFilter{LocationID: locationID})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Class, 0, len(classes))
+	for i := range classes {
+		res = append(res, *newClass(&classes[i]))
+	}
+	return res, nil
+}
+
+// AssignInstructor assigns the instructor to the class. A *ScheduleConflictError is returned if they are already teaching another class at the same time.
+func (s *Service) AssignInstructor(ctx context.Context, classID uint64, instructorID uint64) error {
+	return fromStore(s.store.AssignInstructor(ctx, classID, instructorID))
+}
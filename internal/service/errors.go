@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Kind tells transports how to report an Error, e.g. as an HTTP status or a gRPC code.
+type Kind uint8
+
+const (
+	// The input breaks a rule
+	KindInvalid Kind = iota + 1
+	KindNotFound
+	// The current state doesn't allow the change, e.g. the class is full
+	KindConflict
+	// The member isn't allowed to make the change
+	KindForbidden
+	// What the change refers to has expired
+	KindGone
+	// A service the change depends on failed, e.g. the payment provider
+	KindUpstream
+)
+
+// Error is a failure to be reported to whoever asked for the change. Its message is meant for them.
+type Error struct {
+	Kind    Kind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalid(msg string) *Error {
+	return &Error{Kind: KindInvalid, Message: msg}
+}
+
+var (
+	ClassNotFoundError      = &Error{KindNotFound, "Class not found"}
+	ClassFullError          = &Error{KindConflict, "Class is full"}
+	StartDateInPastError    = &Error{KindInvalid, "Start date cannot be in the past"}
+	DateInPastError         = &Error{KindInvalid, "Date cannot be in the past"}
+	InvalidDateRangeError   = &Error{KindInvalid, "No class is available on the given date"}
+	BookingNotOpenYetError  = &Error{KindInvalid, "Booking is not open yet for the given date"}
+	BookingClosedError      = &Error{KindInvalid, "Booking is closed for the given date"}
+	MemberBlockedError      = &Error{KindForbidden, "Member is temporarily blocked from booking due to late cancellations and no-shows"}
+	NoActiveMembershipError = &Error{KindForbidden, "Member has no active membership on the given date"}
+	WeeklyLimitReachedError = &Error{KindForbidden, "Member has reached the weekly class limit of their membership"}
+	CreditsExhaustedError   = &Error{KindForbidden, "Member has no class credits left"}
+	BookingNotFoundError    = &Error{KindNotFound, "Booking not found"}
+	// Returned when the booking is already cancelled or its occurrence has started
+	BookingNotCancellableError = &Error{KindConflict, "Booking can no longer be cancelled"}
+	InstructorNotFoundError    = &Error{KindNotFound, "Instructor not found"}
+	RoomNotFoundError          = &Error{KindNotFound, "Room not found"}
+	RoomCapacityExceededError  = &Error{KindInvalid, "Capacity cannot exceed the capacity of the room"}
+	HoldNotFoundError          = &Error{KindNotFound, "Hold not found"}
+	// Returned when a seat hold is confirmed after it has expired
+	HoldReleasedError       = &Error{KindGone, "Hold has expired"}
+	DropInNotAvailableError = &Error{KindInvalid, "Class is not available for drop-ins"}
+	PaymentFailedError      = &Error{KindUpstream, "Failed to create payment"}
+)
+
+// storeErrors are the errors of the store that are the client's to deal with
+var storeErrors = map[error]*Error{
+	repo.ClassNotFoundError:         ClassNotFoundError,
+	repo.ClassFullError:             ClassFullError,
+	repo.DateInPastError:            DateInPastError,
+	repo.InvalidDateRangeError:      InvalidDateRangeError,
+	repo.BookingNotOpenYetError:     BookingNotOpenYetError,
+	repo.BookingClosedError:         BookingClosedError,
+	repo.MemberBlockedError:         MemberBlockedError,
+	repo.NoActiveMembershipError:    NoActiveMembershipError,
+	repo.WeeklyLimitReachedError:    WeeklyLimitReachedError,
+	repo.CreditsExhaustedError:      CreditsExhaustedError,
+	repo.BookingNotFoundError:       BookingNotFoundError,
+	repo.BookingNotCancellableError: BookingNotCancellableError,
+	repo.InstructorNotFoundError:    InstructorNotFoundError,
+	repo.RoomNotFoundError:          RoomNotFoundError,
+	repo.RoomCapacityExceededError:  RoomCapacityExceededError,
+	repo.HoldNotFoundError:          HoldNotFoundError,
+	repo.HoldReleasedError:          HoldReleasedError,
+	repo.DropInNotAvailableError:    DropInNotAvailableError,
+}
+
+// Occurrence is a single session of a class.
+type Occurrence struct {
+	ClassID   uint64
+	ClassName string
+	Start     time.Time
+	End       time.Time
+}
+
+// Resources that classes can't share at the same time
+const (
+	ResourceInstructor = repo.ResourceInstructor
+	ResourceRoom       = repo.ResourceRoom
+)
+
+// ScheduleConflictError is returned when a class would make its instructor teach, or its room host, two occurrences at the same time.
+type ScheduleConflictError struct {
+	// Either ResourceInstructor or ResourceRoom
+	Resource string
+	// The clashing occurrences of the other classes
+	Conflicts []Occurrence
+}
+
+func (e *ScheduleConflictError) Error() string {
+	if e.Resource == ResourceRoom {
+		return "Room is already in use by another class at the same time"
+	}
+	return "Instructor is already teaching another class at the same time"
+}
+
+// fromStore returns the error of the service for an error of the store. Errors that aren't the client's to deal with are returned as they are.
+func fromStore(err error) error {
+	if e, ok := storeErrors[err]; ok {
+		return e
+	}
+	var conflict *repo.ScheduleConflictError
+	if errors.As(err, &conflict) {
+		res := &ScheduleConflictError{Resource: conflict.Resource, Conflicts: make([]Occurrence, 0, len(conflict.Occurrences))}
+		for _, o := range conflict.Occurrences {
+			res.Conflicts = append(res.Conflicts, Occurrence{ClassID: o.ClassID, ClassName: o.ClassName, Start: o.Start.UTC(), End: o.End.UTC()})
+		}
+		return res
+	}
+	return err
+}
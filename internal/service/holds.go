@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Hold reserves a spot in an occurrence while the member checks out.
+type Hold struct {
+	ID         uint64
+	ClassID    uint64
+	MemberName string
+	// Midnight in UTC of the day of the occurrence
+	Date time.Time
+	// The spot is released if the hold is not confirmed by then
+	ExpiresAt time.Time
+}
+
+// CreateHold reserves a spot in the occurrence for HoldTTL. The hold counts towards the capacity of the class until it is confirmed or expires. The membership of the member is only checked once it is confirmed.
+func (s *Service) CreateHold(ctx context.Context, n *NewBooking) (*Hold, error) {
+	date, err := s.bookable(n)
+	if err != nil {
+		return nil, err
+	}
+	hold, err := s.store.CreateHold(ctx, n.ClassID, n.MemberName, date, s.HoldTTL, n.email())
+	if err != nil {
+		return nil, fromStore(err)
+	}
+	return newHold(hold), nil
+}
+
+func newHold(hold *repo.Hold) *Hold {
+	return &Hold{
+		ID:         hold.ID,
+		ClassID:    hold.ClassID,
+		MemberName: hold.MemberName,
+		Date:       time.Unix(hold.Date, 0).UTC(),
+		ExpiresAt:  time.Unix(hold.ExpiresAt, 0).UTC(),
+	}
+}
+
+// GetHold returns the hold until it is confirmed or released, even if it has expired.
+func (s *Service) GetHold(ctx context.Context, id uint64) (*Hold, error) {
+	hold, err := s.store.GetHold(ctx, id)
+	if err != nil {
+		return nil, fromStore(err)
+	}
+	return newHold(hold), nil
+}
+
+// ConfirmHold turns the hold into a booking and returns the ID of the booking, which uses up a class of the membership like any other booking. HoldReleasedError is returned if the hold has expired.
+func (s *Service) ConfirmHold(ctx context.Context, id uint64) (uint64, error) {
+	bookingID, err := s.store.ConfirmHold(ctx, id)
+	if err != nil {
+		return 0, fromStore(err)
+	}
+	return bookingID, nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rohitxdev/abc-task/internal/payment"
+)
+
+// DropIn is a booking paid for with the drop-in price of the class, with the payment the client has to complete before the hold expires.
+type DropIn struct {
+	Booking
+	// Handed to the client to complete the payment
+	ClientSecret string
+	Currency     string
+}
+
+// CreateDropInBooking books the occurrence for a member paying the drop-in price of the class instead of using a membership. The spot is held for PaymentHold while the payment is pending, and released right away if the payment can't be created.
+func (s *Service) CreateDropInBooking(ctx context.Context, n *NewBooking) (*DropIn, error) {
+	date, err := s.bookable(n)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := s.store.CreateDropInBooking(ctx, n.ClassID, n.MemberName, date, s.PaymentHold, n.email())
+	if err != nil {
+		return nil, fromStore(err)
+	}
+
+	p, err := s.Payments.CreatePayment(ctx, payment.Request{
+		Amount:      booking.Amount,
+		Currency:    s.Currency,
+		BookingID:   booking.ID,
+		Description: fmt.Sprintf("Drop-in booking %d on %s", booking.ID, n.Date),
+	})
+	if err == nil {
+		err = s.store.SetBookingPayment(ctx, booking.ID, p.ID)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		// Give up the spot right away instead of holding it for a payment that can never arrive
+		if err := s.store.ReleaseHold(ctx, booking.ID); err != nil {
+			slog.Error(err.Error())
+		}
+		return nil, PaymentFailedError
+	}
+	booking.PaymentID = p.ID
+	return &DropIn{Booking: *newBooking(booking), ClientSecret: p.ClientSecret, Currency: s.Currency}, nil
+}
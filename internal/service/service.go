@@ -0,0 +1,51 @@
+// Package service holds the rules of classes and bookings, independent of the transport they are requested over. The REST, gRPC and GraphQL handlers, the CLI and workers all go through it, so that they enforce the same rules and report the same errors.
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+// Store persists classes and bookings. It is implemented by *repo.Repo. Rules that depend on the state of other bookings, like the capacity of a class and the entitlements of a membership, are enforced by the store in the same transaction that makes the change, so that concurrent bookings can't break them.
+type Store interface {
+	CreateClass(ctx context.Context, class *repo.Class) error
+	CreateClasses(ctx context.Context, classes []repo.Class, dryRun bool) ([]error, error)
+	GetClass(ctx context.Context, id uint64) (*repo.Class, error)
+	GetClasses(ctx context.Context, filter repo.ClassFilter) ([]repo.Class, error)
+	AssignInstructor(ctx context.Context, classID uint64, instructorID uint64) error
+	GetRoomTimezone(ctx context.Context, roomID uint64) (string, error)
+
+	CreateBooking(ctx context.Context, classID uint64, memberName string, date int64, email *repo.MemberEmail) (uint64, error)
+	GetBooking(ctx context.Context, id uint64) (*repo.Booking, error)
+	CancelBooking(ctx context.Context, id uint64) (repo.BookingStatus, error)
+	GetRoster(ctx context.Context, classID uint64, date int64) ([]repo.Booking, error)
+
+	CreateHold(ctx context.Context, classID uint64, memberName string, date int64, ttl time.Duration, email *repo.MemberEmail) (*repo.Hold, error)
+	GetHold(ctx context.Context, id uint64) (*repo.Hold, error)
+	ConfirmHold(ctx context.Context, id uint64) (uint64, error)
+
+	CreateDropInBooking(ctx context.Context, classID uint64, memberName string, date int64, holdFor time.Duration, email *repo.MemberEmail) (*repo.Booking, error)
+	SetBookingPayment(ctx context.Context, id uint64, paymentID string) error
+	ReleaseHold(ctx context.Context, id uint64) error
+}
+
+type Service struct {
+	store Store
+	// Dates and booking windows are checked against it
+	Now func() time.Time
+	// Drop-ins are paid with it. Required for drop-ins.
+	Payments payment.Provider
+	// How long a seat hold keeps its spot
+	HoldTTL time.Duration
+	// How long a drop-in keeps its spot while the payment is pending
+	PaymentHold time.Duration
+	// Currency of the drop-in prices
+	Currency string
+}
+
+func New(store Store) *Service {
+	return &Service{store: store, Now: time.Now}
+}
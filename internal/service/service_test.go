@@ -0,0 +1,598 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore keeps classes and bookings in memory, enforcing the capacity of classes like the repo does.
+type memoryStore struct {
+	now         func() time.Time
+	instructors map[uint64]bool
+	classes     []repo.Class
+	bookings    []repo.Booking
+	holds       []repo.Hold
+	emails      map[string]string
+	// Time zones of rooms by ID
+	timezones map[uint64]string
+}
+
+func newMemoryStore(now func() time.Time) *memoryStore {
+	return &memoryStore{now: now, instructors: map[uint64]bool{1: true}, emails: map[string]string{}, timezones: map[uint64]string{1: "Pacific/Honolulu"}}
+}
+
+// checkClass rejects instructors that don't exist and classes that start at the same time as another class of their instructor.
+func (s *memoryStore) checkClass(class *repo.Class, others []repo.Class) error {
+	if class.InstructorID == 0 {
+		return nil
+	}
+	if !s.instructors[class.InstructorID] {
+		return repo.InstructorNotFoundError
+	}
+	for _, other := range others {
+		if other.ID != class.ID && other.InstructorID == class.InstructorID && other.StartDate == class.StartDate && other.StartTime == class.StartTime {
+			start := other.Occurrence(other.StartDate)
+			return &repo.ScheduleConflictError{Resource: repo.ResourceInstructor, Occurrences: []repo.Occurrence{{ClassID: other.ID, ClassName: other.Name, Start: start, End: other.OccurrenceEnd(other.StartDate)}}}
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateClass(ctx context.Context, class *repo.Class) error {
+	if err := s.checkClass(class, s.classes); err != nil {
+		return err
+	}
+	class.ID = uint64(len(s.classes) + 1)
+	s.classes = append(s.classes, *class)
+	return nil
+}
+
+func (s *memoryStore) GetRoomTimezone(ctx context.Context, roomID uint64) (string, error) {
+	return s.timezones[roomID], nil
+}
+
+func (s *memoryStore) CreateClasses(ctx context.Context, classes []repo.Class, dryRun bool) ([]error, error) {
+	var classErrs []error
+	created := append([]repo.Class{}, s.classes...)
+	for i := range classes {
+		if err := s.checkClass(&classes[i], created); err != nil {
+			if classErrs == nil {
+				classErrs = make([]error, len(classes))
+			}
+			classErrs[i] = err
+			continue
+		}
+		class := classes[i]
+		class.ID = uint64(len(created) + 1)
+		created = append(created, class)
+	}
+	if classErrs != nil || dryRun {
+		return classErrs, nil
+	}
+	for i := range classes {
+		classes[i].ID = uint64(len(s.classes) + i + 1)
+	}
+	s.classes = created
+	return nil, nil
+}
+
+func (s *memoryStore) GetClass(ctx context.Context, id uint64) (*repo.Class, error) {
+	if id == 0 || id > uint64(len(s.classes)) {
+		return nil, repo.ClassNotFoundError
+	}
+	class := s.classes[id-1]
+	return &class, nil
+}
+
+func (s *memoryStore) GetClasses(ctx context.Context, filter repo.ClassFilter) ([]repo.Class, error) {
+	return append([]repo.Class{}, s.classes...), nil
+}
+
+func (s *memoryStore) AssignInstructor(ctx context.Context, classID uint64, instructorID uint64) error {
+	class, err := s.GetClass(ctx, classID)
+	if err != nil {
+		return err
+	}
+	class.InstructorID = instructorID
+	if err = s.checkClass(class, s.classes); err != nil {
+		return err
+	}
+	s.classes[classID-1] = *class
+	return nil
+}
+
+// occupying reports whether a booking with 'status' takes a spot, which all do but cancelled ones and drop-ins whose payment failed, as in the repo.
+func occupying(status repo.BookingStatus) bool {
+	switch status {
+	case repo.BookingStatusCancelled, repo.BookingStatusLateCancelled, repo.BookingStatusPaymentFailed:
+		return false
+	}
+	return true
+}
+
+// checkBookable returns the class if the occurrence on 'date' can be booked now and has a spot left, checking the rules of the class like the repo does.
+func (s *memoryStore) checkBookable(classID uint64, date int64) (*repo.Class, error) {
+	class, err := s.GetClass(context.Background(), classID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	switch {
+	case date < class.DateOf(now):
+		return nil, repo.DateInPastError
+	case date < class.StartDate || date > class.EndDate:
+		return nil, repo.InvalidDateRangeError
+	case now.Before(class.BookingOpensAt(date)):
+		return nil, repo.BookingNotOpenYetError
+	case !now.Before(class.BookingClosesAt(date)):
+		return nil, repo.BookingClosedError
+	}
+	var taken uint
+	for _, b := range s.bookings {
+		if b.ClassID == classID && b.Date == date && occupying(b.Status) {
+			taken++
+		}
+	}
+	for _, h := range s.holds {
+		if h.ClassID == classID && h.Date == date && h.ExpiresAt > s.now().Unix() {
+			taken++
+		}
+	}
+	if taken >= class.Capacity {
+		return nil, repo.ClassFullError
+	}
+	return class, nil
+}
+
+func (s *memoryStore) addBooking(booking repo.Booking) *repo.Booking {
+	booking.ID = uint64(len(s.bookings) + 1)
+	booking.CreatedAt = s.now().Unix()
+	if booking.Status == "" {
+		booking.Status = repo.BookingStatusBooked
+	}
+	s.bookings = append(s.bookings, booking)
+	return &s.bookings[len(s.bookings)-1]
+}
+
+func (s *memoryStore) CreateBooking(ctx context.Context, classID uint64, memberName string, date int64, email *repo.MemberEmail) (uint64, error) {
+	if _, err := s.checkBookable(classID, date); err != nil {
+		return 0, err
+	}
+	s.setMemberEmail(memberName, email)
+	return s.addBooking(repo.Booking{ClassID: classID, MemberName: memberName, Date: date}).ID, nil
+}
+
+func (s *memoryStore) GetBooking(ctx context.Context, id uint64) (*repo.Booking, error) {
+	if id == 0 || id > uint64(len(s.bookings)) {
+		return nil, repo.BookingNotFoundError
+	}
+	booking := s.bookings[id-1]
+	return &booking, nil
+}
+
+func (s *memoryStore) CancelBooking(ctx context.Context, id uint64) (repo.BookingStatus, error) {
+	booking, err := s.GetBooking(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if booking.Status != repo.BookingStatusBooked {
+		return "", repo.BookingNotCancellableError
+	}
+	s.bookings[id-1].Status = repo.BookingStatusCancelled
+	s.bookings[id-1].CancelledAt = s.now().Unix()
+	return repo.BookingStatusCancelled, nil
+}
+
+func (s *memoryStore) GetRoster(ctx context.Context, classID uint64, date int64) ([]repo.Booking, error) {
+	if _, err := s.GetClass(ctx, classID); err != nil {
+		return nil, err
+	}
+	var roster []repo.Booking
+	for _, b := range s.bookings {
+		if b.ClassID == classID && b.Date == date {
+			roster = append(roster, b)
+		}
+	}
+	return roster, nil
+}
+
+// setMemberEmail stores the address of the member unless another one is stored and may not be replaced.
+func (s *memoryStore) setMemberEmail(memberName string, email *repo.MemberEmail) {
+	if email == nil || (s.emails[memberName] != "" && !email.Replace) {
+		return
+	}
+	s.emails[memberName] = email.Address
+}
+
+func (s *memoryStore) CreateHold(ctx context.Context, classID uint64, memberName string, date int64, ttl time.Duration, email *repo.MemberEmail) (*repo.Hold, error) {
+	if _, err := s.checkBookable(classID, date); err != nil {
+		return nil, err
+	}
+	s.setMemberEmail(memberName, email)
+	now := s.now()
+	s.holds = append(s.holds, repo.Hold{ID: uint64(len(s.holds) + 1), ClassID: classID, MemberName: memberName, Date: date, CreatedAt: now.Unix(), ExpiresAt: now.Add(ttl).Unix()})
+	hold := s.holds[len(s.holds)-1]
+	return &hold, nil
+}
+
+func (s *memoryStore) GetHold(ctx context.Context, id uint64) (*repo.Hold, error) {
+	if id == 0 || id > uint64(len(s.holds)) || s.holds[id-1].ID == 0 {
+		return nil, repo.HoldNotFoundError
+	}
+	hold := s.holds[id-1]
+	return &hold, nil
+}
+
+func (s *memoryStore) ConfirmHold(ctx context.Context, id uint64) (uint64, error) {
+	hold, err := s.GetHold(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if hold.ExpiresAt <= s.now().Unix() {
+		return 0, repo.HoldReleasedError
+	}
+	s.holds[id-1] = repo.Hold{}
+	return s.addBooking(repo.Booking{ClassID: hold.ClassID, MemberName: hold.MemberName, Date: hold.Date}).ID, nil
+}
+
+func (s *memoryStore) CreateDropInBooking(ctx context.Context, classID uint64, memberName string, date int64, holdFor time.Duration, email *repo.MemberEmail) (*repo.Booking, error) {
+	class, err := s.checkBookable(classID, date)
+	if err != nil {
+		return nil, err
+	}
+	if class.Price <= 0 {
+		return nil, repo.DropInNotAvailableError
+	}
+	s.setMemberEmail(memberName, email)
+	booking := s.addBooking(repo.Booking{ClassID: classID, MemberName: memberName, Date: date, Status: repo.BookingStatusPendingPayment, Amount: class.Price, HoldExpiresAt: s.now().Add(holdFor).Unix()})
+	res := *booking
+	return &res, nil
+}
+
+func (s *memoryStore) SetBookingPayment(ctx context.Context, id uint64, paymentID string) error {
+	s.bookings[id-1].PaymentID = paymentID
+	return nil
+}
+
+func (s *memoryStore) ReleaseHold(ctx context.Context, id uint64) error {
+	s.bookings[id-1].Status = repo.BookingStatusPaymentFailed
+	return nil
+}
+
+// failingPayments can't create payments.
+type failingPayments struct{}
+
+func (failingPayments) CreatePayment(ctx context.Context, req payment.Request) (*payment.Payment, error) {
+	return nil, errors.New("Payment provider unavailable")
+}
+
+func (failingPayments) Refund(ctx context.Context, paymentID string, amount int64) error {
+	return errors.New("Payment provider unavailable")
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	// Rules are checked at 09:00 on 2030-01-10
+	now := time.Date(2030, 1, 10, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := newMemoryStore(clock)
+	payments := payment.NewFake("secret")
+	s := service.New(store)
+	s.Now = clock
+	s.Payments = payments
+	s.HoldTTL = 10 * time.Minute
+	s.PaymentHold = 15 * time.Minute
+	s.Currency = "usd"
+
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		assert.Nil(t, err)
+		return d
+	}
+
+	t.Run("CreateClass", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			class service.NewClass
+			want  error
+		}{
+			{
+				name:  "Valid args",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-11", EndDate: "2030-01-20", StartTime: "07:30", Capacity: 10, InstructorID: 1},
+			},
+			{
+				name:  "With booking window",
+				class: service.NewClass{Name: "Pilates", StartDate: "2030-01-11", EndDate: "2030-01-11", Capacity: 10, BookingWindow: &service.NewBookingWindow{OpensDaysBefore: 1, OpensAt: "08:00"}},
+			},
+			{
+				name:  "Invalid start date",
+				class: service.NewClass{Name: "Yoga", StartDate: "11-01-2030", EndDate: "2030-01-20", Capacity: 10},
+				want:  &service.Error{Kind: service.KindInvalid, Message: "Invalid date format for start date"},
+			},
+			{
+				name:  "Start date is today",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-10", EndDate: "2030-01-20", Capacity: 10},
+				want:  &service.Error{Kind: service.KindInvalid, Message: "Start date cannot be in the past"},
+			},
+			{
+				name:  "End date before start date",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-20", EndDate: "2030-01-11", Capacity: 10},
+				want:  &service.Error{Kind: service.KindInvalid, Message: "End date cannot be before start date"},
+			},
+			{
+				name:  "Invalid start time",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-11", EndDate: "2030-01-20", StartTime: "25:00", Capacity: 10},
+				want:  &service.Error{Kind: service.KindInvalid, Message: "Invalid time format for start time"},
+			},
+			{
+				name:  "Invalid booking opening time",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-11", EndDate: "2030-01-20", Capacity: 10, BookingWindow: &service.NewBookingWindow{OpensAt: "8am"}},
+				want:  &service.Error{Kind: service.KindInvalid, Message: "Invalid time format for booking opening time"},
+			},
+			{
+				name:  "Missing capacity",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-11", EndDate: "2030-01-20"},
+				want:  &service.Error{Kind: service.KindInvalid, Message: "Capacity is required"},
+			},
+			{
+				name:  "Unknown instructor",
+				class: service.NewClass{Name: "Yoga", StartDate: "2030-01-11", EndDate: "2030-01-20", Capacity: 10, InstructorID: 2},
+				want:  service.InstructorNotFoundError,
+			},
+			{
+				name:  "Instructor teaching at the same time",
+				class: service.NewClass{Name: "Spin", StartDate: "2030-01-11", EndDate: "2030-01-11", StartTime: "07:30", Capacity: 10, InstructorID: 1},
+				want: &service.ScheduleConflictError{
+					Resource:  service.ResourceInstructor,
+					Conflicts: []service.Occurrence{{ClassID: 1, ClassName: "Yoga", Start: date("2030-01-11").Add(7*time.Hour + 30*time.Minute), End: date("2030-01-11").Add(8*time.Hour + 30*time.Minute)}},
+				},
+			},
+			{
+				// It is still 2030-01-09 in Honolulu
+				name:  "Start date is tomorrow in the time zone of the room",
+				class: service.NewClass{Name: "Hula", StartDate: "2030-01-10", EndDate: "2030-01-10", Capacity: 10, RoomID: 1},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				class, err := s.CreateClass(ctx, &tt.class)
+				assert.Equal(t, tt.want, err)
+				if tt.want == nil {
+					assert.NotZero(t, class.ID)
+				}
+			})
+		}
+
+		class, err := s.GetClass(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, date("2030-01-11"), class.StartDate)
+		assert.Equal(t, 7*time.Hour+30*time.Minute, class.StartTime)
+		assert.Equal(t, time.Hour, class.Duration)
+
+		class, err = s.GetClass(ctx, 2)
+		assert.Nil(t, err)
+		opensAt, ok := class.NextBookingOpensAt(now)
+		assert.True(t, ok)
+		assert.Equal(t, date("2030-01-10").Add(8*time.Hour), opensAt)
+
+		_, err = s.GetClass(ctx, 99)
+		assert.Equal(t, service.ClassNotFoundError, err)
+		assert.EqualError(t, err, "Class not found")
+	})
+
+	// Held from 2030-01-10 to 2030-01-15 at 10:00 for one member, with booking opening the day before at 08:00 and closing an hour before
+	store.classes = append(store.classes, repo.Class{
+		ID:            uint64(len(store.classes) + 1),
+		Name:          "Boxing",
+		StartDate:     date("2030-01-10").Unix(),
+		EndDate:       date("2030-01-15").Unix(),
+		StartTime:     10 * 60 * 60,
+		Duration:      60 * 60,
+		Capacity:      1,
+		BookingWindow: &repo.BookingWindow{OpensDaysBefore: 1, OpensAt: 8 * 60 * 60, ClosesBefore: 60 * 60},
+		Price:         1500,
+	})
+	boxing := uint64(len(store.classes))
+
+	t.Run("CreateBooking", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			booking service.NewBooking
+			want    error
+		}{
+			{
+				name:    "Valid args",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-11", MemberEmail: "rohit@example.com"},
+			},
+			{
+				name:    "Class is full",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Other", Date: "2030-01-11", MemberEmail: "other@example.com"},
+				want:    service.ClassFullError,
+			},
+			{
+				name:    "Invalid date",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "11-01-2030"},
+				want:    &service.Error{Kind: service.KindInvalid, Message: "Invalid date format"},
+			},
+			{
+				name:    "Date in the past",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-09"},
+				want:    &service.Error{Kind: service.KindInvalid, Message: "Date cannot be in the past"},
+			},
+			{
+				name:    "Unknown class",
+				booking: service.NewBooking{ClassID: 99, MemberName: "Rohit", Date: "2030-01-11"},
+				want:    service.ClassNotFoundError,
+			},
+			{
+				name:    "Date after the end date",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-16"},
+				want:    service.InvalidDateRangeError,
+			},
+			{
+				name:    "Booking not open yet",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-12"},
+				want:    service.BookingNotOpenYetError,
+			},
+			{
+				name:    "Booking closed",
+				booking: service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-10"},
+				want:    service.BookingClosedError,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := s.CreateBooking(ctx, &tt.booking)
+				assert.Equal(t, tt.want, err)
+			})
+		}
+		assert.Equal(t, map[string]string{"Rohit": "rohit@example.com"}, store.emails)
+
+		roster, err := s.GetRoster(ctx, boxing, "2030-01-11")
+		assert.Nil(t, err)
+		assert.Len(t, roster, 1)
+		assert.Equal(t, "Rohit", roster[0].MemberName)
+		assert.Equal(t, date("2030-01-11"), roster[0].Date)
+		assert.Equal(t, service.BookingStatusBooked, roster[0].Status)
+		assert.Equal(t, now, roster[0].CreatedAt)
+		assert.True(t, roster[0].CancelledAt.IsZero())
+
+		_, err = s.GetRoster(ctx, boxing, "tomorrow")
+		assert.EqualError(t, err, "Invalid date format")
+	})
+
+	t.Run("CancelBooking", func(t *testing.T) {
+		status, err := s.CancelBooking(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, service.BookingStatusCancelled, status)
+
+		_, err = s.CancelBooking(ctx, 1)
+		assert.Equal(t, service.BookingNotCancellableError, err)
+
+		_, err = s.CancelBooking(ctx, 99)
+		assert.Equal(t, service.BookingNotFoundError, err)
+	})
+
+	t.Run("Holds", func(t *testing.T) {
+		hold, err := s.CreateHold(ctx, &service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-11"})
+		assert.Nil(t, err)
+		assert.Equal(t, now.Add(s.HoldTTL), hold.ExpiresAt)
+
+		// The held spot is taken
+		_, err = s.CreateBooking(ctx, &service.NewBooking{ClassID: boxing, MemberName: "Other", Date: "2030-01-11"})
+		assert.Equal(t, service.ClassFullError, err)
+
+		id, err := s.ConfirmHold(ctx, hold.ID)
+		assert.Nil(t, err)
+		booking, err := s.GetBooking(ctx, id)
+		assert.Nil(t, err)
+		assert.Equal(t, service.BookingStatusBooked, booking.Status)
+
+		_, err = s.ConfirmHold(ctx, hold.ID)
+		assert.Equal(t, service.HoldNotFoundError, err)
+
+		_, err = s.CancelBooking(ctx, id)
+		assert.Nil(t, err)
+		hold, err = s.CreateHold(ctx, &service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-11"})
+		assert.Nil(t, err)
+		store.holds[hold.ID-1].ExpiresAt = now.Unix()
+		_, err = s.ConfirmHold(ctx, hold.ID)
+		assert.Equal(t, service.HoldReleasedError, err)
+	})
+
+	t.Run("CreateDropInBooking", func(t *testing.T) {
+		dropIn, err := s.CreateDropInBooking(ctx, &service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-11"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1500), dropIn.Amount)
+		assert.Equal(t, "usd", dropIn.Currency)
+		assert.Equal(t, now.Add(s.PaymentHold), dropIn.HoldExpiresAt)
+		assert.NotEmpty(t, dropIn.PaymentID)
+		assert.Equal(t, service.BookingStatusPendingPayment, dropIn.Status)
+
+		// Refunds of cancellations are left to the job the store schedules
+		store.bookings[dropIn.ID-1].Status = repo.BookingStatusBooked
+		_, err = s.CancelBooking(ctx, dropIn.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), payments.Refunded(dropIn.PaymentID))
+
+		// The spot is given up if the payment can't be created
+		s.Payments = failingPayments{}
+		_, err = s.CreateDropInBooking(ctx, &service.NewBooking{ClassID: boxing, MemberName: "Rohit", Date: "2030-01-11"})
+		s.Payments = payments
+		assert.Equal(t, service.PaymentFailedError, err)
+		assert.Equal(t, repo.BookingStatusPaymentFailed, store.bookings[len(store.bookings)-1].Status)
+
+		_, err = s.CreateDropInBooking(ctx, &service.NewBooking{ClassID: 1, MemberName: "Rohit", Date: "2030-01-11"})
+		assert.Equal(t, service.DropInNotAvailableError, err)
+	})
+
+	t.Run("Time zones", func(t *testing.T) {
+		// Held in Honolulu, where it is still 2030-01-09 at 23:00, from 2030-01-09 to 2030-01-12 at 23:30 with booking opening the day before at 07:00
+		store.classes = append(store.classes, repo.Class{
+			ID:            uint64(len(store.classes) + 1),
+			Name:          "Night Swim",
+			StartDate:     date("2030-01-09").Unix(),
+			EndDate:       date("2030-01-12").Unix(),
+			StartTime:     23*60*60 + 30*60,
+			Duration:      60 * 60,
+			Capacity:      5,
+			BookingWindow: &repo.BookingWindow{OpensDaysBefore: 1, OpensAt: 7 * 60 * 60},
+			Timezone:      "Pacific/Honolulu",
+		})
+		swim := uint64(len(store.classes))
+		class, err := s.GetClass(ctx, swim)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2030, 1, 10, 9, 30, 0, 0, time.UTC), class.Occurrence(date("2030-01-09")))
+		assert.Equal(t, time.Date(2030, 1, 10, 17, 0, 0, 0, time.UTC), class.BookingOpensAt(date("2030-01-11")))
+		assert.Equal(t, date("2030-01-09"), class.Today(now))
+		// Daylight saving time starts in New York on 2030-03-10, after which 08:00 is 12:00 in UTC instead of 13:00
+		spring := service.Class{StartTime: 18 * time.Hour, BookingWindow: &service.BookingWindow{OpensDaysBefore: 1, OpensAt: 8 * time.Hour}, Timezone: "America/New_York"}
+		assert.Equal(t, time.Date(2030, 3, 9, 13, 0, 0, 0, time.UTC), spring.BookingOpensAt(date("2030-03-10")))
+		assert.Equal(t, time.Date(2030, 3, 10, 12, 0, 0, 0, time.UTC), spring.BookingOpensAt(date("2030-03-11")))
+
+		tests := []struct {
+			name string
+			date string
+			want error
+		}{
+			{name: "Today in the time zone of the class", date: "2030-01-09"},
+			{name: "Booking open since 07:00 in the time zone of the class", date: "2030-01-10"},
+			{name: "Booking not open yet", date: "2030-01-11", want: service.BookingNotOpenYetError},
+			{name: "Date in the past", date: "2030-01-08", want: &service.Error{Kind: service.KindInvalid, Message: "Date cannot be in the past"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := s.CreateBooking(ctx, &service.NewBooking{ClassID: swim, MemberName: "Rohit", Date: tt.date})
+				assert.Equal(t, tt.want, err)
+			})
+		}
+	})
+
+	t.Run("CreateClasses", func(t *testing.T) {
+		valid, err := s.ParseClass(&service.NewClass{Name: "Barre", StartDate: "2030-02-01", EndDate: "2030-02-01", Capacity: 5, InstructorID: 1})
+		assert.Nil(t, err)
+		clashing, err := s.ParseClass(&service.NewClass{Name: "Barre", StartDate: "2030-02-01", EndDate: "2030-02-01", Capacity: 5, InstructorID: 1})
+		assert.Nil(t, err)
+
+		classErrs, err := s.CreateClasses(ctx, []service.Class{*valid, *clashing}, false)
+		assert.Nil(t, err)
+		assert.Len(t, classErrs, 2)
+		assert.Nil(t, classErrs[0])
+		assert.EqualError(t, classErrs[1], "Instructor is already teaching another class at the same time")
+
+		classes := []service.Class{*valid}
+		classErrs, err = s.CreateClasses(ctx, classes, false)
+		assert.Nil(t, err)
+		assert.Nil(t, classErrs)
+		assert.NotZero(t, classes[0].ID)
+
+		assert.Equal(t, service.ClassNotFoundError, s.AssignInstructor(ctx, 99, 1))
+	})
+}
@@ -0,0 +1,196 @@
+// Package webhook notifies subscribed URLs of booking and class events. Events are queued in the database and delivered in the background with retries, so slow or failing receivers never hold up requests.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/backoff"
+	"github.com/rohitxdev/abc-task/internal/repo"
+)
+
+var InvalidSignatureError = errors.New("Webhook signature is invalid")
+
+type EventType = repo.EventType
+
+const (
+	EventBookingCreated   = repo.EventBookingCreated
+	EventBookingCancelled = repo.EventBookingCancelled
+	EventClassCreated     = repo.EventClassCreated
+	EventClassFull        = repo.EventClassFull
+	EventWaitlistPromoted = repo.EventWaitlistPromoted
+	EventClassCancelled   = repo.EventClassCancelled
+)
+
+// EventTypes lists the events webhooks can subscribe to.
+var EventTypes = []EventType{EventBookingCreated, EventBookingCancelled, EventClassCreated, EventClassFull, EventWaitlistPromoted, EventClassCancelled}
+
+// Headers of a delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	// Unique per event, and the same across deliveries to different webhooks and redeliveries
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader returns the value of the X-Webhook-Signature header for 'payload' sent at 'now'. The signature is the hex encoded HMAC-SHA256 of the timestamp, a dot and the payload.
+func SignatureHeader(secret string, payload []byte, now time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%s", now.Unix(), sign(secret, now.Unix(), payload))
+}
+
+// Verify checks 'header', the X-Webhook-Signature header of a delivery, for receivers. Deliveries signed more than 'tolerance' before 'now' are rejected as replays.
+func Verify(secret string, payload []byte, header string, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || now.Sub(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return InvalidSignatureError
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, timestamp, payload))) {
+		return InvalidSignatureError
+	}
+	return nil
+}
+
+// RandomSecret returns a secret for signing deliveries.
+func RandomSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Dispatcher queues events for the webhooks subscribed to them and delivers them.
+type Dispatcher struct {
+	Repo   *repo.Repo
+	Client *http.Client
+	// Deliveries are given up on after this many failed attempts
+	MaxAttempts uint
+	// Delays the retries of failed deliveries
+	Backoff backoff.Exponential
+	// How many deliveries are sent per run
+	BatchSize int
+}
+
+func NewDispatcher(r *repo.Repo) *Dispatcher {
+	return &Dispatcher{
+		Repo:        r,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		Backoff:     backoff.Exponential{Base: 30 * time.Second, Max: 6 * time.Hour},
+		BatchSize:   50,
+	}
+}
+
+// Enqueue queues the event for delivery to every webhook subscribed to it.
+func (d *Dispatcher) Enqueue(ctx context.Context, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Failed to encode webhook event: %w", err)
+	}
+	if _, err = d.Repo.EnqueueWebhookEvent(ctx, string(event.Type), string(payload)); err != nil {
+		return fmt.Errorf("Failed to queue webhook event: %w", err)
+	}
+	return nil
+}
+
+// Deliver sends the deliveries that are due and returns how many were attempted. Each attempt is recorded, and failed deliveries are scheduled for a retry until MaxAttempts is reached.
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := d.Repo.GetDueWebhookDeliveries(ctx, d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	webhooks := map[uint64]*repo.Webhook{}
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			if webhook, err = d.Repo.GetWebhook(ctx, delivery.WebhookID); err != nil {
+				return 0, err
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		attempt := d.send(ctx, webhook, &delivery)
+		status := repo.WebhookDeliveryStatusDelivered
+		next := time.Unix(attempt.AttemptedAt, 0)
+		if attempt.Error != "" {
+			status = repo.WebhookDeliveryStatusPending
+			if delivery.Attempts+1 >= d.MaxAttempts {
+				status = repo.WebhookDeliveryStatusFailed
+			}
+			next = next.Add(d.Backoff.Delay(delivery.Attempts + 1))
+		}
+		if err = d.Repo.RecordWebhookAttempt(ctx, attempt, status, next); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// send posts the delivery to the webhook once. Responses other than 2xx count as failures.
+func (d *Dispatcher) send(ctx context.Context, webhook *repo.Webhook, delivery *repo.WebhookDelivery) *repo.WebhookAttempt {
+	start := time.Now()
+	attempt := &repo.WebhookAttempt{DeliveryID: delivery.ID, AttemptedAt: start.Unix()}
+	defer func() {
+		attempt.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, SignatureHeader(webhook.Secret, payload, start))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		attempt.Error = "Receiver responded with " + res.Status
+	}
+	return attempt
+}
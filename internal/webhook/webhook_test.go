@@ -0,0 +1,166 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver records the deliveries it is sent and fails the first 'failures' of them.
+type receiver struct {
+	secret   string
+	failures int
+
+	mu     sync.Mutex
+	events []webhook.Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	if err := webhook.Verify(rc.secret, body, r.Header.Get(webhook.HeaderSignature), time.Now(), time.Minute); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var event webhook.Event
+	json.Unmarshal(body, &event)
+	rc.events = append(rc.events, event)
+}
+
+func TestDispatcher(t *testing.T) {
+	db, err := database.NewSQLite("test.db")
+	assert.Nil(t, err)
+	defer func() {
+		db.Close()
+		assert.Nil(t, os.RemoveAll(database.DirName))
+	}()
+	r, err := repo.New(db)
+	assert.Nil(t, err)
+
+	d := webhook.NewDispatcher(r)
+	// Retries are due right away so that they can be sent without waiting
+	d.Backoff.Base = 0
+	d.MaxAttempts = 3
+	publish := func(eventType webhook.EventType, data string) error {
+		return d.Enqueue(context.TODO(), &webhook.Event{ID: "evt_" + data, Type: eventType, CreatedAt: time.Now(), Data: json.RawMessage(data)})
+	}
+
+	t.Run("Retries until delivered", func(t *testing.T) {
+		rc := &receiver{secret: "secret", failures: 2}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+		w := repo.Webhook{URL: srv.URL, Events: []string{string(webhook.EventBookingCreated)}, Secret: "secret"}
+		assert.Nil(t, r.CreateWebhook(context.TODO(), &w))
+		defer r.DeleteWebhook(context.TODO(), w.ID)
+
+		assert.Nil(t, publish(webhook.EventClassCreated, `{"id":1}`))
+		assert.Nil(t, publish(webhook.EventBookingCreated, `{"id":2}`))
+		for range 3 {
+			n, err := d.Deliver(context.TODO())
+			assert.Nil(t, err)
+			assert.Equal(t, 1, n)
+		}
+		n, err := d.Deliver(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+
+		assert.Len(t, rc.events, 1)
+		assert.Equal(t, webhook.EventBookingCreated, rc.events[0].Type)
+		assert.JSONEq(t, `{"id":2}`, string(rc.events[0].Data))
+		deliveries, err := r.GetWebhookDeliveries(context.TODO(), w.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.WebhookDeliveryStatusDelivered, deliveries[0].Status)
+		attempts, err := r.GetWebhookAttempts(context.TODO(), w.ID)
+		assert.Nil(t, err)
+		assert.Len(t, attempts, 3)
+		assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+		assert.Equal(t, http.StatusOK, attempts[2].StatusCode)
+		assert.Empty(t, attempts[2].Error)
+	})
+
+	t.Run("Gives up and replays", func(t *testing.T) {
+		rc := &receiver{secret: "secret", failures: 3}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+		w := repo.Webhook{URL: srv.URL, Secret: "secret"}
+		assert.Nil(t, r.CreateWebhook(context.TODO(), &w))
+		defer r.DeleteWebhook(context.TODO(), w.ID)
+
+		assert.Nil(t, publish(webhook.EventBookingCancelled, `{"id":3}`))
+		for range 4 {
+			_, err := d.Deliver(context.TODO())
+			assert.Nil(t, err)
+		}
+		deliveries, err := r.GetWebhookDeliveries(context.TODO(), w.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, repo.WebhookDeliveryStatusFailed, deliveries[0].Status)
+		assert.Empty(t, rc.events)
+
+		assert.Nil(t, r.ReplayWebhookDelivery(context.TODO(), deliveries[0].ID))
+		n, err := d.Deliver(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		assert.Len(t, rc.events, 1)
+		attempts, err := r.GetWebhookAttempts(context.TODO(), w.ID)
+		assert.Nil(t, err)
+		assert.Len(t, attempts, 4)
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		rc := &receiver{secret: "other"}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+		w := repo.Webhook{URL: srv.URL, Secret: "secret"}
+		assert.Nil(t, r.CreateWebhook(context.TODO(), &w))
+		defer r.DeleteWebhook(context.TODO(), w.ID)
+
+		assert.Nil(t, publish(webhook.EventClassFull, `{"classId":1}`))
+		_, err := d.Deliver(context.TODO())
+		assert.Nil(t, err)
+		attempts, err := r.GetWebhookAttempts(context.TODO(), w.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, attempts[0].StatusCode)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	payload := []byte(`{"id":"evt_1"}`)
+	header := webhook.SignatureHeader("secret", payload, now)
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		want    error
+	}{
+		{name: "Valid signature", secret: "secret", payload: payload, header: header, now: now},
+		{name: "Wrong secret", secret: "other", payload: payload, header: header, now: now, want: webhook.InvalidSignatureError},
+		{name: "Tampered payload", secret: "secret", payload: []byte(`{"id":"evt_2"}`), header: header, now: now, want: webhook.InvalidSignatureError},
+		{name: "Missing header", secret: "secret", payload: payload, now: now, want: webhook.InvalidSignatureError},
+		{name: "Replayed delivery", secret: "secret", payload: payload, header: header, now: now.Add(2 * time.Minute), want: webhook.InvalidSignatureError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, webhook.Verify(tt.secret, tt.payload, tt.header, tt.now, time.Minute))
+		})
+	}
+}
@@ -11,22 +11,44 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/rohitxdev/abc-task/internal/checkin"
 	"github.com/rohitxdev/abc-task/internal/config"
 	"github.com/rohitxdev/abc-task/internal/database"
 	"github.com/rohitxdev/abc-task/internal/handler"
+	"github.com/rohitxdev/abc-task/internal/jobs"
+	"github.com/rohitxdev/abc-task/internal/notify"
+	"github.com/rohitxdev/abc-task/internal/outbox"
+	"github.com/rohitxdev/abc-task/internal/payment"
+	"github.com/rohitxdev/abc-task/internal/replica"
 	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
+	"github.com/rohitxdev/abc-task/internal/webhook"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := importTimetable(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		panic("Failed to load config: " + err.Error())
 	}
 
-	db, err := database.NewSQLite(cfg.DatabaseURL)
+	var pragmas []string
+	if cfg.ReplicaDir != "" {
+		pragmas = append(pragmas, replica.Pragma)
+	}
+	db, err := database.NewSQLite(cfg.DatabaseURL, pragmas...)
 	if err != nil {
 		panic("Failed to create database: " + err.Error())
 	}
@@ -36,10 +58,97 @@ func main() {
 	if err != nil {
 		panic("Failed to create repo: " + err.Error())
 	}
+	r.Penalties = repo.PenaltyPolicy{
+		Limit:  cfg.PenaltyLimit,
+		Window: cfg.PenaltyWindow,
+	}
+	r.ReminderLead = cfg.ReminderLead
+	r.AnalyticsTTL = cfg.AnalyticsCacheTTL
+	r.AuditRetention = cfg.AuditRetention
+
+	key := []byte(cfg.CheckInSecret)
+	if len(key) == 0 {
+		slog.Warn("CHECKIN_SECRET is not set, check-in tokens will be invalidated on restart")
+		if key, err = checkin.RandomKey(); err != nil {
+			panic(err.Error())
+		}
+	}
+	tokens, err := checkin.NewSigner(key)
+	if err != nil {
+		panic("Failed to create check-in token signer: " + err.Error())
+	}
+
+	var payments payment.Provider
+	if cfg.StripeAPIKey != "" {
+		payments = payment.NewStripe(cfg.StripeAPIKey, cfg.StripeURL)
+	} else {
+		slog.Warn("STRIPE_API_KEY is not set, drop-in payments are faked")
+		payments = payment.NewFake(cfg.PaymentWebhookSecret)
+	}
+
+	webhooks := webhook.NewDispatcher(r)
+
+	var sender notify.Sender
+	switch cfg.EmailSender {
+	case "smtp":
+		sender = &notify.SMTPSender{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, Timeout: 30 * time.Second}
+	case "file":
+		sender = &notify.FileSender{Dir: cfg.EmailDir}
+	default:
+		sender = &notify.LogSender{}
+	}
+	mailer := notify.NewMailer(r, sender, cfg.EmailFrom)
+	notifier := &notify.Notifier{Repo: r}
+
+	scheduler := jobs.NewScheduler(r)
+	if err = jobs.Register(context.Background(), scheduler, r, notifier, payments); err != nil {
+		panic(err.Error())
+	}
+
+	var sinks []outbox.Sink
+	for _, name := range cfg.OutboxSinks {
+		switch name {
+		case "webhook":
+			sinks = append(sinks, &outbox.WebhookSink{Dispatcher: webhooks})
+		case "email":
+			sinks = append(sinks, &outbox.EmailSink{Notifier: notifier})
+		case "stdout":
+			sinks = append(sinks, &outbox.WriterSink{W: os.Stdout})
+		case "nats":
+			var conn *nats.Conn
+			if cfg.NatsURL != "" {
+				if conn, err = nats.Connect(cfg.NatsURL); err != nil {
+					panic("Failed to connect to NATS: " + err.Error())
+				}
+			} else {
+				ns, c, err := outbox.StartEmbeddedNATS()
+				if err != nil {
+					panic(err.Error())
+				}
+				defer ns.Shutdown()
+				conn = c
+			}
+			defer conn.Close()
+			sinks = append(sinks, &outbox.NATSSink{Conn: conn, Prefix: cfg.NatsSubjectPrefix})
+		}
+	}
+	relay := outbox.NewRelay(r, sinks...)
+	if err = jobs.RegisterQueues(context.Background(), scheduler, relay, webhooks, mailer); err != nil {
+		panic(err.Error())
+	}
+
+	rules := service.New(r)
+	rules.Payments = payments
+	rules.HoldTTL = cfg.HoldTTL
+	rules.PaymentHold = cfg.PaymentHold
+	rules.Currency = cfg.Currency
 
 	svc := &handler.Services{
-		Config: cfg,
-		Repo:   r,
+		Config:   cfg,
+		Repo:     r,
+		Tokens:   tokens,
+		Payments: payments,
+		Service:  rules,
 	}
 
 	h, err := handler.New(svc)
@@ -47,21 +156,30 @@ func main() {
 		panic("Failed to create handler: " + err.Error())
 	}
 
+	// gRPC shares the port with the REST API
+	rpc, health := handler.NewGRPC(svc)
+
 	ls, err := net.Listen("tcp", net.JoinHostPort(cfg.Host, cfg.Port))
 	if err != nil {
 		panic("Failed to listen on TCP: " + err.Error())
 	}
 	defer func() {
-		if err = ls.Close(); err != nil {
+		// Already closed if the server was shut down
+		if err = ls.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			panic("Failed to close TCP listener: " + err.Error())
 		}
 	}()
 
+	// Stdlib supports HTTP/2 by default when serving over TLS, but has to be explicitly enabled otherwise. Configuring the server with it lets Shutdown close the HTTP/2 connections gracefully too.
+	h2s := &http2.Server{}
+	srv := &http.Server{Handler: h2c.NewHandler(handler.Multiplex(h, rpc), h2s)}
+	if err = http2.ConfigureServer(srv, h2s); err != nil {
+		panic("Failed to configure HTTP/2: " + err.Error())
+	}
+
 	//Start HTTP server
 	go func() {
-		// Stdlib supports HTTP/2 by default when serving over TLS, but has to be explicitly enabled otherwise.
-		handler := h2c.NewHandler(h, &http2.Server{})
-		if err := http.Serve(ls, handler); err != nil && !errors.Is(err, net.ErrClosed) {
+		if err := srv.Serve(ls); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
 			panic("Failed to serve HTTP: " + err.Error())
 		}
 	}()
@@ -74,14 +192,55 @@ func main() {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
+	//Start streaming the WAL to the replica. It is stopped only after the HTTP server so that the last requests are replicated too.
+	replicaCtx, stopReplica := context.WithCancel(context.Background())
+	defer stopReplica()
+	replicaDone := make(chan error, 1)
+	if cfg.ReplicaDir != "" {
+		rep, err := replica.New(db.Writer, db.Reader, database.Path(cfg.DatabaseURL), &replica.DirDestination{Root: cfg.ReplicaDir})
+		if err != nil {
+			panic("Failed to create replicator: " + err.Error())
+		}
+		go func() {
+			replicaDone <- rep.Run(replicaCtx)
+		}()
+		slog.Debug("Replicator started")
+	} else {
+		replicaDone <- nil
+	}
+
+	//Start running background jobs, which also publish the outbox and send webhooks and emails. Jobs that are running on shutdown are allowed to finish.
+	schedulerDone := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx, time.Second)
+		close(schedulerDone)
+	}()
+
 	<-ctx.Done()
 
-	ctx, cancel = context.WithTimeout(ctx, cfg.ShutdownTimeout)
+	// The signal context is done by now, so the deadline starts from a fresh one
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	if err := h.Shutdown(ctx); err != nil {
+	// Health checks start failing so that load balancers stop sending calls
+	health.Shutdown()
+	// Event streams never finish on their own, so they are ended first for the shutdown to wait only for regular requests
+	r.Availability.Close()
+	if err := srv.Shutdown(ctx); err != nil {
 		panic("Failed to shutdown HTTP server: " + err.Error())
 	}
 
 	slog.Debug("HTTP server shut down gracefully")
+
+	select {
+	case <-schedulerDone:
+		slog.Debug("Scheduler shut down gracefully")
+	case <-ctx.Done():
+		slog.Warn("Scheduler did not shut down in time, its running jobs will be retried")
+	}
+
+	stopReplica()
+	if err := <-replicaDone; err != nil {
+		panic("Failed to sync replica: " + err.Error())
+	}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rohitxdev/abc-task/internal/config"
+	"github.com/rohitxdev/abc-task/internal/database"
+	"github.com/rohitxdev/abc-task/internal/handler"
+	"github.com/rohitxdev/abc-task/internal/repo"
+	"github.com/rohitxdev/abc-task/internal/service"
+)
+
+// importTimetable imports the classes of a CSV or iCalendar file straight into the database, by the same rules as POST /admin/classes/import.
+func importTimetable(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: import [-dry-run] [-format csv|ics] [-capacity n] <file>")
+		flags.PrintDefaults()
+	}
+	dryRun := flags.Bool("dry-run", false, "Only report the errors without creating anything")
+	format := flags.String("format", "", "Format of the timetable, csv or ics. Taken from the file extension when omitted.")
+	capacity := flags.Uint("capacity", 0, "Capacity of the classes of iCalendar events without an X-CAPACITY property")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("Expected the path of the timetable")
+	}
+	path := flags.Arg(0)
+	req := &handler.ImportClassesRequest{Format: *format, DryRun: *dryRun, Capacity: *capacity}
+	if req.Format == "" {
+		req.Format = strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("Failed to load config: %w", err)
+	}
+	db, err := database.NewSQLite(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("Failed to create database: %w", err)
+	}
+	defer db.Close()
+	r, err := repo.New(db)
+	if err != nil {
+		return fmt.Errorf("Failed to create repo: %w", err)
+	}
+
+	res, err := handler.ImportTimetable(context.Background(), service.New(r), f, req)
+	if err != nil {
+		return err
+	}
+	for _, rowErr := range res.Errors {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, rowErr.Line, rowErr.Message)
+	}
+	if len(res.Errors) > 0 {
+		return errors.New(res.Message)
+	}
+	if req.DryRun {
+		fmt.Printf("%s, %d classes would be created\n", res.Message, res.Classes)
+	} else {
+		fmt.Printf("%s, created %d classes\n", res.Message, res.Classes)
+	}
+	return nil
+}